@@ -0,0 +1,21 @@
+// Package app holds the application's non-Go assets: static files (app/static), styles
+// (app/styles) and SQL migrations (app/db/migrations).
+//
+// Regular builds embed them with go:embed, so the binary from `gforge build` runs without the
+// source tree. Builds tagged devfs (`go run -tags devfs ./cmd/server`, used by `gforge dev`)
+// read them from disk instead, so edits show up without recompiling.
+package app
+
+import "io/fs"
+
+// Static returns the files served under /static.
+func Static() fs.FS { return sub("static") }
+
+// Styles returns the stylesheets served under /static/styles.
+func Styles() fs.FS { return sub("styles") }
+
+// Migrations returns the goose SQL migrations.
+func Migrations() fs.FS { return sub("db/migrations") }
+
+// Source reports where assets are read from: "embed" or "disk" (devfs builds).
+func Source() string { return source }
@@ -0,0 +1,34 @@
+//go:build devfs
+
+package app
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"gothicforge3/internal/config"
+)
+
+const source = "disk"
+
+// sub reads dir below <root>/app on every call, where root is GFORGE_BASEDIR or the nearest
+// parent of the working directory containing go.mod.
+func sub(dir string) fs.FS { return os.DirFS(filepath.Join(root(), "app", filepath.FromSlash(dir))) }
+
+func root() string {
+	if base := config.Current().BaseDir; base != "" {
+		return base
+	}
+	wd, _ := os.Getwd()
+	for cur := wd; ; {
+		if _, err := os.Stat(filepath.Join(cur, "go.mod")); err == nil {
+			return cur
+		}
+		parent := filepath.Dir(cur)
+		if parent == cur {
+			return wd
+		}
+		cur = parent
+	}
+}
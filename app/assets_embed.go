@@ -0,0 +1,21 @@
+//go:build !devfs
+
+package app
+
+import (
+	"embed"
+	"io/fs"
+)
+
+const source = "embed"
+
+//go:embed static styles db/migrations
+var files embed.FS
+
+func sub(dir string) fs.FS {
+	f, err := fs.Sub(files, dir)
+	if err != nil {
+		panic(err) // dir is one of the embedded literals above
+	}
+	return f
+}
@@ -0,0 +1,18 @@
+-- +goose Up
+CREATE TABLE csp_reports (
+  id bigserial PRIMARY KEY,
+  received_at timestamptz NOT NULL DEFAULT now(),
+  type text NOT NULL,
+  document_uri text NOT NULL DEFAULT '',
+  blocked_uri text NOT NULL DEFAULT '',
+  directive text NOT NULL DEFAULT '',
+  disposition text NOT NULL DEFAULT '',
+  source_file text NOT NULL DEFAULT '',
+  line integer NOT NULL DEFAULT 0,
+  user_agent text NOT NULL DEFAULT '',
+  count integer NOT NULL DEFAULT 1
+);
+CREATE INDEX csp_reports_received_at_idx ON csp_reports (received_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS csp_reports;
@@ -0,0 +1,27 @@
+-- +goose Up
+CREATE TABLE users (
+  id bigserial PRIMARY KEY,
+  email text NOT NULL,
+  password_hash text NOT NULL,
+  email_verified_at timestamptz,
+  created_at timestamptz NOT NULL DEFAULT now(),
+  updated_at timestamptz NOT NULL DEFAULT now()
+);
+-- Emails are stored lower-cased (accounts.NormalizeEmail).
+CREATE UNIQUE INDEX users_email_key ON users (email);
+
+-- Single-use email verification and password reset tokens (SHA-256 hashes only).
+CREATE TABLE user_tokens (
+  id bigserial PRIMARY KEY,
+  user_id bigint NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+  purpose text NOT NULL,
+  token_hash bytea NOT NULL,
+  expires_at timestamptz NOT NULL,
+  created_at timestamptz NOT NULL DEFAULT now()
+);
+CREATE UNIQUE INDEX user_tokens_hash_key ON user_tokens (purpose, token_hash);
+CREATE INDEX user_tokens_user_idx ON user_tokens (user_id, purpose);
+
+-- +goose Down
+DROP TABLE IF EXISTS user_tokens;
+DROP TABLE IF EXISTS users;
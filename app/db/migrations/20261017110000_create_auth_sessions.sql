@@ -0,0 +1,26 @@
+-- +goose Up
+-- Sign-in sessions (internal/auth): one row per refresh token family.
+CREATE TABLE auth_sessions (
+  id text PRIMARY KEY,
+  subject text NOT NULL,
+  claims jsonb NOT NULL DEFAULT '{}',
+  created_at timestamptz NOT NULL DEFAULT now(),
+  expires_at timestamptz NOT NULL,
+  revoked_at timestamptz
+);
+CREATE INDEX auth_sessions_subject_idx ON auth_sessions (subject);
+CREATE INDEX auth_sessions_expires_idx ON auth_sessions (expires_at);
+
+-- Refresh tokens (SHA-256 hashes only); used_at is set on rotation for reuse detection.
+CREATE TABLE auth_refresh_tokens (
+  token_hash bytea PRIMARY KEY,
+  session_id text NOT NULL REFERENCES auth_sessions (id) ON DELETE CASCADE,
+  expires_at timestamptz NOT NULL,
+  used_at timestamptz,
+  created_at timestamptz NOT NULL DEFAULT now()
+);
+CREATE INDEX auth_refresh_tokens_session_idx ON auth_refresh_tokens (session_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS auth_refresh_tokens;
+DROP TABLE IF EXISTS auth_sessions;
@@ -0,0 +1,238 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/a-h/templ"
+	"github.com/go-chi/chi/v5"
+	"gothicforge3/app/templates"
+	"gothicforge3/internal/accounts"
+	"gothicforge3/internal/auth"
+	"gothicforge3/internal/csrf"
+	"gothicforge3/internal/logging"
+	"gothicforge3/internal/ratelimit"
+	"gothicforge3/internal/server"
+)
+
+func init() { RegisterRoute(registerAccounts) }
+
+// registerAccounts mounts password accounts (internal/accounts): signup, login, logout, email
+// verification and password reset. POSTs share the "auth" rate-limit policy.
+func registerAccounts(r chi.Router) {
+	accounts.Init(appConfig)
+	limited := r.With(ratelimit.Limit("auth"))
+
+	r.Get("/signup", func(w http.ResponseWriter, req *http.Request) {
+		renderAccount(w, req, http.StatusOK, templates.SignupPage(templates.AccountForm{}))
+	})
+	limited.Post("/signup", func(w http.ResponseWriter, req *http.Request) {
+		email := req.FormValue("email")
+		u, err := accounts.Signup(req.Context(), absBaseURL(req), email, req.FormValue("password"))
+		if u == nil {
+			renderAccount(w, req, formStatus(err), templates.SignupPage(templates.AccountForm{Email: email, Error: accountError(req.Context(), err)}))
+			return
+		}
+		if err != nil {
+			logging.FromContext(req.Context()).Error("accounts: verification email", "error", err)
+		}
+		// Login waits for the confirmed address, so signup must not sign in either.
+		if accounts.RequireVerified() && !u.Verified() {
+			msg := "We sent a confirmation link to " + u.Email + ". Open it, then sign in."
+			if err != nil {
+				msg = "We could not send the confirmation email. Use \"Forgot password\" later to confirm " + u.Email + " and set your password."
+			}
+			renderAccount(w, req, http.StatusOK, templates.AccountMessagePage("Check your email", msg))
+			return
+		}
+		if err := signIn(w, req, u); err != nil {
+			http.Error(w, "token error", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, req, "/account", http.StatusSeeOther)
+	})
+
+	r.Get("/login", func(w http.ResponseWriter, req *http.Request) {
+		renderAccount(w, req, http.StatusOK, templates.LoginPage(loginForm(templates.AccountForm{Next: localPath(req.URL.Query().Get("next"))})))
+	})
+	limited.Post("/login", func(w http.ResponseWriter, req *http.Request) {
+		email, next := req.FormValue("email"), localPath(req.FormValue("next"))
+		u, err := accounts.Authenticate(req.Context(), email, req.FormValue("password"))
+		if err != nil {
+			renderAccount(w, req, formStatus(err), templates.LoginPage(loginForm(templates.AccountForm{Email: email, Next: next, Error: accountError(req.Context(), err)})))
+			return
+		}
+		if err := signIn(w, req, u); err != nil {
+			http.Error(w, "token error", http.StatusInternalServerError)
+			return
+		}
+		if next == "" {
+			next = "/account"
+		}
+		http.Redirect(w, req, next, http.StatusSeeOther)
+	})
+
+	r.Post("/logout", func(w http.ResponseWriter, req *http.Request) {
+		if err := auth.SignOut(w, req); err != nil {
+			logging.FromContext(req.Context()).Error("accounts: revoke session", "error", err)
+		}
+		if sm := server.Sessions(); sm != nil {
+			_ = sm.RenewToken(req.Context())
+			csrf.Renew(req.Context(), sm)
+		}
+		http.Redirect(w, req, "/", http.StatusSeeOther)
+	})
+
+	r.With(auth.RequireAuth).Get("/account", func(w http.ResponseWriter, req *http.Request) {
+		u := currentUser(req)
+		if u == nil { // signed in through another provider, or the account was deleted
+			_ = auth.SignOut(w, req)
+			http.Redirect(w, req, "/login?next=/account", http.StatusSeeOther)
+			return
+		}
+		renderAccount(w, req, http.StatusOK, templates.AccountPage(u.Email, u.Verified(), ""))
+	})
+
+	r.Get("/verify-email", func(w http.ResponseWriter, req *http.Request) {
+		u, err := accounts.VerifyEmail(req.Context(), req.URL.Query().Get("token"))
+		if err != nil {
+			renderAccount(w, req, formStatus(err), templates.AccountMessagePage("Email not verified", accountError(req.Context(), err)))
+			return
+		}
+		// Refresh the signed-in user's claims; the link alone does not sign anyone in.
+		if auth.Subject(req) == strconv.FormatInt(u.ID, 10) {
+			_ = signIn(w, req, u)
+		}
+		renderAccount(w, req, http.StatusOK, templates.AccountMessagePage("Email verified", "Thanks, "+u.Email+" is confirmed."))
+	})
+	limited.With(auth.RequireAuth).Post("/verify-email/resend", func(w http.ResponseWriter, req *http.Request) {
+		u := currentUser(req)
+		if u == nil {
+			http.Redirect(w, req, "/login?next=/account", http.StatusSeeOther)
+			return
+		}
+		notice := "We sent a new confirmation link to " + u.Email + "."
+		if err := accounts.SendVerification(req.Context(), absBaseURL(req), u); err != nil {
+			logging.FromContext(req.Context()).Error("accounts: verification email", "error", err)
+			notice = "We could not send the email; try again later."
+		}
+		renderAccount(w, req, http.StatusOK, templates.AccountPage(u.Email, u.Verified(), notice))
+	})
+
+	r.Get("/password/forgot", func(w http.ResponseWriter, req *http.Request) {
+		renderAccount(w, req, http.StatusOK, templates.ForgotPasswordPage(templates.AccountForm{}))
+	})
+	limited.Post("/password/forgot", func(w http.ResponseWriter, req *http.Request) {
+		email := req.FormValue("email")
+		if err := accounts.RequestPasswordReset(req.Context(), absBaseURL(req), email); err != nil {
+			renderAccount(w, req, formStatus(err), templates.ForgotPasswordPage(templates.AccountForm{Email: email, Error: accountError(req.Context(), err)}))
+			return
+		}
+		// Same answer whether or not the address has an account.
+		renderAccount(w, req, http.StatusOK, templates.ForgotPasswordPage(templates.AccountForm{Notice: "If an account exists for that address, a reset link is on its way."}))
+	})
+	r.Get("/password/reset", func(w http.ResponseWriter, req *http.Request) {
+		renderAccount(w, req, http.StatusOK, templates.ResetPasswordPage(templates.AccountForm{Token: req.URL.Query().Get("token")}))
+	})
+	limited.Post("/password/reset", func(w http.ResponseWriter, req *http.Request) {
+		tok := req.FormValue("token")
+		u, err := accounts.ResetPassword(req.Context(), tok, req.FormValue("password"))
+		if err != nil {
+			renderAccount(w, req, formStatus(err), templates.ResetPasswordPage(templates.AccountForm{Token: tok, Error: accountError(req.Context(), err)}))
+			return
+		}
+		// A new password signs out every other device.
+		if err := auth.RevokeAll(req.Context(), strconv.FormatInt(u.ID, 10)); err != nil {
+			logging.FromContext(req.Context()).Error("accounts: revoke sessions", "error", err)
+		}
+		if err := signIn(w, req, u); err != nil {
+			http.Error(w, "token error", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, req, "/account", http.StatusSeeOther)
+	})
+
+	RegisterURL("/signup")
+	RegisterURL("/login")
+}
+
+// signIn starts an auth session for u (gf_jwt and gf_refresh cookies) and rotates the session
+// id and CSRF token, as on any privilege change.
+func signIn(w http.ResponseWriter, req *http.Request, u *accounts.User) error {
+	err := auth.SignIn(w, req, map[string]any{
+		"sub":            strconv.FormatInt(u.ID, 10),
+		"email":          u.Email,
+		"email_verified": u.Verified(),
+		"provider":       "password",
+	})
+	if err != nil {
+		return err
+	}
+	if sm := server.Sessions(); sm != nil {
+		_ = sm.RenewToken(req.Context())
+		csrf.Renew(req.Context(), sm)
+	}
+	return nil
+}
+
+// currentUser loads the account named by the verified JWT subject, or nil.
+func currentUser(req *http.Request) *accounts.User {
+	c, err := auth.Authenticate(req)
+	if err != nil || (c.Provider != "" && c.Provider != "password") {
+		return nil
+	}
+	id, err := c.UserID()
+	if err != nil {
+		return nil
+	}
+	u, err := accounts.Lookup(req.Context(), id)
+	if err != nil {
+		return nil
+	}
+	return u
+}
+
+func renderAccount(w http.ResponseWriter, req *http.Request, status int, c templ.Component) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = c.Render(req.Context(), w)
+}
+
+// formStatus maps account errors to 422 (the user can fix the input) or 500.
+func formStatus(err error) int {
+	if isUserError(err) {
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusInternalServerError
+}
+
+func isUserError(err error) bool {
+	for _, e := range []error{accounts.ErrEmailTaken, accounts.ErrInvalidEmail, accounts.ErrWeakPassword, accounts.ErrInvalidCredentials, accounts.ErrUnverified, accounts.ErrInvalidToken} {
+		if errors.Is(err, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// accountError is the message shown for err; unexpected errors are logged, not displayed.
+func accountError(ctx context.Context, err error) string {
+	if isUserError(err) {
+		return err.Error()
+	}
+	logging.FromContext(ctx).Error("accounts", "error", err)
+	return "Something went wrong; please try again."
+}
+
+// localPath returns p when it is a path on this site ("/x", not "//host" or "http://..."),
+// otherwise "".
+func localPath(p string) string {
+	if !strings.HasPrefix(p, "/") || strings.HasPrefix(p, "//") || strings.HasPrefix(p, "/\\") {
+		return ""
+	}
+	return p
+}
@@ -2,37 +2,89 @@ package routes
 
 import (
     "encoding/json"
+    "errors"
     "net/http"
+    "strings"
     "time"
 
     "github.com/go-chi/chi/v5"
     "gothicforge3/internal/auth"
+    "gothicforge3/internal/logging"
 )
 
 func init() { RegisterRoute(registerAuthAPI) }
 
 func registerAuthAPI(r chi.Router) {
-    r.Get("/api/me", http.HandlerFunc(apiMe))
-    r.Get("/auth/logout", http.HandlerFunc(logout))
+    r.With(auth.RequireAuth).Get("/api/me", http.HandlerFunc(apiMe))
+    r.Post(auth.RefreshPath, http.HandlerFunc(refreshTokens))
+    r.With(auth.RequireAuth).Post(auth.LogoutAllPath, http.HandlerFunc(logoutAll))
 }
 
 func apiMe(w http.ResponseWriter, r *http.Request) {
-    claims, err := auth.ReadAndVerifyCookie(r, "gf_jwt")
+    claims, _ := auth.FromContext(r.Context())
+    w.Header().Set("Content-Type", "application/json; charset=utf-8")
+    _ = json.NewEncoder(w).Encode(claims.Raw)
+}
+
+// refreshTokens exchanges a refresh token for a new access token. API clients post
+// {"refresh_token": "..."} (JSON or form) and get the rotated refresh token back; browsers
+// send the gf_refresh cookie and get both cookies renewed instead.
+func refreshTokens(w http.ResponseWriter, r *http.Request) {
+    raw, fromCookie := "", false
+    if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+        var body struct{ RefreshToken string `json:"refresh_token"` }
+        _ = json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<10)).Decode(&body)
+        raw = body.RefreshToken
+    } else {
+        raw = r.PostFormValue("refresh_token")
+    }
+    if raw == "" {
+        if ck, err := r.Cookie(auth.RefreshCookieName); err == nil {
+            raw, fromCookie = ck.Value, true
+        }
+    }
+    w.Header().Set("Cache-Control", "no-store")
+    w.Header().Set("Content-Type", "application/json; charset=utf-8")
+    t, err := auth.Refresh(r.Context(), raw)
     if err != nil {
-        http.Error(w, "unauthorized", http.StatusUnauthorized)
+        if !errors.Is(err, auth.ErrRefreshInvalid) && !errors.Is(err, auth.ErrRefreshReused) {
+            logging.FromContext(r.Context()).Error("auth: refresh", "error", err)
+            w.WriteHeader(http.StatusInternalServerError)
+            _ = json.NewEncoder(w).Encode(map[string]string{"error": "server_error"})
+            return
+        }
+        if fromCookie {
+            auth.ClearSessionCookies(w)
+        }
+        w.WriteHeader(http.StatusUnauthorized)
+        _ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
         return
     }
-    w.Header().Set("Content-Type", "application/json; charset=utf-8")
-    _ = json.NewEncoder(w).Encode(claims)
+    resp := map[string]any{
+        "access_token": t.Access,
+        "token_type":   "Bearer",
+        "expires_in":   int(time.Until(t.AccessExpires).Seconds()),
+    }
+    if fromCookie {
+        auth.SetSessionCookies(w, t)
+    } else if t.Refresh != "" {
+        resp["refresh_token"] = t.Refresh
+    }
+    _ = json.NewEncoder(w).Encode(resp)
 }
 
-func logout(w http.ResponseWriter, r *http.Request) {
-    http.SetCookie(w, &http.Cookie{
-        Name:     "gf_jwt",
-        Value:    "",
-        Path:     "/",
-        HttpOnly: true,
-        Expires:  time.Unix(0, 0),
-    })
-    http.Redirect(w, r, "/", http.StatusFound)
+// logoutAll revokes every session of the signed-in subject ("log out everywhere").
+func logoutAll(w http.ResponseWriter, r *http.Request) {
+    claims, _ := auth.FromContext(r.Context())
+    if err := auth.RevokeAll(r.Context(), claims.Subject); err != nil {
+        logging.FromContext(r.Context()).Error("auth: revoke sessions", "error", err)
+        http.Error(w, "could not sign out", http.StatusInternalServerError)
+        return
+    }
+    auth.ClearSessionCookies(w)
+    if _, bearer := auth.Token(r); bearer {
+        w.WriteHeader(http.StatusNoContent)
+        return
+    }
+    http.Redirect(w, r, "/", http.StatusSeeOther)
 }
@@ -10,14 +10,14 @@ import (
   "gothicforge3/app/templates"
   "gothicforge3/internal/auth"
   "gothicforge3/internal/db"
-  "gothicforge3/internal/env"
+  "gothicforge3/internal/httpcache"
   "github.com/jackc/pgx/v5/pgxpool"
 )
 
 func init() {
   RegisterRoute(func(r chi.Router) {
-    // List
-    r.Get("/db/posts", func(w http.ResponseWriter, req *http.Request) {
+    // List (cached for a minute; the mutations below invalidate the "posts" tag)
+    r.With(httpcache.Cache(httpcache.CacheOptions{TTL: time.Minute, Tags: []string{"posts"}})).Get("/db/posts", func(w http.ResponseWriter, req *http.Request) {
       w.Header().Set("Content-Type", "text/html; charset=utf-8")
       pool, ok := requireDB(req, w)
       if !ok { return }
@@ -39,9 +39,8 @@ func init() {
       _ = templates.DBPostsForm("/db/posts", nil, "Create").Render(req.Context(), w)
     })
 
-    // Create
-    r.Post("/db/posts", func(w http.ResponseWriter, req *http.Request) {
-      if !requireJWTGuard(req) { http.Error(w, "unauthorized", http.StatusUnauthorized); return }
+    // Create (mutations require a signed-in user: auth.RequireAuth)
+    r.With(auth.RequireAuth).Post("/db/posts", func(w http.ResponseWriter, req *http.Request) {
       pool, ok := requireDB(req, w)
       if !ok { return }
       _ = req.ParseForm()
@@ -49,6 +48,7 @@ func init() {
       body := req.FormValue("body")
       if title == "" { http.Redirect(w, req, "/db/posts/new", http.StatusSeeOther); return }
       if _, err := pool.Exec(req.Context(), `INSERT INTO posts (title, body) VALUES ($1, $2)`, title, body); err != nil { http.Error(w, err.Error(), http.StatusInternalServerError); return }
+      _ = httpcache.Invalidate(req.Context(), "posts")
       http.Redirect(w, req, "/db/posts", http.StatusSeeOther)
     })
 
@@ -65,24 +65,24 @@ func init() {
     })
 
     // Update
-    r.Post("/db/posts/{id}", func(w http.ResponseWriter, req *http.Request) {
-      if !requireJWTGuard(req) { http.Error(w, "unauthorized", http.StatusUnauthorized); return }
+    r.With(auth.RequireAuth).Post("/db/posts/{id}", func(w http.ResponseWriter, req *http.Request) {
       pool, ok := requireDB(req, w)
       if !ok { return }
       _ = req.ParseForm()
       id, _ := strconv.ParseInt(chi.URLParam(req, "id"), 10, 64)
       title := req.FormValue("title"); body := req.FormValue("body")
       if _, err := pool.Exec(req.Context(), `UPDATE posts SET title=$1, body=$2, updated_at=now() WHERE id=$3`, title, body, id); err != nil { http.Error(w, err.Error(), http.StatusInternalServerError); return }
+      _ = httpcache.Invalidate(req.Context(), "posts")
       http.Redirect(w, req, "/db/posts", http.StatusSeeOther)
     })
 
     // Delete
-    r.Post("/db/posts/{id}/delete", func(w http.ResponseWriter, req *http.Request) {
-      if !requireJWTGuard(req) { http.Error(w, "unauthorized", http.StatusUnauthorized); return }
+    r.With(auth.RequireAuth).Post("/db/posts/{id}/delete", func(w http.ResponseWriter, req *http.Request) {
       pool, ok := requireDB(req, w)
       if !ok { return }
       id, _ := strconv.ParseInt(chi.URLParam(req, "id"), 10, 64)
       if _, err := pool.Exec(req.Context(), `DELETE FROM posts WHERE id=$1`, id); err != nil { http.Error(w, err.Error(), http.StatusInternalServerError); return }
+      _ = httpcache.Invalidate(req.Context(), "posts")
       http.Redirect(w, req, "/db/posts", http.StatusSeeOther)
     })
 
@@ -90,12 +90,10 @@ func init() {
   })
 }
 
-func requireJWTGuard(r *http.Request) bool { _, err := auth.ReadAndVerifyCookie(r, "gf_jwt"); return err == nil }
-
 // requireDB ensures DATABASE_URL is configured and a connection is established.
 // It responds with 503 when missing or 500 when connect fails.
 func requireDB(req *http.Request, w http.ResponseWriter) (*pgxpool.Pool, bool) {
-  if env.Get("DATABASE_URL", "") == "" {
+  if appConfig.DatabaseURL == "" {
     http.Error(w, "database not configured", http.StatusServiceUnavailable)
     return nil, false
   }
@@ -0,0 +1,92 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"gothicforge3/app/templates"
+	"gothicforge3/internal/auth"
+	"gothicforge3/internal/csrf"
+	"gothicforge3/internal/logging"
+	"gothicforge3/internal/ratelimit"
+	"gothicforge3/internal/server"
+)
+
+func init() {
+	RegisterRoute(registerOAuth)
+}
+
+// registerOAuth mounts sign-in for every enabled provider in the auth registry (GitHub, Google,
+// GitLab, Microsoft, OIDC and auth.RegisterProvider): /auth/{provider}/login?next=/path starts
+// it and /auth/{provider}/callback finishes it with auth.SignIn. Both count against the "oauth"
+// rate-limit policy, so social sign-ins do not use up the password forms' "auth" budget.
+func registerOAuth(r chi.Router) {
+	limited := r.With(ratelimit.Limit("oauth"))
+	limited.Get("/auth/{provider}/login", oauthLogin)
+	limited.Get("/auth/{provider}/callback", oauthCallback)
+}
+
+func oauthLogin(w http.ResponseWriter, r *http.Request) {
+	p, ok := auth.LookupProvider(chi.URLParam(r, "provider"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if err := p.BeginLogin(w, r, oauthCallbackURL(r, p), localPath(r.URL.Query().Get("next"))); err != nil {
+		oauthFailure(w, r, p, err)
+	}
+}
+
+func oauthCallback(w http.ResponseWriter, r *http.Request) {
+	p, ok := auth.LookupProvider(chi.URLParam(r, "provider"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	id, next, err := p.CompleteLogin(w, r, oauthCallbackURL(r, p))
+	if err != nil {
+		oauthFailure(w, r, p, err)
+		return
+	}
+	if err := auth.SignIn(w, r, id.Claims()); err != nil {
+		http.Error(w, "token error", http.StatusInternalServerError)
+		return
+	}
+	if sm := server.Sessions(); sm != nil {
+		_ = sm.RenewToken(r.Context())
+		csrf.Renew(r.Context(), sm)
+	}
+	if next = localPath(next); next == "" {
+		next = "/"
+	}
+	http.Redirect(w, r, next, http.StatusSeeOther)
+}
+
+// oauthCallbackURL is <OAUTH_BASE_URL>auth/<provider>/callback, falling back to this request's
+// origin when neither OAUTH_BASE_URL nor SITE_BASE_URL is set.
+func oauthCallbackURL(r *http.Request, p *auth.Provider) string {
+	base := appConfig.OAuthBase()
+	if base == "/" {
+		base = absBaseURL(r) + "/"
+	}
+	return base + "auth/" + p.Name + "/callback"
+}
+
+func oauthFailure(w http.ResponseWriter, r *http.Request, p *auth.Provider, err error) {
+	msg := "Signing in with " + p.DisplayName + " failed; please try again."
+	if errors.Is(err, auth.ErrOAuthState) {
+		msg = "That sign-in link has expired; please try again."
+	}
+	logging.FromContext(r.Context()).Warn("oauth sign-in failed", "provider", p.Name, "error", err)
+	renderAccount(w, r, http.StatusUnauthorized, templates.LoginPage(loginForm(templates.AccountForm{Error: msg})))
+}
+
+// loginForm adds the enabled sign-in providers to a login page form.
+func loginForm(f templates.AccountForm) templates.AccountForm {
+	for _, p := range auth.Providers() {
+		f.Providers = append(f.Providers, templates.ProviderLink{Name: p.Name, Label: p.DisplayName})
+	}
+	return f
+}
@@ -2,29 +2,33 @@ package routes
 
 import (
     "context"
-    "crypto/tls"
     "fmt"
     "io"
     "net/http"
-    "net/url"
-    "os"
-    "path/filepath"
     "sort"
     "strconv"
     "strings"
     "time"
 
     "github.com/go-chi/chi/v5"
+    "gothicforge3/app"
     "gothicforge3/app/templates"
-    redigo "github.com/gomodule/redigo/redis"
+    "gothicforge3/internal/config"
     "gothicforge3/internal/db"
-    "gothicforge3/internal/env"
+    "gothicforge3/internal/health"
+    "gothicforge3/internal/realip"
     "gothicforge3/internal/server"
     "gothicforge3/internal/auth"
 )
 
-// Register mounts all application routes on a chi router.
-func Register(r *chi.Mux) {
+// appConfig is the configuration passed to Register; registrars read it while mounting.
+var appConfig *config.Config
+
+// Register mounts all application routes on a chi router. A nil cfg falls back to config.Current().
+func Register(r *chi.Mux, cfg *config.Config) {
+    if cfg == nil { cfg = config.Current() }
+    appConfig = cfg
+
     // Home
     r.Get("/", func(w http.ResponseWriter, req *http.Request) {
         server.Sessions().Put(req.Context(), "count", 0)
@@ -34,7 +38,7 @@ func Register(r *chi.Mux) {
 
     // dev-only: mint a short-lived JWT and set cookie (gf_jwt)
     r.Get("/dev/jwt", func(w http.ResponseWriter, req *http.Request) {
-        if strings.EqualFold(env.Get("APP_ENV", "development"), "production") {
+        if cfg.IsProduction() {
             http.NotFound(w, req)
             return
         }
@@ -68,39 +72,12 @@ func Register(r *chi.Mux) {
         http.Redirect(w, req, "/static/favicon.svg", http.StatusMovedPermanently)
     })
 
-    // health
-    r.Get("/healthz", func(w http.ResponseWriter, req *http.Request) {
-        w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-        _, _ = w.Write([]byte("ok"))
-    })
+    // readiness: the database check joins the /readyz probe (skipped without DATABASE_URL)
+    health.Register(health.Check{Name: "db", Critical: true, Timeout: 3 * time.Second, CacheTTL: 2 * time.Second, Fn: dbCheck})
 
-    // readiness (checks external deps when configured)
-    r.Get("/readyz", func(w http.ResponseWriter, req *http.Request) {
-        w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-        status := http.StatusOK
-        // Valkey readiness (optional)
-        if err := valkeyPing(); err != nil {
-            status = http.StatusServiceUnavailable
-            _, _ = w.Write([]byte("valkey: FAIL\n"))
-        } else {
-            _, _ = w.Write([]byte("valkey: OK|SKIP\n"))
-        }
-        // DB readiness (optional)
-        if skip, err := dbReady(); skip {
-            _, _ = w.Write([]byte("db: SKIP\n"))
-        } else if err != nil {
-            status = http.StatusServiceUnavailable
-            _, _ = w.Write([]byte("db: FAIL\n"))
-        } else {
-            _, _ = w.Write([]byte("db: OK\n"))
-        }
-        if status != http.StatusOK { w.WriteHeader(status) }
-    })
-
-    // robots.txt (serve from root). If a file exists under app/static, stream it directly; otherwise emit sensible defaults.
+    // robots.txt (serve from root). If a file exists under app/static (embedded or on disk), stream it directly; otherwise emit sensible defaults.
     r.Get("/robots.txt", func(w http.ResponseWriter, req *http.Request) {
-        p := filepath.Join("app", "static", "robots.txt")
-        if f, err := os.Open(p); err == nil {
+        if f, err := app.Static().Open("robots.txt"); err == nil {
             defer f.Close()
             w.Header().Set("Content-Type", "text/plain; charset=utf-8")
             _, _ = io.Copy(w, f)
@@ -117,10 +94,28 @@ func Register(r *chi.Mux) {
         _, _ = w.Write([]byte(b.String()))
     })
 
+    // security.txt (RFC 9116), generated from SECURITY_* settings; 404 when no contact is configured.
+    r.Get("/.well-known/security.txt", func(w http.ResponseWriter, req *http.Request) {
+        if len(cfg.SecurityContact) == 0 {
+            http.NotFound(w, req)
+            return
+        }
+        w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+        _, _ = w.Write([]byte(securityTxt(cfg, absBaseURL(req))))
+    })
+
+    // JWKS: public keys of the active RS256/EdDSA JWT keys, for services verifying our tokens.
+    r.Get("/.well-known/jwks.json", func(w http.ResponseWriter, req *http.Request) {
+        b, err := auth.JWKS()
+        if err != nil { http.Error(w, "jwks error", http.StatusInternalServerError); return }
+        w.Header().Set("Content-Type", "application/jwk-set+json")
+        w.Header().Set("Cache-Control", "public, max-age=300")
+        _, _ = w.Write(b)
+    })
+
     // sitemap.xml (serve from root). If a file exists, stream it; else emit a minimal but valid sitemap with absolute URLs.
     r.Get("/sitemap.xml", func(w http.ResponseWriter, req *http.Request) {
-        p := filepath.Join("app", "static", "sitemap.xml")
-        if f, err := os.Open(p); err == nil {
+        if f, err := app.Static().Open("sitemap.xml"); err == nil {
             defer f.Close()
             w.Header().Set("Content-Type", "application/xml; charset=utf-8")
             _, _ = io.Copy(w, f)
@@ -165,61 +160,36 @@ func Register(r *chi.Mux) {
 
 // absBaseURL returns SITE_BASE_URL if provided (normalized), otherwise derives from request scheme/host.
 func absBaseURL(req *http.Request) string {
-    if v := strings.TrimSpace(env.Get("SITE_BASE_URL", "")); v != "" {
+    if v := strings.TrimSpace(appConfig.SiteBaseURL); v != "" {
         if strings.HasSuffix(v, "/") { return strings.TrimRight(v, "/") }
         return v
     }
-    scheme := "http"
-    if req.TLS != nil || strings.EqualFold(req.Header.Get("X-Forwarded-Proto"), "https") { scheme = "https" }
-    host := req.Host
-    return scheme + "://" + host
+    return realip.Scheme(req) + "://" + req.Host
 }
 
-// dbReady tries to connect and ping the Postgres database when DATABASE_URL is set.
-// Returns (skip=true) when DATABASE_URL is empty.
-func dbReady() (bool, error) {
-    if strings.TrimSpace(env.Get("DATABASE_URL", "")) == "" {
-        return true, nil
+// securityTxt renders the security.txt body. Expires defaults to one year from now.
+func securityTxt(cfg *config.Config, base string) string {
+    var b strings.Builder
+    for _, c := range cfg.SecurityContact {
+        if !strings.Contains(c, ":") { c = "mailto:" + c }
+        fmt.Fprintf(&b, "Contact: %s\n", c)
     }
-    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-    defer cancel()
-    if err := db.Connect(ctx); err != nil { return false, err }
-    return false, db.Health(ctx)
+    exp := strings.TrimSpace(cfg.SecurityExpires)
+    if exp == "" {
+        exp = time.Now().UTC().AddDate(1, 0, 0).Truncate(24 * time.Hour).Format(time.RFC3339)
+    }
+    fmt.Fprintf(&b, "Expires: %s\n", exp)
+    if cfg.SecurityEncryptionURL != "" { fmt.Fprintf(&b, "Encryption: %s\n", cfg.SecurityEncryptionURL) }
+    if cfg.SecurityAcknowledgmentsURL != "" { fmt.Fprintf(&b, "Acknowledgments: %s\n", cfg.SecurityAcknowledgmentsURL) }
+    if cfg.SecurityPolicyURL != "" { fmt.Fprintf(&b, "Policy: %s\n", cfg.SecurityPolicyURL) }
+    if cfg.SecurityPreferredLanguages != "" { fmt.Fprintf(&b, "Preferred-Languages: %s\n", cfg.SecurityPreferredLanguages) }
+    fmt.Fprintf(&b, "Canonical: %s/.well-known/security.txt\n", base)
+    return b.String()
 }
 
-// valkeyPing attempts to PING a Valkey/Redis instance when configured.
-// It returns nil if VALKEY_URL/REDIS_URL is empty (treated as SKIP) or if PING succeeds.
-// It returns an error only when a URL is configured but PING fails.
-func valkeyPing() error {
-    ru := strings.TrimSpace(env.Get("VALKEY_URL", ""))
-    if ru == "" { ru = strings.TrimSpace(env.Get("REDIS_URL", "")) }
-    if ru == "" { return nil } // not configured → skip is OK
-    skipVerify := strings.EqualFold(strings.TrimSpace(env.Get("VALKEY_TLS_SKIP_VERIFY", "")), "1")
-    u, perr := url.Parse(ru)
-    var c redigo.Conn
-    var err error
-    if perr == nil {
-        scheme := strings.ToLower(u.Scheme)
-        if scheme == "rediss" || skipVerify {
-            opts := []redigo.DialOption{}
-            if u.User != nil {
-                if pw, ok := u.User.Password(); ok { opts = append(opts, redigo.DialPassword(pw)) }
-            }
-            if dbStr := strings.TrimPrefix(u.Path, "/"); dbStr != "" {
-                if n, e := strconv.Atoi(dbStr); e == nil { opts = append(opts, redigo.DialDatabase(n)) }
-            }
-            opts = append(opts, redigo.DialUseTLS(true))
-            if skipVerify { opts = append(opts, redigo.DialTLSConfig(&tls.Config{InsecureSkipVerify: true})) }
-            host := u.Host
-            c, err = redigo.Dial("tcp", host, opts...)
-        } else {
-            c, err = redigo.DialURL(ru)
-        }
-    } else {
-        c, err = redigo.DialURL(ru)
-    }
-    if err != nil { return err }
-    defer c.Close()
-    _, err = c.Do("PING")
-    return err
+// dbCheck pings the Postgres pool, connecting on first use. It is skipped when DATABASE_URL is empty.
+func dbCheck(ctx context.Context) error {
+    if appConfig.DatabaseURL == "" { return health.ErrSkip }
+    if err := db.Connect(ctx); err != nil { return err }
+    return db.Health(ctx)
 }
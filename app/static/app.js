@@ -1,6 +1,30 @@
 // Alpine component definitions for Gothic Forge v3
 // Works with Alpine CSP build (no inline/eval).
 
+// CSRF: copy the session token from <meta name="csrf-token"> into hx-headers on <body> so
+// every HTMX request (hx-post, htmx.ajax, ...) sends X-CSRF-Token. Plain forms use the
+// hidden field rendered by templates.CSRFField().
+(function () {
+  const meta = document.querySelector('meta[name="csrf-token"]');
+  const token = meta && meta.getAttribute('content');
+  if (!token || !document.body) return;
+  let headers = {};
+  try {
+    headers = JSON.parse(document.body.getAttribute('hx-headers') || '{}');
+  } catch (_) {}
+  headers['X-CSRF-Token'] = token;
+  document.body.setAttribute('hx-headers', JSON.stringify(headers));
+})();
+
+// Rate limits: HTMX ignores error responses by default. Let 429 fragments swap so the
+// alert (retargeted to #flash by the server) is shown instead of a silent failure.
+document.addEventListener('htmx:beforeSwap', (evt) => {
+  if (evt.detail.xhr && evt.detail.xhr.status === 429) {
+    evt.detail.shouldSwap = true;
+    evt.detail.isError = false;
+  }
+});
+
 document.addEventListener('alpine:init', () => {
   Alpine.data('counter', () => ({
     c: 0,
@@ -56,6 +56,7 @@ func DBPostsForm(action string, item *DBPostItem, submit string) templ.Component
     _, _ = io.WriteString(w, "<section class=\"mx-auto max-w-xl p-4\"><div class=\"card bg-base-200/60 border border-white/10 rounded-box shadow-xl ring-1 ring-white/10\"><div class=\"card-body\">")
     _, _ = io.WriteString(w, "<h2 class=\"card-title\">Post</h2>")
     _, _ = io.WriteString(w, "<form method=\"post\" action=\"" + action + "\" class=\"grid gap-3\">")
+    _ = CSRFField().Render(ctx, w)
     title := ""
     body := ""
     if item != nil { title = item.Title; body = item.Body }
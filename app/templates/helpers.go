@@ -0,0 +1,97 @@
+package templates
+
+import (
+    "context"
+    "html"
+    "io"
+    "strings"
+
+    templ "github.com/a-h/templ"
+    "gothicforge3/internal/assets"
+    "gothicforge3/internal/csrf"
+    "gothicforge3/internal/tracing"
+    "gothicforge3/internal/vendored"
+)
+
+// Layout is the base page shell; each render is traced as "render Layout".
+func Layout(title string) templ.Component { return tracing.Component("Layout", layout(title)) }
+
+// LayoutSEO is Layout with SEO meta tags; each render is traced as "render LayoutSEO".
+func LayoutSEO(seo SEO) templ.Component { return tracing.Component("LayoutSEO", layoutSEO(seo)) }
+
+// Asset returns the URL of a file from app/static ("app.js") or app/styles
+// ("styles/output.css"), fingerprinted in production builds so it can be cached forever.
+func Asset(name string) string { return assets.URL(name) }
+
+// VendorStyles renders the <link> tags for vendored stylesheets (DaisyUI): local copies, or the
+// pinned CDN URLs with integrity= (plus a preconnect) when not vendored locally.
+func VendorStyles() templ.Component {
+    return templ.ComponentFunc(func(ctx context.Context, w io.Writer) error {
+        var b strings.Builder
+        for _, o := range vendored.Origins() {
+            b.WriteString(`<link rel="preconnect" href="` + html.EscapeString(o) + `" crossorigin/>`)
+        }
+        for _, l := range vendored.Libs() {
+            if l.Kind != "style" { continue }
+            b.WriteString(`<link rel="stylesheet" href="` + html.EscapeString(vendorURL(l)) + `"` + sriAttrs(l) + `/>`)
+        }
+        _, err := io.WriteString(w, b.String())
+        return err
+    })
+}
+
+// VendorScripts renders the <script> tags for vendored libraries (Alpine CSP build, htmx) with
+// the request nonce, in lock order.
+func VendorScripts() templ.Component {
+    return templ.ComponentFunc(func(ctx context.Context, w io.Writer) error {
+        var b strings.Builder
+        for _, l := range vendored.Libs() {
+            if l.Kind != "script" { continue }
+            b.WriteString(`<script`)
+            if l.Defer { b.WriteString(` defer`) }
+            b.WriteString(` src="` + html.EscapeString(vendorURL(l)) + `" nonce="` + html.EscapeString(Nonce(ctx)) + `"` + sriAttrs(l) + `></script>`)
+        }
+        _, err := io.WriteString(w, b.String())
+        return err
+    })
+}
+
+func vendorURL(l vendored.Lib) string {
+    if vendored.Local() { return Asset(l.AssetName()) }
+    return l.URL
+}
+
+// sriAttrs adds Subresource Integrity for CDN links (local copies are verified at startup).
+func sriAttrs(l vendored.Lib) string {
+    if vendored.Local() || l.Integrity == "" { return "" }
+    return ` integrity="` + html.EscapeString(l.Integrity) + `" crossorigin="anonymous"`
+}
+
+// Nonce returns the per-request CSP nonce set by the server middleware ("" outside a request,
+// e.g. during static export). Stamp it on every <script> element: nonce={ Nonce(ctx) }.
+func Nonce(ctx context.Context) string { return templ.GetNonce(ctx) }
+
+// CSRFToken returns the session CSRF token for the request ("" outside a request).
+func CSRFToken(ctx context.Context) string { return csrf.Token(ctx) }
+
+// CSRFField renders the hidden input that every non-HTMX <form method="post"> must include:
+// @templates.CSRFField() in templ, or CSRFField().Render(ctx, w) from hand-written components.
+func CSRFField() templ.Component {
+    return templ.ComponentFunc(func(ctx context.Context, w io.Writer) error {
+        tok := csrf.Token(ctx)
+        if tok == "" { return nil }
+        _, err := io.WriteString(w, `<input type="hidden" name="`+csrf.FieldName+`" value="`+html.EscapeString(tok)+`"/>`)
+        return err
+    })
+}
+
+// jsonLD renders a JSON-LD data block carrying the request nonce. "</" is escaped so the
+// payload cannot terminate the script element early. Nothing is rendered for empty input.
+func jsonLD(data string) templ.Component {
+    return templ.ComponentFunc(func(ctx context.Context, w io.Writer) error {
+        if strings.TrimSpace(data) == "" { return nil }
+        _, err := io.WriteString(w, `<script type="application/ld+json" nonce="`+html.EscapeString(Nonce(ctx))+`">`+
+            strings.ReplaceAll(data, "</", `<\/`)+`</script>`)
+        return err
+    })
+}
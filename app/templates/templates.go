@@ -2,11 +2,11 @@ package templates
 
 import (
     "context"
+    "html"
     "io"
-    "strings"
 
     templ "github.com/a-h/templ"
-    "gothicforge3/internal/env"
+    "gothicforge3/internal/auth"
 )
 
 func Index() templ.Component {
@@ -19,14 +19,21 @@ func Index() templ.Component {
         _, _ = io.WriteString(w, `<h1 class="text-5xl md:text-7xl font-extrabold tracking-tight bg-gradient-to-r from-[#4F46E5] to-[#EC4899] bg-clip-text text-transparent">Gothic Forge v3</h1>`)
         _, _ = io.WriteString(w, `<p class="mt-4 max-w-2xl mx-auto opacity-80">Lean, batteries-included Go starter with Templ + HTMX + Tailwind + DaisyUI. No Node required for rendering.</p>`)
         _, _ = io.WriteString(w, `<div class="mt-6 flex gap-3 justify-center"><a href="#counter" class="btn btn-primary">Try the demo</a><a href="https://github.com/gerrymoeis/gothic_forge" target="_blank" rel="noopener" class="btn btn-outline">View source</a></div>`)
-        // Auth links (only show Login if OAuth configured)
-        oauthEnabled := strings.TrimSpace(env.Get("GITHUB_CLIENT_ID", "")) != "" && strings.TrimSpace(env.Get("GITHUB_CLIENT_SECRET", "")) != ""
-        if oauthEnabled {
-            _, _ = io.WriteString(w, `<div class="mt-3 text-sm opacity-90">`+
-                `<a href="/auth/github/login" class="link link-hover text-primary">Sign in with GitHub</a>`+
-                ` <span class="opacity-50">·</span> `+
-                `<a href="/auth/logout" class="link link-hover">Logout</a>`+
-                `</div>`)
+        // Password accounts are always available; provider sign-in links only for configured providers.
+        _, _ = io.WriteString(w, `<div class="mt-3 text-sm opacity-90">`+
+            `<a href="/login" class="link link-hover text-primary">Sign in</a>`+
+            ` <span class="opacity-50">·</span> `+
+            `<a href="/signup" class="link link-hover">Create account</a>`+
+            `</div>`)
+        if providers := auth.Providers(); len(providers) > 0 {
+            _, _ = io.WriteString(w, `<div class="mt-3 text-sm opacity-90">`)
+            for _, p := range providers {
+                _, _ = io.WriteString(w, `<a href="/auth/`+p.Name+`/login" class="link link-hover text-primary">Sign in with `+html.EscapeString(p.DisplayName)+`</a> <span class="opacity-50">·</span> `)
+            }
+            // Signing out changes state, so it is a POST with the CSRF token, not a link.
+            _, _ = io.WriteString(w, `<form method="post" action="/logout" class="inline">`)
+            _ = CSRFField().Render(ctx, w)
+            _, _ = io.WriteString(w, `<button type="submit" class="link link-hover">Logout</button></form></div>`)
         }
         _, _ = io.WriteString(w, `</div></div>`)
         _, _ = io.WriteString(w, `</section>`)
@@ -8,6 +8,8 @@ import (
     "strings"
     "time"
 
+    "gothicforge3/internal/accounts"
+    "gothicforge3/internal/auth"
     "gothicforge3/internal/execx"
     "github.com/spf13/cobra"
 )
@@ -82,36 +84,48 @@ var addCmd = &cobra.Command{
     },
 }
 
-// scaffoldOAuth creates placeholder OAuth routes for a provider.
+// scaffoldOAuth sets up a sign-in provider. Built-in providers only need credentials; any
+// other name gets a generic OpenID Connect provider configured from <NAME>_ISSUER,
+// <NAME>_CLIENT_ID and <NAME>_CLIENT_SECRET.
 func scaffoldOAuth(provider string) error {
     keb := kebabCase(provider)
-    routePath := filepath.Join("app", "routes", fmt.Sprintf("oauth_%s.go", keb))
+    env := strings.ToUpper(strings.ReplaceAll(keb, "-", "_"))
+    switch keb {
+    case "github", "google", "gitlab", "microsoft", "oidc":
+        fmt.Printf("%s sign-in is built in. Set in .env:\n", keb)
+        if keb == "oidc" { fmt.Println("  OIDC_ISSUER=") }
+        fmt.Printf("  %s_CLIENT_ID=\n  %s_CLIENT_SECRET=\n", env, env)
+        fmt.Printf("Register the callback URL with the provider: <OAUTH_BASE_URL>/auth/%s/callback\n", keb)
+        return nil
+    }
+    routePath := filepath.Join("app", "routes", fmt.Sprintf("oauth_%s.go", strings.ReplaceAll(keb, "-", "_")))
     routeSrc := fmt.Sprintf(`package routes
 
 import (
-    "net/http"
+    "os"
+
     "github.com/go-chi/chi/v5"
+    "gothicforge3/internal/auth"
 )
 
+// %[3]s sign-in via OpenID Connect discovery, enabled once %[2]s_ISSUER, _CLIENT_ID and _CLIENT_SECRET are set.
 func init() {
     RegisterRoute(func(r chi.Router) {
-        r.Get("/oauth/%[1]s/start", func(w http.ResponseWriter, req *http.Request) {
-            w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-            w.WriteHeader(http.StatusNotImplemented)
-            _, _ = w.Write([]byte("OAuth %[1]s start not implemented"))
+        auth.RegisterProvider(&auth.Provider{
+            Name:         "%[1]s",
+            DisplayName:  "%[3]s",
+            Issuer:       os.Getenv("%[2]s_ISSUER"),
+            ClientID:     os.Getenv("%[2]s_CLIENT_ID"),
+            ClientSecret: os.Getenv("%[2]s_CLIENT_SECRET"),
+            Scopes:       []string{"openid", "email", "profile"},
         })
-        r.Get("/oauth/%[1]s/callback", func(w http.ResponseWriter, req *http.Request) {
-            w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-            w.WriteHeader(http.StatusNotImplemented)
-            _, _ = w.Write([]byte("OAuth %[1]s callback not implemented"))
-        })
-        RegisterURL("/oauth/%[1]s/start")
     })
 }
-`, keb)
+`, keb, env, pascalCase(provider))
     if err := execx.WriteFileIfMissing(routePath, []byte(routeSrc), 0o644); err != nil { return err }
-    fmt.Printf("Added OAuth placeholder: /oauth/%s/start, /oauth/%s/callback\n", keb, keb)
+    fmt.Printf("Added OpenID provider %s: /auth/%s/login, /auth/%s/callback\n", keb, keb, keb)
     fmt.Printf("  - %s\n", routePath)
+    fmt.Printf("Set %s_ISSUER, %s_CLIENT_ID and %s_CLIENT_SECRET in .env\n", env, env, env)
     return nil
 }
 
@@ -226,6 +240,7 @@ func DB%[1]sForm(action string, item *DB%[1]sItem, submit string) templ.Componen
     _, _ = io.WriteString(w, "<section class=\"mx-auto max-w-xl p-4\"><div class=\"card bg-base-200/60 border border-white/10 rounded-box shadow-xl ring-1 ring-white/10\"><div class=\"card-body\">")
     _, _ = io.WriteString(w, "<h2 class=\"card-title\">%[3]s</h2>")
     _, _ = io.WriteString(w, "<form method=\"post\" action=\"" + action + "\" class=\"grid gap-3\">")
+    _ = CSRFField().Render(ctx, w)
 %[6]s    _, _ = io.WriteString(w, "<button class=\"btn btn-primary\" type=\"submit\">" + submit + "</button>")
     _, _ = io.WriteString(w, "</form></div></div></section>")
     return nil
@@ -282,16 +297,17 @@ import (
   "github.com/go-chi/chi/v5"
   "gothicforge3/app/templates"
   "gothicforge3/internal/auth"
+  "gothicforge3/internal/config"
   "gothicforge3/internal/db"
-  "gothicforge3/internal/env"
+  "gothicforge3/internal/httpcache"
 )
 
 func init() {
   RegisterRoute(func(r chi.Router) {
-    // List
-    r.Get("/db/%[4]s", func(w http.ResponseWriter, req *http.Request) {
+    // List (cached for a minute; the mutations below invalidate the "%[3]s" tag)
+    r.With(httpcache.Cache(httpcache.CacheOptions{TTL: time.Minute, Tags: []string{"%[3]s"}})).Get("/db/%[4]s", func(w http.ResponseWriter, req *http.Request) {
       w.Header().Set("Content-Type", "text/html; charset=utf-8")
-      if env.Get("DATABASE_URL", "") == "" { http.Error(w, "database not configured", http.StatusServiceUnavailable); return }
+      if config.Current().DatabaseURL == "" { http.Error(w, "database not configured", http.StatusServiceUnavailable); return }
       ctx, cancel := context.WithTimeout(req.Context(), 5*time.Second); defer cancel()
       if err := db.Connect(ctx); err != nil { http.Error(w, err.Error(), http.StatusInternalServerError); return }
       rows, err := db.Pool().Query(req.Context(), "SELECT %[6]s FROM %[3]s ORDER BY id DESC LIMIT 50")
@@ -313,20 +329,20 @@ func init() {
     })
 
     // Create
-    r.Post("/db/%[4]s", func(w http.ResponseWriter, req *http.Request) {
-      if _, err := auth.ReadAndVerifyCookie(req, "gf_jwt"); err != nil { http.Error(w, "unauthorized", http.StatusUnauthorized); return }
-      if env.Get("DATABASE_URL", "") == "" { http.Error(w, "database not configured", http.StatusServiceUnavailable); return }
+    r.With(auth.RequireAuth).Post("/db/%[4]s", func(w http.ResponseWriter, req *http.Request) {
+      if config.Current().DatabaseURL == "" { http.Error(w, "database not configured", http.StatusServiceUnavailable); return }
       ctx, cancel := context.WithTimeout(req.Context(), 5*time.Second); defer cancel()
       if err := db.Connect(ctx); err != nil { http.Error(w, err.Error(), http.StatusInternalServerError); return }
       _ = req.ParseForm()
 %[8]s      if _, err := db.Pool().Exec(req.Context(), "INSERT INTO %[3]s (%[9]s) VALUES (%[10]s)", %[11]s); err != nil { http.Error(w, err.Error(), http.StatusInternalServerError); return }
+      _ = httpcache.Invalidate(req.Context(), "%[3]s")
       http.Redirect(w, req, "/db/%[4]s", http.StatusSeeOther)
     })
 
     // Edit form
     r.Get("/db/%[4]s/{id}/edit", func(w http.ResponseWriter, req *http.Request) {
       w.Header().Set("Content-Type", "text/html; charset=utf-8")
-      if env.Get("DATABASE_URL", "") == "" { http.Error(w, "database not configured", http.StatusServiceUnavailable); return }
+      if config.Current().DatabaseURL == "" { http.Error(w, "database not configured", http.StatusServiceUnavailable); return }
       ctx, cancel := context.WithTimeout(req.Context(), 5*time.Second); defer cancel()
       if err := db.Connect(ctx); err != nil { http.Error(w, err.Error(), http.StatusInternalServerError); return }
       id, _ := strconv.ParseInt(chi.URLParam(req, "id"), 10, 64)
@@ -337,25 +353,25 @@ func init() {
     })
 
     // Update
-    r.Post("/db/%[4]s/{id}", func(w http.ResponseWriter, req *http.Request) {
-      if _, err := auth.ReadAndVerifyCookie(req, "gf_jwt"); err != nil { http.Error(w, "unauthorized", http.StatusUnauthorized); return }
-      if env.Get("DATABASE_URL", "") == "" { http.Error(w, "database not configured", http.StatusServiceUnavailable); return }
+    r.With(auth.RequireAuth).Post("/db/%[4]s/{id}", func(w http.ResponseWriter, req *http.Request) {
+      if config.Current().DatabaseURL == "" { http.Error(w, "database not configured", http.StatusServiceUnavailable); return }
       ctx, cancel := context.WithTimeout(req.Context(), 5*time.Second); defer cancel()
       if err := db.Connect(ctx); err != nil { http.Error(w, err.Error(), http.StatusInternalServerError); return }
       _ = req.ParseForm()
       id, _ := strconv.ParseInt(chi.URLParam(req, "id"), 10, 64)
 %[14]s      if _, err := db.Pool().Exec(req.Context(), "UPDATE %[3]s SET %[15]s, updated_at=now() WHERE id=$%[16]d", %[17]s, id); err != nil { http.Error(w, err.Error(), http.StatusInternalServerError); return }
+      _ = httpcache.Invalidate(req.Context(), "%[3]s")
       http.Redirect(w, req, "/db/%[4]s", http.StatusSeeOther)
     })
 
     // Delete
-    r.Post("/db/%[4]s/{id}/delete", func(w http.ResponseWriter, req *http.Request) {
-      if _, err := auth.ReadAndVerifyCookie(req, "gf_jwt"); err != nil { http.Error(w, "unauthorized", http.StatusUnauthorized); return }
-      if env.Get("DATABASE_URL", "") == "" { http.Error(w, "database not configured", http.StatusServiceUnavailable); return }
+    r.With(auth.RequireAuth).Post("/db/%[4]s/{id}/delete", func(w http.ResponseWriter, req *http.Request) {
+      if config.Current().DatabaseURL == "" { http.Error(w, "database not configured", http.StatusServiceUnavailable); return }
       ctx, cancel := context.WithTimeout(req.Context(), 5*time.Second); defer cancel()
       if err := db.Connect(ctx); err != nil { http.Error(w, err.Error(), http.StatusInternalServerError); return }
       id, _ := strconv.ParseInt(chi.URLParam(req, "id"), 10, 64)
       if _, err := db.Pool().Exec(req.Context(), "DELETE FROM %[3]s WHERE id=$1", id); err != nil { http.Error(w, err.Error(), http.StatusInternalServerError); return }
+      _ = httpcache.Invalidate(req.Context(), "%[3]s")
       http.Redirect(w, req, "/db/%[4]s", http.StatusSeeOther)
     })
 
@@ -478,75 +494,36 @@ func scaffoldDB(name string) error {
     return nil
 }
 
-// scaffoldAuth creates minimal session-backed login/logout routes and a login page.
+// scaffoldAuth sets up password accounts (internal/accounts, app/routes/accounts.go): it
+// restores the users migration when missing and lists the routes.
 func scaffoldAuth() error {
-    // Routes
-    routePath := filepath.Join("app", "routes", "auth.go")
-    routeSrc := `package routes
-
-import (
-    "net/http"
-    "strings"
-    "github.com/go-chi/chi/v5"
-    "gothicforge3/app/templates"
-    "gothicforge3/internal/server"
-)
-
-func init() {
-    RegisterRoute(func(r chi.Router) {
-        r.Get("/login", func(w http.ResponseWriter, req *http.Request) {
-            w.Header().Set("Content-Type", "text/html; charset=utf-8")
-            _ = templates.AuthLogin().Render(req.Context(), w)
-        })
-        r.Post("/login", func(w http.ResponseWriter, req *http.Request) {
-            _ = req.ParseForm()
-            user := strings.TrimSpace(req.FormValue("username"))
-            if user == "" {
-                http.Redirect(w, req, "/login?err=1", http.StatusSeeOther)
-                return
-            }
-            server.Sessions().Put(req.Context(), "user", user)
-            http.Redirect(w, req, "/", http.StatusSeeOther)
-        })
-        r.Get("/logout", func(w http.ResponseWriter, req *http.Request) {
-            server.Sessions().Remove(req.Context(), "user")
-            http.Redirect(w, req, "/", http.StatusSeeOther)
-        })
-        RegisterURL("/login")
-    })
-}
-`
-    if err := execx.WriteFileIfMissing(routePath, []byte(routeSrc), 0o644); err != nil { return err }
-
-    // Template
-    tmplPath := filepath.Join("app", "templates", "auth_login.go")
-    tmplSrc := `package templates
-
-import (
-    "context"
-    "io"
-    templ "github.com/a-h/templ"
-)
-
-func AuthLogin() templ.Component {
-    body := templ.ComponentFunc(func(ctx context.Context, w io.Writer) error {
-        _, _ = io.WriteString(w, "<section class=\"mx-auto max-w-xl p-4\"><div class=\"card bg-base-200/60 border border-white/10 rounded-box shadow-xl ring-1 ring-white/10\"><div class=\"card-body\">")
-        _, _ = io.WriteString(w, "<h2 class=\"card-title\">Sign in</h2>")
-        _, _ = io.WriteString(w, "<form method=\"post\" action=\"/login\" class=\"grid gap-3\">")
-        _, _ = io.WriteString(w, "<label class=\"form-control\"><span class=\"label-text\">Username</span><input type=\"text\" name=\"username\" class=\"input input-bordered\" required></label>")
-        _, _ = io.WriteString(w, "<button class=\"btn btn-primary\" type=\"submit\">Continue</button>")
-        _, _ = io.WriteString(w, "</form>")
-        _, _ = io.WriteString(w, "</div></div></section>")
-        return nil
-    })
-    return templ.ComponentFunc(func(ctx context.Context, w io.Writer) error { return LayoutSEO(SEO{Title: "Sign in", Description: "Demo auth form", Canonical: "/login"}).Render(templ.WithChildren(ctx, body), w) })
-}
-`
-    if err := execx.WriteFileIfMissing(tmplPath, []byte(tmplSrc), 0o644); err != nil { return err }
-
-    fmt.Println("Added auth routes: /login, /logout")
-    fmt.Printf("  - %s\n", routePath)
-    fmt.Printf("  - %s\n", tmplPath)
+    dir := filepath.Join("app", "db", "migrations")
+    now := time.Now().UTC()
+    files := map[string]string{}
+    for i, m := range []struct{ name, sql string }{
+        {"create_users", accounts.MigrationSQL},
+        {"create_auth_sessions", auth.SessionsMigrationSQL},
+    } {
+        existing, _ := filepath.Glob(filepath.Join(dir, "*_"+m.name+".sql"))
+        if len(existing) > 0 {
+            files[m.name] = existing[0]
+            continue
+        }
+        if err := os.MkdirAll(dir, 0o755); err != nil { return err }
+        // goose versions must be unique, so the second file is stamped a second later
+        file := filepath.Join(dir, now.Add(time.Duration(i)*time.Second).Format("20060102150405")+"_"+m.name+".sql")
+        if err := os.WriteFile(file, []byte(m.sql), 0o644); err != nil { return err }
+        files[m.name] = file
+        fmt.Printf("Added migration: %s\n", filepath.Base(file))
+    }
+    fmt.Println("Password accounts (argon2id) are built in:")
+    fmt.Println("  • /signup, /login, POST /logout, /account")
+    fmt.Println("  • /verify-email, /password/forgot, /password/reset")
+    fmt.Println("  • POST /auth/refresh, POST /auth/logout/all (sign out everywhere)")
+    fmt.Printf("  • users table: %s\n", files["create_users"])
+    fmt.Printf("  • sessions tables: %s\n", files["create_auth_sessions"])
+    fmt.Println("────────")
+    fmt.Println("Next: set DATABASE_URL, run `gforge db --migrate` (or `bin/server migrate`), and SMTP_ADDR for real email.")
     return nil
 }
 
@@ -703,6 +680,7 @@ func Crud%[1]sForm(action string, item *%[1]sItem, submit string) templ.Componen
         _, _ = io.WriteString(w, "<section class=\"mx-auto max-w-xl p-4\"><div class=\"card bg-base-200/60 border border-white/10 rounded-box shadow-xl ring-1 ring-white/10\"><div class=\"card-body\">")
         _, _ = io.WriteString(w, "<h2 class=\"card-title\">%[1]s</h2>")
         _, _ = io.WriteString(w, "<form method=\"post\" action=\"" + action + "\" class=\"grid gap-3\">")
+        _ = CSRFField().Render(ctx, w)
         name := ""
         desc := ""
         if item != nil { name = item.Name; desc = item.Description }
@@ -750,8 +728,7 @@ func init() {
             w.Header().Set("Content-Type", "text/html; charset=utf-8")
             _ = templates.Crud%[1]sForm("/%[3]s", nil, "Create").Render(req.Context(), w)
         })
-        r.Post("/%[3]s", func(w http.ResponseWriter, req *http.Request) {
-            if !requireJWT(req) { http.Error(w, "unauthorized", http.StatusUnauthorized); return }
+        r.With(auth.RequireAuth).Post("/%[3]s", func(w http.ResponseWriter, req *http.Request) {
             _ = req.ParseForm()
             name := req.FormValue("name"); desc := req.FormValue("description")
             if name == "" { http.Redirect(w, req, "/%[3]s/new", http.StatusSeeOther); return }
@@ -766,15 +743,13 @@ func init() {
             %[2]sMu.RLock(); it, ok := %[2]sStore[id]; %[2]sMu.RUnlock(); if !ok { http.NotFound(w, req); return }
             _ = templates.Crud%[1]sForm("/%[3]s/"+strconv.Itoa(id), &it, "Update").Render(req.Context(), w)
         })
-        r.Post("/%[3]s/{id}", func(w http.ResponseWriter, req *http.Request) {
-            if !requireJWT(req) { http.Error(w, "unauthorized", http.StatusUnauthorized); return }
+        r.With(auth.RequireAuth).Post("/%[3]s/{id}", func(w http.ResponseWriter, req *http.Request) {
             _ = req.ParseForm(); id, _ := strconv.Atoi(chi.URLParam(req, "id"))
             name := req.FormValue("name"); desc := req.FormValue("description")
             %[2]sMu.Lock(); if it, ok := %[2]sStore[id]; ok { it.Name = name; it.Description = desc; %[2]sStore[id] = it }; %[2]sMu.Unlock()
             http.Redirect(w, req, "/%[3]s", http.StatusSeeOther)
         })
-        r.Post("/%[3]s/{id}/delete", func(w http.ResponseWriter, req *http.Request) {
-            if !requireJWT(req) { http.Error(w, "unauthorized", http.StatusUnauthorized); return }
+        r.With(auth.RequireAuth).Post("/%[3]s/{id}/delete", func(w http.ResponseWriter, req *http.Request) {
             id, _ := strconv.Atoi(chi.URLParam(req, "id"))
             %[2]sMu.Lock(); delete(%[2]sStore, id); %[2]sMu.Unlock()
             http.Redirect(w, req, "/%[3]s", http.StatusSeeOther)
@@ -782,12 +757,10 @@ func init() {
         RegisterURL("/%[3]s")
     })
 }
-
-func requireJWT(r *http.Request) bool { _, err := auth.ReadAndVerifyCookie(r, "gf_jwt"); return err == nil }
 `, pas, keb, keb)
     if err := execx.WriteFileIfMissing(routePath, []byte(routeSrc), 0o644); err != nil { return err }
 
-    fmt.Printf("Added CRUD: /%s (memory-backed; POST/PUT/DELETE require JWT)\n", keb)
+    fmt.Printf("Added CRUD: /%s (memory-backed; POST/PUT/DELETE require sign-in via auth.RequireAuth)\n", keb)
     fmt.Printf("  - %s\n", tmplPath)
     fmt.Printf("  - %s\n", routePath)
     return nil
@@ -9,14 +9,17 @@ import (
   "strings"
   "time"
 
+  "gothicforge3/internal/assets"
   "gothicforge3/internal/execx"
+  "gothicforge3/internal/vendored"
 
   "github.com/spf13/cobra"
 )
 
 var (
-  buildOS   string
-  buildArch string
+  buildOS    string
+  buildArch  string
+  buildDevFS bool
 )
 
 var buildCmd = &cobra.Command{
@@ -46,16 +49,47 @@ var buildCmd = &cobra.Command{
       os.Setenv("GOOS", buildOS)
       os.Setenv("GOARCH", buildArch)
     }
-    fmt.Println("Building server ->", out)
-    if err := execx.Run(ctx, "go build", "go", "build", "-o", out, "./cmd/server"); err != nil {
-      return err
-    }
-
-    // SEO files (auto-generate sitemap.xml and robots.txt)
+    // SEO files (auto-generate sitemap.xml and robots.txt) before compiling, so they are embedded
     if err := writeSEOFiles(); err != nil {
       fmt.Printf("seo files generation warning: %v\n", err)
     }
 
+    // Vendor htmx/Alpine/DaisyUI on first build: production links no CDN file without the
+    // lock's integrity hashes.
+    vendorDir := filepath.Join(strings.TrimSpace(os.Getenv("GFORGE_BASEDIR")), "app", "static", vendored.Dir)
+    if did, err := vendorIfMissing(ctx, vendorDir); err != nil {
+      fmt.Printf("vendor warning: %v (run gforge vendor)\n", err)
+    } else if did {
+      fmt.Println("Vendored front-end libraries ->", vendorDir)
+    }
+
+    // Fingerprint app/static + app/styles into app/static/manifest.json (embedded below)
+    // and write .br/.gz siblings the server negotiates by Accept-Encoding.
+    if !buildDevFS {
+      if n, err := writePrecompressed(); err != nil {
+        fmt.Printf("precompression warning: %v\n", err)
+      } else {
+        fmt.Printf("Assets: wrote %d .br/.gz files\n", n)
+      }
+      if n, err := writeAssetManifest(); err != nil {
+        fmt.Printf("asset manifest warning: %v\n", err)
+      } else {
+        fmt.Printf("Assets: fingerprinted %d files -> app/static/%s\n", n, assets.ManifestFile)
+      }
+    }
+
+    goArgs := []string{"go", "build", "-o", out}
+    if buildDevFS {
+      goArgs = append(goArgs, "-tags", "devfs")
+      fmt.Println("Assets: read from ./app at runtime (devfs)")
+    } else {
+      fmt.Println("Assets: embedded (app/static, app/styles, app/db/migrations)")
+    }
+    fmt.Println("Building server ->", out)
+    if err := execx.Run(ctx, "go build", append(goArgs, "./cmd/server")...); err != nil {
+      return err
+    }
+
     fmt.Println("────────────────────────────────────────")
     fmt.Println("Build complete.")
     return nil
@@ -65,6 +99,7 @@ var buildCmd = &cobra.Command{
 func init() {
   buildCmd.Flags().StringVar(&buildOS, "os", "", "target OS (optional)")
   buildCmd.Flags().StringVar(&buildArch, "arch", "", "target arch (optional)")
+  buildCmd.Flags().BoolVar(&buildDevFS, "devfs", false, "serve assets from ./app on disk instead of embedding them")
   rootCmd.AddCommand(buildCmd)
 }
 
@@ -121,6 +156,30 @@ func writeSEOFiles() error {
   return nil
 }
 
+// writePrecompressed writes .br and .gz siblings for compressible files in app/static and app/styles.
+func writePrecompressed() (int, error) {
+  base := strings.TrimSpace(os.Getenv("GFORGE_BASEDIR"))
+  total := 0
+  for _, dir := range []string{"static", "styles"} {
+    n, err := assets.Compress(filepath.Join(base, "app", dir))
+    if err != nil { return total, err }
+    total += n
+  }
+  return total, nil
+}
+
+// writeAssetManifest hashes app/static and app/styles and writes app/static/manifest.json.
+// It respects GFORGE_BASEDIR like writeSEOFiles.
+func writeAssetManifest() (int, error) {
+  base := strings.TrimSpace(os.Getenv("GFORGE_BASEDIR"))
+  staticDir := filepath.Join(base, "app", "static")
+  m, err := assets.Generate(os.DirFS(staticDir), os.DirFS(filepath.Join(base, "app", "styles")))
+  if err != nil { return 0, err }
+  b, err := m.Marshal()
+  if err != nil { return 0, err }
+  return len(m), os.WriteFile(filepath.Join(staticDir, assets.ManifestFile), append(b, '\n'), 0o644)
+}
+
 // collectSitemapURLs reads app/sitemap/urls.txt if present and returns a list of absolute URLs.
 // Lines starting with http(s) are used as-is; other lines are treated as paths relative to base.
 // Blank lines and lines starting with '#' are ignored.
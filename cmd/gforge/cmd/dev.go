@@ -26,6 +26,11 @@ var devCmd = &cobra.Command{
         port := env.Get("HTTP_PORT", "8080")
         fmt.Printf("Dev: http://%s:%s\n", host, port)
         fmt.Println("Tools: templ • gotailwindcss")
+        if devTrace {
+            // The server (go run / air) inherits the environment: print spans to stdout.
+            _ = os.Setenv("OTEL_TRACES_EXPORTER", "stdout")
+            fmt.Println("Tracing: OpenTelemetry spans → stdout")
+        }
 
         ctx, cancel := context.WithCancel(context.Background())
         defer cancel()
@@ -107,12 +112,12 @@ var devCmd = &cobra.Command{
                 go func() { _ = execx.Run(ctx, "air", airPath, "-c", ".air.toml") }()
             } else {
                 fmt.Printf("air not available: %v\nfalling back to go run\n", err)
-                go func() { fmt.Println("Server: go run"); _ = execx.Run(ctx, "server", "go", "run", "./cmd/server") }()
+                go func() { fmt.Println("Server: go run -tags devfs (assets from disk)"); _ = execx.Run(ctx, "server", "go", "run", "-tags", "devfs", "./cmd/server") }()
             }
         } else {
             // Run go server and restart on component changes
             srvCtx, srvCancel := context.WithCancel(ctx)
-            startServer := func() { go func() { fmt.Println("Server: go run"); _ = execx.Run(srvCtx, "server", "go", "run", "./cmd/server") }() }
+            startServer := func() { go func() { fmt.Println("Server: go run -tags devfs (assets from disk)"); _ = execx.Run(srvCtx, "server", "go", "run", "-tags", "devfs", "./cmd/server") }() }
             startServer()
             go func() {
                 last := map[string]time.Time{}
@@ -171,9 +176,13 @@ var devCmd = &cobra.Command{
     },
 }
 
-var devAir bool
+var (
+    devAir   bool
+    devTrace bool
+)
 
 func init() {
     devCmd.Flags().BoolVar(&devAir, "air", false, "Use Air for full autoreload (requires .air.toml)")
+    devCmd.Flags().BoolVar(&devTrace, "trace", false, "Print OpenTelemetry spans to stdout (OTEL_TRACES_EXPORTER=stdout)")
     rootCmd.AddCommand(devCmd)
 }
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+  "context"
   "fmt"
   "net"
   "os"
@@ -10,17 +11,19 @@ import (
   "time"
 
   "gothicforge3/internal/execx"
+  "gothicforge3/internal/health"
   "github.com/spf13/cobra"
 )
 
 var (
   doctorVerbose bool
   doctorFix bool
+  doctorURL string
 )
 
 var doctorCmd = &cobra.Command{
   Use:   "doctor",
-  Short: "Run preflight checks (env, tools, ports)",
+  Short: "Run preflight checks (env, tools, ports, health of a running instance)",
   RunE: func(cmd *cobra.Command, args []string) error {
     banner()
     fmt.Println("Doctor")
@@ -85,10 +88,21 @@ var doctorCmd = &cobra.Command{
 
     // Port probe (default dev port)
     devAddr := "127.0.0.1:8080"
+    devUp := false
     if portFree(devAddr) {
       fmt.Printf("  • Port %s: available\n", devAddr)
     } else {
       fmt.Printf("  • Port %s: in use\n", devAddr)
+      devUp = true
+    }
+
+    // Probe a running instance (--url, or the dev server when the port is taken)
+    target := strings.TrimSpace(doctorURL)
+    if target == "" && devUp { target = "http://" + devAddr }
+    if target != "" {
+      fmt.Println("────────────────────────────────────────")
+      fmt.Printf("Instance %s\n", target)
+      printProbes(target)
     }
 
     // Create sitemap registry template if missing and --fix
@@ -131,7 +145,7 @@ var doctorCmd = &cobra.Command{
         for _, m := range missing { fmt.Printf("    - %s\n", m) }
       }
       if doctorVerbose {
-        fmt.Println("  • Tips: set APP_ENV=production for stricter CSP, enable CSRF middleware")
+        fmt.Println("  • Tips: set APP_ENV=production for stricter CSP and Secure session cookies")
       }
     }
 
@@ -140,6 +154,26 @@ var doctorCmd = &cobra.Command{
   },
 }
 
+// printProbes fetches /livez, /readyz and /startupz (JSON) from a running server and lists each check.
+func printProbes(base string) {
+  for _, p := range health.Probes {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    rep, err := health.Fetch(ctx, base, p)
+    cancel()
+    if err != nil {
+      fmt.Printf("  • /%s: unreachable (%v)\n", p, err)
+      continue
+    }
+    fmt.Printf("  • /%s: %s\n", p, rep.Status)
+    for _, c := range rep.Checks {
+      line := fmt.Sprintf("    - %s: %s", c.Name, c.Status)
+      if c.Error != "" { line += " (" + c.Error + ")" }
+      if c.Status == health.StatusFail && !c.Critical { line += " [non-critical]" }
+      fmt.Println(line)
+    }
+  }
+}
+
 func portFree(addr string) bool {
   ln, err := net.Listen("tcp", addr)
   if err != nil { return false }
@@ -159,23 +193,63 @@ func writeEnvExample(p string) error {
 # Copy this file to .env and fill only what's necessary.
 # Notes:
 # - APP_ENV: development | production
-# - In production, CSRF middleware is enabled and CSP is stricter.
+# - CSRF tokens are enforced in every environment; in production CSP is stricter.
 # - All development happens in /app; gforge handles tooling and build.
 
 # App
 APP_ENV=development
 SITE_BASE_URL=http://127.0.0.1:8080
 JWT_SECRET=devsecret-change-me
+# Accounts mail (links are logged without SMTP_ADDR)
+SMTP_ADDR=
+MAIL_FROM=no-reply@localhost
 
 # Server
 HTTP_HOST=127.0.0.1
 HTTP_PORT=8080
-# LOG_FORMAT: empty for human logs, or 'json' for structured logs
+# Built-in HTTPS (self-hosting): TLS_CERT_FILE/TLS_KEY_FILE or ACME_DOMAINS; HTTP_REDIRECT_ADDR=:80
+TLS_CERT_FILE=
+TLS_KEY_FILE=
+ACME_DOMAINS=
+ACME_EMAIL=
+HTTP_REDIRECT_ADDR=
+# Proxies trusted for client IP/scheme: CIDRs or presets cloudflare, railway, private, loopback
+TRUSTED_PROXIES=
+# Unix socket listener and SIGHUP/SIGUSR2 zero-downtime handoff (self-hosting)
+HTTP_SOCKET=
+HANDOFF_ENABLE=0
+# LOG_FORMAT: text (default) | json | off (no per-request lines)
 LOG_FORMAT=
+# LOG_LEVEL: debug | info | warn | error (debug also logs request headers, secrets redacted)
+LOG_LEVEL=info
+# Fraction of successful requests to log (0..1); 4xx/5xx are always logged
+LOG_SAMPLE_RATE=1
 
-# Rate limiting (per IP)
+# Rate limiting (shared via VALKEY_URL when set, otherwise per process)
+# "default" policy: POST/PUT/PATCH/DELETE per client IP
 RATE_LIMIT_MAX=120
 RATE_LIMIT_WINDOW_SECONDS=60
+# Extra named policies for ratelimit.Limit(name): name=limit/window[:ip|sub|apikey], comma-separated
+# e.g. RATE_LIMIT_POLICIES=login=5/1m:ip,api=600/1m:apikey
+RATE_LIMIT_POLICIES=
+
+# ETag + 304 for rendered HTML (opt-in); server-side response/fragment cache (on unless disabled)
+ETAG_ENABLE=0
+HTTP_CACHE_DISABLE=0
+
+# Prometheus metrics (opt-in): /metrics behind METRICS_TOKEN, or a separate METRICS_ADDR listener
+METRICS_ENABLE=0
+METRICS_TOKEN=
+METRICS_ADDR=
+
+# OpenTelemetry tracing (off by default): OTLP/HTTP endpoint, or OTEL_TRACES_EXPORTER=stdout
+OTEL_TRACES_EXPORTER=
+OTEL_EXPORTER_OTLP_ENDPOINT=
+OTEL_EXPORTER_OTLP_HEADERS=
+OTEL_SERVICE_NAME=gothic-forge
+
+# Front-end libraries: local (app/static/vendor, see gforge vendor) or cdn (pinned URLs + integrity)
+VENDOR_MODE=local
 
 # CORS
 # Comma-separated list (e.g., https://example.com,https://app.example.com)
@@ -186,10 +260,20 @@ CORS_ORIGINS=
 DATABASE_URL=
 VALKEY_URL=
 
-# OAuth (optional)
-# If set, GitHub OAuth login will be enabled at /auth/github/login
+# OAuth / OpenID sign-in (optional)
+# Each provider is enabled at /auth/<provider>/login when its ID and secret are set
 GITHUB_CLIENT_ID=
 GITHUB_CLIENT_SECRET=
+GOOGLE_CLIENT_ID=
+GOOGLE_CLIENT_SECRET=
+GITLAB_CLIENT_ID=
+GITLAB_CLIENT_SECRET=
+MICROSOFT_CLIENT_ID=
+MICROSOFT_CLIENT_SECRET=
+# Generic OpenID Connect provider (discovery from the issuer)
+OIDC_ISSUER=
+OIDC_CLIENT_ID=
+OIDC_CLIENT_SECRET=
 # Base URL used to compute OAuth callback, defaults to SITE_BASE_URL
 OAUTH_BASE_URL=
 
@@ -208,8 +292,8 @@ CF_API_TOKEN=
 # Cloudflare API tokens: https://dash.cloudflare.com/profile/api-tokens
 
 # Security notes
-# - CSRF: automatically enforced when APP_ENV=production
-# - CSP: allows unpkg.com & cdn.jsdelivr.net and inline JSON-LD for SEO
+# - CSRF: session-bound tokens on every POST/PUT/PATCH/DELETE (header X-CSRF-Token or form field csrf_token)
+# - CSP: per-request script nonce + 'strict-dynamic' outside development (no 'unsafe-inline' scripts)
 # - Sessions: cookie SameSite=Lax, Secure in production
 `
   return os.WriteFile(p, []byte(content), 0o644)
@@ -235,5 +319,6 @@ func readEnvKey(path, key string) string {
 func init() {
   doctorCmd.Flags().BoolVar(&doctorVerbose, "verbose", false, "verbose output")
   doctorCmd.Flags().BoolVar(&doctorFix, "fix", false, "attempt to fix common issues")
+  doctorCmd.Flags().StringVar(&doctorURL, "url", "", "probe /livez, /readyz and /startupz on a running instance (default: the dev server when it is up)")
   rootCmd.AddCommand(doctorCmd)
 }
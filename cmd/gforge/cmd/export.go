@@ -13,8 +13,11 @@ import (
 
 	"github.com/spf13/cobra"
 	"gothicforge3/app/routes"
+	"gothicforge3/internal/assets"
+	"gothicforge3/internal/config"
 	"gothicforge3/internal/execx"
 	"gothicforge3/internal/server"
+	"gothicforge3/internal/vendored"
 )
 
 var (
@@ -50,8 +53,16 @@ var exportCmd = &cobra.Command{
 		if outDir == "" { outDir = "dist" }
 		if err := os.MkdirAll(outDir, 0o755); err != nil { return err }
 
-		r := server.New()
-		routes.Register(r)
+		cfg, err := config.Load()
+		if err != nil { return err }
+		r := server.New(cfg)
+		routes.Register(r, cfg)
+		// Fingerprint from disk (output.css was just rebuilt) so pages link the hashed copies written below.
+		manifest, err := assets.Generate(os.DirFS(filepath.Join("app", "static")), os.DirFS(filepath.Join("app", "styles")))
+		if err != nil { return err }
+		assets.Use(manifest, false)
+		// Likewise link the vendored libraries on disk (or the pinned CDN URLs when not vendored).
+		if err := vendored.Init(os.DirFS(filepath.Join("app", "static")), cfg.VendorMode, cfg.IsProduction()); err != nil { fmt.Println("  • " + err.Error()) }
 
 		// Derive URLs: from sitemap helper, then convert to paths
 		base := strings.TrimSpace(os.Getenv("SITE_BASE_URL"))
@@ -76,9 +87,10 @@ var exportCmd = &cobra.Command{
 		// Copy assets: app/static -> dist/static; app/styles -> dist/static/styles
 		if err := copyDir("app/static", filepath.Join(outDir, "static")); err != nil { return err }
 		if err := copyDir("app/styles", filepath.Join(outDir, "static", "styles")); err != nil { return err }
+		if err := writeHashedCopies(filepath.Join(outDir, "static"), manifest); err != nil { return err }
 
 		// Write Cloudflare Pages _headers for security and caching
-		if err := writeCFHeaders(outDir); err != nil {
+		if err := writeCFHeaders(outDir, manifest); err != nil {
 			fmt.Printf("warning: failed to write _headers: %v\n", err)
 		}
 
@@ -129,9 +141,23 @@ func copyDir(src, dst string) error {
     })
 }
 
-// writeCFHeaders writes a Cloudflare Pages _headers file into outDir.
+// writeHashedCopies copies each asset in staticDir to its fingerprinted name and writes the manifest.
+func writeHashedCopies(staticDir string, m assets.Manifest) error {
+    for _, name := range m.Names() {
+        b, err := os.ReadFile(filepath.Join(staticDir, filepath.FromSlash(name)))
+        if err != nil { return err }
+        if err := os.WriteFile(filepath.Join(staticDir, filepath.FromSlash(m[name])), b, 0o644); err != nil { return err }
+    }
+    b, err := m.Marshal()
+    if err != nil { return err }
+    return os.WriteFile(filepath.Join(staticDir, assets.ManifestFile), append(b, '\n'), 0o644)
+}
+
+// writeCFHeaders writes a Cloudflare Pages _headers file into outDir. Only fingerprinted assets
+// are cached as immutable; pages and plain /static paths keep Pages' revalidating default so a
+// deploy is picked up immediately (matching rules' headers are joined, so /* sets no Cache-Control).
 // Docs: https://developers.cloudflare.com/pages/configuration/headers/
-func writeCFHeaders(outDir string) error {
+func writeCFHeaders(outDir string, m assets.Manifest) error {
     var b strings.Builder
     // Defaults for all routes
     b.WriteString("/*\n")
@@ -139,14 +165,18 @@ func writeCFHeaders(outDir string) error {
     b.WriteString("  X-Content-Type-Options: nosniff\n")
     b.WriteString("  Referrer-Policy: strict-origin-when-cross-origin\n")
     b.WriteString("  Strict-Transport-Security: max-age=31536000; includeSubDomains; preload\n")
-    // Align with server CSP allowances (Templ + HTMX + Alpine via CDNs, inline JSON-LD)
-    b.WriteString("  Content-Security-Policy: default-src 'self'; script-src 'self' https://unpkg.com https://cdn.jsdelivr.net 'unsafe-inline'; style-src 'self' https: 'unsafe-inline'; img-src 'self' data: https:; font-src 'self' https:; connect-src 'self' https:; object-src 'none'; base-uri 'self'; frame-ancestors 'self'\n")
+    // Static pages cannot carry a per-request nonce, so the exported policy keeps the inline
+    // JSON-LD allowance the server drops in production. CDN origins are only listed when the
+    // libraries are not vendored (see gforge vendor).
+    cdn := strings.Join(vendored.Origins(), " ")
+    if cdn != "" { cdn = " " + cdn }
+    b.WriteString("  Content-Security-Policy: default-src 'self'; script-src 'self'" + cdn + " 'unsafe-inline'; style-src 'self'" + cdn + " 'unsafe-inline'; img-src 'self' data: https:; font-src 'self'" + cdn + "; connect-src 'self'; object-src 'none'; base-uri 'self'; frame-ancestors 'self'\n")
     b.WriteString("  Permissions-Policy: geolocation=(), microphone=(), camera=()\n")
-    b.WriteString("  Cache-Control: public, max-age=3600\n")
-    b.WriteString("\n")
-    // Long cache for static assets
-    b.WriteString("/static/*\n")
-    b.WriteString("  Cache-Control: public, max-age=604800, immutable\n")
+    // Long cache for fingerprinted assets only
+    for _, name := range m.Names() {
+        b.WriteString("\n" + assets.Prefix + m[name] + "\n")
+        b.WriteString("  Cache-Control: " + assets.CacheImmutable + "\n")
+    }
     path := filepath.Join(outDir, "_headers")
     return os.WriteFile(path, []byte(b.String()), 0o644)
 }
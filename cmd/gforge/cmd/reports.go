@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gothicforge3/internal/config"
+	"gothicforge3/internal/env"
+	"gothicforge3/internal/reports"
+)
+
+var (
+	reportsSince  time.Duration
+	reportsTop    int
+	reportsSource string
+	reportsFile   string
+)
+
+var reportsCmd = &cobra.Command{
+	Use:   "reports",
+	Short: "Summarise CSP/NEL violation reports collected at /_reports/csp",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		banner()
+		_ = env.Load()
+		cfg := config.Current()
+		source := strings.ToLower(strings.TrimSpace(reportsSource))
+		if source == "" { source = strings.ToLower(cfg.ReportsStore) }
+		path := reportsFile
+		if path == "" { path = cfg.ReportsFile }
+		since := time.Now().Add(-reportsSince)
+
+		var list []reports.Violation
+		var err error
+		switch source {
+		case "file":
+			list, err = reports.ReadFile(path, since)
+		case "postgres":
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			list, err = reports.QueryPostgres(ctx, since)
+		default:
+			return fmt.Errorf("reports are stored in %q; use --source file|postgres (log output is not queryable)", source)
+		}
+		if err != nil { return err }
+
+		fmt.Printf("Reports (%s, last %s)\n", source, reportsSince)
+		sums := reports.Summarize(list)
+		if len(sums) == 0 {
+			fmt.Println("  • No violations recorded")
+			fmt.Println("────────────────────────────────────────")
+			return nil
+		}
+		total := 0
+		for _, s := range sums { total += s.Count }
+		fmt.Printf("  • %d violation(s) in %d group(s)\n", total, len(sums))
+		for i, s := range sums {
+			if reportsTop > 0 && i >= reportsTop {
+				fmt.Printf("  • ... %d more group(s); raise --top to see them\n", len(sums)-reportsTop)
+				break
+			}
+			blocked := s.BlockedURI
+			if blocked == "" { blocked = "(none)" }
+			fmt.Printf("  %6d  %-14s %-22s %s\n", s.Count, s.Type, s.Directive, blocked)
+			fmt.Printf("          %d page(s), e.g. %s; last seen %s\n", s.Documents, s.Sample, s.LastSeen.Local().Format(time.DateTime))
+		}
+		fmt.Println("────────────────────────────────────────")
+		return nil
+	},
+}
+
+func init() {
+	reportsCmd.Flags().DurationVar(&reportsSince, "since", 24*time.Hour, "only include reports newer than this")
+	reportsCmd.Flags().IntVar(&reportsTop, "top", 20, "number of groups to show (0 = all)")
+	reportsCmd.Flags().StringVar(&reportsSource, "source", "", "file | postgres (defaults to REPORTS_STORE)")
+	reportsCmd.Flags().StringVar(&reportsFile, "file", "", "JSON lines file for --source file (defaults to REPORTS_FILE)")
+	rootCmd.AddCommand(reportsCmd)
+}
@@ -2,12 +2,17 @@ package cmd
 
 import (
   "bufio"
+  "errors"
   "fmt"
   "os"
   "path/filepath"
+  "sort"
   "strings"
+  "time"
 
   "github.com/spf13/cobra"
+  "gothicforge3/internal/auth"
+  "gothicforge3/internal/env"
 )
 
 var (
@@ -17,33 +22,16 @@ var (
 
 var secretsCmd = &cobra.Command{
   Use:   "secrets",
-  Short: "Manage .env secrets (set/get)",
+  Short: "Manage .env secrets (set/get) and JWT keys (rotate-jwt)",
   RunE: func(cmd *cobra.Command, args []string) error {
     banner()
     envPath := filepath.Join(".env")
     if secretsSet == "" && secretsGet == "" {
-      fmt.Println("Usage: gforge secrets --set KEY=VAL | --get KEY")
+      fmt.Println("Usage: gforge secrets --set KEY=VAL | --get KEY | rotate-jwt [--alg EdDSA] [--grace 168h]")
       return nil
     }
-    // Ensure .env exists
-    if _, err := os.Stat(envPath); os.IsNotExist(err) {
-      if err := os.WriteFile(envPath, []byte(""), 0o600); err != nil {
-        return err
-      }
-    }
-    // Load existing
-    kv := map[string]string{}
-    if f, err := os.Open(envPath); err == nil {
-      defer f.Close()
-      sc := bufio.NewScanner(f)
-      for sc.Scan() {
-        line := strings.TrimSpace(sc.Text())
-        if line == "" || strings.HasPrefix(line, "#") { continue }
-        if parts := strings.SplitN(line, "=", 2); len(parts) == 2 {
-          kv[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
-        }
-      }
-    }
+    kv, err := readDotEnv(envPath)
+    if err != nil { return err }
     if secretsGet != "" {
       if v, ok := kv[secretsGet]; ok {
         fmt.Printf("%s=%s\n", secretsGet, v)
@@ -60,17 +48,104 @@ var secretsCmd = &cobra.Command{
       key := strings.TrimSpace(parts[0])
       val := strings.TrimSpace(parts[1])
       kv[key] = val
-      // Rewrite .env
-      b := &strings.Builder{}
-      for k, v := range kv { fmt.Fprintf(b, "%s=%s\n", k, v) }
-      return os.WriteFile(envPath, []byte(b.String()), 0o600)
+      return writeDotEnv(envPath, kv)
+    }
+    return nil
+  },
+}
+
+var (
+  rotateAlg   string
+  rotateGrace time.Duration
+  rotateFile  string
+)
+
+// defaultJWTKeysFile is used when neither --file nor JWT_KEYS_FILE is set.
+const defaultJWTKeysFile = "data/jwt-keys.json"
+
+var secretsRotateJWTCmd = &cobra.Command{
+  Use:   "rotate-jwt",
+  Short: "Add a new JWT signing key; previous keys keep verifying for --grace",
+  RunE: func(cmd *cobra.Command, args []string) error {
+    banner()
+    _ = env.Load()
+    path := rotateFile
+    if path == "" { path = os.Getenv("JWT_KEYS_FILE") }
+    if path == "" { path = defaultJWTKeysFile }
+    alg := rotateAlg
+    if alg == "" { alg = os.Getenv("JWT_ALG") }
+    if alg == "" { alg = auth.EdDSA }
+    now := time.Now()
+
+    kf, err := auth.ReadKeyFile(path)
+    if errors.Is(err, os.ErrNotExist) {
+      // First rotation: keep tokens signed with JWT_SECRET valid for the grace period too.
+      if secret := os.Getenv("JWT_SECRET"); secret != "" {
+        kf.Keys = append(kf.Keys, auth.SecretKey(auth.LegacyKID, secret, now))
+      }
+    } else if err != nil {
+      return err
+    }
+    k, err := kf.Rotate(alg, rotateGrace, now)
+    if err != nil { return err }
+    if err := kf.Write(path); err != nil { return err }
+
+    fmt.Printf("New signing key %s (%s) in %s\n", k.KID, k.Alg, path)
+    for _, old := range kf.Active(now) {
+      if old.RetireAt != nil { fmt.Printf("  • %s (%s) verifies until %s\n", old.KID, old.Alg, old.RetireAt.Format(time.RFC3339)) }
+    }
+    if os.Getenv("JWT_KEYS_FILE") == "" {
+      kv, err := readDotEnv(".env")
+      if err != nil { return err }
+      kv["JWT_KEYS_FILE"] = path
+      if err := writeDotEnv(".env", kv); err != nil { return err }
+      fmt.Println("  • set JWT_KEYS_FILE in .env")
     }
+    fmt.Println("────────")
+    fmt.Println("Restart the server (or send SIGHUP with HANDOFF_ENABLE=1) on every instance to sign with the new key.")
+    fmt.Println("Keep the key file out of git; public keys are served at /.well-known/jwks.json.")
     return nil
   },
 }
 
+// readDotEnv parses KEY=VAL lines from path, creating an empty file when missing.
+func readDotEnv(path string) (map[string]string, error) {
+  if _, err := os.Stat(path); os.IsNotExist(err) {
+    if err := os.WriteFile(path, []byte(""), 0o600); err != nil {
+      return nil, err
+    }
+  }
+  kv := map[string]string{}
+  f, err := os.Open(path)
+  if err != nil { return nil, err }
+  defer f.Close()
+  sc := bufio.NewScanner(f)
+  for sc.Scan() {
+    line := strings.TrimSpace(sc.Text())
+    if line == "" || strings.HasPrefix(line, "#") { continue }
+    if parts := strings.SplitN(line, "=", 2); len(parts) == 2 {
+      kv[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+    }
+  }
+  return kv, sc.Err()
+}
+
+// writeDotEnv rewrites path with kv, sorted by key.
+func writeDotEnv(path string, kv map[string]string) error {
+  keys := make([]string, 0, len(kv))
+  for k := range kv { keys = append(keys, k) }
+  sort.Strings(keys)
+  b := &strings.Builder{}
+  for _, k := range keys { fmt.Fprintf(b, "%s=%s\n", k, kv[k]) }
+  return os.WriteFile(path, []byte(b.String()), 0o600)
+}
+
 func init() {
   secretsCmd.Flags().StringVar(&secretsSet, "set", "", "set KEY=VAL")
   secretsCmd.Flags().StringVar(&secretsGet, "get", "", "get KEY")
+  secretsRotateJWTCmd.Flags().StringVar(&rotateAlg, "alg", "", "key algorithm: EdDSA, RS256 or HS256 (default JWT_ALG, or EdDSA)")
+  secretsRotateJWTCmd.Flags().DurationVar(&rotateGrace, "grace", 7*24*time.Hour, "how long previous keys keep verifying (cover the longest token TTL)")
+  secretsRotateJWTCmd.Flags().StringVar(&rotateFile, "file", "", "key file (default JWT_KEYS_FILE, or "+defaultJWTKeysFile+")")
+  secretsCmd.AddCommand(secretsRotateJWTCmd)
   rootCmd.AddCommand(secretsCmd)
 }
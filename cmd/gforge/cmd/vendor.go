@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gothicforge3/internal/vendored"
+)
+
+var vendorCheck bool
+
+var vendorCmd = &cobra.Command{
+	Use:   "vendor",
+	Short: "Download pinned htmx/Alpine/DaisyUI into app/static/vendor with a sha384 lock",
+	Long: "Downloads the pinned front-end libraries into app/static/vendor and writes vendor.lock.json\n" +
+		"with their Subresource Integrity hashes. With the lock present the layout serves the local\n" +
+		"copies (VENDOR_MODE=local) and the production CSP allows 'self' only; VENDOR_MODE=cdn links\n" +
+		"the pinned CDN URLs with integrity= instead. --check verifies the files against the lock.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		banner()
+		dir := filepath.Join(strings.TrimSpace(os.Getenv("GFORGE_BASEDIR")), "app", "static", vendored.Dir)
+		if vendorCheck {
+			lock, err := vendored.ReadLock(os.DirFS(dir))
+			if err != nil {
+				return fmt.Errorf("read lock: %w (run gforge vendor)", err)
+			}
+			if err := vendored.Verify(os.DirFS(dir), lock); err != nil {
+				return err
+			}
+			fmt.Println("Vendored libraries match", filepath.Join(dir, vendored.LockFile))
+			printVendored(lock)
+			return nil
+		}
+		fmt.Println("Vendoring into", dir)
+		lock, err := vendorDefaults(cmd.Context(), dir)
+		if err != nil {
+			return err
+		}
+		printVendored(lock)
+		fmt.Println("Commit app/static/vendor so builds serve the local copies.")
+		return nil
+	},
+}
+
+// vendorDefaults downloads vendored.Defaults into dir and writes the lock.
+func vendorDefaults(ctx context.Context, dir string) (vendored.Lock, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+	lock, err := vendored.Download(ctx, &http.Client{Timeout: 30 * time.Second}, vendored.Defaults, dir)
+	if err != nil {
+		return lock, err
+	}
+	return lock, vendored.WriteLock(dir, lock)
+}
+
+// vendorIfMissing runs vendorDefaults when dir has no lock yet. It reports whether it did.
+func vendorIfMissing(ctx context.Context, dir string) (bool, error) {
+	if _, err := vendored.ReadLock(os.DirFS(dir)); !errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	_, err := vendorDefaults(ctx, dir)
+	return err == nil, err
+}
+
+func printVendored(lock vendored.Lock) {
+	for _, l := range lock.Libs {
+		fmt.Printf("  • %s@%s  %s\n", l.Name, l.Version, l.Integrity)
+	}
+	fmt.Println("────────────────────────────────────────")
+}
+
+func init() {
+	vendorCmd.Flags().BoolVar(&vendorCheck, "check", false, "verify vendored files against vendor.lock.json without downloading")
+	rootCmd.AddCommand(vendorCmd)
+}
@@ -1,37 +1,110 @@
 package main
 
 import (
-    "fmt"
-    "log"
-    "net/http"
+    "context"
+    "log/slog"
     "os"
+    "time"
 
+    "gothicforge3/app"
     "gothicforge3/app/routes"
+    "gothicforge3/internal/auth"
+    "gothicforge3/internal/config"
+    "gothicforge3/internal/db"
     "gothicforge3/internal/env"
+    "gothicforge3/internal/metrics"
     "gothicforge3/internal/server"
+    "gothicforge3/internal/tracing"
 )
 
 func main() {
 	_ = env.Load()
-	r := server.New()
+	// Fail fast with a readable report (e.g. JWT_SECRET still the dev default in production).
+	cfg, err := config.Load()
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	// `server migrate` applies the embedded app/db/migrations and exits (no source tree needed).
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		err := db.Migrate(ctx, app.Migrations())
+		cancel()
+		if err != nil {
+			slog.Error("migrate", "error", err)
+			os.Exit(1)
+		}
+		slog.Info("migrations complete")
+		return
+	}
+
+	// OpenTelemetry tracing (OTEL_TRACES_EXPORTER / OTEL_EXPORTER_OTLP_ENDPOINT); spans are flushed on shutdown.
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg)
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	server.OnShutdown("tracing", shutdownTracing)
+	// An unreadable JWT_KEYS_FILE must not leave production signing with an unchecked JWT_SECRET.
+	if err := auth.CheckKeys(cfg); err != nil && cfg.IsProduction() {
+		slog.Error("jwt keys", "error", err)
+		os.Exit(1)
+	}
+	r := server.New(cfg)
 
 	// Mount application routes
-	routes.Register(r)
-
-    // Prefer PORT from the platform (Railway/Heroku/etc.). Fallback to .env values.
-    port := os.Getenv("PORT")
-    if port == "" { port = env.Get("HTTP_PORT", "8080") }
-    host := env.Get("HTTP_HOST", "")
-    if host == "" {
-        if os.Getenv("PORT") != "" {
-            host = "0.0.0.0"
-        } else {
-            host = "127.0.0.1"
-        }
+	routes.Register(r, cfg)
+
+    // Prefer PORT from the platform (Railway/Heroku/etc.). Fallback to HTTP_HOST/HTTP_PORT.
+    addr := cfg.Addr()
+    opts := server.DefaultOptions(addr)
+    opts.ShutdownTimeout = cfg.ShutdownGrace
+    opts.Handoff, opts.HandoffTimeout = cfg.HandoffEnable, cfg.HandoffTimeout
+
+    // The listener is inherited during a SIGHUP/SIGUSR2 handoff or from systemd socket
+    // activation (LISTEN_FDS); otherwise it binds HTTP_SOCKET (Unix socket) or addr.
+    ln, err := server.Listen("http", cfg.ListenAddr())
+    if err != nil {
+        slog.Error("listen", "error", err)
+        os.Exit(1)
     }
-    addr := fmt.Sprintf("%s:%s", host, port)
-	log.Printf("Gothic Forge v3 listening at http://%s", addr)
-	if err := http.ListenAndServe(addr, r); err != nil {
-		log.Fatalf("server error: %v", err)
+    if cfg.HTTPSocket != "" {
+        if err := os.Chmod(cfg.HTTPSocket, cfg.SocketMode()); err != nil { slog.Warn("listen: chmod socket", "error", err) }
+    }
+    opts.Listener = ln
+
+    // Built-in HTTPS (TLS_CERT_FILE/TLS_KEY_FILE or ACME_DOMAINS) with HTTP/2; HTTP_REDIRECT_ADDR
+    // adds a plain listener that redirects to HTTPS and answers ACME http-01 challenges.
+    tlsConf, redirect, err := server.TLS(cfg)
+    if err != nil {
+        slog.Error(err.Error())
+        os.Exit(1)
+    }
+    opts.TLSConfig, opts.RedirectAddr, opts.RedirectHandler = tlsConf, cfg.HTTPRedirectAddr, redirect
+
+    // Close the DB pool once requests have drained (no-op if never connected).
+    server.OnShutdown("db", func(context.Context) error { db.Close(); return nil })
+
+    // Internal metrics listener (METRICS_ENABLE=1 with METRICS_ADDR, e.g. 127.0.0.1:9090)
+    if cfg.MetricsEnable && cfg.MetricsAddr != "" {
+        ms := metrics.Serve(cfg.MetricsAddr, cfg.MetricsToken)
+        server.OnStart("metrics", func(context.Context) error {
+            ln, err := server.Listen("metrics", ms.Addr)
+            if err != nil { return err }
+            go func() { _ = ms.Serve(ln) }()
+            slog.Info("metrics listening", "url", "http://"+ms.Addr+metrics.Path)
+            return nil
+        })
+        server.OnShutdown("metrics", ms.Shutdown)
+    }
+
+    url := "http://" + ln.Addr().String()
+    if tlsConf != nil { url = "https://" + ln.Addr().String() }
+    if ln.Addr().Network() == "unix" { url = "unix:" + ln.Addr().String() }
+	slog.Info("Gothic Forge v3 listening", "url", url, "tls", cfg.TLSMode(), "pid", os.Getpid(), "inherited", server.InheritedFrom())
+	if err := server.Run(context.Background(), r, opts); err != nil {
+		slog.Error("server error", "error", err)
+		os.Exit(1)
 	}
+	slog.Info("server stopped")
 }
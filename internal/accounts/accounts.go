@@ -0,0 +1,300 @@
+// Package accounts implements password-based user accounts: signup, login with argon2id
+// hashes that are upgraded to the current parameters on login, email verification and
+// password reset through single-use tokens. Users and tokens live in Postgres
+// (PostgresStore, the create_users migration) or, without DATABASE_URL, in memory.
+//
+// Routes in app/routes/accounts.go drive the flows and sign users in with auth.SignIn, which
+// starts a revocable session (gf_jwt access token plus rotating gf_refresh token).
+package accounts
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/mail"
+	"strings"
+	"sync"
+	"time"
+
+	"gothicforge3/internal/config"
+)
+
+// Errors returned by the account flows. Handlers show them to the user.
+var (
+	ErrEmailTaken         = errors.New("an account with this email already exists")
+	ErrInvalidEmail       = errors.New("enter a valid email address")
+	ErrWeakPassword       = fmt.Errorf("passwords need at least %d characters", MinPasswordLen)
+	ErrInvalidCredentials = errors.New("incorrect email or password")
+	ErrUnverified         = errors.New("confirm your email address first; we sent you a link")
+	ErrInvalidToken       = errors.New("this link is invalid or has expired")
+)
+
+// Password length bounds (bytes). The upper bound keeps hashing cost predictable.
+const (
+	MinPasswordLen = 8
+	MaxPasswordLen = 1024
+)
+
+// Token lifetimes.
+const (
+	VerifyEmailTTL   = 48 * time.Hour
+	ResetPasswordTTL = time.Hour
+)
+
+var (
+	mu              sync.RWMutex
+	store           Store  = NewMemoryStore()
+	mailer          Mailer = LogMailer{}
+	params                 = DefaultParams
+	requireVerified bool
+	baseURL         string
+
+	// dummyHash is verified against when an email is unknown, so response times do not reveal
+	// which addresses have accounts.
+	dummyOnce sync.Once
+	dummyHash string
+)
+
+// Init selects the store (Postgres with DATABASE_URL, memory otherwise), the mailer (SMTP
+// with SMTP_ADDR, log otherwise) and the argon2id parameters from cfg.
+func Init(cfg *config.Config) {
+	mu.Lock()
+	defer mu.Unlock()
+	if cfg.DatabaseURL != "" {
+		store = PostgresStore{}
+	} else {
+		store = NewMemoryStore()
+		if cfg.IsProduction() {
+			slog.Warn("accounts: DATABASE_URL is empty; accounts are kept in memory and lost on restart")
+		}
+	}
+	if cfg.SMTPAddr != "" {
+		mailer = SMTPMailer{Addr: cfg.SMTPAddr, Username: cfg.SMTPUsername, Password: cfg.SMTPPassword, From: cfg.MailFrom}
+	} else {
+		mailer = LogMailer{}
+	}
+	params = Params{Memory: uint32(cfg.Argon2MemoryKiB), Time: uint32(cfg.Argon2Time), Threads: uint8(cfg.Argon2Threads), KeyLen: DefaultParams.KeyLen, SaltLen: DefaultParams.SaltLen}
+	requireVerified = cfg.AccountsRequireVerified
+	// Required in production (config.accountsProblems); development falls back to the request.
+	baseURL = strings.TrimRight(cfg.SiteBaseURL, "/")
+}
+
+// RequireVerified reports whether login waits for a confirmed email (ACCOUNTS_REQUIRE_VERIFIED).
+func RequireVerified() bool { mu.RLock(); defer mu.RUnlock(); return requireVerified }
+
+// SetStore replaces the store (tests, custom backends).
+func SetStore(s Store) { mu.Lock(); store = s; mu.Unlock() }
+
+// SetMailer replaces the mailer, e.g. with a transactional email API client.
+func SetMailer(m Mailer) { mu.Lock(); mailer = m; mu.Unlock() }
+
+// SetParams replaces the argon2id parameters used for new hashes.
+func SetParams(p Params) { mu.Lock(); params = p; mu.Unlock() }
+
+func current() (Store, Mailer, Params) {
+	mu.RLock()
+	defer mu.RUnlock()
+	return store, mailer, params
+}
+
+// NormalizeEmail trims and lower-cases an address, rejecting anything that is not a bare
+// address ("a@b.example").
+func NormalizeEmail(s string) (string, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	a, err := mail.ParseAddress(s)
+	if err != nil || a.Address != s || !strings.Contains(s[strings.LastIndex(s, "@"):], ".") {
+		return "", ErrInvalidEmail
+	}
+	return s, nil
+}
+
+func checkPassword(pw string) error {
+	if len(pw) < MinPasswordLen || len(pw) > MaxPasswordLen {
+		return ErrWeakPassword
+	}
+	return nil
+}
+
+// Signup creates an account and emails a verification link built from base (the site URL,
+// e.g. "https://example.com"; SITE_BASE_URL wins when set).
+func Signup(ctx context.Context, base, email, password string) (*User, error) {
+	email, err := NormalizeEmail(email)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkPassword(password); err != nil {
+		return nil, err
+	}
+	st, _, p := current()
+	hash, err := HashPassword(password, p)
+	if err != nil {
+		return nil, err
+	}
+	u, err := st.CreateUser(ctx, email, hash)
+	if err != nil {
+		return nil, err
+	}
+	return u, SendVerification(ctx, base, u)
+}
+
+// SendVerification emails u a new verification link (earlier links stop working).
+func SendVerification(ctx context.Context, base string, u *User) error {
+	st, m, _ := current()
+	tok, err := newToken(ctx, st, u.ID, PurposeVerifyEmail, VerifyEmailTTL)
+	if err != nil {
+		return err
+	}
+	return m.Send(ctx, Message{
+		To:      u.Email,
+		Subject: "Confirm your email address",
+		Body:    "Confirm your email address by opening this link within 48 hours:\n\n" + link(base, "/verify-email", tok) + "\n",
+	})
+}
+
+// Authenticate checks email and password. A hash made with outdated parameters is replaced
+// by one made with the current parameters. With ACCOUNTS_REQUIRE_VERIFIED, unverified users
+// get ErrUnverified (after a correct password only).
+func Authenticate(ctx context.Context, email, password string) (*User, error) {
+	st, _, p := current()
+	email, err := NormalizeEmail(email)
+	if err != nil || len(password) > MaxPasswordLen {
+		return nil, ErrInvalidCredentials
+	}
+	u, err := st.UserByEmail(ctx, email)
+	if errors.Is(err, ErrNotFound) {
+		dummyOnce.Do(func() { dummyHash, _ = HashPassword("gforge-dummy-password", p) })
+		_, _, _ = VerifyPassword(dummyHash, password, p)
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	ok, rehash, err := VerifyPassword(u.PasswordHash, password, p)
+	if err != nil || !ok {
+		return nil, ErrInvalidCredentials
+	}
+	if rehash {
+		if h, err := HashPassword(password, p); err == nil {
+			if err := st.SetPasswordHash(ctx, u.ID, h); err != nil {
+				slog.Warn("accounts: rehash", "user", u.ID, "error", err)
+			} else {
+				u.PasswordHash = h
+			}
+		}
+	}
+	if RequireVerified() && !u.Verified() {
+		return u, ErrUnverified
+	}
+	return u, nil
+}
+
+// VerifyEmail consumes a verification token and marks its user verified.
+func VerifyEmail(ctx context.Context, token string) (*User, error) {
+	st, _, _ := current()
+	id, err := st.ConsumeToken(ctx, PurposeVerifyEmail, hashToken(token), time.Now())
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := st.MarkVerified(ctx, id, time.Now()); err != nil {
+		return nil, err
+	}
+	return st.UserByID(ctx, id)
+}
+
+// RequestPasswordReset emails a reset link when email has an account. It returns nil for
+// unknown addresses so the response does not reveal which addresses are registered.
+func RequestPasswordReset(ctx context.Context, base, email string) error {
+	st, m, _ := current()
+	email, err := NormalizeEmail(email)
+	if err != nil {
+		return err
+	}
+	u, err := st.UserByEmail(ctx, email)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	tok, err := newToken(ctx, st, u.ID, PurposeResetPassword, ResetPasswordTTL)
+	if err != nil {
+		return err
+	}
+	return m.Send(ctx, Message{
+		To:      u.Email,
+		Subject: "Reset your password",
+		Body:    "Choose a new password by opening this link within an hour:\n\n" + link(base, "/password/reset", tok) + "\n\nIf you did not ask for this, ignore this email.\n",
+	})
+}
+
+// ResetPassword consumes a reset token and sets a new password. Receiving the link proves
+// ownership of the address, so the user is also marked verified.
+func ResetPassword(ctx context.Context, token, password string) (*User, error) {
+	if err := checkPassword(password); err != nil {
+		return nil, err
+	}
+	st, _, p := current()
+	id, err := st.ConsumeToken(ctx, PurposeResetPassword, hashToken(token), time.Now())
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	hash, err := HashPassword(password, p)
+	if err != nil {
+		return nil, err
+	}
+	if err := st.SetPasswordHash(ctx, id, hash); err != nil {
+		return nil, err
+	}
+	if err := st.MarkVerified(ctx, id, time.Now()); err != nil {
+		return nil, err
+	}
+	_ = st.DeleteTokens(ctx, id, PurposeResetPassword)
+	return st.UserByID(ctx, id)
+}
+
+// newToken replaces the user's tokens for purpose with a fresh one and returns it. Only its
+// SHA-256 hash is stored.
+func newToken(ctx context.Context, st Store, userID int64, purpose string, ttl time.Duration) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	tok := base64.RawURLEncoding.EncodeToString(b)
+	if err := st.DeleteTokens(ctx, userID, purpose); err != nil {
+		return "", err
+	}
+	if err := st.CreateToken(ctx, userID, purpose, hashToken(tok), time.Now().Add(ttl)); err != nil {
+		return "", err
+	}
+	return tok, nil
+}
+
+func hashToken(tok string) []byte {
+	sum := sha256.Sum256([]byte(tok))
+	return sum[:]
+}
+
+func link(base, path, tok string) string {
+	mu.RLock()
+	if baseURL != "" {
+		base = baseURL
+	}
+	mu.RUnlock()
+	return strings.TrimRight(base, "/") + path + "?token=" + tok
+}
+
+// Lookup returns the user with id.
+func Lookup(ctx context.Context, id int64) (*User, error) {
+	st, _, _ := current()
+	return st.UserByID(ctx, id)
+}
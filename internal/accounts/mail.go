@@ -0,0 +1,56 @@
+package accounts
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Message is an email sent by the account flows (verification and password reset links).
+type Message struct {
+	To      string
+	Subject string
+	Body    string // plain text
+}
+
+// Mailer delivers account emails.
+type Mailer interface {
+	Send(ctx context.Context, m Message) error
+}
+
+// LogMailer writes messages to the log instead of sending them (development default): the
+// verification and reset links appear in the server output.
+type LogMailer struct{}
+
+// Send implements Mailer.
+func (LogMailer) Send(_ context.Context, m Message) error {
+	slog.Info("accounts: email (not sent; set SMTP_ADDR)", "to", m.To, "subject", m.Subject, "body", m.Body)
+	return nil
+}
+
+// SMTPMailer sends plain-text mail through an SMTP relay (STARTTLS when offered; PLAIN auth
+// when Username is set).
+type SMTPMailer struct {
+	Addr     string // host:port
+	Username string
+	Password string
+	From     string
+}
+
+// Send implements Mailer.
+func (s SMTPMailer) Send(_ context.Context, m Message) error {
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, _ := net.SplitHostPort(s.Addr)
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\n", s.From, m.To, m.Subject, time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(m.Body, "\n", "\r\n"))
+	return smtp.SendMail(s.Addr, auth, s.From, []string{m.To}, []byte(b.String()))
+}
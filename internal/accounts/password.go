@@ -0,0 +1,80 @@
+package accounts
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Params are argon2id cost parameters. Hashes record the parameters they were made with, so
+// raising them (ARGON2_MEMORY_KIB, ARGON2_TIME, ARGON2_THREADS) upgrades each stored hash the
+// next time its owner logs in.
+type Params struct {
+	Memory  uint32 // KiB
+	Time    uint32 // iterations
+	Threads uint8
+	KeyLen  uint32
+	SaltLen uint32
+}
+
+// DefaultParams follow the OWASP recommendation for argon2id (19 MiB, 2 iterations, 1 lane).
+var DefaultParams = Params{Memory: 19 * 1024, Time: 2, Threads: 1, KeyLen: 32, SaltLen: 16}
+
+// ErrBadHash is returned for stored hashes that are not in argon2id PHC format.
+var ErrBadHash = errors.New("accounts: malformed password hash")
+
+var b64 = base64.RawStdEncoding
+
+// HashPassword hashes password with argon2id and returns it in PHC string format:
+// $argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>.
+func HashPassword(password string, p Params) (string, error) {
+	salt := make([]byte, p.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, p.Time, p.Memory, p.Threads, p.KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, p.Memory, p.Time, p.Threads, b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+}
+
+// VerifyPassword reports whether password matches encoded. rehash is true when the hash was
+// made with parameters other than want and should be replaced.
+func VerifyPassword(encoded, password string, want Params) (ok, rehash bool, err error) {
+	p, salt, key, err := decodeHash(encoded)
+	if err != nil {
+		return false, false, err
+	}
+	got := argon2.IDKey([]byte(password), salt, p.Time, p.Memory, p.Threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(got, key) != 1 {
+		return false, false, nil
+	}
+	rehash = p.Memory != want.Memory || p.Time != want.Time || p.Threads != want.Threads ||
+		uint32(len(key)) != want.KeyLen || uint32(len(salt)) != want.SaltLen
+	return true, rehash, nil
+}
+
+func decodeHash(encoded string) (p Params, salt, key []byte, err error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return p, nil, nil, ErrBadHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, ErrBadHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Time, &p.Threads); err != nil {
+		return p, nil, nil, ErrBadHash
+	}
+	if salt, err = b64.DecodeString(parts[4]); err != nil {
+		return p, nil, nil, ErrBadHash
+	}
+	if key, err = b64.DecodeString(parts[5]); err != nil || len(key) == 0 {
+		return p, nil, nil, ErrBadHash
+	}
+	p.KeyLen, p.SaltLen = uint32(len(key)), uint32(len(salt))
+	return p, salt, key, nil
+}
@@ -0,0 +1,305 @@
+package accounts
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gothicforge3/internal/db"
+)
+
+// User is an account. PasswordHash is an argon2id PHC string (see HashPassword).
+type User struct {
+	ID              int64
+	Email           string
+	PasswordHash    string
+	EmailVerifiedAt *time.Time
+	CreatedAt       time.Time
+}
+
+// Verified reports whether the user confirmed their email address.
+func (u *User) Verified() bool { return u.EmailVerifiedAt != nil }
+
+// Token purposes.
+const (
+	PurposeVerifyEmail   = "verify_email"
+	PurposeResetPassword = "reset_password"
+)
+
+// ErrNotFound is returned by Store lookups that match nothing.
+var ErrNotFound = errors.New("accounts: not found")
+
+// Store persists users and single-use tokens. Tokens are stored as SHA-256 hashes only.
+type Store interface {
+	CreateUser(ctx context.Context, email, passwordHash string) (*User, error) // ErrEmailTaken on duplicates
+	UserByEmail(ctx context.Context, email string) (*User, error)
+	UserByID(ctx context.Context, id int64) (*User, error)
+	SetPasswordHash(ctx context.Context, id int64, hash string) error
+	MarkVerified(ctx context.Context, id int64, at time.Time) error
+	CreateToken(ctx context.Context, userID int64, purpose string, hash []byte, expires time.Time) error
+	// ConsumeToken deletes the unexpired token and returns its user id (ErrNotFound otherwise).
+	ConsumeToken(ctx context.Context, purpose string, hash []byte, now time.Time) (int64, error)
+	DeleteTokens(ctx context.Context, userID int64, purpose string) error
+}
+
+// MigrationSQL creates the users and user_tokens tables. It is the content of
+// app/db/migrations/*_create_users.sql, which `gforge add auth` restores when missing.
+const MigrationSQL = `-- +goose Up
+CREATE TABLE users (
+  id bigserial PRIMARY KEY,
+  email text NOT NULL,
+  password_hash text NOT NULL,
+  email_verified_at timestamptz,
+  created_at timestamptz NOT NULL DEFAULT now(),
+  updated_at timestamptz NOT NULL DEFAULT now()
+);
+-- Emails are stored lower-cased (accounts.NormalizeEmail).
+CREATE UNIQUE INDEX users_email_key ON users (email);
+
+-- Single-use email verification and password reset tokens (SHA-256 hashes only).
+CREATE TABLE user_tokens (
+  id bigserial PRIMARY KEY,
+  user_id bigint NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+  purpose text NOT NULL,
+  token_hash bytea NOT NULL,
+  expires_at timestamptz NOT NULL,
+  created_at timestamptz NOT NULL DEFAULT now()
+);
+CREATE UNIQUE INDEX user_tokens_hash_key ON user_tokens (purpose, token_hash);
+CREATE INDEX user_tokens_user_idx ON user_tokens (user_id, purpose);
+
+-- +goose Down
+DROP TABLE IF EXISTS user_tokens;
+DROP TABLE IF EXISTS users;
+`
+
+// PostgresStore keeps accounts in the users and user_tokens tables
+// (see app/db/migrations/*_create_users.sql).
+type PostgresStore struct{}
+
+func (PostgresStore) pool(ctx context.Context) error {
+	cctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	return db.Connect(cctx)
+}
+
+const userColumns = `id, email, password_hash, email_verified_at, created_at`
+
+func scanUser(row pgx.Row) (*User, error) {
+	var u User
+	if err := row.Scan(&u.ID, &u.Email, &u.PasswordHash, &u.EmailVerifiedAt, &u.CreatedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &u, nil
+}
+
+// CreateUser implements Store.
+func (s PostgresStore) CreateUser(ctx context.Context, email, passwordHash string) (*User, error) {
+	if err := s.pool(ctx); err != nil {
+		return nil, err
+	}
+	u, err := scanUser(db.Pool().QueryRow(ctx, `INSERT INTO users (email, password_hash) VALUES ($1, $2) RETURNING `+userColumns, email, passwordHash))
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return nil, ErrEmailTaken
+	}
+	return u, err
+}
+
+// UserByEmail implements Store.
+func (s PostgresStore) UserByEmail(ctx context.Context, email string) (*User, error) {
+	if err := s.pool(ctx); err != nil {
+		return nil, err
+	}
+	return scanUser(db.Pool().QueryRow(ctx, `SELECT `+userColumns+` FROM users WHERE email = $1`, email))
+}
+
+// UserByID implements Store.
+func (s PostgresStore) UserByID(ctx context.Context, id int64) (*User, error) {
+	if err := s.pool(ctx); err != nil {
+		return nil, err
+	}
+	return scanUser(db.Pool().QueryRow(ctx, `SELECT `+userColumns+` FROM users WHERE id = $1`, id))
+}
+
+// SetPasswordHash implements Store.
+func (s PostgresStore) SetPasswordHash(ctx context.Context, id int64, hash string) error {
+	if err := s.pool(ctx); err != nil {
+		return err
+	}
+	_, err := db.Pool().Exec(ctx, `UPDATE users SET password_hash = $2, updated_at = now() WHERE id = $1`, id, hash)
+	return err
+}
+
+// MarkVerified implements Store.
+func (s PostgresStore) MarkVerified(ctx context.Context, id int64, at time.Time) error {
+	if err := s.pool(ctx); err != nil {
+		return err
+	}
+	_, err := db.Pool().Exec(ctx, `UPDATE users SET email_verified_at = COALESCE(email_verified_at, $2), updated_at = now() WHERE id = $1`, id, at)
+	return err
+}
+
+// CreateToken implements Store.
+func (s PostgresStore) CreateToken(ctx context.Context, userID int64, purpose string, hash []byte, expires time.Time) error {
+	if err := s.pool(ctx); err != nil {
+		return err
+	}
+	_, err := db.Pool().Exec(ctx, `INSERT INTO user_tokens (user_id, purpose, token_hash, expires_at) VALUES ($1, $2, $3, $4)`, userID, purpose, hash, expires)
+	return err
+}
+
+// ConsumeToken implements Store.
+func (s PostgresStore) ConsumeToken(ctx context.Context, purpose string, hash []byte, now time.Time) (int64, error) {
+	if err := s.pool(ctx); err != nil {
+		return 0, err
+	}
+	var id int64
+	var expires time.Time
+	err := db.Pool().QueryRow(ctx, `DELETE FROM user_tokens WHERE purpose = $1 AND token_hash = $2 RETURNING user_id, expires_at`, purpose, hash).Scan(&id, &expires)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && !now.Before(expires)) {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// DeleteTokens implements Store.
+func (s PostgresStore) DeleteTokens(ctx context.Context, userID int64, purpose string) error {
+	if err := s.pool(ctx); err != nil {
+		return err
+	}
+	_, err := db.Pool().Exec(ctx, `DELETE FROM user_tokens WHERE user_id = $1 AND purpose = $2`, userID, purpose)
+	return err
+}
+
+// MemoryStore keeps accounts in process memory: for development without DATABASE_URL and
+// for tests. Everything is lost on restart.
+type MemoryStore struct {
+	mu     sync.Mutex
+	nextID int64
+	users  map[int64]*User
+	tokens map[string]memToken
+}
+
+type memToken struct {
+	userID  int64
+	expires time.Time
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{users: map[int64]*User{}, tokens: map[string]memToken{}}
+}
+
+func tokenKey(purpose string, hash []byte) string { return purpose + ":" + hex.EncodeToString(hash) }
+
+// CreateUser implements Store.
+func (m *MemoryStore) CreateUser(_ context.Context, email, passwordHash string) (*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, u := range m.users {
+		if u.Email == email {
+			return nil, ErrEmailTaken
+		}
+	}
+	m.nextID++
+	u := &User{ID: m.nextID, Email: email, PasswordHash: passwordHash, CreatedAt: time.Now()}
+	m.users[u.ID] = u
+	c := *u
+	return &c, nil
+}
+
+// UserByEmail implements Store.
+func (m *MemoryStore) UserByEmail(_ context.Context, email string) (*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, u := range m.users {
+		if u.Email == email {
+			c := *u
+			return &c, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// UserByID implements Store.
+func (m *MemoryStore) UserByID(_ context.Context, id int64) (*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	c := *u
+	return &c, nil
+}
+
+// SetPasswordHash implements Store.
+func (m *MemoryStore) SetPasswordHash(_ context.Context, id int64, hash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	u.PasswordHash = hash
+	return nil
+}
+
+// MarkVerified implements Store.
+func (m *MemoryStore) MarkVerified(_ context.Context, id int64, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if u.EmailVerifiedAt == nil {
+		u.EmailVerifiedAt = &at
+	}
+	return nil
+}
+
+// CreateToken implements Store.
+func (m *MemoryStore) CreateToken(_ context.Context, userID int64, purpose string, hash []byte, expires time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tokens[tokenKey(purpose, hash)] = memToken{userID: userID, expires: expires}
+	return nil
+}
+
+// ConsumeToken implements Store.
+func (m *MemoryStore) ConsumeToken(_ context.Context, purpose string, hash []byte, now time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := tokenKey(purpose, hash)
+	t, ok := m.tokens[k]
+	delete(m.tokens, k)
+	if !ok || !now.Before(t.expires) {
+		return 0, ErrNotFound
+	}
+	return t.userID, nil
+}
+
+// DeleteTokens implements Store.
+func (m *MemoryStore) DeleteTokens(_ context.Context, userID int64, purpose string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for k, t := range m.tokens {
+		if t.userID == userID && strings.HasPrefix(k, purpose+":") {
+			delete(m.tokens, k)
+		}
+	}
+	return nil
+}
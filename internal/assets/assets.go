@@ -0,0 +1,151 @@
+// Package assets fingerprints the files served under /static so they can be cached forever.
+//
+// Every file in app/static (at the root) and app/styles (under "styles/") gets a content-hashed
+// name, e.g. "app.js" -> "app.3f2a1b9c0d.js". Templates link through templates.Asset("app.js"),
+// which returns the hashed URL; the handler serves hashed paths with a one-year immutable
+// Cache-Control and plain paths with a short one, so a deploy never leaves stale CSS or JS in
+// browsers or at the CDN.
+//
+// `gforge build` writes the mapping to app/static/manifest.json before compiling, so it is
+// embedded with the files; without it the server hashes the files once at startup. devfs builds
+// (gforge dev) skip fingerprinting and serve everything with Cache-Control: no-cache. The build
+// also writes .br/.gz siblings (Compress) that Handler negotiates by Accept-Encoding.
+package assets
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ManifestFile is the manifest's name inside app/static.
+const ManifestFile = "manifest.json"
+
+// Prefix is the URL prefix assets are served under.
+const Prefix = "/static/"
+
+// Manifest maps logical names ("app.js", "styles/output.css") to fingerprinted names.
+type Manifest map[string]string
+
+var (
+	mu      sync.RWMutex
+	current = Manifest{}
+	reverse = map[string]string{}
+	dev     bool
+)
+
+// Generate hashes every file in static and styles (styles entries are prefixed "styles/").
+// Either FS may be nil.
+func Generate(static, styles fs.FS) (Manifest, error) {
+	m := Manifest{}
+	add := func(fsys fs.FS, prefix string) error {
+		if fsys == nil {
+			return nil
+		}
+		return fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || (prefix == "" && p == ManifestFile) || strings.HasPrefix(d.Name(), ".") || isSibling(p) {
+				return nil
+			}
+			b, err := fs.ReadFile(fsys, p)
+			if err != nil {
+				return err
+			}
+			m[prefix+p] = Fingerprint(prefix+p, b)
+			return nil
+		})
+	}
+	if err := add(static, ""); err != nil {
+		return nil, err
+	}
+	if err := add(styles, "styles/"); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Fingerprint returns name with the first 10 hex digits of the SHA-256 of content inserted
+// before the extension: "styles/output.css" -> "styles/output.1a2b3c4d5e.css".
+func Fingerprint(name string, content []byte) string {
+	sum := sha256.Sum256(content)
+	h := hex.EncodeToString(sum[:])[:10]
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + h + ext
+}
+
+// Marshal renders m as indented JSON with sorted keys.
+func (m Manifest) Marshal() ([]byte, error) { return json.MarshalIndent(m, "", "  ") }
+
+// Names returns the logical names in m, sorted.
+func (m Manifest) Names() []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Load reads the manifest from static, falling back to hashing static and styles when it is
+// absent.
+func Load(static, styles fs.FS) (Manifest, error) {
+	b, err := fs.ReadFile(static, ManifestFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Generate(static, styles)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Use installs m as the active manifest. devMode disables fingerprinted URLs.
+func Use(m Manifest, devMode bool) {
+	rev := make(map[string]string, len(m))
+	for k, v := range m {
+		rev[v] = k
+	}
+	mu.Lock()
+	current, reverse, dev = m, rev, devMode
+	mu.Unlock()
+}
+
+// URL returns the URL for a logical asset name ("app.js", "styles/output.css"): the
+// fingerprinted path when known, the plain /static path otherwise.
+func URL(name string) string {
+	name = strings.TrimPrefix(name, "/")
+	mu.RLock()
+	hashed, ok := current[name]
+	d := dev
+	mu.RUnlock()
+	if ok && !d {
+		return Prefix + hashed
+	}
+	return Prefix + name
+}
+
+// resolve maps a fingerprinted name back to its logical name.
+func resolve(name string) (string, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	orig, ok := reverse[name]
+	return orig, ok
+}
+
+func isDev() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return dev
+}
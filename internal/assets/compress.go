@@ -0,0 +1,102 @@
+package assets
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Precompressed sibling extensions, in server preference order.
+var encodings = []struct{ name, ext string }{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// compressible lists extensions worth precompressing (images and fonts are already compressed).
+var compressible = map[string]bool{
+	".css": true, ".js": true, ".mjs": true, ".map": true, ".json": true, ".svg": true,
+	".txt": true, ".xml": true, ".html": true, ".wasm": true,
+}
+
+// minCompressSize skips files too small to benefit.
+const minCompressSize = 256
+
+// isSibling reports whether name is a precompressed sibling (x.js.br, x.css.gz).
+func isSibling(name string) bool {
+	ext := filepath.Ext(name)
+	return (ext == ".br" || ext == ".gz") && compressible[filepath.Ext(strings.TrimSuffix(name, ext))]
+}
+
+// Compress writes name.br (brotli level 11) and name.gz (gzip best) next to every compressible
+// file in dir, keeping a sibling only when it is smaller than the original. Siblings whose
+// original is gone are removed. It returns the number of siblings written.
+func Compress(dir string) (int, error) {
+	n := 0
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if isSibling(p) {
+			if _, err := os.Stat(strings.TrimSuffix(p, filepath.Ext(p))); errors.Is(err, fs.ErrNotExist) {
+				return os.Remove(p)
+			}
+			return nil
+		}
+		if !compressible[filepath.Ext(p)] {
+			return nil
+		}
+		src, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		for _, enc := range encodings {
+			out := p + enc.ext
+			if len(src) < minCompressSize {
+				_ = os.Remove(out)
+				continue
+			}
+			b, err := encode(enc.name, src)
+			if err != nil {
+				return err
+			}
+			if len(b) >= len(src) {
+				_ = os.Remove(out)
+				continue
+			}
+			if err := os.WriteFile(out, b, 0o644); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+func encode(enc string, src []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	if enc == "br" {
+		w = brotli.NewWriterLevel(&buf, brotli.BestCompression)
+	} else {
+		gz, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+		if err != nil {
+			return nil, err
+		}
+		w = gz
+	}
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,126 @@
+package assets
+
+import (
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// Cache-Control values for fingerprinted and plain asset paths.
+const (
+	CacheImmutable = "public, max-age=31536000, immutable"
+	CacheShort     = "public, max-age=300"
+	CacheDev       = "no-cache"
+)
+
+// dynamicLevel is the gzip/deflate level for files without a precompressed sibling.
+const dynamicLevel = 5
+
+// Handler serves static (and styles under "styles/") for requests with Prefix stripped.
+// Fingerprinted names are resolved to their file and marked immutable. When the client accepts
+// it and the build produced one (see Compress), a .br or .gz sibling is served with
+// Content-Encoding, the original Content-Type and Vary: Accept-Encoding. Other files (plain
+// `go build`, assets added after the build) are compressed on the fly.
+func Handler(static, styles fs.FS) http.Handler {
+	compress := middleware.Compress(dynamicLevel)
+	staticH := compress(http.FileServerFS(static))
+	stylesH := compress(http.StripPrefix("/styles", http.FileServerFS(styles)))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/")
+		cc := CacheShort
+		dev := isDev()
+		switch {
+		case dev:
+			cc = CacheDev
+		default:
+			if orig, ok := resolve(name); ok {
+				r2 := r.Clone(r.Context())
+				r2.URL.Path = "/" + orig
+				r2.URL.RawPath = ""
+				r, name, cc = r2, orig, CacheImmutable
+			}
+		}
+		w.Header().Set("Cache-Control", cc)
+		fsys, rel, h := static, name, http.Handler(staticH)
+		if strings.HasPrefix(name, "styles/") {
+			fsys, rel, h = styles, strings.TrimPrefix(name, "styles/"), stylesH
+		}
+		// Dev serves from disk, where siblings from an earlier build may be stale.
+		if !dev && compressible[path.Ext(rel)] && servePrecompressed(w, r, fsys, rel) {
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// servePrecompressed serves rel's preferred sibling accepted by the client. It reports false
+// when no sibling exists or none is acceptable; Vary is still set if a sibling exists.
+func servePrecompressed(w http.ResponseWriter, r *http.Request, fsys fs.FS, rel string) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	accept := r.Header.Get("Accept-Encoding")
+	found := false
+	for _, enc := range encodings {
+		f, err := fsys.Open(rel + enc.ext)
+		if err != nil {
+			continue
+		}
+		found = true
+		rs, ok := f.(io.ReadSeeker)
+		if !ok || !acceptsEncoding(accept, enc.name) {
+			f.Close()
+			continue
+		}
+		defer f.Close()
+		w.Header().Add("Vary", "Accept-Encoding")
+		serveEncoded(w, r, f, rs, rel, enc.name)
+		return true
+	}
+	if found {
+		w.Header().Add("Vary", "Accept-Encoding")
+	}
+	return false
+}
+
+func serveEncoded(w http.ResponseWriter, r *http.Request, f fs.File, rs io.ReadSeeker, rel, enc string) {
+	var mod time.Time
+	if st, err := f.Stat(); err == nil {
+		mod = st.ModTime()
+	}
+	ct := mime.TypeByExtension(path.Ext(rel))
+	if ct == "" {
+		ct = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", ct)
+	w.Header().Set("Content-Encoding", enc)
+	http.ServeContent(w, r, rel, mod, rs)
+}
+
+// acceptsEncoding reports whether an Accept-Encoding header allows enc (q > 0, directly or via *).
+func acceptsEncoding(header, enc string) bool {
+	star := false
+	for _, part := range strings.Split(header, ",") {
+		token, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		switch {
+		case strings.EqualFold(token, enc):
+			return q > 0
+		case token == "*":
+			star = q > 0
+		}
+	}
+	return star
+}
@@ -1,37 +1,165 @@
 package auth
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/go-chi/jwtauth/v5"
-	"gothicforge3/internal/env"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"gothicforge3/internal/config"
 )
 
-var tokenAuth *jwtauth.JWTAuth
+// keyring is the signing key and the keys accepted for verification.
+type keyring struct {
+	alg      jwa.SignatureAlgorithm
+	sign     jwk.Key
+	verify   jwk.Set // active HMAC secrets and public keys
+	public   jwk.Set // public halves of active RS256/EdDSA keys (JWKS)
+	issuer   string
+	audience []string
+}
+
+var errNoSigningKey = errors.New("auth: no signing key")
+
+var (
+	mu           sync.RWMutex
+	ring         *keyring
+	secureCookie bool
+
+	sessions              SessionStore
+	accessTTL, refreshTTL time.Duration
+)
+
+// Init loads the JWT keys: the key set in cfg.JWTKeysFile when set, otherwise an HS256 key
+// from cfg.JWTSecret (or, for JWT_ALG=RS256/EdDSA in development, a key generated for this
+// process). On error development falls back to JWT_SECRET so the server still starts, while
+// production signs nothing and rejects every token (cmd/server exits first, see CheckKeys).
+// It also selects the session store (AUTH_SESSION_STORE), token lifetimes and the built-in
+// sign-in providers.
+func Init(cfg *config.Config) error {
+	mu.Lock()
+	secureCookie = cfg.IsProduction()
+	mu.Unlock()
+	initSessions(cfg)
+	initProviders(cfg)
+	now := time.Now()
+	r, err := loadKeyring(cfg, now)
+	if err != nil {
+		if cfg.IsProduction() {
+			// config.jwtProblems does not vet JWT_SECRET once JWT_KEYS_FILE is set.
+			r = &keyring{verify: jwk.NewSet(), public: jwk.NewSet()}
+		} else {
+			r, _ = newKeyring([]StoredKey{SecretKey("", cfg.JWTSecret, now)})
+		}
+	}
+	r.issuer, r.audience = cfg.JWTIssuer, cfg.JWTAudience
+	mu.Lock()
+	ring = r
+	mu.Unlock()
+	return err
+}
+
+// CheckKeys reports whether Init would load cfg's signing keys, without installing them.
+func CheckKeys(cfg *config.Config) error {
+	_, err := loadKeyring(cfg, time.Now())
+	return err
+}
 
-// Init initializes the JWT signer using JWT_SECRET.
-func Init() {
-	secret := env.Get("JWT_SECRET", "devsecret-change-me")
-	tokenAuth = jwtauth.New("HS256", []byte(secret), nil)
+func loadKeyring(cfg *config.Config, now time.Time) (*keyring, error) {
+	var keys []StoredKey
+	var err error
+	switch {
+	case cfg.JWTKeysFile != "":
+		var f *KeyFile
+		if f, err = ReadKeyFile(cfg.JWTKeysFile); err == nil {
+			keys = f.Active(now)
+			if _, ok := f.Signing(now); !ok {
+				err = fmt.Errorf("%s: no active signing key (run `gforge secrets rotate-jwt`)", cfg.JWTKeysFile)
+			}
+		}
+	case !strings.EqualFold(cfg.JWTAlg, HS256):
+		var k StoredKey
+		if k, err = GenerateKey(cfg.JWTAlg, now); err == nil {
+			keys = []StoredKey{k}
+			slog.Warn("auth: JWT_KEYS_FILE is empty; using a key generated at startup (tokens do not survive restarts)", "alg", k.Alg)
+		}
+	default:
+		keys = []StoredKey{SecretKey("", cfg.JWTSecret, now)}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newKeyring(keys)
+}
+
+// newKeyring signs with the first key without RetireAt (keys are newest first).
+func newKeyring(keys []StoredKey) (*keyring, error) {
+	r := &keyring{verify: jwk.NewSet(), public: jwk.NewSet()}
+	for _, k := range keys {
+		key, err := k.jwk()
+		if err != nil {
+			return nil, err
+		}
+		if r.sign == nil && k.RetireAt == nil {
+			r.sign, r.alg = key, jwa.SignatureAlgorithm(key.Algorithm().String())
+		}
+		if k.Alg == HS256 {
+			_ = r.verify.AddKey(key)
+			continue
+		}
+		pub, err := key.PublicKey()
+		if err != nil {
+			return nil, err
+		}
+		_ = r.verify.AddKey(pub)
+		_ = r.public.AddKey(pub)
+	}
+	if r.sign == nil {
+		return nil, errNoSigningKey
+	}
+	return r, nil
 }
 
-// TokenAuth returns the configured JWT auth instance.
-func TokenAuth() *jwtauth.JWTAuth {
-	if tokenAuth == nil {
-		Init()
+func current() *keyring {
+	mu.RLock()
+	r := ring
+	mu.RUnlock()
+	if r == nil {
+		_ = Init(config.Current())
+		mu.RLock()
+		r = ring
+		mu.RUnlock()
 	}
-	return tokenAuth
+	return r
 }
 
-// Issue creates a signed JWT string with standard claims and provided custom claims.
+// Issue creates a signed JWT with exp, iat, the configured iss/aud and the given claims. The
+// header names the signing key ("kid") when it comes from a key file.
 func Issue(ttl time.Duration, claims map[string]any) (string, time.Time, error) {
-	ta := TokenAuth()
-	exp := time.Now().Add(ttl)
-	std := map[string]any{
-		"exp": exp.Unix(),
-		"iat": time.Now().Unix(),
+	r := current()
+	if r.sign == nil {
+		return "", time.Time{}, errNoSigningKey
+	}
+	now := time.Now()
+	exp := now.Add(ttl)
+	tok := jwt.New()
+	_ = tok.Set(jwt.IssuedAtKey, now)
+	_ = tok.Set(jwt.ExpirationKey, exp)
+	if r.issuer != "" {
+		_ = tok.Set(jwt.IssuerKey, r.issuer)
+	}
+	if len(r.audience) > 0 {
+		_ = tok.Set(jwt.AudienceKey, r.audience)
 	}
 	for k, v := range claims {
 		if k == "sub" {
@@ -39,10 +167,18 @@ func Issue(ttl time.Duration, claims map[string]any) (string, time.Time, error)
 				v = fmt.Sprint(v)
 			}
 		}
-		std[k] = v
+		if err := tok.Set(k, v); err != nil {
+			return "", time.Time{}, fmt.Errorf("auth: claim %q: %w", k, err)
+		}
 	}
-	_, t, err := ta.Encode(std)
-	return t, exp, err
+	signed, err := jwt.Sign(tok, jwt.WithKey(r.alg, r.sign))
+	return string(signed), exp, err
+}
+
+// JWKS returns the public verification keys as a JSON Web Key Set, for other services to
+// verify our tokens. HMAC keys are never published, so HS256-only setups serve no keys.
+func JWKS() ([]byte, error) {
+	return json.Marshal(current().public)
 }
 
 // SetJWTCookie writes a JWT as an HttpOnly cookie, SameSite=Lax, Secure in prod.
@@ -55,26 +191,69 @@ func SetJWTCookie(w http.ResponseWriter, name, token string, exp time.Time) {
 		SameSite: http.SameSiteLaxMode,
 		Expires:  exp,
 	}
-	if env.Get("APP_ENV", "development") == "production" {
-		c.Secure = true
-	}
+	mu.RLock()
+	c.Secure = secureCookie
+	mu.RUnlock()
 	http.SetCookie(w, c)
 }
 
-// ReadAndVerifyCookie reads a cookie and verifies the JWT.
+// ReadAndVerifyCookie reads a cookie and verifies the JWT. Prefer RequireAuth/OptionalAuth
+// and FromContext in handlers.
 func ReadAndVerifyCookie(r *http.Request, name string) (map[string]any, error) {
 	ck, err := r.Cookie(name)
 	if err != nil {
 		return nil, err
 	}
-	ta := TokenAuth()
-	tok, err := jwtauth.VerifyToken(ta, ck.Value)
+	return Verify(r.Context(), ck.Value)
+}
+
+// Subject returns the verified "sub" claim from an "Authorization: Bearer" header or the
+// gf_jwt cookie, or "" for anonymous requests.
+func Subject(r *http.Request) string {
+	c, err := Authenticate(r)
+	if err != nil {
+		return ""
+	}
+	return c.Subject
+}
+
+// Verify checks a raw JWT against the active keys (the "kid" header picks the key; tokens
+// without one are tried against every key), its expiry, the configured issuer and audience,
+// and that its session ("sid") is not revoked, and returns its claims.
+func Verify(ctx context.Context, raw string) (map[string]any, error) {
+	r := current()
+	msg, err := jws.ParseString(raw)
+	if err != nil {
+		return nil, err
+	}
+	ks := jwt.WithKeySet(r.verify)
+	if sigs := msg.Signatures(); len(sigs) == 0 || sigs[0].ProtectedHeaders().KeyID() == "" {
+		ks = jwt.WithKeySet(r.verify, jws.WithRequireKid(false))
+	}
+	opts := []jwt.ParseOption{ks, jwt.WithValidate(true)}
+	if r.issuer != "" {
+		opts = append(opts, jwt.WithIssuer(r.issuer))
+	}
+	if len(r.audience) > 0 {
+		opts = append(opts, jwt.WithValidator(jwt.ValidatorFunc(func(_ context.Context, t jwt.Token) jwt.ValidationError {
+			for _, a := range t.Audience() {
+				if slices.Contains(r.audience, a) {
+					return nil
+				}
+			}
+			return jwt.ErrInvalidAudience()
+		})))
+	}
+	tok, err := jwt.ParseString(raw, opts...)
 	if err != nil {
 		return nil, err
 	}
-	claims, err := tok.AsMap(r.Context())
+	claims, err := tok.AsMap(ctx)
 	if err != nil {
 		return nil, err
 	}
+	if err := checkSession(ctx, claims); err != nil {
+		return nil, err
+	}
 	return claims, nil
 }
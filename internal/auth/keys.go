@@ -0,0 +1,214 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+)
+
+// Signing algorithms supported for JWT_ALG and key files.
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	EdDSA = "EdDSA"
+)
+
+// LegacyKID names the JWT_SECRET key imported by the first rotation, so tokens issued before
+// the key file existed stay valid for the grace period.
+const LegacyKID = "legacy"
+
+// StoredKey is one key in a JWT_KEYS_FILE.
+type StoredKey struct {
+	KID       string     `json:"kid"`
+	Alg       string     `json:"alg"`
+	Key       string     `json:"key"` // PKCS#8 PEM private key, or the base64url secret for HS256
+	CreatedAt time.Time  `json:"created_at"`
+	RetireAt  *time.Time `json:"retire_at,omitempty"` // verify-only until then, dropped after
+}
+
+// KeyFile is the JWT_KEYS_FILE document. The newest key without RetireAt signs; every key not
+// yet retired verifies.
+type KeyFile struct {
+	Keys []StoredKey `json:"keys"`
+}
+
+// ReadKeyFile loads a key file. A missing file is an empty KeyFile and os.ErrNotExist.
+func ReadKeyFile(path string) (*KeyFile, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return &KeyFile{}, err
+	}
+	var f KeyFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &f, nil
+}
+
+// Write saves the key file with mode 0600, replacing it atomically.
+func (f *KeyFile) Write(path string) error {
+	b, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(b, '\n'), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Active returns the keys not retired at now, newest first.
+func (f *KeyFile) Active(now time.Time) []StoredKey {
+	out := make([]StoredKey, 0, len(f.Keys))
+	for _, k := range f.Keys {
+		if k.RetireAt == nil || now.Before(*k.RetireAt) {
+			out = append(out, k)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out
+}
+
+// Signing returns the newest key that is not being retired.
+func (f *KeyFile) Signing(now time.Time) (StoredKey, bool) {
+	for _, k := range f.Active(now) {
+		if k.RetireAt == nil {
+			return k, true
+		}
+	}
+	return StoredKey{}, false
+}
+
+// Rotate adds a new alg key as the signing key. Current signing keys stay valid for grace;
+// keys already retired are removed.
+func (f *KeyFile) Rotate(alg string, grace time.Duration, now time.Time) (StoredKey, error) {
+	k, err := GenerateKey(alg, now)
+	if err != nil {
+		return StoredKey{}, err
+	}
+	retire := now.Add(grace)
+	kept := f.Active(now)
+	for i := range kept {
+		if kept[i].RetireAt == nil {
+			kept[i].RetireAt = &retire
+		}
+	}
+	f.Keys = append([]StoredKey{k}, kept...)
+	return k, nil
+}
+
+// GenerateKey creates a key for alg: Ed25519, RSA-2048 or a 32-byte HMAC secret.
+func GenerateKey(alg string, now time.Time) (StoredKey, error) {
+	alg, err := normalizeAlg(alg)
+	if err != nil {
+		return StoredKey{}, err
+	}
+	var raw any
+	switch alg {
+	case EdDSA:
+		_, raw, err = ed25519.GenerateKey(rand.Reader)
+	case RS256:
+		raw, err = rsa.GenerateKey(rand.Reader, 2048)
+	default:
+		secret := make([]byte, 32)
+		_, err = rand.Read(secret)
+		raw = secret
+	}
+	if err != nil {
+		return StoredKey{}, err
+	}
+	k := StoredKey{KID: newKID(now), Alg: alg, CreatedAt: now.UTC()}
+	if secret, ok := raw.([]byte); ok {
+		k.Key = base64.RawURLEncoding.EncodeToString(secret)
+		return k, nil
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(raw)
+	if err != nil {
+		return StoredKey{}, err
+	}
+	k.Key = string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	return k, nil
+}
+
+// SecretKey wraps an HMAC secret (e.g. JWT_SECRET) as a StoredKey.
+func SecretKey(kid, secret string, now time.Time) StoredKey {
+	return StoredKey{KID: kid, Alg: HS256, Key: base64.RawURLEncoding.EncodeToString([]byte(secret)), CreatedAt: now.UTC()}
+}
+
+func newKID(now time.Time) string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return now.UTC().Format("20060102") + "-" + hex.EncodeToString(b)
+}
+
+func normalizeAlg(alg string) (string, error) {
+	for _, a := range []string{HS256, RS256, EdDSA} {
+		if strings.EqualFold(alg, a) {
+			return a, nil
+		}
+	}
+	return "", fmt.Errorf("auth: unsupported JWT algorithm %q (want HS256, RS256 or EdDSA)", alg)
+}
+
+// jwk returns the signing key as a JWK carrying kid and alg.
+func (k StoredKey) jwk() (jwk.Key, error) {
+	alg, err := normalizeAlg(k.Alg)
+	if err != nil {
+		return nil, err
+	}
+	var raw any
+	if alg == HS256 {
+		if raw, err = base64.RawURLEncoding.DecodeString(k.Key); err != nil {
+			return nil, fmt.Errorf("auth: key %q: %w", k.KID, err)
+		}
+	} else {
+		block, _ := pem.Decode([]byte(k.Key))
+		if block == nil {
+			return nil, fmt.Errorf("auth: key %q: no PEM block", k.KID)
+		}
+		if raw, err = x509.ParsePKCS8PrivateKey(block.Bytes); err != nil {
+			return nil, fmt.Errorf("auth: key %q: %w", k.KID, err)
+		}
+		switch raw.(type) {
+		case ed25519.PrivateKey:
+			if alg != EdDSA {
+				return nil, fmt.Errorf("auth: key %q: Ed25519 key used with %s", k.KID, alg)
+			}
+		case *rsa.PrivateKey:
+			if alg != RS256 {
+				return nil, fmt.Errorf("auth: key %q: RSA key used with %s", k.KID, alg)
+			}
+		default:
+			return nil, errors.New("auth: key " + k.KID + ": unsupported key type")
+		}
+	}
+	key, err := jwk.FromRaw(raw)
+	if err != nil {
+		return nil, err
+	}
+	if k.KID != "" {
+		_ = key.Set(jwk.KeyIDKey, k.KID)
+	}
+	_ = key.Set(jwk.AlgorithmKey, jwa.SignatureAlgorithm(alg))
+	_ = key.Set(jwk.KeyUsageKey, jwk.ForSignature)
+	return key, nil
+}
@@ -0,0 +1,276 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CookieName is the cookie holding the session JWT (see SetJWTCookie).
+const CookieName = "gf_jwt"
+
+// ErrNoToken is returned by Authenticate when the request carries no JWT.
+var ErrNoToken = errors.New("auth: no token")
+
+// Claims are the verified claims of a gf_jwt token. Well-known claims have fields; Raw keeps
+// every claim, including custom ones passed to Issue.
+type Claims struct {
+	Subject       string // "sub": user id (accounts) or provider id (OAuth)
+	Email         string
+	EmailVerified bool
+	Provider      string // "password", "github", ...
+	Login         string // provider username, when known
+	Name          string
+	IssuedAt      time.Time
+	ExpiresAt     time.Time
+	Raw           map[string]any
+}
+
+// UserID parses Subject as a numeric account id (internal/accounts users).
+func (c *Claims) UserID() (int64, error) { return strconv.ParseInt(c.Subject, 10, 64) }
+
+// ClaimsFromMap builds Claims from a verified claim set.
+func ClaimsFromMap(m map[string]any) *Claims {
+	c := &Claims{Raw: m}
+	c.Subject, _ = m["sub"].(string)
+	c.Email, _ = m["email"].(string)
+	c.EmailVerified, _ = m["email_verified"].(bool)
+	c.Provider, _ = m["provider"].(string)
+	c.Login, _ = m["login"].(string)
+	c.Name, _ = m["name"].(string)
+	c.IssuedAt = claimTime(m["iat"])
+	c.ExpiresAt = claimTime(m["exp"])
+	return c
+}
+
+func claimTime(v any) time.Time {
+	switch t := v.(type) {
+	case time.Time:
+		return t
+	case float64:
+		return time.Unix(int64(t), 0)
+	case int64:
+		return time.Unix(t, 0)
+	case json.Number:
+		n, _ := t.Int64()
+		return time.Unix(n, 0)
+	}
+	return time.Time{}
+}
+
+type claimsKey struct{}
+
+// FromContext returns the claims stored by RequireAuth or OptionalAuth.
+func FromContext(ctx context.Context) (*Claims, bool) {
+	c, ok := ctx.Value(claimsKey{}).(*Claims)
+	return c, ok && c != nil
+}
+
+// WithClaims returns a copy of ctx carrying c (tests, custom middleware).
+func WithClaims(ctx context.Context, c *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, c)
+}
+
+// Token returns the raw JWT from an "Authorization: Bearer" header or the gf_jwt cookie, and
+// whether it came from the header.
+func Token(r *http.Request) (raw string, bearer bool) {
+	if h := r.Header.Get("Authorization"); len(h) > 7 && strings.EqualFold(h[:7], "bearer ") {
+		return strings.TrimSpace(h[7:]), true
+	}
+	if ck, err := r.Cookie(CookieName); err == nil {
+		return ck.Value, false
+	}
+	return "", false
+}
+
+type memoKey struct{}
+
+// verifyMemo holds the outcome of the first Authenticate of a request.
+type verifyMemo struct {
+	mu     sync.Mutex
+	done   bool
+	claims *Claims
+	err    error
+}
+
+// Memoize makes every Authenticate of a request share one verification, and so one session
+// store lookup: the request logger, subject rate limits, RequireAuth and handlers all ask.
+// server.New installs it ahead of logging.
+func Memoize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), memoKey{}, &verifyMemo{})))
+	})
+}
+
+// remember records c as the request's verified claims (after a refresh renewed them).
+func remember(r *http.Request, c *Claims) {
+	if m, ok := r.Context().Value(memoKey{}).(*verifyMemo); ok {
+		m.mu.Lock()
+		m.done, m.claims, m.err = true, c, nil
+		m.mu.Unlock()
+	}
+}
+
+// Authenticate verifies the request's JWT (see Token). Claims already in the context, or
+// verified earlier in the same request under Memoize, are returned without verifying again.
+func Authenticate(r *http.Request) (*Claims, error) {
+	if c, ok := FromContext(r.Context()); ok {
+		return c, nil
+	}
+	m, ok := r.Context().Value(memoKey{}).(*verifyMemo)
+	if !ok {
+		return verifyRequest(r)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.done {
+		m.claims, m.err = verifyRequest(r)
+		m.done = true
+	}
+	return m.claims, m.err
+}
+
+func verifyRequest(r *http.Request) (*Claims, error) {
+	raw, _ := Token(r)
+	if raw == "" {
+		return nil, ErrNoToken
+	}
+	m, err := Verify(r.Context(), raw)
+	if err != nil {
+		return nil, err
+	}
+	return ClaimsFromMap(m), nil
+}
+
+// AuthOptions configures RequireAuthWith.
+type AuthOptions struct {
+	// LoginPath is where HTML and HTMX requests are sent, with ?next=<path> (default "/login").
+	LoginPath string
+	// Unauthorized replaces the default response entirely when set.
+	Unauthorized func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+// authenticate is Authenticate for cookie sessions: a missing, expired or revoked gf_jwt is
+// renewed from the gf_refresh cookie (Refresh), writing both cookies to w. Cookies of a dead
+// session are cleared.
+func authenticate(w http.ResponseWriter, r *http.Request) (*Claims, error) {
+	c, err := Authenticate(r)
+	if err == nil {
+		return c, nil
+	}
+	if _, bearer := Token(r); bearer {
+		return nil, err
+	}
+	ck, cerr := r.Cookie(RefreshCookieName)
+	if cerr != nil || ck.Value == "" {
+		return nil, err
+	}
+	t, rerr := Refresh(r.Context(), ck.Value)
+	if rerr != nil {
+		if errors.Is(rerr, ErrRefreshInvalid) || errors.Is(rerr, ErrRefreshReused) {
+			ClearSessionCookies(w)
+		}
+		return nil, err
+	}
+	SetSessionCookies(w, t)
+	m, err := Verify(r.Context(), t.Access)
+	if err != nil {
+		return nil, err
+	}
+	c = ClaimsFromMap(m)
+	remember(r, c)
+	return c, nil
+}
+
+// OptionalAuth stores the claims of a valid JWT in the request context and otherwise lets the
+// request through anonymously. An expired gf_jwt is renewed from the gf_refresh cookie.
+func OptionalAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c, err := authenticate(w, r); err == nil {
+			r = r.WithContext(WithClaims(r.Context(), c))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireAuth rejects requests without a valid JWT (cookie or bearer) using the default
+// responses of RequireAuthWith, and stores the claims for FromContext. An expired gf_jwt is
+// renewed from the gf_refresh cookie.
+func RequireAuth(next http.Handler) http.Handler { return RequireAuthWith(AuthOptions{})(next) }
+
+// RequireAuthWith is RequireAuth with options. Unauthenticated requests get:
+//   - HTMX (HX-Request): 401 with HX-Redirect to the login page;
+//   - API (/api/ paths, bearer tokens, or JSON-only Accept): 401 JSON and WWW-Authenticate;
+//   - HTML: 303 to the login page (next is the current URL for GET/HEAD).
+func RequireAuthWith(opts AuthOptions) func(http.Handler) http.Handler {
+	if opts.LoginPath == "" {
+		opts.LoginPath = "/login"
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c, err := authenticate(w, r)
+			if err != nil {
+				if opts.Unauthorized != nil {
+					opts.Unauthorized(w, r, err)
+				} else {
+					unauthorized(w, r, opts.LoginPath, err)
+				}
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(WithClaims(r.Context(), c)))
+		})
+	}
+}
+
+func unauthorized(w http.ResponseWriter, r *http.Request, loginPath string, err error) {
+	w.Header().Set("Cache-Control", "no-store")
+	if r.Header.Get("HX-Request") == "true" {
+		next := r.URL.RequestURI()
+		if cu, perr := url.Parse(r.Header.Get("HX-Current-URL")); perr == nil && cu.Path != "" {
+			next = cu.RequestURI()
+		}
+		w.Header().Set("HX-Redirect", loginURL(loginPath, next))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if wantsJSON(r) {
+		code := "unauthorized"
+		if !errors.Is(err, ErrNoToken) {
+			code = "invalid_token"
+		}
+		w.Header().Set("WWW-Authenticate", `Bearer error="`+code+`"`)
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": code})
+		return
+	}
+	next := ""
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		next = r.URL.RequestURI()
+	}
+	http.Redirect(w, r, loginURL(loginPath, next), http.StatusSeeOther)
+}
+
+func wantsJSON(r *http.Request) bool {
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		return true
+	}
+	if _, bearer := Token(r); bearer {
+		return true
+	}
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "application/json") && !strings.Contains(accept, "text/html")
+}
+
+func loginURL(loginPath, next string) string {
+	if next == "" || next == loginPath {
+		return loginPath
+	}
+	return loginPath + "?next=" + url.QueryEscape(next)
+}
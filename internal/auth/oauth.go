@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// oauthCookieName holds the state of a sign-in in progress between /login and /callback.
+const oauthCookieName = "gf_oauth"
+
+// oauthStateTTL bounds how long the user may take on the provider's consent page.
+const oauthStateTTL = 10 * time.Minute
+
+// ErrOAuthState means the callback does not belong to a sign-in started by this browser
+// (missing or expired gf_oauth cookie, state mismatch).
+var ErrOAuthState = errors.New("auth: oauth state mismatch")
+
+type oauthState struct {
+	Provider string `json:"p"`
+	State    string `json:"s"`
+	Nonce    string `json:"n,omitempty"`
+	Verifier string `json:"v"`
+	Next     string `json:"x,omitempty"`
+	Expires  int64  `json:"e"`
+}
+
+// BeginLogin redirects to the provider's authorization page. redirectURL is the absolute
+// callback URL registered with the provider; next is kept for CompleteLogin. The request is
+// protected by state, PKCE (S256) and, for OpenID providers, a nonce.
+func (p *Provider) BeginLogin(w http.ResponseWriter, r *http.Request, redirectURL, next string) error {
+	conf, _, err := p.oauth2Config(r.Context(), redirectURL)
+	if err != nil {
+		return err
+	}
+	st := oauthState{Provider: p.Name, State: randomToken(24), Verifier: oauth2.GenerateVerifier(), Next: next, Expires: time.Now().Add(oauthStateTTL).Unix()}
+	opts := []oauth2.AuthCodeOption{oauth2.S256ChallengeOption(st.Verifier)}
+	if p.OIDC() {
+		st.Nonce = randomToken(24)
+		opts = append(opts, oauth2.SetAuthURLParam("nonce", st.Nonce))
+	}
+	b, _ := json.Marshal(st)
+	setOAuthCookie(w, base64.RawURLEncoding.EncodeToString(b), int(oauthStateTTL.Seconds()))
+	http.Redirect(w, r, conf.AuthCodeURL(st.State, opts...), http.StatusFound)
+	return nil
+}
+
+// setOAuthCookie writes the gf_oauth state cookie; a negative maxAge clears it with the same
+// attributes it was set with.
+func setOAuthCookie(w http.ResponseWriter, value string, maxAge int) {
+	mu.RLock()
+	secure := secureCookie
+	mu.RUnlock()
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthCookieName,
+		Value:    value,
+		Path:     "/auth/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: http.SameSiteLaxMode, // sent on the provider's top-level redirect back
+	})
+}
+
+// CompleteLogin handles the provider's redirect to the callback: it checks the state,
+// exchanges the code, and validates the ID token (OpenID) or loads the profile (OAuth2). It
+// returns the identity and the next path given to BeginLogin.
+func (p *Provider) CompleteLogin(w http.ResponseWriter, r *http.Request, redirectURL string) (*Identity, string, error) {
+	setOAuthCookie(w, "", -1)
+	st, err := readOAuthState(r)
+	if err != nil || st.Provider != p.Name || time.Now().Unix() > st.Expires ||
+		subtle.ConstantTimeCompare([]byte(st.State), []byte(r.FormValue("state"))) != 1 {
+		return nil, "", ErrOAuthState
+	}
+	if e := r.FormValue("error"); e != "" {
+		return nil, st.Next, fmt.Errorf("auth: %s: %s %s", p.Name, e, r.FormValue("error_description"))
+	}
+	ctx := context.WithValue(r.Context(), oauth2.HTTPClient, p.client())
+	conf, meta, err := p.oauth2Config(ctx, redirectURL)
+	if err != nil {
+		return nil, st.Next, err
+	}
+	tok, err := conf.Exchange(ctx, r.FormValue("code"), oauth2.VerifierOption(st.Verifier))
+	if err != nil {
+		return nil, st.Next, fmt.Errorf("auth: %s token: %w", p.Name, err)
+	}
+	if !p.OIDC() {
+		id, err := p.Profile(ctx, conf.Client(ctx, tok))
+		return id, st.Next, err
+	}
+	raw, _ := tok.Extra("id_token").(string)
+	if raw == "" {
+		return nil, st.Next, fmt.Errorf("auth: %s: no id_token in token response", p.Name)
+	}
+	id, err := p.verifyIDToken(ctx, meta, raw, st.Nonce)
+	return id, st.Next, err
+}
+
+func readOAuthState(r *http.Request) (*oauthState, error) {
+	ck, err := r.Cookie(oauthCookieName)
+	if err != nil {
+		return nil, err
+	}
+	b, err := base64.RawURLEncoding.DecodeString(ck.Value)
+	if err != nil {
+		return nil, err
+	}
+	var st oauthState
+	if err := json.Unmarshal(b, &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"golang.org/x/oauth2"
+)
+
+// oidcMeta is the part of an OpenID Provider Configuration document we use.
+type oidcMeta struct {
+	Issuer   string `json:"issuer"`
+	AuthURL  string `json:"authorization_endpoint"`
+	TokenURL string `json:"token_endpoint"`
+	JWKSURL  string `json:"jwks_uri"`
+}
+
+// tenantIssuer is the issuer placeholder in multi-tenant discovery documents. Only the
+// tenantProvider is trusted to publish one; the ID token's "tid" then fixes the issuer.
+const (
+	tenantIssuer   = "{tenantid}"
+	tenantProvider = "microsoft"
+)
+
+// jwksMinRefresh limits key refetches triggered by unknown keys.
+const jwksMinRefresh = time.Minute
+
+// discover fetches and caches <Issuer>/.well-known/openid-configuration.
+func (p *Provider) discover(ctx context.Context) (*oidcMeta, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.meta != nil {
+		return p.meta, nil
+	}
+	issuer := strings.TrimRight(p.Issuer, "/")
+	var m oidcMeta
+	if err := getJSON(ctx, p.client(), issuer+"/.well-known/openid-configuration", &m); err != nil {
+		return nil, fmt.Errorf("auth: %s discovery: %w", p.Name, err)
+	}
+	if got := strings.TrimRight(m.Issuer, "/"); got != issuer && (p.Name != tenantProvider || !strings.Contains(got, tenantIssuer)) {
+		return nil, fmt.Errorf("auth: %s discovery: issuer %q does not match %q", p.Name, m.Issuer, p.Issuer)
+	}
+	if m.AuthURL == "" || m.TokenURL == "" || m.JWKSURL == "" {
+		return nil, fmt.Errorf("auth: %s discovery: missing endpoints", p.Name)
+	}
+	p.meta = &m
+	return p.meta, nil
+}
+
+// jwks returns the provider's signing keys, refetching them when refresh is set (an unknown
+// key id after rotation) at most once per jwksMinRefresh.
+func (p *Provider) jwks(ctx context.Context, m *oidcMeta, refresh bool) (jwk.Set, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.keys != nil && (!refresh || time.Since(p.keysAt) < jwksMinRefresh) {
+		return p.keys, nil
+	}
+	set, err := jwk.Fetch(ctx, m.JWKSURL, jwk.WithHTTPClient(p.client()))
+	if err != nil {
+		return nil, fmt.Errorf("auth: %s keys: %w", p.Name, err)
+	}
+	p.keys, p.keysAt = set, time.Now()
+	return set, nil
+}
+
+// verifyIDToken validates an ID token (OpenID Connect Core 3.1.3.7): signature by a key of the
+// provider, issuer, audience (and azp), expiry and nonce.
+func (p *Provider) verifyIDToken(ctx context.Context, m *oidcMeta, raw, nonce string) (*Identity, error) {
+	parse := func(refresh bool) (jwt.Token, error) {
+		keys, err := p.jwks(ctx, m, refresh)
+		if err != nil {
+			return nil, err
+		}
+		return jwt.ParseString(raw,
+			jwt.WithKeySet(keys, jws.WithInferAlgorithmFromKey(true)),
+			jwt.WithValidate(true),
+			jwt.WithAudience(p.ClientID),
+			jwt.WithAcceptableSkew(time.Minute),
+			jwt.WithRequiredClaim(jwt.ExpirationKey),
+			jwt.WithRequiredClaim(jwt.IssuedAtKey),
+		)
+	}
+	tok, err := parse(false)
+	if err != nil && !errors.Is(err, jwt.ErrTokenExpired()) {
+		tok, err = parse(true)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("auth: %s id_token: %w", p.Name, err)
+	}
+	claims := tok.PrivateClaims()
+	issuer := m.Issuer
+	if p.Name == tenantProvider && strings.Contains(issuer, tenantIssuer) {
+		tid, _ := claims["tid"].(string)
+		if tid == "" {
+			return nil, fmt.Errorf("auth: %s id_token: no tid for issuer %s", p.Name, issuer)
+		}
+		issuer = strings.Replace(issuer, tenantIssuer, tid, 1)
+	}
+	if strings.TrimRight(tok.Issuer(), "/") != strings.TrimRight(issuer, "/") {
+		return nil, fmt.Errorf("auth: %s id_token: issuer %q, want %q", p.Name, tok.Issuer(), issuer)
+	}
+	if got, _ := claims["nonce"].(string); got == "" || got != nonce {
+		return nil, fmt.Errorf("auth: %s id_token: nonce mismatch", p.Name)
+	}
+	if azp, ok := claims["azp"].(string); len(tok.Audience()) > 1 && (!ok || azp != p.ClientID) {
+		return nil, fmt.Errorf("auth: %s id_token: azp %q is not this client", p.Name, azp)
+	}
+	if tok.Subject() == "" {
+		return nil, fmt.Errorf("auth: %s id_token: no sub", p.Name)
+	}
+	id := &Identity{Provider: p.Name, Subject: tok.Subject()}
+	id.Email, _ = claims["email"].(string)
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		id.EmailVerified = v
+	case string:
+		id.EmailVerified = v == "true"
+	}
+	id.Name, _ = claims["name"].(string)
+	id.Login, _ = claims["preferred_username"].(string)
+	return id, nil
+}
+
+// oauth2Config returns the OAuth2 client for p with the given callback URL.
+func (p *Provider) oauth2Config(ctx context.Context, redirectURL string) (*oauth2.Config, *oidcMeta, error) {
+	c := &oauth2.Config{ClientID: p.ClientID, ClientSecret: p.ClientSecret, RedirectURL: redirectURL, Scopes: p.Scopes, Endpoint: p.Endpoint}
+	if !p.OIDC() {
+		return c, nil, nil
+	}
+	m, err := p.discover(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	c.Endpoint = oauth2.Endpoint{AuthURL: m.AuthURL, TokenURL: m.TokenURL}
+	if len(c.Scopes) == 0 {
+		c.Scopes = []string{"openid", "email", "profile"}
+	}
+	return c, m, nil
+}
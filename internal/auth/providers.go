@@ -0,0 +1,232 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/github"
+	"gothicforge3/internal/config"
+)
+
+// Provider is an OAuth 2.0 or OpenID Connect sign-in provider, mounted at
+// /auth/{Name}/login and /auth/{Name}/callback.
+//
+// OpenID providers set Issuer: endpoints and keys come from discovery and the ID token is
+// validated. Plain OAuth2 providers (GitHub) set Endpoint and Profile instead.
+type Provider struct {
+	Name         string // URL segment and "provider" claim: lowercase letters, digits, '-'
+	DisplayName  string // "Sign in with <DisplayName>"
+	ClientID     string
+	ClientSecret string
+	Scopes       []string // default for OpenID: openid, email, profile
+
+	Issuer   string
+	Endpoint oauth2.Endpoint
+	Profile  func(ctx context.Context, client *http.Client) (*Identity, error)
+
+	// HTTPClient makes discovery, token and profile requests (default: 10s timeout).
+	HTTPClient *http.Client
+
+	mu     sync.Mutex
+	meta   *oidcMeta
+	keys   jwk.Set
+	keysAt time.Time
+}
+
+// Identity is the user a provider vouches for.
+type Identity struct {
+	Provider      string
+	Subject       string // the provider's user id
+	Email         string
+	EmailVerified bool
+	Name          string
+	Login         string // username, when the provider has one
+}
+
+// Claims returns the session claims for i. "sub" is "<provider>:<id>" so ids from different
+// providers (and password accounts) never collide.
+func (i *Identity) Claims() map[string]any {
+	c := map[string]any{"sub": i.Provider + ":" + i.Subject, "provider": i.Provider}
+	if i.Email != "" {
+		c["email"] = i.Email
+		c["email_verified"] = i.EmailVerified
+	}
+	if i.Name != "" {
+		c["name"] = i.Name
+	}
+	if i.Login != "" {
+		c["login"] = i.Login
+	}
+	return c
+}
+
+// OIDC reports whether p is an OpenID Connect provider.
+func (p *Provider) OIDC() bool { return p.Issuer != "" }
+
+// Enabled reports whether p has credentials and a way to identify users.
+func (p *Provider) Enabled() bool {
+	return p.ClientID != "" && p.ClientSecret != "" && (p.OIDC() || p.Profile != nil)
+}
+
+func (p *Provider) client() *http.Client {
+	if p.HTTPClient != nil {
+		return p.HTTPClient
+	}
+	return defaultProviderClient
+}
+
+var defaultProviderClient = &http.Client{Timeout: 10 * time.Second}
+
+var providerName = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+var (
+	providersMu sync.RWMutex
+	builtin     []*Provider // from config, replaced by Init
+	custom      []*Provider // RegisterProvider
+)
+
+// RegisterProvider adds a sign-in provider, replacing any provider with the same name
+// (including a built-in one). Providers without credentials are not listed or mounted.
+func RegisterProvider(p *Provider) {
+	if !providerName.MatchString(p.Name) {
+		panic(fmt.Sprintf("auth: invalid provider name %q", p.Name))
+	}
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	for i, q := range custom {
+		if q.Name == p.Name {
+			custom[i] = p
+			return
+		}
+	}
+	custom = append(custom, p)
+}
+
+// Providers returns the enabled providers: built-ins (GitHub, Google, GitLab, Microsoft,
+// OIDC) first, then registered ones in registration order.
+func Providers() []*Provider {
+	current() // lazy Init
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	overridden := map[string]bool{}
+	for _, p := range custom {
+		overridden[p.Name] = true
+	}
+	var out []*Provider
+	for _, p := range builtin {
+		if !overridden[p.Name] && p.Enabled() {
+			out = append(out, p)
+		}
+	}
+	for _, p := range custom {
+		if p.Enabled() {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// LookupProvider returns the enabled provider called name.
+func LookupProvider(name string) (*Provider, bool) {
+	for _, p := range Providers() {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// initProviders builds the built-in providers from cfg.
+func initProviders(cfg *config.Config) {
+	oidcScopes := []string{"openid", "email", "profile"}
+	ps := []*Provider{
+		{
+			Name: "github", DisplayName: "GitHub",
+			ClientID: cfg.GitHubClientID, ClientSecret: cfg.GitHubClientSecret,
+			Scopes: []string{"read:user", "user:email"}, Endpoint: github.Endpoint, Profile: githubProfile,
+		},
+		{
+			Name: "google", DisplayName: "Google",
+			ClientID: cfg.GoogleClientID, ClientSecret: cfg.GoogleClientSecret,
+			Scopes: oidcScopes, Issuer: "https://accounts.google.com",
+		},
+		{
+			Name: "gitlab", DisplayName: "GitLab",
+			ClientID: cfg.GitLabClientID, ClientSecret: cfg.GitLabClientSecret,
+			Scopes: oidcScopes, Issuer: strings.TrimRight(cfg.GitLabURL, "/"),
+		},
+		{
+			// Multi-tenant ("common", "organizations") tokens are issued by the user's tenant.
+			Name: "microsoft", DisplayName: "Microsoft",
+			ClientID: cfg.MicrosoftClientID, ClientSecret: cfg.MicrosoftClientSecret,
+			Scopes: oidcScopes, Issuer: "https://login.microsoftonline.com/" + cfg.MicrosoftTenant + "/v2.0",
+		},
+		{
+			Name: "oidc", DisplayName: cfg.OIDCName,
+			ClientID: cfg.OIDCClientID, ClientSecret: cfg.OIDCClientSecret,
+			Scopes: cfg.OIDCScopes, Issuer: cfg.OIDCIssuer,
+		},
+	}
+	providersMu.Lock()
+	builtin = ps
+	providersMu.Unlock()
+}
+
+// githubProfile loads the GitHub user and, when the profile hides it, the primary verified
+// email address.
+func githubProfile(ctx context.Context, client *http.Client) (*Identity, error) {
+	var u struct {
+		ID    int64  `json:"id"`
+		Login string `json:"login"`
+		Name  string `json:"name"`
+		Email string `json:"email"`
+	}
+	if err := getJSON(ctx, client, "https://api.github.com/user", &u); err != nil {
+		return nil, err
+	}
+	if u.ID == 0 {
+		return nil, errors.New("auth: github: no user id")
+	}
+	id := &Identity{Provider: "github", Subject: strconv.FormatInt(u.ID, 10), Login: u.Login, Name: u.Name, Email: u.Email}
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := getJSON(ctx, client, "https://api.github.com/user/emails", &emails); err == nil {
+		for _, e := range emails {
+			if e.Primary && e.Verified {
+				id.Email, id.EmailVerified = e.Email, true
+			}
+		}
+	}
+	return id, nil
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("auth: GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
@@ -0,0 +1,274 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"gothicforge3/internal/config"
+)
+
+// RefreshCookieName is the cookie holding the refresh token set by SignIn.
+const RefreshCookieName = "gf_refresh"
+
+// RefreshPath is the token refresh endpoint (app/routes), exempt from CSRF checks: the
+// SameSite=Lax gf_refresh cookie is not sent cross-site, and API clients have no session.
+const RefreshPath = "/auth/refresh"
+
+// LogoutAllPath revokes every session of the caller (app/routes). API clients reach it with
+// "Authorization: Bearer", which skips the CSRF check there.
+const LogoutAllPath = "/auth/logout/all"
+
+// refreshReuseLeeway is how long an already rotated refresh token still yields an access token
+// (without a new refresh token), so parallel requests from one browser do not look like theft.
+const refreshReuseLeeway = 10 * time.Second
+
+var (
+	// ErrRefreshInvalid means the refresh token is unknown, expired or its session was revoked.
+	ErrRefreshInvalid = errors.New("auth: refresh token invalid or expired")
+	// ErrRefreshReused means a rotated refresh token was presented again; its session is revoked.
+	ErrRefreshReused = errors.New("auth: refresh token reused; session revoked")
+	// ErrSessionRevoked is returned by Verify for access tokens of a revoked or expired session.
+	ErrSessionRevoked = errors.New("auth: session revoked")
+)
+
+// Tokens is an access token and the refresh token that renews it.
+type Tokens struct {
+	SessionID      string
+	Access         string
+	AccessExpires  time.Time
+	Refresh        string // "" when a parallel request already rotated the presented token
+	RefreshExpires time.Time
+}
+
+// initSessions picks the session store for cfg.AuthSessionStore ("auto": Valkey when
+// VALKEY_URL/REDIS_URL is set, then Postgres when DATABASE_URL is set, then memory).
+func initSessions(cfg *config.Config) {
+	var s SessionStore
+	switch mode := strings.ToLower(cfg.AuthSessionStore); {
+	case mode == "valkey" || (mode == "auto" && cfg.KVURL() != ""):
+		s = ValkeySessionStore{}
+	case mode == "postgres" || (mode == "auto" && cfg.DatabaseURL != ""):
+		s = PostgresSessionStore{}
+	default:
+		s = NewMemorySessionStore()
+		if cfg.IsProduction() {
+			slog.Warn("auth: sessions are kept in memory; a restart signs everyone out (set VALKEY_URL or DATABASE_URL)")
+		}
+	}
+	mu.Lock()
+	sessions, accessTTL, refreshTTL = s, cfg.JWTAccessTTL, cfg.RefreshTTL
+	mu.Unlock()
+}
+
+// SetSessionStore replaces the session store (tests, custom backends).
+func SetSessionStore(s SessionStore) { mu.Lock(); sessions = s; mu.Unlock() }
+
+func sessionStore() (SessionStore, time.Duration, time.Duration) {
+	current() // lazy Init
+	mu.RLock()
+	defer mu.RUnlock()
+	return sessions, accessTTL, refreshTTL
+}
+
+// StartSession creates a session for claims (which must include "sub") and returns its first
+// access and refresh tokens. Access tokens carry the session id as "sid".
+func StartSession(ctx context.Context, claims map[string]any) (*Tokens, error) {
+	st, _, ttl := sessionStore()
+	sub, ok := claims["sub"]
+	if !ok || fmt.Sprint(sub) == "" {
+		return nil, errors.New("auth: session claims need a sub")
+	}
+	c := make(map[string]any, len(claims))
+	for k, v := range claims {
+		c[k] = v
+	}
+	c["sub"] = fmt.Sprint(sub)
+	now := time.Now()
+	s := &Session{ID: randomToken(16), Subject: c["sub"].(string), Claims: c, CreatedAt: now, ExpiresAt: now.Add(ttl)}
+	if err := st.CreateSession(ctx, s); err != nil {
+		return nil, err
+	}
+	return rotate(ctx, st, s, now)
+}
+
+// Refresh exchanges a refresh token for new tokens. The presented token is spent: using it
+// again after refreshReuseLeeway revokes the whole session (ErrRefreshReused).
+func Refresh(ctx context.Context, raw string) (*Tokens, error) {
+	st, _, _ := sessionStore()
+	sid, _, ok := strings.Cut(raw, ".")
+	if !ok || sid == "" {
+		return nil, ErrRefreshInvalid
+	}
+	now := time.Now()
+	got, usedAt, err := st.UseRefreshToken(ctx, hashToken(raw), now)
+	if errors.Is(err, ErrSessionNotFound) || (err == nil && got != sid) {
+		return nil, ErrRefreshInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	s, err := st.Session(ctx, sid)
+	if errors.Is(err, ErrSessionNotFound) {
+		return nil, ErrRefreshInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s.RevokedAt != nil || !now.Before(s.ExpiresAt) {
+		return nil, ErrRefreshInvalid
+	}
+	if usedAt != nil {
+		if now.Sub(*usedAt) > refreshReuseLeeway {
+			slog.Warn("auth: refresh token reused; revoking session", "sid", sid, "sub", s.Subject)
+			if err := st.RevokeSession(ctx, sid, now); err != nil {
+				return nil, err
+			}
+			return nil, ErrRefreshReused
+		}
+		return issueAccess(s, now)
+	}
+	return rotate(ctx, st, s, now)
+}
+
+// rotate stores a new refresh token for s and issues an access token with it.
+func rotate(ctx context.Context, st SessionStore, s *Session, now time.Time) (*Tokens, error) {
+	raw := s.ID + "." + randomToken(32)
+	if err := st.AddRefreshToken(ctx, s.ID, hashToken(raw), s.ExpiresAt); err != nil {
+		return nil, err
+	}
+	t, err := issueAccess(s, now)
+	if err != nil {
+		return nil, err
+	}
+	t.Refresh, t.RefreshExpires = raw, s.ExpiresAt
+	return t, nil
+}
+
+func issueAccess(s *Session, now time.Time) (*Tokens, error) {
+	_, ttl, _ := sessionStore()
+	if exp := now.Add(ttl); exp.After(s.ExpiresAt) {
+		ttl = s.ExpiresAt.Sub(now)
+	}
+	claims := make(map[string]any, len(s.Claims)+1)
+	for k, v := range s.Claims {
+		claims[k] = v
+	}
+	claims["sid"] = s.ID
+	tok, exp, err := Issue(ttl, claims)
+	if err != nil {
+		return nil, err
+	}
+	return &Tokens{SessionID: s.ID, Access: tok, AccessExpires: exp}, nil
+}
+
+// checkSession rejects claims whose "sid" names a revoked, expired or unknown session. Tokens
+// without a sid (e.g. /dev/jwt) are not tied to a session.
+func checkSession(ctx context.Context, claims map[string]any) error {
+	sid, _ := claims["sid"].(string)
+	if sid == "" {
+		return nil
+	}
+	st, _, _ := sessionStore()
+	s, err := st.Session(ctx, sid)
+	if errors.Is(err, ErrSessionNotFound) {
+		return ErrSessionRevoked
+	}
+	if err != nil {
+		return err
+	}
+	if s.RevokedAt != nil || !time.Now().Before(s.ExpiresAt) {
+		return ErrSessionRevoked
+	}
+	return nil
+}
+
+// RevokeSession signs out one session; its refresh and access tokens stop working.
+func RevokeSession(ctx context.Context, sid string) error {
+	st, _, _ := sessionStore()
+	return st.RevokeSession(ctx, sid, time.Now())
+}
+
+// RevokeAll signs subject out everywhere ("log out of all devices", password changes).
+func RevokeAll(ctx context.Context, subject string) error {
+	st, _, _ := sessionStore()
+	return st.RevokeSubject(ctx, subject, time.Now())
+}
+
+// SignIn starts a session for claims and sets the gf_jwt and gf_refresh cookies. A session
+// already attached to the request is revoked.
+func SignIn(w http.ResponseWriter, r *http.Request, claims map[string]any) error {
+	if sid := SessionID(r); sid != "" {
+		if err := RevokeSession(r.Context(), sid); err != nil {
+			return err
+		}
+	}
+	t, err := StartSession(r.Context(), claims)
+	if err != nil {
+		return err
+	}
+	SetSessionCookies(w, t)
+	return nil
+}
+
+// SignOut revokes the request's session and clears the session cookies.
+func SignOut(w http.ResponseWriter, r *http.Request) error {
+	ClearSessionCookies(w)
+	if sid := SessionID(r); sid != "" {
+		return RevokeSession(r.Context(), sid)
+	}
+	return nil
+}
+
+// SessionID returns the session of the request: the "sid" of its claims or, when the access
+// token has expired, the session named by the gf_refresh cookie.
+func SessionID(r *http.Request) string {
+	if c, err := Authenticate(r); err == nil {
+		if sid, _ := c.Raw["sid"].(string); sid != "" {
+			return sid
+		}
+	}
+	if ck, err := r.Cookie(RefreshCookieName); err == nil {
+		sid, _, _ := strings.Cut(ck.Value, ".")
+		return sid
+	}
+	return ""
+}
+
+// SetSessionCookies writes the access token (gf_jwt) and, when present, the refresh token
+// (gf_refresh) as HttpOnly cookies.
+func SetSessionCookies(w http.ResponseWriter, t *Tokens) {
+	SetJWTCookie(w, CookieName, t.Access, t.AccessExpires)
+	if t.Refresh != "" {
+		SetJWTCookie(w, RefreshCookieName, t.Refresh, t.RefreshExpires)
+	}
+}
+
+// ClearSessionCookies expires the gf_jwt and gf_refresh cookies, with the same attributes
+// SetJWTCookie gives them.
+func ClearSessionCookies(w http.ResponseWriter) {
+	mu.RLock()
+	secure := secureCookie
+	mu.RUnlock()
+	for _, name := range []string{CookieName, RefreshCookieName} {
+		http.SetCookie(w, &http.Cookie{Name: name, Value: "", Path: "/", HttpOnly: true, Secure: secure, SameSite: http.SameSiteLaxMode, MaxAge: -1, Expires: time.Unix(0, 0)})
+	}
+}
+
+func randomToken(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func hashToken(raw string) []byte {
+	h := sha256.Sum256([]byte(raw))
+	return h[:]
+}
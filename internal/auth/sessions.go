@@ -0,0 +1,428 @@
+package auth
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	redigo "github.com/gomodule/redigo/redis"
+	"github.com/jackc/pgx/v5"
+	"gothicforge3/internal/db"
+	"gothicforge3/internal/kv"
+)
+
+// Session is one sign-in: the family of refresh tokens rotated from it. Its id is the "sid"
+// claim of every access token it issues, so revoking it invalidates those too.
+type Session struct {
+	ID        string
+	Subject   string
+	Claims    map[string]any // copied into each access token
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	RevokedAt *time.Time
+}
+
+// ErrSessionNotFound is returned by SessionStore lookups that match nothing.
+var ErrSessionNotFound = errors.New("auth: session not found")
+
+// SessionStore persists sessions and their refresh tokens. Tokens are stored as SHA-256
+// hashes only.
+type SessionStore interface {
+	CreateSession(ctx context.Context, s *Session) error
+	Session(ctx context.Context, id string) (*Session, error) // ErrSessionNotFound
+	AddRefreshToken(ctx context.Context, sessionID string, hash []byte, expires time.Time) error
+	// UseRefreshToken marks an unexpired token used and returns its session id and, when it
+	// had been used before, the time of that first use (ErrSessionNotFound for unknown tokens).
+	UseRefreshToken(ctx context.Context, hash []byte, now time.Time) (sessionID string, usedAt *time.Time, err error)
+	RevokeSession(ctx context.Context, id string, at time.Time) error
+	RevokeSubject(ctx context.Context, subject string, at time.Time) error
+}
+
+// SessionsMigrationSQL creates the auth_sessions and auth_refresh_tokens tables. It is the
+// content of app/db/migrations/*_create_auth_sessions.sql, which `gforge add auth` restores
+// when missing; a test keeps the two identical.
+const SessionsMigrationSQL = `-- +goose Up
+-- Sign-in sessions (internal/auth): one row per refresh token family.
+CREATE TABLE auth_sessions (
+  id text PRIMARY KEY,
+  subject text NOT NULL,
+  claims jsonb NOT NULL DEFAULT '{}',
+  created_at timestamptz NOT NULL DEFAULT now(),
+  expires_at timestamptz NOT NULL,
+  revoked_at timestamptz
+);
+CREATE INDEX auth_sessions_subject_idx ON auth_sessions (subject);
+CREATE INDEX auth_sessions_expires_idx ON auth_sessions (expires_at);
+
+-- Refresh tokens (SHA-256 hashes only); used_at is set on rotation for reuse detection.
+CREATE TABLE auth_refresh_tokens (
+  token_hash bytea PRIMARY KEY,
+  session_id text NOT NULL REFERENCES auth_sessions (id) ON DELETE CASCADE,
+  expires_at timestamptz NOT NULL,
+  used_at timestamptz,
+  created_at timestamptz NOT NULL DEFAULT now()
+);
+CREATE INDEX auth_refresh_tokens_session_idx ON auth_refresh_tokens (session_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS auth_refresh_tokens;
+DROP TABLE IF EXISTS auth_sessions;
+`
+
+// MemorySessionStore keeps sessions in process memory (development, tests). Sessions are lost
+// on restart, which signs everyone out.
+type MemorySessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]*Session
+	tokens   map[string]*memRefresh
+}
+
+type memRefresh struct {
+	sessionID string
+	expires   time.Time
+	usedAt    *time.Time
+}
+
+// NewMemorySessionStore returns an empty in-memory store.
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: map[string]*Session{}, tokens: map[string]*memRefresh{}}
+}
+
+// CreateSession implements SessionStore. Expired sessions and tokens are dropped here.
+func (m *MemorySessionStore) CreateSession(_ context.Context, s *Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for id, old := range m.sessions {
+		if !now.Before(old.ExpiresAt) {
+			delete(m.sessions, id)
+		}
+	}
+	for h, t := range m.tokens {
+		if _, ok := m.sessions[t.sessionID]; !ok || !now.Before(t.expires) {
+			delete(m.tokens, h)
+		}
+	}
+	c := *s
+	m.sessions[s.ID] = &c
+	return nil
+}
+
+// Session implements SessionStore.
+func (m *MemorySessionStore) Session(_ context.Context, id string) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	c := *s
+	return &c, nil
+}
+
+// AddRefreshToken implements SessionStore.
+func (m *MemorySessionStore) AddRefreshToken(_ context.Context, sessionID string, hash []byte, expires time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tokens[hex.EncodeToString(hash)] = &memRefresh{sessionID: sessionID, expires: expires}
+	return nil
+}
+
+// UseRefreshToken implements SessionStore.
+func (m *MemorySessionStore) UseRefreshToken(_ context.Context, hash []byte, now time.Time) (string, *time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.tokens[hex.EncodeToString(hash)]
+	if !ok || !now.Before(t.expires) {
+		return "", nil, ErrSessionNotFound
+	}
+	used := t.usedAt
+	if used == nil {
+		at := now
+		t.usedAt = &at
+	}
+	return t.sessionID, used, nil
+}
+
+// RevokeSession implements SessionStore.
+func (m *MemorySessionStore) RevokeSession(_ context.Context, id string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s, ok := m.sessions[id]; ok && s.RevokedAt == nil {
+		s.RevokedAt = &at
+	}
+	return nil
+}
+
+// RevokeSubject implements SessionStore.
+func (m *MemorySessionStore) RevokeSubject(_ context.Context, subject string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, s := range m.sessions {
+		if s.Subject == subject && s.RevokedAt == nil {
+			s.RevokedAt = &at
+		}
+	}
+	return nil
+}
+
+// PostgresSessionStore keeps sessions in the auth_sessions and auth_refresh_tokens tables
+// (see app/db/migrations/*_create_auth_sessions.sql).
+type PostgresSessionStore struct{}
+
+func (PostgresSessionStore) pool(ctx context.Context) error {
+	cctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	return db.Connect(cctx)
+}
+
+// CreateSession implements SessionStore. Expired sessions (and, by cascade, their tokens) are
+// deleted here.
+func (p PostgresSessionStore) CreateSession(ctx context.Context, s *Session) error {
+	if err := p.pool(ctx); err != nil {
+		return err
+	}
+	claims, err := json.Marshal(s.Claims)
+	if err != nil {
+		return err
+	}
+	if _, err := db.Pool().Exec(ctx, `DELETE FROM auth_sessions WHERE expires_at < now()`); err != nil {
+		return err
+	}
+	_, err = db.Pool().Exec(ctx, `INSERT INTO auth_sessions (id, subject, claims, created_at, expires_at) VALUES ($1, $2, $3, $4, $5)`,
+		s.ID, s.Subject, claims, s.CreatedAt, s.ExpiresAt)
+	return err
+}
+
+// Session implements SessionStore.
+func (p PostgresSessionStore) Session(ctx context.Context, id string) (*Session, error) {
+	if err := p.pool(ctx); err != nil {
+		return nil, err
+	}
+	var s Session
+	var claims []byte
+	err := db.Pool().QueryRow(ctx, `SELECT id, subject, claims, created_at, expires_at, revoked_at FROM auth_sessions WHERE id = $1`, id).
+		Scan(&s.ID, &s.Subject, &claims, &s.CreatedAt, &s.ExpiresAt, &s.RevokedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(claims, &s.Claims); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// AddRefreshToken implements SessionStore.
+func (p PostgresSessionStore) AddRefreshToken(ctx context.Context, sessionID string, hash []byte, expires time.Time) error {
+	if err := p.pool(ctx); err != nil {
+		return err
+	}
+	_, err := db.Pool().Exec(ctx, `INSERT INTO auth_refresh_tokens (token_hash, session_id, expires_at) VALUES ($1, $2, $3)`, hash, sessionID, expires)
+	return err
+}
+
+// UseRefreshToken implements SessionStore. The row lock makes concurrent uses see each other.
+func (p PostgresSessionStore) UseRefreshToken(ctx context.Context, hash []byte, now time.Time) (string, *time.Time, error) {
+	if err := p.pool(ctx); err != nil {
+		return "", nil, err
+	}
+	var sid string
+	var used *time.Time
+	err := db.Pool().QueryRow(ctx, `
+WITH old AS (
+  SELECT token_hash, session_id, used_at FROM auth_refresh_tokens
+  WHERE token_hash = $1 AND expires_at > $2 FOR UPDATE
+)
+UPDATE auth_refresh_tokens t SET used_at = COALESCE(t.used_at, $2)
+FROM old WHERE t.token_hash = old.token_hash
+RETURNING old.session_id, old.used_at`, hash, now).Scan(&sid, &used)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil, ErrSessionNotFound
+	}
+	return sid, used, err
+}
+
+// RevokeSession implements SessionStore.
+func (p PostgresSessionStore) RevokeSession(ctx context.Context, id string, at time.Time) error {
+	if err := p.pool(ctx); err != nil {
+		return err
+	}
+	_, err := db.Pool().Exec(ctx, `UPDATE auth_sessions SET revoked_at = $2 WHERE id = $1 AND revoked_at IS NULL`, id, at)
+	return err
+}
+
+// RevokeSubject implements SessionStore.
+func (p PostgresSessionStore) RevokeSubject(ctx context.Context, subject string, at time.Time) error {
+	if err := p.pool(ctx); err != nil {
+		return err
+	}
+	_, err := db.Pool().Exec(ctx, `UPDATE auth_sessions SET revoked_at = $2 WHERE subject = $1 AND revoked_at IS NULL AND expires_at > $2`, subject, at)
+	return err
+}
+
+// ValkeySessionStore keeps sessions in Valkey/Redis through kv.Pool, expiring keys with the
+// session:
+//
+//	gf:auth:sess:<sid>   session JSON
+//	gf:auth:rt:<hash>    refresh token hash: sid, used (unix ms)
+//	gf:auth:subj:<sub>   set of the subject's session ids
+type ValkeySessionStore struct{}
+
+type valkeySession struct {
+	Subject   string         `json:"sub"`
+	Claims    map[string]any `json:"claims"`
+	CreatedAt time.Time      `json:"created_at"`
+	ExpiresAt time.Time      `json:"expires_at"`
+	RevokedAt *time.Time     `json:"revoked_at,omitempty"`
+}
+
+func (ValkeySessionStore) do(ctx context.Context, fn func(redigo.Conn) error) error {
+	p := kv.Pool()
+	if p == nil {
+		return errors.New("auth: AUTH_SESSION_STORE=valkey needs VALKEY_URL or REDIS_URL")
+	}
+	c, err := p.GetContext(ctx)
+	if err != nil {
+		return kv.NoteError(err)
+	}
+	defer c.Close()
+	return kv.NoteError(fn(c))
+}
+
+func sessKey(id string) string      { return "gf:auth:sess:" + id }
+func subjKey(sub string) string     { return "gf:auth:subj:" + sub }
+func refreshKey(hash []byte) string { return "gf:auth:rt:" + hex.EncodeToString(hash) }
+
+// CreateSession implements SessionStore.
+func (v ValkeySessionStore) CreateSession(ctx context.Context, s *Session) error {
+	b, err := json.Marshal(valkeySession{Subject: s.Subject, Claims: s.Claims, CreatedAt: s.CreatedAt, ExpiresAt: s.ExpiresAt})
+	if err != nil {
+		return err
+	}
+	exp := s.ExpiresAt.UnixMilli()
+	return v.do(ctx, func(c redigo.Conn) error {
+		_ = c.Send("MULTI")
+		_ = c.Send("SET", sessKey(s.ID), b, "PXAT", exp)
+		_ = c.Send("SADD", subjKey(s.Subject), s.ID)
+		_ = c.Send("PEXPIREAT", subjKey(s.Subject), exp)
+		_, err := c.Do("EXEC")
+		return err
+	})
+}
+
+// Session implements SessionStore.
+func (v ValkeySessionStore) Session(ctx context.Context, id string) (*Session, error) {
+	var b []byte
+	err := v.do(ctx, func(c redigo.Conn) error {
+		var err error
+		b, err = redigo.Bytes(c.Do("GET", sessKey(id)))
+		if errors.Is(err, redigo.ErrNil) {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if b == nil {
+		return nil, ErrSessionNotFound
+	}
+	var vs valkeySession
+	if err := json.Unmarshal(b, &vs); err != nil {
+		return nil, err
+	}
+	return &Session{ID: id, Subject: vs.Subject, Claims: vs.Claims, CreatedAt: vs.CreatedAt, ExpiresAt: vs.ExpiresAt, RevokedAt: vs.RevokedAt}, nil
+}
+
+// AddRefreshToken implements SessionStore.
+func (v ValkeySessionStore) AddRefreshToken(ctx context.Context, sessionID string, hash []byte, expires time.Time) error {
+	return v.do(ctx, func(c redigo.Conn) error {
+		_ = c.Send("MULTI")
+		_ = c.Send("HSET", refreshKey(hash), "sid", sessionID)
+		_ = c.Send("PEXPIREAT", refreshKey(hash), expires.UnixMilli())
+		_, err := c.Do("EXEC")
+		return err
+	})
+}
+
+// useRefreshScript returns {sid, first use in unix ms or ""} and records the first use.
+var useRefreshScript = redigo.NewScript(1, `
+local sid = redis.call('HGET', KEYS[1], 'sid')
+if not sid then return false end
+local used = redis.call('HGET', KEYS[1], 'used')
+if not used then redis.call('HSET', KEYS[1], 'used', ARGV[1]) end
+return {sid, used or ''}
+`)
+
+// UseRefreshToken implements SessionStore.
+func (v ValkeySessionStore) UseRefreshToken(ctx context.Context, hash []byte, now time.Time) (string, *time.Time, error) {
+	var vals []string
+	err := v.do(ctx, func(c redigo.Conn) error {
+		var err error
+		vals, err = redigo.Strings(useRefreshScript.Do(c, refreshKey(hash), now.UnixMilli()))
+		if errors.Is(err, redigo.ErrNil) {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	if len(vals) != 2 {
+		return "", nil, ErrSessionNotFound
+	}
+	if vals[1] == "" {
+		return vals[0], nil, nil
+	}
+	ms, err := strconv.ParseInt(vals[1], 10, 64)
+	if err != nil {
+		return "", nil, err
+	}
+	used := time.UnixMilli(ms)
+	return vals[0], &used, nil
+}
+
+// RevokeSession implements SessionStore.
+func (v ValkeySessionStore) RevokeSession(ctx context.Context, id string, at time.Time) error {
+	s, err := v.Session(ctx, id)
+	if errors.Is(err, ErrSessionNotFound) {
+		return nil
+	}
+	if err != nil || s.RevokedAt != nil {
+		return err
+	}
+	b, err := json.Marshal(valkeySession{Subject: s.Subject, Claims: s.Claims, CreatedAt: s.CreatedAt, ExpiresAt: s.ExpiresAt, RevokedAt: &at})
+	if err != nil {
+		return err
+	}
+	return v.do(ctx, func(c redigo.Conn) error {
+		_, err := c.Do("SET", sessKey(id), b, "XX", "KEEPTTL")
+		return err
+	})
+}
+
+// RevokeSubject implements SessionStore.
+func (v ValkeySessionStore) RevokeSubject(ctx context.Context, subject string, at time.Time) error {
+	var ids []string
+	err := v.do(ctx, func(c redigo.Conn) error {
+		var err error
+		ids, err = redigo.Strings(c.Do("SMEMBERS", subjKey(subject)))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := v.RevokeSession(ctx, id, at); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,562 @@
+// Package config loads the server's runtime settings from the environment into a
+// single typed struct. Fields are described with struct tags:
+//
+//	env:"KEY"             environment variable name (KEY_FILE is read when KEY is unset)
+//	default:"value"       value used when neither KEY nor KEY_FILE is set
+//	secret:"true"         value is masked by Config.Report
+//	oneof:"a,b,c"         value must be one of the listed options (case-insensitive)
+//
+// Rules that depend on APP_ENV or on other settings live in the *Problems methods run by Load.
+//
+// Supported field types: string, bool, int, float64, time.Duration (a bare integer means
+// seconds) and []string (comma-separated).
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config holds every runtime setting used by the server and application routes.
+type Config struct {
+	// App
+	AppEnv      string `env:"APP_ENV" default:"development"`
+	SiteBaseURL string `env:"SITE_BASE_URL"`
+	BaseDir     string `env:"GFORGE_BASEDIR"`
+
+	// Front-end libraries: vendored copies from /static/vendor (local) or pinned CDN URLs with SRI (cdn)
+	VendorMode string `env:"VENDOR_MODE" default:"local" oneof:"local,cdn"`
+
+	// HTTP server
+	HTTPHost      string        `env:"HTTP_HOST"`
+	HTTPPort      string        `env:"HTTP_PORT" default:"8080"`
+	Port          string        `env:"PORT"`
+	ShutdownGrace time.Duration `env:"SHUTDOWN_GRACE_SECONDS" default:"20"`
+	LogFormat     string        `env:"LOG_FORMAT" oneof:"text,json,off,silent,none"`
+	LogLevel      string        `env:"LOG_LEVEL" default:"info" oneof:"debug,info,warn,error"`
+	LogSampleRate float64       `env:"LOG_SAMPLE_RATE" default:"1"`
+	PprofEnable   bool          `env:"PPROF_ENABLE"`
+	// Reverse proxies whose forwarding headers (Forwarded, X-Forwarded-*) are believed:
+	// CIDRs, addresses or presets "cloudflare", "railway", "private", "loopback" (internal/realip)
+	TrustedProxies []string `env:"TRUSTED_PROXIES"`
+
+	// Listeners: HTTP_SOCKET serves on a Unix socket instead of HTTP_HOST/HTTP_PORT (behind
+	// nginx/Caddy). With HANDOFF_ENABLE, SIGHUP/SIGUSR2 starts a new process on the same sockets
+	// and this one drains once it is ready. systemd socket activation (LISTEN_FDS) needs no setting.
+	HTTPSocket     string        `env:"HTTP_SOCKET"`
+	HTTPSocketMode string        `env:"HTTP_SOCKET_MODE" default:"0660"`
+	HandoffEnable  bool          `env:"HANDOFF_ENABLE"`
+	HandoffTimeout time.Duration `env:"HANDOFF_TIMEOUT_SECONDS" default:"60"`
+
+	// HTTP caching: ETag and 304 Not Modified for rendered HTML (internal/httpcache)
+	ETagEnable bool `env:"ETAG_ENABLE"`
+	ETagWeak   bool `env:"ETAG_WEAK"`
+	// Response/fragment caching (httpcache.Cache, httpcache.Fragment) is on unless disabled
+	HTTPCacheDisable bool `env:"HTTP_CACHE_DISABLE"`
+
+	// HTTPS (self-hosting): certificate files or ACME certificates (autocert), served with HTTP/2.
+	// HTTP_REDIRECT_ADDR (e.g. ":80") adds a plain listener that redirects to HTTPS and answers
+	// ACME http-01 challenges. HSTS is sent on HTTPS responses.
+	TLSCertFile           string        `env:"TLS_CERT_FILE"`
+	TLSKeyFile            string        `env:"TLS_KEY_FILE"`
+	ACMEDomains           []string      `env:"ACME_DOMAINS"`
+	ACMEEmail             string        `env:"ACME_EMAIL"`
+	ACMEDirectoryURL      string        `env:"ACME_DIRECTORY_URL"`
+	ACMECAFile            string        `env:"ACME_CA_FILE"`
+	ACMECache             string        `env:"ACME_CACHE" default:"dir" oneof:"dir,valkey"`
+	ACMECacheDir          string        `env:"ACME_CACHE_DIR" default:"data/acme"`
+	HTTPRedirectAddr      string        `env:"HTTP_REDIRECT_ADDR"`
+	HSTSMaxAge            time.Duration `env:"HSTS_MAX_AGE_SECONDS" default:"31536000"`
+	HSTSIncludeSubdomains bool          `env:"HSTS_INCLUDE_SUBDOMAINS"`
+	HSTSPreload           bool          `env:"HSTS_PRELOAD"`
+
+	// Rate limiting: the "default" policy (per IP) plus named policies "name=limit/window[:ip|sub|apikey]"
+	RateLimitMax      int           `env:"RATE_LIMIT_MAX" default:"120"`
+	RateLimitWindow   time.Duration `env:"RATE_LIMIT_WINDOW_SECONDS" default:"60"`
+	RateLimitPolicies []string      `env:"RATE_LIMIT_POLICIES"`
+	AuthRateLimit     int           `env:"AUTH_RATE_LIMIT" default:"10"`
+	OAuthRateLimit    int           `env:"OAUTH_RATE_LIMIT" default:"30"`
+
+	// Metrics: opt-in Prometheus endpoint, on /metrics behind a bearer token or on its own listener
+	MetricsEnable bool   `env:"METRICS_ENABLE"`
+	MetricsToken  string `env:"METRICS_TOKEN" secret:"true"`
+	MetricsAddr   string `env:"METRICS_ADDR"`
+
+	// Tracing: OpenTelemetry spans exported over OTLP/HTTP or to stdout (internal/tracing)
+	OTelTracesExporter string   `env:"OTEL_TRACES_EXPORTER" oneof:"otlp,stdout,none"`
+	OTelEndpoint       string   `env:"OTEL_EXPORTER_OTLP_ENDPOINT"`
+	OTelHeaders        []string `env:"OTEL_EXPORTER_OTLP_HEADERS" secret:"true"`
+	OTelServiceName    string   `env:"OTEL_SERVICE_NAME" default:"gothic-forge"`
+	OTelSampleRatio    float64  `env:"OTEL_TRACES_SAMPLER_ARG" default:"1"`
+
+	// CORS
+	CORSOrigins []string `env:"CORS_ORIGINS"`
+
+	// Security
+	JWTSecret string `env:"JWT_SECRET" default:"devsecret-change-me" secret:"true"`
+
+	// JWT keys (internal/auth). JWT_KEYS_FILE holds a rotated key set (`gforge secrets rotate-jwt`);
+	// without it tokens are HS256 over JWT_SECRET. Issuer/audience are set on issue and checked on verify.
+	JWTAlg      string   `env:"JWT_ALG" default:"HS256" oneof:"HS256,RS256,EdDSA"`
+	JWTKeysFile string   `env:"JWT_KEYS_FILE"`
+	JWTIssuer   string   `env:"JWT_ISSUER"`
+	JWTAudience []string `env:"JWT_AUDIENCE"`
+
+	// Sign-in sessions (internal/auth): short-lived access JWTs plus a rotating gf_refresh token
+	// stored hashed server-side. AUTH_SESSION_STORE=auto uses Valkey, then Postgres, then memory.
+	JWTAccessTTL     time.Duration `env:"JWT_ACCESS_TTL_SECONDS" default:"900"`
+	RefreshTTL       time.Duration `env:"REFRESH_TTL_SECONDS" default:"2592000"`
+	AuthSessionStore string        `env:"AUTH_SESSION_STORE" default:"auto" oneof:"auto,memory,postgres,valkey"`
+
+	// Accounts (internal/accounts): argon2id cost, raised hashes are upgraded on the next login.
+	// Verification and reset links are mailed through SMTP_ADDR, or logged when it is empty.
+	AccountsRequireVerified bool   `env:"ACCOUNTS_REQUIRE_VERIFIED"`
+	Argon2MemoryKiB         int    `env:"ARGON2_MEMORY_KIB" default:"19456"`
+	Argon2Time              int    `env:"ARGON2_TIME" default:"2"`
+	Argon2Threads           int    `env:"ARGON2_THREADS" default:"1"`
+	SMTPAddr                string `env:"SMTP_ADDR"`
+	SMTPUsername            string `env:"SMTP_USERNAME"`
+	SMTPPassword            string `env:"SMTP_PASSWORD" secret:"true"`
+	MailFrom                string `env:"MAIL_FROM" default:"no-reply@localhost"`
+
+	// Services
+	DatabaseURL         string `env:"DATABASE_URL" secret:"true"`
+	ValkeyURL           string `env:"VALKEY_URL" secret:"true"`
+	RedisURL            string `env:"REDIS_URL" secret:"true"`
+	ValkeyTLSSkipVerify bool   `env:"VALKEY_TLS_SKIP_VERIFY"`
+
+	// Violation reports (CSP/NEL) collected at /_reports/csp
+	ReportsStore        string        `env:"REPORTS_STORE" default:"log" oneof:"log,file,postgres,off"`
+	ReportsFile         string        `env:"REPORTS_FILE" default:"data/reports.jsonl"`
+	ReportsRateLimit    int           `env:"REPORTS_RATE_LIMIT" default:"30"`
+	ReportsDedupeWindow time.Duration `env:"REPORTS_DEDUPE_WINDOW" default:"3600"`
+
+	// /.well-known/security.txt (RFC 9116); served only when SECURITY_CONTACT is set
+	SecurityContact            []string `env:"SECURITY_CONTACT"`
+	SecurityExpires            string   `env:"SECURITY_EXPIRES"`
+	SecurityPolicyURL          string   `env:"SECURITY_POLICY_URL"`
+	SecurityAcknowledgmentsURL string   `env:"SECURITY_ACKNOWLEDGMENTS_URL"`
+	SecurityEncryptionURL      string   `env:"SECURITY_ENCRYPTION_URL"`
+	SecurityPreferredLanguages string   `env:"SECURITY_PREFERRED_LANGUAGES" default:"en"`
+
+	// OAuth / OpenID Connect sign-in (internal/auth providers). A provider is enabled when its client
+	// id and secret are set; callbacks are <OAUTH_BASE_URL>auth/<provider>/callback.
+	GitHubClientID        string   `env:"GITHUB_CLIENT_ID"`
+	GitHubClientSecret    string   `env:"GITHUB_CLIENT_SECRET" secret:"true"`
+	GoogleClientID        string   `env:"GOOGLE_CLIENT_ID"`
+	GoogleClientSecret    string   `env:"GOOGLE_CLIENT_SECRET" secret:"true"`
+	GitLabClientID        string   `env:"GITLAB_CLIENT_ID"`
+	GitLabClientSecret    string   `env:"GITLAB_CLIENT_SECRET" secret:"true"`
+	GitLabURL             string   `env:"GITLAB_URL" default:"https://gitlab.com"`
+	MicrosoftClientID     string   `env:"MICROSOFT_CLIENT_ID"`
+	MicrosoftClientSecret string   `env:"MICROSOFT_CLIENT_SECRET" secret:"true"`
+	MicrosoftTenant       string   `env:"MICROSOFT_TENANT" default:"common"`
+	OIDCIssuer            string   `env:"OIDC_ISSUER"` // any OpenID provider, configured by discovery
+	OIDCClientID          string   `env:"OIDC_CLIENT_ID"`
+	OIDCClientSecret      string   `env:"OIDC_CLIENT_SECRET" secret:"true"`
+	OIDCName              string   `env:"OIDC_NAME" default:"SSO"`
+	OIDCScopes            []string `env:"OIDC_SCOPES" default:"openid,email,profile"`
+	OAuthBaseURL          string   `env:"OAUTH_BASE_URL"`
+}
+
+// IsProduction reports whether APP_ENV is "production".
+func (c *Config) IsProduction() bool { return strings.EqualFold(c.AppEnv, "production") }
+
+// IsDevelopment reports whether APP_ENV is "development".
+func (c *Config) IsDevelopment() bool { return strings.EqualFold(c.AppEnv, "development") }
+
+// Addr returns the listen address. A platform-provided PORT wins over HTTP_PORT and
+// binds all interfaces unless HTTP_HOST is set; otherwise the default is loopback.
+func (c *Config) Addr() string {
+	port := c.Port
+	if port == "" {
+		port = c.HTTPPort
+	}
+	host := c.HTTPHost
+	if host == "" {
+		if c.Port != "" {
+			host = "0.0.0.0"
+		} else {
+			host = "127.0.0.1"
+		}
+	}
+	return host + ":" + port
+}
+
+// ListenAddr returns the address for server.Listen: "unix:" plus HTTP_SOCKET when set,
+// otherwise Addr.
+func (c *Config) ListenAddr() string {
+	if c.HTTPSocket != "" {
+		return "unix:" + c.HTTPSocket
+	}
+	return c.Addr()
+}
+
+// SocketMode returns HTTP_SOCKET_MODE parsed as octal permissions (0660 if invalid).
+func (c *Config) SocketMode() os.FileMode {
+	m, err := strconv.ParseUint(c.HTTPSocketMode, 8, 32)
+	if err != nil || m > 0o777 {
+		return 0o660
+	}
+	return os.FileMode(m)
+}
+
+// TLSMode reports how the server gets certificates: "files", "acme" or "" (plain HTTP).
+func (c *Config) TLSMode() string {
+	switch {
+	case c.TLSCertFile != "" || c.TLSKeyFile != "":
+		return "files"
+	case len(c.ACMEDomains) > 0:
+		return "acme"
+	}
+	return ""
+}
+
+// KVURL returns VALKEY_URL, falling back to REDIS_URL.
+func (c *Config) KVURL() string {
+	if c.ValkeyURL != "" {
+		return c.ValkeyURL
+	}
+	return c.RedisURL
+}
+
+// OAuthBase returns the base URL for OAuth callbacks with a trailing slash.
+// It falls back to SITE_BASE_URL and finally "/".
+func (c *Config) OAuthBase() string {
+	base := c.OAuthBaseURL
+	if base == "" {
+		base = c.SiteBaseURL
+	}
+	if base == "" {
+		base = "/"
+	}
+	if !strings.HasSuffix(base, "/") {
+		base += "/"
+	}
+	return base
+}
+
+// Error is returned by Load when one or more settings are invalid.
+type Error struct {
+	Problems []string
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "config: %d invalid setting(s):", len(e.Problems))
+	for _, p := range e.Problems {
+		b.WriteString("\n  - ")
+		b.WriteString(p)
+	}
+	return b.String()
+}
+
+var (
+	mu      sync.RWMutex
+	current *Config
+)
+
+// Load reads the configuration from the process environment, validates it and
+// makes it available through Current. The returned *Error lists every problem.
+func Load() (*Config, error) {
+	return LoadFrom(os.LookupEnv)
+}
+
+// LoadFrom is like Load but reads variables through lookup (useful in tests).
+func LoadFrom(lookup func(string) (string, bool)) (*Config, error) {
+	c, problems := parse(lookup)
+	if len(problems) > 0 {
+		return nil, &Error{Problems: problems}
+	}
+	mu.Lock()
+	current = c
+	mu.Unlock()
+	return c, nil
+}
+
+// Current returns the most recently loaded configuration. When Load has not been
+// called yet it parses the environment on the fly, ignoring validation problems.
+func Current() *Config {
+	mu.RLock()
+	c := current
+	mu.RUnlock()
+	if c != nil {
+		return c
+	}
+	c, _ = parse(os.LookupEnv)
+	return c
+}
+
+// Report renders the effective configuration with secrets masked, one KEY=value per line.
+func (c *Config) Report() string {
+	var b strings.Builder
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		key := f.Tag.Get("env")
+		if key == "" {
+			continue
+		}
+		val := formatValue(v.Field(i))
+		if f.Tag.Get("secret") == "true" && val != "" {
+			val = "********"
+		}
+		fmt.Fprintf(&b, "%s=%s\n", key, val)
+	}
+	return b.String()
+}
+
+func parse(lookup func(string) (string, bool)) (*Config, []string) {
+	c := &Config{}
+	var problems []string
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		key := f.Tag.Get("env")
+		if key == "" {
+			continue
+		}
+		raw, err := lookupValue(lookup, key)
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		if raw == "" {
+			raw = f.Tag.Get("default")
+		}
+		if err := setValue(v.Field(i), raw); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", key, err))
+			continue
+		}
+		if opts := f.Tag.Get("oneof"); opts != "" && raw != "" && !containsFold(strings.Split(opts, ","), raw) {
+			problems = append(problems, fmt.Sprintf("%s: %q is not one of %s", key, raw, opts))
+		}
+	}
+	problems = append(problems, c.tlsProblems()...)
+	problems = append(problems, c.accountsProblems()...)
+	problems = append(problems, c.jwtProblems()...)
+	problems = append(problems, c.sessionProblems()...)
+	problems = append(problems, c.oauthProblems()...)
+	return c, problems
+}
+
+// tlsProblems checks the HTTPS settings against each other.
+func (c *Config) tlsProblems() []string {
+	var problems []string
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		problems = append(problems, "TLS_CERT_FILE and TLS_KEY_FILE: set both or neither")
+	}
+	if c.TLSCertFile != "" && len(c.ACMEDomains) > 0 {
+		problems = append(problems, "ACME_DOMAINS: cannot be combined with TLS_CERT_FILE/TLS_KEY_FILE")
+	}
+	if len(c.ACMEDomains) > 0 && strings.EqualFold(c.ACMECache, "valkey") && c.KVURL() == "" {
+		problems = append(problems, "ACME_CACHE: valkey requires VALKEY_URL or REDIS_URL")
+	}
+	if c.HTTPRedirectAddr != "" && c.TLSMode() == "" {
+		problems = append(problems, "HTTP_REDIRECT_ADDR: requires TLS_CERT_FILE/TLS_KEY_FILE or ACME_DOMAINS")
+	}
+	if m, err := strconv.ParseUint(c.HTTPSocketMode, 8, 32); c.HTTPSocket != "" && (err != nil || m > 0o777) {
+		problems = append(problems, fmt.Sprintf("HTTP_SOCKET_MODE: %q is not an octal file mode like 0660", c.HTTPSocketMode))
+	}
+	return problems
+}
+
+// jwtProblems checks the token signing setup. Production needs a real JWT_SECRET unless
+// JWT_KEYS_FILE provides the keys, and asymmetric algorithms always need a key file there.
+func (c *Config) jwtProblems() []string {
+	if !c.IsProduction() || c.JWTKeysFile != "" {
+		return nil
+	}
+	var problems []string
+	switch {
+	case !strings.EqualFold(c.JWTAlg, "HS256"):
+		problems = append(problems, fmt.Sprintf("JWT_KEYS_FILE: required for JWT_ALG=%s when APP_ENV=production (run `gforge secrets rotate-jwt`)", c.JWTAlg))
+	case c.JWTSecret == "":
+		problems = append(problems, "JWT_SECRET: required when APP_ENV=production (set JWT_SECRET or JWT_SECRET_FILE, or JWT_KEYS_FILE)")
+	case c.JWTSecret == "devsecret-change-me":
+		problems = append(problems, "JWT_SECRET: still set to the development default; set a real value for production")
+	}
+	return problems
+}
+
+// sessionProblems checks the access/refresh lifetimes and that an explicit AUTH_SESSION_STORE
+// has its backend configured.
+func (c *Config) sessionProblems() []string {
+	var problems []string
+	if c.JWTAccessTTL < time.Minute {
+		problems = append(problems, "JWT_ACCESS_TTL_SECONDS: must be at least 60")
+	}
+	if c.RefreshTTL < c.JWTAccessTTL {
+		problems = append(problems, "REFRESH_TTL_SECONDS: must not be shorter than JWT_ACCESS_TTL_SECONDS")
+	}
+	switch {
+	case strings.EqualFold(c.AuthSessionStore, "valkey") && c.KVURL() == "":
+		problems = append(problems, "AUTH_SESSION_STORE: valkey requires VALKEY_URL or REDIS_URL")
+	case strings.EqualFold(c.AuthSessionStore, "postgres") && c.DatabaseURL == "":
+		problems = append(problems, "AUTH_SESSION_STORE: postgres requires DATABASE_URL")
+	}
+	return problems
+}
+
+// oauthProblems reports sign-in providers configured by halves.
+func (c *Config) oauthProblems() []string {
+	var problems []string
+	for _, p := range []struct{ prefix, id, secret string }{
+		{"GITHUB", c.GitHubClientID, c.GitHubClientSecret},
+		{"GOOGLE", c.GoogleClientID, c.GoogleClientSecret},
+		{"GITLAB", c.GitLabClientID, c.GitLabClientSecret},
+		{"MICROSOFT", c.MicrosoftClientID, c.MicrosoftClientSecret},
+		{"OIDC", c.OIDCClientID, c.OIDCClientSecret},
+	} {
+		switch {
+		case p.id != "" && p.secret == "":
+			problems = append(problems, p.prefix+"_CLIENT_SECRET: required when "+p.prefix+"_CLIENT_ID is set")
+		case p.id == "" && p.secret != "":
+			problems = append(problems, p.prefix+"_CLIENT_ID: required when "+p.prefix+"_CLIENT_SECRET is set")
+		}
+	}
+	if c.OIDCClientID != "" && c.OIDCIssuer == "" {
+		problems = append(problems, "OIDC_ISSUER: required when OIDC_CLIENT_ID is set")
+	}
+	return problems
+}
+
+// accountsProblems checks the argon2id parameters (golang.org/x/crypto/argon2 limits) and, in
+// production, that emailed links have a fixed origin instead of the client's Host header.
+func (c *Config) accountsProblems() []string {
+	var problems []string
+	if c.IsProduction() {
+		if u, err := url.Parse(c.SiteBaseURL); c.SiteBaseURL == "" || err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			problems = append(problems, "SITE_BASE_URL: an absolute http(s) URL is required when APP_ENV=production (verification and password-reset links must not be built from the Host header)")
+		}
+	}
+	if c.Argon2Time < 1 {
+		problems = append(problems, "ARGON2_TIME: must be at least 1")
+	}
+	if c.Argon2Threads < 1 || c.Argon2Threads > 255 {
+		problems = append(problems, "ARGON2_THREADS: must be between 1 and 255")
+	}
+	if c.Argon2MemoryKiB < 8*c.Argon2Threads || c.Argon2MemoryKiB > 1<<22 {
+		problems = append(problems, "ARGON2_MEMORY_KIB: must be at least 8 x ARGON2_THREADS and at most 4194304 (4 GiB)")
+	}
+	return problems
+}
+
+// lookupValue returns KEY, or the trimmed contents of the file named by KEY_FILE.
+func lookupValue(lookup func(string) (string, bool), key string) (string, error) {
+	val, _ := lookup(key)
+	val = strings.TrimSpace(val)
+	path, _ := lookup(key + "_FILE")
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return val, nil
+	}
+	if val != "" {
+		return "", fmt.Errorf("%s: set either %s or %s_FILE, not both", key, key, key)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("%s_FILE: %v", key, err)
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func setValue(fv reflect.Value, raw string) error {
+	if fv.Type() == durationType {
+		if raw == "" {
+			return nil
+		}
+		if n, err := strconv.Atoi(raw); err == nil {
+			fv.SetInt(int64(time.Duration(n) * time.Second))
+			return nil
+		}
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q (use seconds or a Go duration like 30s)", raw)
+		}
+		fv.SetInt(int64(d))
+		return nil
+	}
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(raw)
+	case reflect.Bool:
+		if raw == "" {
+			return nil
+		}
+		switch strings.ToLower(raw) {
+		case "1", "true", "yes", "on":
+			fv.SetBool(true)
+		case "0", "false", "no", "off":
+			fv.SetBool(false)
+		default:
+			return fmt.Errorf("invalid boolean %q (use 1/0 or true/false)", raw)
+		}
+	case reflect.Int:
+		if raw == "" {
+			return nil
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		fv.SetInt(int64(n))
+	case reflect.Float64:
+		if raw == "" {
+			return nil
+		}
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", raw)
+		}
+		fv.SetFloat(f)
+	case reflect.Slice:
+		var out []string
+		for _, p := range strings.Split(raw, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				out = append(out, p)
+			}
+		}
+		fv.Set(reflect.ValueOf(out))
+	default:
+		return fmt.Errorf("unsupported field type %s", fv.Type())
+	}
+	return nil
+}
+
+func formatValue(fv reflect.Value) string {
+	if fv.Type() == durationType {
+		return time.Duration(fv.Int()).String()
+	}
+	switch fv.Kind() {
+	case reflect.Bool:
+		return strconv.FormatBool(fv.Bool())
+	case reflect.Int:
+		return strconv.FormatInt(fv.Int(), 10)
+	case reflect.Float64:
+		return strconv.FormatFloat(fv.Float(), 'g', -1, 64)
+	case reflect.Slice:
+		return strings.Join(fv.Interface().([]string), ",")
+	default:
+		return fv.String()
+	}
+}
@@ -0,0 +1,217 @@
+// Package csrf implements synchronizer-token CSRF protection. A random token is stored
+// in the scs session and must be echoed on every state-changing request, either in the
+// X-CSRF-Token header (HTMX, fetch) or in the csrf_token form field (plain forms).
+//
+// Templates render the field with templates.CSRFField() and the layout exposes the token
+// in <meta name="csrf-token">, which app.js copies into hx-headers for HTMX requests.
+//
+// The token, and with it the session, is only created when a page needs one: requests that
+// render no HTML (health probes, JWKS, Bearer API calls) get no session cookie.
+package csrf
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/alexedwards/scs/v2"
+)
+
+const (
+	// FieldName is the form field checked on form submissions.
+	FieldName = "csrf_token"
+	// HeaderName is the request header checked for HTMX and API clients.
+	HeaderName = "X-CSRF-Token"
+	// sessionKey is where the token lives in the session.
+	sessionKey = "csrf_token"
+)
+
+type ctxKey struct{}
+
+var (
+	mu           sync.RWMutex
+	exempt       []string // path prefixes that skip verification entirely
+	bearerPrefix []string // path prefixes where "Authorization: Bearer" skips verification
+)
+
+// Exempt disables verification for requests whose path starts with any of the prefixes.
+// Use it for endpoints that browsers call without a session, such as report collectors
+// or webhooks that authenticate by signature.
+func Exempt(prefixes ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+	exempt = append(exempt, prefixes...)
+}
+
+// ExemptBearer skips verification under the given path prefixes when the request carries
+// an "Authorization: Bearer" header. Browsers never attach that header on their own, so
+// token-authenticated API clients are not exposed to CSRF; cookie-authenticated requests
+// to the same routes are still checked.
+func ExemptBearer(prefixes ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+	bearerPrefix = append(bearerPrefix, prefixes...)
+}
+
+// Token returns the token for the current request, creating it on first use ("" outside the
+// middleware, e.g. during static export).
+func Token(ctx context.Context) string {
+	l, _ := ctx.Value(ctxKey{}).(*lazyToken)
+	if l == nil {
+		return ""
+	}
+	return l.get()
+}
+
+// lazyToken is the session token of one request, created when first asked for.
+type lazyToken struct {
+	sm  *scs.SessionManager
+	ctx context.Context
+	mu  sync.Mutex
+	tok string
+}
+
+func (l *lazyToken) get() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.tok == "" {
+		l.tok = newToken()
+		l.sm.Put(l.ctx, sessionKey, l.tok)
+	}
+	return l.tok
+}
+
+func (l *lazyToken) set(tok string) {
+	l.mu.Lock()
+	l.tok = tok
+	l.mu.Unlock()
+}
+
+// htmlWriter creates the token before an HTML response starts: scs commits the session when
+// the header is written, so a token first asked for while rendering would be lost.
+type htmlWriter struct {
+	http.ResponseWriter
+	l       *lazyToken
+	started bool
+}
+
+func (w *htmlWriter) start(body []byte) {
+	if w.started {
+		return
+	}
+	w.started = true
+	ct := w.Header().Get("Content-Type")
+	if ct == "" && body != nil {
+		ct = http.DetectContentType(body)
+	}
+	if strings.HasPrefix(ct, "text/html") {
+		w.l.get()
+	}
+}
+
+func (w *htmlWriter) WriteHeader(code int) {
+	w.start(nil)
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *htmlWriter) Write(b []byte) (int, error) {
+	w.start(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *htmlWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *htmlWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// Middleware verifies the session token on POST, PUT, PATCH and DELETE and makes it
+// available to Token, which creates it on first use. It must run inside sm.LoadAndSave.
+// Failures get 403; HTMX requests additionally receive an HX-Reswap: none header so the page
+// is left untouched.
+func Middleware(sm *scs.SessionManager) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p := r.URL.Path
+			if hasPrefix(exemptList(), p) || strings.HasPrefix(p, "/static/") {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ctx := r.Context()
+			l := &lazyToken{sm: sm, ctx: ctx, tok: sm.GetString(ctx, sessionKey)}
+			tok := l.tok
+			r = r.WithContext(context.WithValue(ctx, ctxKey{}, l))
+			w = &htmlWriter{ResponseWriter: w, l: l}
+
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+				next.ServeHTTP(w, r)
+				return
+			}
+			if isBearer(r) && hasPrefix(bearerList(), p) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			sent := r.Header.Get(HeaderName)
+			if sent == "" {
+				sent = r.PostFormValue(FieldName)
+			}
+			if sent == "" || subtle.ConstantTimeCompare([]byte(sent), []byte(tok)) != 1 {
+				if r.Header.Get("HX-Request") == "true" {
+					w.Header().Set("HX-Reswap", "none")
+				}
+				http.Error(w, "forbidden: invalid or missing CSRF token", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Renew replaces the session token. Call it after login or any privilege change.
+func Renew(ctx context.Context, sm *scs.SessionManager) string {
+	tok := newToken()
+	sm.Put(ctx, sessionKey, tok)
+	if l, _ := ctx.Value(ctxKey{}).(*lazyToken); l != nil {
+		l.set(tok)
+	}
+	return tok
+}
+
+func newToken() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func isBearer(r *http.Request) bool {
+	h := r.Header.Get("Authorization")
+	return len(h) > 7 && strings.EqualFold(h[:7], "bearer ")
+}
+
+func exemptList() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return exempt
+}
+
+func bearerList() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return bearerPrefix
+}
+
+func hasPrefix(prefixes []string, p string) bool {
+	for _, pre := range prefixes {
+		if strings.HasPrefix(p, pre) {
+			return true
+		}
+	}
+	return false
+}
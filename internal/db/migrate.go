@@ -0,0 +1,27 @@
+package db
+
+import (
+  "context"
+  "database/sql"
+  "errors"
+  "io/fs"
+
+  _ "github.com/jackc/pgx/v5/stdlib"
+  "github.com/pressly/goose/v3"
+  "gothicforge3/internal/config"
+)
+
+// Migrate applies the goose SQL migrations in fsys (e.g. app.Migrations(), embedded in the
+// server binary) to DATABASE_URL.
+func Migrate(ctx context.Context, fsys fs.FS) error {
+  dsn := config.Current().DatabaseURL
+  if dsn == "" { return errors.New("DATABASE_URL is empty") }
+  dbx, err := sql.Open("pgx", dsn)
+  if err != nil { return err }
+  defer dbx.Close()
+  if err := dbx.PingContext(ctx); err != nil { return err }
+  goose.SetBaseFS(fsys)
+  defer goose.SetBaseFS(nil)
+  if err := goose.SetDialect("postgres"); err != nil { return err }
+  return goose.UpContext(ctx, dbx, ".")
+}
@@ -3,11 +3,11 @@ package db
 import (
   "context"
   "errors"
-  "os"
-  "strings"
   "time"
 
   "github.com/jackc/pgx/v5/pgxpool"
+  "gothicforge3/internal/config"
+  "gothicforge3/internal/tracing"
 )
 
 var pool *pgxpool.Pool
@@ -15,12 +15,14 @@ var pool *pgxpool.Pool
 // Connect initializes a global pgx pool using DATABASE_URL if not already connected.
 func Connect(ctx context.Context) error {
   if pool != nil { return nil }
-  dsn := strings.TrimSpace(os.Getenv("DATABASE_URL"))
+  dsn := config.Current().DatabaseURL
   if dsn == "" {
     return errors.New("DATABASE_URL is empty")
   }
   cfg, err := pgxpool.ParseConfig(dsn)
   if err != nil { return err }
+  // Query spans (no-op unless tracing is enabled)
+  cfg.ConnConfig.Tracer = tracing.PgxTracer()
   // Reasonable defaults; keep conservative for local/dev
   // cfg.MaxConns = 5
   cctx, cancel := context.WithTimeout(ctx, 5*time.Second)
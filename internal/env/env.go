@@ -1,7 +1,7 @@
 package env
 
 import (
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
@@ -22,9 +22,9 @@ func Load() error {
 			mode := strings.ToLower(strings.TrimSpace(os.Getenv("APP_ENV")))
 			if mode == "" || mode == "development" {
 				if err := godotenv.Overload(p); err != nil {
-					log.Printf("env: could not overload %s: %v", p, err)
+					slog.Warn("env: could not overload", "file", p, "error", err)
 				} else {
-					log.Printf("env: loaded %s (overload)", p)
+					slog.Debug("env: loaded (overload)", "file", p)
 				}
 			} else {
 				_ = godotenv.Load(p)
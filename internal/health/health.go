@@ -0,0 +1,195 @@
+// Package health is a registry of named dependency checks behind the Kubernetes-style probe
+// endpoints:
+//
+//	/livez     the process is alive (only checks registered with Live)
+//	/readyz    the instance can serve traffic (every Ready check; the default scope)
+//	/startupz  startup hooks have finished (MarkStarted) and Startup checks pass
+//
+// Features register their own checks, typically while the router is built:
+//
+//	health.Register(health.Check{Name: "valkey", Critical: true, Timeout: 2 * time.Second,
+//		CacheTTL: 2 * time.Second, Fn: kv.Ping})
+//
+// Checks run in parallel, each under its own timeout; a result younger than CacheTTL is reused
+// so aggressive probing does not hammer dependencies. A failing critical check answers 503; a
+// failing non-critical check only marks the report "degraded". Return ErrSkip from Fn when the
+// dependency is not configured.
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Scope selects the probes a check takes part in.
+type Scope uint8
+
+const (
+	Ready   Scope = 1 << iota // /readyz (default when Scope is zero)
+	Live                      // /livez
+	Startup                   // /startupz
+)
+
+// DefaultTimeout bounds a check that does not set Timeout.
+const DefaultTimeout = 2 * time.Second
+
+// ErrSkip reports that a check does not apply (e.g. the dependency is not configured).
+var ErrSkip = errors.New("skip")
+
+// Check is a named dependency check.
+type Check struct {
+	Name     string
+	Scope    Scope         // probes the check belongs to; zero means Ready
+	Critical bool          // a failure makes the probe answer 503
+	Timeout  time.Duration // per-run deadline (DefaultTimeout when zero)
+	CacheTTL time.Duration // reuse the last result for this long (zero: run on every probe)
+	Fn       func(ctx context.Context) error
+}
+
+// Status of a single check or a whole report.
+type Status string
+
+const (
+	StatusOK       Status = "ok"
+	StatusSkip     Status = "skip"
+	StatusFail     Status = "fail"
+	StatusDegraded Status = "degraded" // reports only: a non-critical check failed
+)
+
+// Result is the outcome of one check.
+type Result struct {
+	Name       string    `json:"name"`
+	Status     Status    `json:"status"`
+	Critical   bool      `json:"critical"`
+	Error      string    `json:"error,omitempty"`
+	DurationMS float64   `json:"duration_ms"`
+	Cached     bool      `json:"cached,omitempty"`
+	CheckedAt  time.Time `json:"checked_at"`
+}
+
+// Report is the outcome of a probe.
+type Report struct {
+	Probe  string   `json:"probe"`
+	Status Status   `json:"status"`
+	Checks []Result `json:"checks"`
+}
+
+// Healthy reports whether the probe should answer 200.
+func (r Report) Healthy() bool { return r.Status != StatusFail }
+
+type entry struct {
+	check Check
+	mu    sync.Mutex // serializes runs so concurrent probes share one result
+	last  Result
+	at    time.Time
+}
+
+var (
+	mu      sync.RWMutex
+	checks  = map[string]*entry{}
+	started atomic.Bool
+)
+
+// Register adds c, replacing any check with the same name.
+func Register(c Check) {
+	if c.Name == "" || c.Fn == nil {
+		panic("health: check needs a Name and Fn")
+	}
+	if c.Scope == 0 {
+		c.Scope = Ready
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultTimeout
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	checks[c.Name] = &entry{check: c}
+}
+
+// Unregister removes the named check.
+func Unregister(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+	delete(checks, name)
+}
+
+// MarkStarted flips /startupz to passing once startup hooks have completed.
+func MarkStarted() { started.Store(true) }
+
+// Started reports whether MarkStarted has been called.
+func Started() bool { return started.Load() }
+
+// Run executes every check in scope in parallel and returns the report for probe.
+func Run(ctx context.Context, probe string, scope Scope) Report {
+	mu.RLock()
+	es := make([]*entry, 0, len(checks))
+	for _, e := range checks {
+		if e.check.Scope&scope != 0 {
+			es = append(es, e)
+		}
+	}
+	mu.RUnlock()
+	sort.Slice(es, func(i, j int) bool { return es[i].check.Name < es[j].check.Name })
+
+	rep := Report{Probe: probe, Status: StatusOK, Checks: make([]Result, len(es))}
+	var wg sync.WaitGroup
+	for i, e := range es {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rep.Checks[i] = e.run(ctx)
+		}()
+	}
+	wg.Wait()
+	for _, r := range rep.Checks {
+		if r.Status != StatusFail {
+			continue
+		}
+		if r.Critical {
+			rep.Status = StatusFail
+		} else if rep.Status == StatusOK {
+			rep.Status = StatusDegraded
+		}
+	}
+	return rep
+}
+
+func (e *entry) run(ctx context.Context) Result {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	c := e.check
+	if c.CacheTTL > 0 && !e.at.IsZero() && time.Since(e.at) < c.CacheTTL {
+		r := e.last
+		r.Cached = true
+		return r
+	}
+	start := time.Now()
+	cctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- c.Fn(cctx) }()
+	var err error
+	select {
+	case err = <-done:
+	case <-cctx.Done():
+		err = fmt.Errorf("timeout after %s", c.Timeout)
+	}
+	r := Result{Name: c.Name, Critical: c.Critical, Status: StatusOK, CheckedAt: start.UTC(),
+		DurationMS: float64(time.Since(start).Microseconds()) / 1000}
+	switch {
+	case errors.Is(err, ErrSkip):
+		r.Status = StatusSkip
+	case err != nil:
+		r.Status, r.Error = StatusFail, err.Error()
+	}
+	// A probe cancelled by its caller says nothing about the dependency; don't cache it.
+	if ctx.Err() == nil {
+		e.last, e.at = r, start
+	}
+	return r
+}
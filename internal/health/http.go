@@ -0,0 +1,118 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Probe names, also the paths they are mounted on.
+const (
+	Livez    = "livez"
+	Readyz   = "readyz"
+	Startupz = "startupz"
+)
+
+// Probes lists the probe names in the order doctor reports them.
+var Probes = []string{Livez, Readyz, Startupz}
+
+// Probe runs the named probe. /startupz also fails until MarkStarted has been called.
+func Probe(ctx context.Context, name string) Report {
+	switch name {
+	case Livez:
+		return Run(ctx, name, Live)
+	case Startupz:
+		rep := Run(ctx, name, Startup)
+		st := Result{Name: "started", Status: StatusOK, Critical: true, CheckedAt: time.Now().UTC()}
+		if !Started() {
+			st.Status, st.Error = StatusFail, "startup hooks still running"
+			rep.Status = StatusFail
+		}
+		rep.Checks = append([]Result{st}, rep.Checks...)
+		return rep
+	default:
+		return Run(ctx, Readyz, Ready)
+	}
+}
+
+// Handler serves the named probe: 200 unless a critical check fails (503). The body is plain
+// text ("ok", or one line per check with ?verbose or on failure), or JSON with ?format=json
+// or Accept: application/json.
+func Handler(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rep := Probe(r.Context(), name)
+		code := http.StatusOK
+		if !rep.Healthy() {
+			code = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		if wantsJSON(r) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(code)
+			_ = json.NewEncoder(w).Encode(rep)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(code)
+		_, verbose := r.URL.Query()["verbose"]
+		_ = WriteText(w, rep, verbose || code != http.StatusOK)
+	})
+}
+
+// WriteText renders rep as text: one "[+] name ok" line per check when verbose, then the
+// overall status.
+func WriteText(w io.Writer, rep Report, verbose bool) error {
+	var b strings.Builder
+	if verbose {
+		for _, c := range rep.Checks {
+			mark := map[Status]string{StatusOK: "+", StatusSkip: "~", StatusFail: "-"}[c.Status]
+			fmt.Fprintf(&b, "[%s] %s %s", mark, c.Name, c.Status)
+			if c.Error != "" {
+				fmt.Fprintf(&b, ": %s", c.Error)
+			}
+			if c.Status == StatusFail && !c.Critical {
+				b.WriteString(" (non-critical)")
+			}
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "%s check %s\n", rep.Probe, rep.Status)
+	} else {
+		b.WriteString(string(rep.Status))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func wantsJSON(r *http.Request) bool {
+	if f := r.URL.Query().Get("format"); f != "" {
+		return strings.EqualFold(f, "json")
+	}
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+// Fetch queries a probe on a running instance (e.g. http://127.0.0.1:8080) and decodes the
+// JSON report. A 503 is not an error: the report says what failed.
+func Fetch(ctx context.Context, baseURL, name string) (Report, error) {
+	var rep Report
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(baseURL, "/")+"/"+name+"?format=json", nil)
+	if err != nil {
+		return rep, err
+	}
+	req.Header.Set("Accept", "application/json")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return rep, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusServiceUnavailable {
+		return rep, fmt.Errorf("%s: unexpected status %s", name, res.Status)
+	}
+	if err := json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(&rep); err != nil {
+		return rep, fmt.Errorf("%s: %w", name, err)
+	}
+	return rep, nil
+}
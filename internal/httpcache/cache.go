@@ -0,0 +1,258 @@
+package httpcache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/a-h/templ"
+	"gothicforge3/internal/csrf"
+	"gothicforge3/internal/kv"
+	"gothicforge3/internal/logging"
+)
+
+// CacheOptions configures Cache.
+type CacheOptions struct {
+	// TTL bounds how long a response is reused (required; 0 disables caching).
+	TTL time.Duration
+	// Tags are recorded with every entry; Invalidate(ctx, tag) drops them.
+	Tags []string
+	// Vary lists request headers whose values select a separate entry (e.g. "Accept-Language").
+	// HX-Request is always included: htmx requests to a page URL receive a fragment.
+	Vary []string
+}
+
+// Placeholders stored in place of the per-request CSP nonce and the session CSRF token, so one
+// cached body can be served to every request with that request's own values.
+const (
+	noncePlaceholder = "\x00gf:nonce\x00"
+	csrfPlaceholder  = "\x00gf:csrf\x00"
+)
+
+var enabled atomic.Bool
+
+func init() { enabled.Store(true) }
+
+// Enable turns response and fragment caching on or off (HTTP_CACHE_DISABLE=1 turns it off).
+// Invalidation still runs while disabled.
+func Enable(on bool) { enabled.Store(on) }
+
+// entry is a cached response.
+type entry struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+// errUncacheable carries a response that must not be stored (non-200, no-store, Set-Cookie).
+type errUncacheable struct{ rec *recorder }
+
+func (errUncacheable) Error() string { return "httpcache: response not cacheable" }
+
+// Cache serves GET responses from the kv store (Valkey when configured, in-memory otherwise),
+// keyed by path, query string and the Vary headers. Only 200 responses are stored; the first
+// request after expiry or invalidation renders the page, concurrent ones wait for it (see
+// kv.GetOrCompute). Responses carry X-Cache: HIT or MISS.
+//
+// The CSP nonce and CSRF token rendered into a page are swapped for the current request's
+// values on every hit, but anything else is shared by everyone who hits the entry: do not wrap
+// pages that render per-user data unless a Vary header separates the users.
+func Cache(opts CacheOptions) func(http.Handler) http.Handler {
+	vary := append([]string{"HX-Request"}, opts.Vary...)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet || opts.TTL <= 0 || !enabled.Load() {
+				next.ServeHTTP(w, r)
+				return
+			}
+			for _, h := range vary {
+				w.Header().Add("Vary", h)
+			}
+			ctx := r.Context()
+			nonce, token := templ.GetNonce(ctx), csrf.Token(ctx)
+			mine := &recorder{header: http.Header{}}
+			status := "HIT"
+			b, err := kv.GetOrCompute(ctx, responseKey(r, vary), opts.TTL, func(context.Context) ([]byte, error) {
+				status = "MISS"
+				next.ServeHTTP(mine, r)
+				if !mine.cacheable() {
+					return nil, errUncacheable{rec: mine}
+				}
+				return json.Marshal(entry{Status: mine.status(), Header: mine.header, Body: normalize(mine.body.Bytes(), nonce, token)})
+			}, opts.Tags...)
+			var u errUncacheable
+			switch {
+			case errors.As(err, &u) && u.rec == mine:
+				mine.replay(w)
+				return
+			case err != nil:
+				// A concurrent request's response was not cacheable, or the entry is unreadable.
+				next.ServeHTTP(w, r)
+				return
+			}
+			var e entry
+			if err := json.Unmarshal(b, &e); err != nil {
+				logging.FromContext(ctx).Warn("httpcache: bad entry", "error", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+			copyHeader(w.Header(), e.Header)
+			w.Header().Set("X-Cache", status)
+			w.WriteHeader(e.Status)
+			_, _ = w.Write(denormalize(e.Body, nonce, token))
+		})
+	}
+}
+
+// Fragment caches the HTML rendered by c under key for ttl, recorded under tags. Like Cache,
+// the CSP nonce and CSRF token are substituted per request; the key must cover everything
+// else the fragment depends on:
+//
+//	@httpcache.Fragment("recent-posts", time.Minute, RecentPosts(posts), "posts")
+func Fragment(key string, ttl time.Duration, c templ.Component, tags ...string) templ.Component {
+	return templ.ComponentFunc(func(ctx context.Context, w io.Writer) error {
+		if ttl <= 0 || !enabled.Load() {
+			return c.Render(ctx, w)
+		}
+		nonce, token := templ.GetNonce(ctx), csrf.Token(ctx)
+		b, err := kv.GetOrCompute(ctx, "httpcache:fragment:"+key, ttl, func(context.Context) ([]byte, error) {
+			var buf bytes.Buffer
+			if err := c.Render(ctx, &buf); err != nil {
+				return nil, err
+			}
+			return normalize(buf.Bytes(), nonce, token), nil
+		}, tags...)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(denormalize(b, nonce, token))
+		return err
+	})
+}
+
+var (
+	hooksMu sync.Mutex
+	hooks   []func(ctx context.Context, tags []string)
+)
+
+// OnInvalidate registers fn to run after Invalidate drops tags, e.g. to purge a CDN.
+func OnInvalidate(fn func(ctx context.Context, tags []string)) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	hooks = append(hooks, fn)
+}
+
+// Invalidate drops every cached response and fragment recorded under any of tags, then runs
+// the OnInvalidate hooks. Mutation handlers call it after writing, e.g. with the table name:
+//
+//	_ = httpcache.Invalidate(req.Context(), "posts")
+func Invalidate(ctx context.Context, tags ...string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	err := kv.InvalidateTags(ctx, tags...)
+	if err != nil {
+		logging.FromContext(ctx).Warn("httpcache: invalidate", "tags", tags, "error", err)
+	}
+	hooksMu.Lock()
+	fns := make([]func(context.Context, []string), len(hooks))
+	copy(fns, hooks)
+	hooksMu.Unlock()
+	for _, fn := range fns {
+		fn(ctx, tags)
+	}
+	return err
+}
+
+// responseKey hashes the path, the (sorted) query string and the Vary header values.
+func responseKey(r *http.Request, vary []string) string {
+	h := sha256.New()
+	h.Write([]byte(r.URL.Path + "?" + r.URL.Query().Encode()))
+	for _, name := range vary {
+		h.Write([]byte("\n" + strings.ToLower(name) + ":" + r.Header.Get(name)))
+	}
+	return "httpcache:response:" + hex.EncodeToString(h.Sum(nil))
+}
+
+func normalize(b []byte, nonce, token string) []byte {
+	if nonce != "" {
+		b = bytes.ReplaceAll(b, []byte(nonce), []byte(noncePlaceholder))
+	}
+	if token != "" {
+		b = bytes.ReplaceAll(b, []byte(token), []byte(csrfPlaceholder))
+	}
+	return b
+}
+
+func denormalize(b []byte, nonce, token string) []byte {
+	b = bytes.ReplaceAll(b, []byte(noncePlaceholder), []byte(nonce))
+	return bytes.ReplaceAll(b, []byte(csrfPlaceholder), []byte(token))
+}
+
+// copyHeader adds src to dst, except headers that belong to a single response.
+func copyHeader(dst, src http.Header) {
+	for k, vs := range src {
+		switch k {
+		case "Set-Cookie", "Content-Length", "Date":
+			continue
+		}
+		for _, v := range vs {
+			dst.Add(k, v)
+		}
+	}
+}
+
+// recorder captures the handler's response on a miss. Header starts empty so only headers
+// set by the handler (not outer middleware) are stored.
+type recorder struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func (c *recorder) Header() http.Header { return c.header }
+
+func (c *recorder) WriteHeader(code int) {
+	if c.code == 0 {
+		c.code = code
+	}
+}
+
+func (c *recorder) Write(p []byte) (int, error) {
+	if c.code == 0 {
+		c.code = http.StatusOK
+	}
+	return c.body.Write(p)
+}
+
+func (c *recorder) status() int {
+	if c.code == 0 {
+		return http.StatusOK
+	}
+	return c.code
+}
+
+func (c *recorder) cacheable() bool {
+	return c.status() == http.StatusOK && c.header.Get("Set-Cookie") == "" && !noStore(c.header.Get("Cache-Control"))
+}
+
+// replay writes an uncacheable response to w.
+func (c *recorder) replay(w http.ResponseWriter) {
+	for k, vs := range c.header {
+		for _, v := range vs {
+			w.Header().Add(k, v)
+		}
+	}
+	w.Header().Set("X-Cache", "MISS")
+	w.WriteHeader(c.status())
+	_, _ = w.Write(c.body.Bytes())
+}
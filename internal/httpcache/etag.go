@@ -0,0 +1,187 @@
+package httpcache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/a-h/templ"
+	"gothicforge3/internal/assets"
+)
+
+// MaxBuffer bounds how much of a response ETag buffers; larger responses are streamed without
+// a validator.
+const MaxBuffer = 1 << 20
+
+// Options configures ETag.
+type Options struct {
+	// Weak always emits weak validators (W/"..."). Otherwise they are strong, except when the
+	// client accepts gzip or deflate: the compression middleware (which runs outside ETag)
+	// re-encodes the body, so the validator only promises semantic equivalence.
+	Weak bool
+}
+
+// ETag buffers successful HTML responses to GET requests, tags them with a hash of the body and
+// answers a matching If-None-Match with 304 Not Modified.
+//
+// The per-request CSP nonce is left out of the hash, so unchanged pages keep their ETag. A 304
+// carries no Content-Security-Policy: the browser keeps the policy stored with its cached body,
+// whose nonce is the one that body was rendered with. Responses that set their own ETag, carry
+// Content-Encoding or Cache-Control: no-store, and /static paths (fingerprinted, see package
+// assets) pass through untouched. HTML gets Vary: HX-Request because htmx requests to the same
+// URL receive fragments.
+func ETag(opts Options) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet || strings.HasPrefix(r.URL.Path, assets.Prefix) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			bw := &bufferedWriter{ResponseWriter: w}
+			next.ServeHTTP(bw, r)
+			if !bw.streaming {
+				bw.finish(r, opts.Weak || compressed(r))
+			}
+		})
+	}
+}
+
+// bufferedWriter holds the body of an eligible response until the handler returns.
+type bufferedWriter struct {
+	http.ResponseWriter
+	status    int
+	buf       bytes.Buffer
+	streaming bool
+}
+
+func (b *bufferedWriter) WriteHeader(code int) {
+	if b.streaming {
+		b.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if b.status != 0 {
+		return
+	}
+	b.status = code
+	if !b.eligible() {
+		b.stream()
+	}
+}
+
+func (b *bufferedWriter) Write(p []byte) (int, error) {
+	if b.status == 0 {
+		b.WriteHeader(http.StatusOK)
+	}
+	if !b.streaming && b.buf.Len()+len(p) > MaxBuffer {
+		b.stream()
+	}
+	if b.streaming {
+		return b.ResponseWriter.Write(p)
+	}
+	return b.buf.Write(p)
+}
+
+// Flush is ignored while an HTML response is buffered: templ flushes after every render.
+// Streaming responses (text/event-stream and other non-HTML types) are never buffered.
+func (b *bufferedWriter) Flush() {
+	if !b.streaming {
+		return
+	}
+	if f, ok := b.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (b *bufferedWriter) Unwrap() http.ResponseWriter { return b.ResponseWriter }
+
+// eligible is decided when the status is written; a missing Content-Type is sniffed in finish.
+func (b *bufferedWriter) eligible() bool {
+	h := b.Header()
+	ct := h.Get("Content-Type")
+	return b.status == http.StatusOK && (ct == "" || isHTML(ct)) &&
+		h.Get("ETag") == "" && h.Get("Content-Encoding") == "" && !noStore(h.Get("Cache-Control"))
+}
+
+// stream writes what was buffered and passes everything after it straight through.
+func (b *bufferedWriter) stream() {
+	if b.streaming {
+		return
+	}
+	b.streaming = true
+	if b.status == 0 {
+		return
+	}
+	b.ResponseWriter.WriteHeader(b.status)
+	if b.buf.Len() > 0 {
+		_, _ = b.ResponseWriter.Write(b.buf.Bytes())
+		b.buf.Reset()
+	}
+}
+
+func (b *bufferedWriter) finish(r *http.Request, weak bool) {
+	h := b.Header()
+	body := b.buf.Bytes()
+	if h.Get("Content-Type") == "" && len(body) > 0 {
+		h.Set("Content-Type", http.DetectContentType(body))
+	}
+	if b.status == 0 || len(body) == 0 || !isHTML(h.Get("Content-Type")) {
+		b.stream()
+		return
+	}
+	if h.Get("Cache-Control") == "" {
+		h.Set("Cache-Control", NoCache)
+	}
+	h.Add("Vary", "HX-Request")
+	tag := Tag(body, templ.GetNonce(r.Context()), weak)
+	h.Set("ETag", tag)
+	if Match(r.Header.Get("If-None-Match"), tag) {
+		for _, k := range []string{"Content-Type", "Content-Length", "Content-Security-Policy"} {
+			h.Del(k)
+		}
+		b.ResponseWriter.WriteHeader(http.StatusNotModified)
+		return
+	}
+	h.Set("Content-Length", strconv.Itoa(len(body)))
+	b.stream()
+}
+
+// Tag returns the entity tag for body, ignoring occurrences of nonce.
+func Tag(body []byte, nonce string, weak bool) string {
+	if nonce != "" {
+		body = bytes.ReplaceAll(body, []byte(nonce), nil)
+	}
+	sum := sha256.Sum256(body)
+	tag := `"` + hex.EncodeToString(sum[:10]) + `"`
+	if weak {
+		return "W/" + tag
+	}
+	return tag
+}
+
+// Match reports whether an If-None-Match header matches tag. If-None-Match always uses the
+// weak comparison (RFC 9110 §13.1.2), so W/ prefixes are ignored.
+func Match(header, tag string) bool {
+	tag = strings.TrimPrefix(tag, "W/")
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" || strings.TrimPrefix(t, "W/") == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func isHTML(ct string) bool {
+	mt, _, err := mime.ParseMediaType(ct)
+	return err == nil && mt == "text/html"
+}
+
+// compressed reports whether the request accepts an encoding middleware.Compress produces.
+func compressed(r *http.Request) bool {
+	ae := strings.ToLower(r.Header.Get("Accept-Encoding"))
+	return strings.Contains(ae, "gzip") || strings.Contains(ae, "deflate")
+}
@@ -0,0 +1,65 @@
+// Package httpcache adds HTTP caching to rendered pages: validators (ETag answered with 304 on
+// If-None-Match), per-route Cache-Control policies, and server-side caching of whole responses
+// (Cache) or templ components (Fragment) in the kv store, dropped by tag with Invalidate.
+//
+// ETag is opt-in (ETAG_ENABLE=1) and installed by server.New after the CSP and CSRF
+// middlewares. Routes declare how browsers and shared caches may keep their responses:
+//
+//	r.With(httpcache.Policy(httpcache.Public(5*time.Minute))).Get("/about", about)
+//	r.With(httpcache.Policy(httpcache.NoStore)).Get("/account", account)
+//
+// HTML responses without a policy get NoCache: browsers keep them but revalidate each time,
+// which the ETag turns into a cheap 304.
+//
+// Server-side caching skips the handler (and its queries) entirely until the TTL ends or a
+// mutation invalidates a tag:
+//
+//	r.With(httpcache.Cache(httpcache.CacheOptions{TTL: time.Minute, Tags: []string{"posts"}})).Get("/db/posts", list)
+//	_ = httpcache.Invalidate(ctx, "posts") // after INSERT/UPDATE/DELETE
+package httpcache
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Common Cache-Control values.
+const (
+	// NoCache lets the browser store the page but requires revalidation on every use.
+	NoCache = "private, no-cache"
+	// NoStore forbids storing the response anywhere; such responses get no ETag.
+	NoStore = "no-store"
+)
+
+// Public allows browsers and shared caches (CDNs) to reuse the response for maxAge. Only use it
+// for pages that render nothing session specific (no CSRF field, no user name).
+func Public(maxAge time.Duration) string {
+	return "public, max-age=" + strconv.Itoa(int(maxAge.Seconds()))
+}
+
+// Private allows only the browser to reuse the response for maxAge without revalidating.
+func Private(maxAge time.Duration) string {
+	return "private, max-age=" + strconv.Itoa(int(maxAge.Seconds()))
+}
+
+// Policy sets Cache-Control for the routes it wraps. A handler may still set its own value.
+func Policy(cacheControl string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", cacheControl)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// noStore reports whether a Cache-Control value forbids storing the response.
+func noStore(cc string) bool {
+	for _, d := range strings.Split(cc, ",") {
+		if strings.EqualFold(strings.TrimSpace(d), "no-store") {
+			return true
+		}
+	}
+	return false
+}
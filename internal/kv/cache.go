@@ -0,0 +1,146 @@
+package kv
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Store is a byte cache with expiry and tag-based invalidation.
+type Store interface {
+	// Get returns the value for key; ok is false on a miss.
+	Get(ctx context.Context, key string) (val []byte, ok bool, err error)
+	// Set stores val under key for ttl (0 means no expiry) and records it under tags.
+	Set(ctx context.Context, key string, val []byte, ttl time.Duration, tags ...string) error
+	// Delete removes keys.
+	Delete(ctx context.Context, keys ...string) error
+	// InvalidateTags removes every key recorded under any of the tags.
+	InvalidateTags(ctx context.Context, tags ...string) error
+	// Lock tries to take a short-lived lock and returns a release func when it succeeds.
+	Lock(ctx context.Context, key string, ttl time.Duration) (release func(), ok bool, err error)
+}
+
+// Default returns the active store (Valkey or in-memory).
+func Default() Store {
+	ensure()
+	mu.RLock()
+	defer mu.RUnlock()
+	return store
+}
+
+// Get reads key from the default store.
+func Get(ctx context.Context, key string) ([]byte, bool, error) {
+	return Default().Get(ctx, key)
+}
+
+// Set writes key to the default store.
+func Set(ctx context.Context, key string, val []byte, ttl time.Duration, tags ...string) error {
+	return Default().Set(ctx, key, val, ttl, tags...)
+}
+
+// Delete removes keys from the default store.
+func Delete(ctx context.Context, keys ...string) error {
+	return Default().Delete(ctx, keys...)
+}
+
+// InvalidateTags drops every entry recorded under any of tags in the default store.
+func InvalidateTags(ctx context.Context, tags ...string) error {
+	return Default().InvalidateTags(ctx, tags...)
+}
+
+// GetJSON decodes the JSON value stored under key into v.
+func GetJSON(ctx context.Context, key string, v any) (bool, error) {
+	b, ok, err := Get(ctx, key)
+	if err != nil || !ok {
+		return false, err
+	}
+	return true, json.Unmarshal(b, v)
+}
+
+// SetJSON stores v as JSON.
+func SetJSON(ctx context.Context, key string, v any, ttl time.Duration, tags ...string) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return Set(ctx, key, b, ttl, tags...)
+}
+
+var (
+	group singleflight.Group
+
+	// lockTTL bounds how long other callers wait for a peer computing the same key.
+	lockTTL  = 10 * time.Second
+	lockPoll = 50 * time.Millisecond
+	// computeTimeout bounds the shared wait and compute, which do not end with the caller
+	// that started them.
+	computeTimeout = 30 * time.Second
+)
+
+// GetOrCompute returns the cached value for key, or calls compute, caches its result for
+// ttl under tags and returns it. Concurrent misses for the same key are collapsed: within
+// the process by a singleflight group, and across instances by a short Valkey lock that
+// makes other callers wait for the winner's value instead of recomputing it.
+//
+// The shared work runs detached from the first caller's context (bounded by computeTimeout),
+// so a client that disconnects does not fail the others waiting on it; each caller still
+// returns as soon as its own ctx is done. Cache errors never fail the call; compute runs and
+// its result is returned.
+func GetOrCompute(ctx context.Context, key string, ttl time.Duration, compute func(context.Context) ([]byte, error), tags ...string) ([]byte, error) {
+	s := Default()
+	if b, ok, err := s.Get(ctx, key); err == nil && ok {
+		return b, nil
+	}
+	ch := group.DoChan(key, func() (any, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), computeTimeout)
+		defer cancel()
+		release, locked, lerr := s.Lock(ctx, "lock:"+key, lockTTL)
+		if lerr == nil && !locked {
+			if b, ok := waitFor(ctx, s, key); ok {
+				return b, nil
+			}
+		}
+		if locked {
+			defer release()
+			// Another instance may have finished between our miss and taking the lock.
+			if b, ok, err := s.Get(ctx, key); err == nil && ok {
+				return b, nil
+			}
+		}
+		b, err := compute(ctx)
+		if err != nil {
+			return nil, err
+		}
+		_ = s.Set(ctx, key, b, ttl, tags...)
+		return b, nil
+	})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.([]byte), nil
+	}
+}
+
+// waitFor polls key until it appears, the lock TTL elapses or ctx is done.
+func waitFor(ctx context.Context, s Store, key string) ([]byte, bool) {
+	deadline := time.Now().Add(lockTTL)
+	t := time.NewTicker(lockPoll)
+	defer t.Stop()
+	for time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return nil, false
+		case <-t.C:
+		}
+		if b, ok, err := s.Get(ctx, key); err == nil && ok {
+			return b, true
+		}
+	}
+	return nil, false
+}
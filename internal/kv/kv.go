@@ -0,0 +1,166 @@
+// Package kv owns the process-wide Valkey/Redis connection pool and a small cache API on
+// top of it. When neither VALKEY_URL nor REDIS_URL is set, an in-memory backend is used
+// so callers never need to branch on configuration.
+//
+// Sessions (scs redisstore), rate limits, readiness checks and application code share the
+// same pool; use Pool for raw commands and Get/Set/GetOrCompute/InvalidateTags for caching.
+package kv
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	redigo "github.com/gomodule/redigo/redis"
+	"gothicforge3/internal/config"
+	"gothicforge3/internal/tracing"
+)
+
+var (
+	errCount atomic.Uint64
+
+	mu      sync.RWMutex
+	pool    *redigo.Pool
+	store   Store
+	started bool
+)
+
+// Init (re)configures the package from cfg: a pooled Valkey backend when cfg.KVURL() is
+// set, the in-memory backend otherwise. A previously opened pool is closed.
+func Init(cfg *config.Config) {
+	var p *redigo.Pool
+	var s Store
+	if raw := cfg.KVURL(); raw != "" {
+		p = newPool(raw, cfg.ValkeyTLSSkipVerify)
+		s = newValkeyStore(p)
+	} else {
+		s = newMemoryStore()
+	}
+	mu.Lock()
+	old := pool
+	pool, store, started = p, s, true
+	mu.Unlock()
+	if old != nil {
+		_ = old.Close()
+	}
+}
+
+// ensure lazily initializes from config.Current() for callers outside server.New
+// (CLI commands, tests).
+func ensure() {
+	mu.RLock()
+	ok := started
+	mu.RUnlock()
+	if !ok {
+		Init(config.Current())
+	}
+}
+
+// Pool returns the shared Valkey pool, or nil when the in-memory backend is active.
+func Pool() *redigo.Pool {
+	ensure()
+	mu.RLock()
+	defer mu.RUnlock()
+	return pool
+}
+
+// Backend reports "valkey" or "memory".
+func Backend() string {
+	if Pool() != nil {
+		return "valkey"
+	}
+	return "memory"
+}
+
+// Ping checks the Valkey connection. It is a no-op for the in-memory backend.
+func Ping(ctx context.Context) error {
+	p := Pool()
+	if p == nil {
+		return nil
+	}
+	c, err := p.GetContext(ctx)
+	if err != nil {
+		return NoteError(err)
+	}
+	defer c.Close()
+	_, err = redigo.DoContext(c, ctx, "PING")
+	return NoteError(err)
+}
+
+// Stats is a snapshot of the Valkey pool for metrics.
+type Stats struct {
+	Backend string
+	Active  int    // connections in use or idle
+	Idle    int    // idle connections
+	Errors  uint64 // Valkey command/connection errors since start
+}
+
+// Snapshot returns current pool statistics.
+func Snapshot() Stats {
+	st := Stats{Backend: Backend(), Errors: errCount.Load()}
+	if p := Pool(); p != nil {
+		ps := p.Stats()
+		st.Active, st.Idle = ps.ActiveCount, ps.IdleCount
+	}
+	return st
+}
+
+// NoteError counts err (if non-nil) as a Valkey error and returns it unchanged. Packages
+// that talk to the pool directly (e.g. rate limiting) use it so errors show up in metrics.
+// A nil reply (redigo.ErrNil) is a miss, not an error.
+func NoteError(err error) error {
+	if err != nil && !errors.Is(err, redigo.ErrNil) {
+		errCount.Add(1)
+	}
+	return err
+}
+
+// Close releases the pool. The next call re-initializes from config.Current().
+func Close() error {
+	mu.Lock()
+	p := pool
+	pool, store, started = nil, nil, false
+	mu.Unlock()
+	if p == nil {
+		return nil
+	}
+	return p.Close()
+}
+
+// newPool builds the pool. rediss:// enables TLS; VALKEY_TLS_SKIP_VERIFY=1 also forces TLS
+// for redis:// URLs and disables certificate verification (some managed providers need it).
+func newPool(raw string, skipVerify bool) *redigo.Pool {
+	if skipVerify && strings.HasPrefix(strings.ToLower(raw), "redis://") {
+		raw = "rediss://" + raw[len("redis://"):]
+	}
+	opts := []redigo.DialOption{
+		redigo.DialConnectTimeout(5 * time.Second),
+		redigo.DialReadTimeout(5 * time.Second),
+		redigo.DialWriteTimeout(5 * time.Second),
+	}
+	if skipVerify {
+		opts = append(opts, redigo.DialTLSSkipVerify(true))
+	}
+	return &redigo.Pool{
+		MaxIdle:     4,
+		IdleTimeout: 300 * time.Second,
+		Dial: func() (redigo.Conn, error) {
+			c, err := redigo.DialURL(raw, opts...)
+			if err != nil {
+				return nil, err
+			}
+			// Commands issued with a context (DoContext) get client spans when tracing is on.
+			return tracing.WrapRedis(c), nil
+		},
+		TestOnBorrow: func(c redigo.Conn, t time.Time) error {
+			if time.Since(t) < time.Minute {
+				return nil
+			}
+			_, err := c.Do("PING")
+			return err
+		},
+	}
+}
@@ -0,0 +1,118 @@
+package kv
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// memoryStore is the single-process backend used when no Valkey URL is configured.
+type memoryStore struct {
+	mu      sync.Mutex
+	items   map[string]memItem
+	tags    map[string]map[string]struct{}
+	sweepAt time.Time
+}
+
+type memItem struct {
+	val []byte
+	exp time.Time // zero means no expiry
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{items: map[string]memItem{}, tags: map[string]map[string]struct{}{}}
+}
+
+func (m *memoryStore) Get(_ context.Context, key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	it, ok := m.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+	if !it.exp.IsZero() && time.Now().After(it.exp) {
+		delete(m.items, key)
+		return nil, false, nil
+	}
+	return append([]byte(nil), it.val...), true, nil
+}
+
+func (m *memoryStore) Set(_ context.Context, key string, val []byte, ttl time.Duration, tags ...string) error {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sweep(now)
+	it := memItem{val: append([]byte(nil), val...)}
+	if ttl > 0 {
+		it.exp = now.Add(ttl)
+	}
+	m.items[key] = it
+	for _, t := range tags {
+		set := m.tags[t]
+		if set == nil {
+			set = map[string]struct{}{}
+			m.tags[t] = set
+		}
+		set[key] = struct{}{}
+	}
+	return nil
+}
+
+func (m *memoryStore) Delete(_ context.Context, keys ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, k := range keys {
+		delete(m.items, k)
+	}
+	return nil
+}
+
+func (m *memoryStore) InvalidateTags(_ context.Context, tags ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, t := range tags {
+		for k := range m.tags[t] {
+			delete(m.items, k)
+		}
+		delete(m.tags, t)
+	}
+	return nil
+}
+
+func (m *memoryStore) Lock(_ context.Context, key string, ttl time.Duration) (func(), bool, error) {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if it, ok := m.items[key]; ok && (it.exp.IsZero() || now.Before(it.exp)) {
+		return nil, false, nil
+	}
+	m.items[key] = memItem{exp: now.Add(ttl)}
+	return func() {
+		m.mu.Lock()
+		delete(m.items, key)
+		m.mu.Unlock()
+	}, true, nil
+}
+
+// sweep drops expired entries and empty tag references about once a minute.
+func (m *memoryStore) sweep(now time.Time) {
+	if now.Before(m.sweepAt) {
+		return
+	}
+	m.sweepAt = now.Add(time.Minute)
+	for k, it := range m.items {
+		if !it.exp.IsZero() && now.After(it.exp) {
+			delete(m.items, k)
+		}
+	}
+	for t, set := range m.tags {
+		for k := range set {
+			if _, ok := m.items[k]; !ok {
+				delete(set, k)
+			}
+		}
+		if len(set) == 0 {
+			delete(m.tags, t)
+		}
+	}
+}
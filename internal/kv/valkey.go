@@ -0,0 +1,155 @@
+package kv
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	redigo "github.com/gomodule/redigo/redis"
+)
+
+// Key prefixes keep cache data apart from sessions (scs:session:*) and rate limits (gf:rl:*).
+const (
+	cachePrefix = "gf:c:"
+	tagPrefix   = "gf:t:"
+)
+
+// valkeyStore implements Store on the shared pool.
+type valkeyStore struct {
+	pool *redigo.Pool
+}
+
+func newValkeyStore(p *redigo.Pool) *valkeyStore { return &valkeyStore{pool: p} }
+
+// setScript stores ARGV[1] under KEYS[1] for ARGV[2] ms (0 = no expiry) and adds the key to
+// each tag set KEYS[2..]. Tag sets live as long as their longest-lived member.
+var setScript = redigo.NewScript(-1, `
+local ttl = tonumber(ARGV[2])
+if ttl > 0 then
+  redis.call('SET', KEYS[1], ARGV[1], 'PX', ttl)
+else
+  redis.call('SET', KEYS[1], ARGV[1])
+end
+for i = 2, #KEYS do
+  local added = redis.call('SADD', KEYS[i], KEYS[1])
+  local cur = redis.call('PTTL', KEYS[i])
+  if ttl <= 0 then
+    redis.call('PERSIST', KEYS[i])
+  elseif (cur == -1 and added == 1 and redis.call('SCARD', KEYS[i]) == 1) or (cur >= 0 and cur < ttl) then
+    redis.call('PEXPIRE', KEYS[i], ttl)
+  end
+end
+return 1
+`)
+
+// invalidateScript deletes every member of the tag sets in KEYS and the sets themselves.
+var invalidateScript = redigo.NewScript(-1, `
+local n = 0
+for i = 1, #KEYS do
+  local members = redis.call('SMEMBERS', KEYS[i])
+  for _, k in ipairs(members) do n = n + redis.call('DEL', k) end
+  redis.call('DEL', KEYS[i])
+end
+return n
+`)
+
+// unlockScript releases a lock only if it is still held by the caller's token.
+var unlockScript = redigo.NewScript(1, `
+if redis.call('GET', KEYS[1]) == ARGV[1] then return redis.call('DEL', KEYS[1]) end
+return 0
+`)
+
+func (v *valkeyStore) do(ctx context.Context, fn func(redigo.Conn) error) error {
+	c, err := v.pool.GetContext(ctx)
+	if err != nil {
+		return NoteError(err)
+	}
+	defer c.Close()
+	return NoteError(fn(c))
+}
+
+func (v *valkeyStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	var b []byte
+	err := v.do(ctx, func(c redigo.Conn) error {
+		var err error
+		b, err = redigo.Bytes(redigo.DoContext(c, ctx, "GET", cachePrefix+key))
+		return err
+	})
+	if errors.Is(err, redigo.ErrNil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return b, true, nil
+}
+
+func (v *valkeyStore) Set(ctx context.Context, key string, val []byte, ttl time.Duration, tags ...string) error {
+	return v.do(ctx, func(c redigo.Conn) error {
+		args := make([]any, 0, len(tags)+4)
+		args = append(args, len(tags)+1, cachePrefix+key)
+		for _, t := range tags {
+			args = append(args, tagPrefix+t)
+		}
+		args = append(args, val, ttl.Milliseconds())
+		_, err := setScript.DoContext(ctx, c, args...)
+		return err
+	})
+}
+
+func (v *valkeyStore) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	return v.do(ctx, func(c redigo.Conn) error {
+		args := make([]any, len(keys))
+		for i, k := range keys {
+			args[i] = cachePrefix + k
+		}
+		_, err := redigo.DoContext(c, ctx, "DEL", args...)
+		return err
+	})
+}
+
+func (v *valkeyStore) InvalidateTags(ctx context.Context, tags ...string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	return v.do(ctx, func(c redigo.Conn) error {
+		args := make([]any, 0, len(tags)+1)
+		args = append(args, len(tags))
+		for _, t := range tags {
+			args = append(args, tagPrefix+t)
+		}
+		_, err := invalidateScript.DoContext(ctx, c, args...)
+		return err
+	})
+}
+
+func (v *valkeyStore) Lock(ctx context.Context, key string, ttl time.Duration) (func(), bool, error) {
+	tok := make([]byte, 16)
+	_, _ = rand.Read(tok)
+	id := hex.EncodeToString(tok)
+	k := cachePrefix + key
+	var ok bool
+	err := v.do(ctx, func(c redigo.Conn) error {
+		_, err := redigo.String(redigo.DoContext(c, ctx, "SET", k, id, "NX", "PX", ttl.Milliseconds()))
+		if errors.Is(err, redigo.ErrNil) {
+			return nil
+		}
+		ok = err == nil
+		return err
+	})
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	return func() {
+		ctx := context.Background()
+		_ = v.do(ctx, func(c redigo.Conn) error {
+			_, err := unlockScript.DoContext(ctx, c, k, id)
+			return err
+		})
+	}, true, nil
+}
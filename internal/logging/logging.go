@@ -0,0 +1,128 @@
+// Package logging configures log/slog for the server and provides a request-scoped
+// logger. Handlers log through FromContext so every line carries the request ID, client
+// IP, method, path, chi route pattern and, for authenticated requests, the JWT subject:
+//
+//	logging.FromContext(r.Context()).Info("post created", "id", id)
+//
+// Attributes whose key names a secret (Authorization, Cookie, password, token, ...) are
+// redacted by the handler, wherever they appear.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+
+	"gothicforge3/internal/config"
+)
+
+// Output is where Setup writes log lines (stderr by default; tests may swap it).
+var Output io.Writer = os.Stderr
+
+// Redacted replaces the value of sensitive attributes.
+const Redacted = "[REDACTED]"
+
+// sensitive lists attribute keys (lower-case) whose values are never logged.
+var sensitive = map[string]bool{
+	"authorization":       true,
+	"proxy-authorization": true,
+	"cookie":              true,
+	"set-cookie":          true,
+	"x-api-key":           true,
+	"x-csrf-token":        true,
+	"csrf_token":          true,
+	"password":            true,
+	"secret":              true,
+	"token":               true,
+	"access_token":        true,
+	"refresh_token":       true,
+	"id_token":            true,
+	"client_secret":       true,
+	"jwt":                 true,
+	"gf_jwt":              true,
+}
+
+// IsSensitive reports whether values logged under key are redacted.
+func IsSensitive(key string) bool { return sensitive[strings.ToLower(key)] }
+
+var (
+	mu     sync.RWMutex
+	base   = slog.Default()
+	sample = 1.0
+	quiet  bool
+)
+
+// Setup builds the process logger from cfg and installs it as slog's (and the standard log
+// package's) default:
+//
+//	LOG_FORMAT       text (default) | json | off (no per-request lines)
+//	LOG_LEVEL        debug | info | warn | error
+//	LOG_SAMPLE_RATE  fraction of successful requests to log (errors are always logged)
+func Setup(cfg *config.Config) *slog.Logger {
+	l := New(cfg, Output)
+	mu.Lock()
+	base = l
+	sample = cfg.LogSampleRate
+	switch strings.ToLower(cfg.LogFormat) {
+	case "off", "silent", "none":
+		quiet = true
+	default:
+		quiet = false
+	}
+	mu.Unlock()
+	slog.SetDefault(l)
+	return l
+}
+
+// New returns a logger writing to w in the format and level configured by cfg.
+func New(cfg *config.Config, w io.Writer) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: ParseLevel(cfg.LogLevel), ReplaceAttr: redact}
+	var h slog.Handler
+	if strings.EqualFold(cfg.LogFormat, "json") {
+		h = slog.NewJSONHandler(w, opts)
+	} else {
+		h = slog.NewTextHandler(w, opts)
+	}
+	return slog.New(h)
+}
+
+// ParseLevel maps debug/info/warn/error to a slog level (info when unknown).
+func ParseLevel(s string) slog.Level {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(s)); err != nil {
+		return slog.LevelInfo
+	}
+	return l
+}
+
+func redact(_ []string, a slog.Attr) slog.Attr {
+	if a.Value.Kind() != slog.KindGroup && IsSensitive(a.Key) {
+		return slog.String(a.Key, Redacted)
+	}
+	return a
+}
+
+// Logger returns the process logger configured by Setup.
+func Logger() *slog.Logger {
+	mu.RLock()
+	defer mu.RUnlock()
+	return base
+}
+
+type ctxKey struct{}
+
+// WithContext returns a copy of ctx carrying l.
+func WithContext(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, l)
+}
+
+// FromContext returns the request-scoped logger, or the process logger outside a request.
+func FromContext(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(ctxKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return Logger()
+}
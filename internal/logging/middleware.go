@@ -0,0 +1,144 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel/trace"
+	"gothicforge3/internal/auth"
+	"gothicforge3/internal/realip"
+)
+
+// Middleware installs the request-scoped logger, recovers panics (logged with a stack
+// trace, answered with 500) and writes one line per request: status, bytes and duration at
+// info for 1xx-3xx (subject to LOG_SAMPLE_RATE), warn for 4xx and error for 5xx. It must
+// run after middleware.RequestID and realip.Middleware; when tracing is enabled, lines also
+// carry the trace_id of the request span.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		info := &requestInfo{req: r}
+		l := slog.New(&requestHandler{Handler: Logger().Handler(), info: info}).With(
+			"request_id", middleware.GetReqID(r.Context()),
+			"ip", realip.ClientIP(r),
+			"method", r.Method,
+			"path", r.URL.Path,
+		)
+		if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+			l = l.With("trace_id", sc.TraceID().String())
+		}
+		ctx := WithContext(r.Context(), l)
+		r = r.WithContext(ctx)
+		info.req = r
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		defer func() {
+			if rec := recover(); rec != nil {
+				if rec == http.ErrAbortHandler {
+					panic(rec)
+				}
+				l.ErrorContext(ctx, "panic", "error", fmt.Sprint(rec), "stack", string(debug.Stack()))
+				if r.Header.Get("Connection") != "Upgrade" && ww.Status() == 0 {
+					http.Error(ww, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				}
+			}
+			logRequest(ctx, l, r, ww, time.Since(start))
+		}()
+		next.ServeHTTP(ww, r)
+	})
+}
+
+func logRequest(ctx context.Context, l *slog.Logger, r *http.Request, ww middleware.WrapResponseWriter, d time.Duration) {
+	mu.RLock()
+	q, rate := quiet, sample
+	mu.RUnlock()
+	if q {
+		return
+	}
+	status := ww.Status()
+	if status == 0 {
+		status = http.StatusOK
+	}
+	level := slog.LevelInfo
+	switch {
+	case status >= 500:
+		level = slog.LevelError
+	case status >= 400:
+		level = slog.LevelWarn
+	default:
+		if rate < 1 && rand.Float64() >= rate {
+			return
+		}
+	}
+	if !l.Enabled(ctx, level) {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.Int("status", status),
+		slog.Int("bytes", ww.BytesWritten()),
+		slog.Duration("duration", d),
+		slog.String("ua", r.UserAgent()),
+	}
+	if l.Enabled(ctx, slog.LevelDebug) {
+		// Header values for secrets are redacted by key (see IsSensitive).
+		hs := make([]any, 0, len(r.Header))
+		for k, v := range r.Header {
+			hs = append(hs, slog.Any(k, v))
+		}
+		attrs = append(attrs, slog.Group("headers", hs...))
+	}
+	l.LogAttrs(ctx, level, "request", attrs...)
+}
+
+// requestInfo resolves per-request attributes lazily: the route pattern is only known once
+// chi has routed the request, and the JWT subject is verified at most once.
+type requestInfo struct {
+	req     *http.Request
+	subOnce sync.Once
+	sub     string
+}
+
+func (i *requestInfo) route() string {
+	if rc := chi.RouteContext(i.req.Context()); rc != nil {
+		return rc.RoutePattern()
+	}
+	return ""
+}
+
+func (i *requestInfo) subject() string {
+	i.subOnce.Do(func() { i.sub = auth.Subject(i.req) })
+	return i.sub
+}
+
+// requestHandler appends route and user to each record at log time.
+type requestHandler struct {
+	slog.Handler
+	info *requestInfo
+}
+
+func (h *requestHandler) Handle(ctx context.Context, rec slog.Record) error {
+	rec = rec.Clone()
+	if route := h.info.route(); route != "" {
+		rec.AddAttrs(slog.String("route", route))
+	}
+	if sub := h.info.subject(); sub != "" {
+		rec.AddAttrs(slog.String("user", sub))
+	}
+	return h.Handler.Handle(ctx, rec)
+}
+
+func (h *requestHandler) WithAttrs(as []slog.Attr) slog.Handler {
+	return &requestHandler{Handler: h.Handler.WithAttrs(as), info: h.info}
+}
+
+func (h *requestHandler) WithGroup(name string) slog.Handler {
+	return &requestHandler{Handler: h.Handler.WithGroup(name), info: h.info}
+}
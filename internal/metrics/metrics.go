@@ -0,0 +1,170 @@
+// Package metrics exposes Prometheus metrics for the server: per-route request counters and
+// latency histograms (labelled with the chi route pattern, never the raw path), pgxpool and
+// Valkey pool statistics, session store errors and rate-limit rejections.
+//
+// The endpoint is opt-in (METRICS_ENABLE=1). It is mounted on the main router at /metrics
+// behind METRICS_TOKEN (Authorization: Bearer), or served on a separate listener when
+// METRICS_ADDR is set (see Serve).
+package metrics
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"gothicforge3/internal/db"
+	"gothicforge3/internal/kv"
+	"gothicforge3/internal/ratelimit"
+)
+
+// Path is where the endpoint is mounted on the main router.
+const Path = "/metrics"
+
+var (
+	// Registry holds every collector exported by this package.
+	Registry = prometheus.NewRegistry()
+
+	requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by method, chi route pattern and status code.",
+	}, []string{"method", "route", "code"})
+
+	duration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency by method and chi route pattern.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	inflight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "HTTP requests currently being served.",
+	})
+
+	// SessionErrors counts session store failures (load/commit), incremented by the server.
+	SessionErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "gforge_session_errors_total",
+		Help: "Session store errors.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		requests, duration, inflight, SessionErrors,
+		poolCollector{},
+	)
+}
+
+// Middleware records request counts and latency. The route label is resolved after routing;
+// requests that match no route are labelled "unmatched" and non-standard methods "OTHER" to
+// keep cardinality bounded.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		inflight.Inc()
+		defer inflight.Dec()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+		route := "unmatched"
+		if rc := chi.RouteContext(r.Context()); rc != nil && rc.RoutePattern() != "" {
+			route = rc.RoutePattern()
+		}
+		code := ww.Status()
+		if code == 0 {
+			code = http.StatusOK
+		}
+		method := methodLabel(r.Method)
+		requests.WithLabelValues(method, route, strconv.Itoa(code)).Inc()
+		duration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+	})
+}
+
+func methodLabel(m string) string {
+	switch m {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return m
+	}
+	return "OTHER"
+}
+
+// Handler serves the registry in the Prometheus exposition format. When token is non-empty,
+// requests must send "Authorization: Bearer <token>".
+func Handler(token string) http.Handler {
+	h := promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+	if token == "" {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := r.Header.Get("Authorization")
+		if len(got) < 7 || !strings.EqualFold(got[:7], "bearer ") ||
+			subtle.ConstantTimeCompare([]byte(strings.TrimSpace(got[7:])), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Serve returns an http.Server for the internal metrics listener on addr.
+func Serve(addr, token string) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle(Path, Handler(token))
+	return &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+}
+
+var (
+	dbAcquired    = prometheus.NewDesc("gforge_db_pool_acquired_conns", "Connections currently acquired from the pgx pool.", nil, nil)
+	dbIdle        = prometheus.NewDesc("gforge_db_pool_idle_conns", "Idle connections in the pgx pool.", nil, nil)
+	dbTotal       = prometheus.NewDesc("gforge_db_pool_total_conns", "Total connections in the pgx pool.", nil, nil)
+	dbMax         = prometheus.NewDesc("gforge_db_pool_max_conns", "Maximum size of the pgx pool.", nil, nil)
+	dbAcquires    = prometheus.NewDesc("gforge_db_pool_acquires_total", "Successful acquires from the pgx pool.", nil, nil)
+	dbWaits       = prometheus.NewDesc("gforge_db_pool_empty_acquires_total", "Acquires that had to wait for a connection.", nil, nil)
+	dbWaitSeconds = prometheus.NewDesc("gforge_db_pool_acquire_wait_seconds_total", "Time spent waiting for pgx pool connections.", nil, nil)
+	dbCanceled    = prometheus.NewDesc("gforge_db_pool_canceled_acquires_total", "Acquires canceled by their context.", nil, nil)
+	kvActive      = prometheus.NewDesc("gforge_valkey_pool_active_conns", "Connections in the Valkey pool (in use or idle).", nil, nil)
+	kvIdle        = prometheus.NewDesc("gforge_valkey_pool_idle_conns", "Idle connections in the Valkey pool.", nil, nil)
+	kvErrors      = prometheus.NewDesc("gforge_valkey_errors_total", "Valkey connection and command errors.", nil, nil)
+	rlRejected    = prometheus.NewDesc("gforge_ratelimit_rejections_total", "Requests rejected with 429 by rate-limit policy.", []string{"policy"}, nil)
+)
+
+// poolCollector reads pool and limiter statistics at scrape time.
+type poolCollector struct{}
+
+func (poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{dbAcquired, dbIdle, dbTotal, dbMax, dbAcquires, dbWaits, dbWaitSeconds, dbCanceled, kvActive, kvIdle, kvErrors, rlRejected} {
+		ch <- d
+	}
+}
+
+func (poolCollector) Collect(ch chan<- prometheus.Metric) {
+	if p := db.Pool(); p != nil {
+		st := p.Stat()
+		ch <- prometheus.MustNewConstMetric(dbAcquired, prometheus.GaugeValue, float64(st.AcquiredConns()))
+		ch <- prometheus.MustNewConstMetric(dbIdle, prometheus.GaugeValue, float64(st.IdleConns()))
+		ch <- prometheus.MustNewConstMetric(dbTotal, prometheus.GaugeValue, float64(st.TotalConns()))
+		ch <- prometheus.MustNewConstMetric(dbMax, prometheus.GaugeValue, float64(st.MaxConns()))
+		ch <- prometheus.MustNewConstMetric(dbAcquires, prometheus.CounterValue, float64(st.AcquireCount()))
+		ch <- prometheus.MustNewConstMetric(dbWaits, prometheus.CounterValue, float64(st.EmptyAcquireCount()))
+		ch <- prometheus.MustNewConstMetric(dbWaitSeconds, prometheus.CounterValue, st.AcquireDuration().Seconds())
+		ch <- prometheus.MustNewConstMetric(dbCanceled, prometheus.CounterValue, float64(st.CanceledAcquireCount()))
+	}
+	ks := kv.Snapshot()
+	if ks.Backend == "valkey" {
+		ch <- prometheus.MustNewConstMetric(kvActive, prometheus.GaugeValue, float64(ks.Active))
+		ch <- prometheus.MustNewConstMetric(kvIdle, prometheus.GaugeValue, float64(ks.Idle))
+	}
+	ch <- prometheus.MustNewConstMetric(kvErrors, prometheus.CounterValue, float64(ks.Errors))
+	for policy, n := range ratelimit.Rejections() {
+		ch <- prometheus.MustNewConstMetric(rlRejected, prometheus.CounterValue, float64(n), policy)
+	}
+}
@@ -0,0 +1,291 @@
+// Package ratelimit provides named rate-limit policies backed by Valkey (shared across
+// instances and deploys) or process memory. Policies are keyed per client IP, per JWT
+// "sub" or per API key and are attached to routes with Limit:
+//
+//	r.With(ratelimit.Limit("auth")).Post("/login", login)
+//	r.Group(func(g chi.Router) { g.Use(ratelimit.Limit("api")); ... })
+//
+// Every limited response carries RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset and
+// RateLimit-Policy headers; rejections add Retry-After and return 429 (an alert fragment
+// for HTMX requests).
+package ratelimit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	redigo "github.com/gomodule/redigo/redis"
+	"gothicforge3/internal/auth"
+	"gothicforge3/internal/config"
+	"gothicforge3/internal/realip"
+)
+
+// Key strategies for Policy.By.
+const (
+	ByIP      = "ip"     // client IP (realip.ClientIP)
+	BySubject = "sub"    // JWT "sub" from Authorization: Bearer or the gf_jwt cookie; IP when anonymous
+	ByAPIKey  = "apikey" // X-API-Key header (hashed); IP when absent
+)
+
+// Policy is a named limit: at most Limit requests per Window for each key.
+type Policy struct {
+	Name   string
+	Limit  int
+	Window time.Duration
+	By     string
+}
+
+// Result describes the state of a key after a request was counted.
+type Result struct {
+	Limit     int
+	Remaining int
+	Reset     time.Duration // until the current window ends
+	Allowed   bool
+}
+
+var (
+	mu       sync.RWMutex
+	policies       = map[string]Policy{}
+	store    Store = NewMemoryStore()
+	exempt   []string
+	rejected = map[string]uint64{}
+)
+
+// Setup defines the built-in policies from cfg and selects the store: Valkey when pool is
+// non-nil, process memory otherwise. Extra policies come from RATE_LIMIT_POLICIES; invalid
+// entries are skipped and reported in the returned error.
+//
+//	default  RATE_LIMIT_MAX per RATE_LIMIT_WINDOW_SECONDS per IP (unsafe methods, see Global)
+//	auth     AUTH_RATE_LIMIT per minute per IP, for login/signup/reset forms
+//	oauth    OAUTH_RATE_LIMIT per minute per IP, for provider sign-in (login and callback)
+//	reports  REPORTS_RATE_LIMIT per minute per IP, for the CSP/NEL collector
+func Setup(cfg *config.Config, pool *redigo.Pool) error {
+	max := cfg.RateLimitMax
+	if max <= 0 {
+		max = 120
+	}
+	window := cfg.RateLimitWindow
+	if window <= 0 {
+		window = time.Minute
+	}
+	authMax := cfg.AuthRateLimit
+	if authMax <= 0 {
+		authMax = 10
+	}
+	oauthMax := cfg.OAuthRateLimit
+	if oauthMax <= 0 {
+		oauthMax = 30
+	}
+	reports := cfg.ReportsRateLimit
+	if reports <= 0 {
+		reports = 30
+	}
+	Define(Policy{Name: "default", Limit: max, Window: window, By: ByIP})
+	Define(Policy{Name: "auth", Limit: authMax, Window: time.Minute, By: ByIP})
+	Define(Policy{Name: "oauth", Limit: oauthMax, Window: time.Minute, By: ByIP})
+	Define(Policy{Name: "reports", Limit: reports, Window: time.Minute, By: ByIP})
+	var errs []error
+	for _, spec := range cfg.RateLimitPolicies {
+		p, err := ParsePolicy(spec)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		Define(p)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if pool != nil {
+		store = NewValkeyStore(pool)
+	} else {
+		store = NewMemoryStore()
+	}
+	return errors.Join(errs...)
+}
+
+// ParsePolicy parses "name=limit/window[:by]", e.g. "login=5/1m:ip" or "api=600/60:apikey".
+// A bare integer window means seconds; by defaults to ip.
+func ParsePolicy(spec string) (Policy, error) {
+	name, rest, ok := strings.Cut(strings.TrimSpace(spec), "=")
+	if !ok || name == "" {
+		return Policy{}, fmt.Errorf("ratelimit: policy %q: want name=limit/window[:by]", spec)
+	}
+	rest, by, _ := strings.Cut(rest, ":")
+	ls, ws, ok := strings.Cut(rest, "/")
+	if !ok {
+		return Policy{}, fmt.Errorf("ratelimit: policy %q: want name=limit/window[:by]", spec)
+	}
+	limit, err := strconv.Atoi(ls)
+	if err != nil || limit <= 0 {
+		return Policy{}, fmt.Errorf("ratelimit: policy %q: invalid limit %q", spec, ls)
+	}
+	window, err := time.ParseDuration(ws)
+	if n, nerr := strconv.Atoi(ws); nerr == nil {
+		window, err = time.Duration(n)*time.Second, nil
+	}
+	if err != nil || window <= 0 {
+		return Policy{}, fmt.Errorf("ratelimit: policy %q: invalid window %q", spec, ws)
+	}
+	if by == "" {
+		by = ByIP
+	}
+	switch by {
+	case ByIP, BySubject, ByAPIKey:
+	default:
+		return Policy{}, fmt.Errorf("ratelimit: policy %q: key must be ip, sub or apikey", spec)
+	}
+	return Policy{Name: name, Limit: limit, Window: window, By: by}, nil
+}
+
+// Define adds or replaces a policy.
+func Define(p Policy) {
+	if p.By == "" {
+		p.By = ByIP
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	policies[p.Name] = p
+}
+
+// Lookup returns the policy registered under name.
+func Lookup(name string) (Policy, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	p, ok := policies[name]
+	return p, ok
+}
+
+// Exempt excludes path prefixes from the Global middleware (routes with their own policy).
+func Exempt(prefixes ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+	exempt = append(exempt, prefixes...)
+}
+
+// Limit returns middleware enforcing the named policy. The policy must already be defined;
+// its current definition is read on each request so Setup may adjust limits later.
+func Limit(name string) func(http.Handler) http.Handler {
+	if _, ok := Lookup(name); !ok {
+		panic("ratelimit: unknown policy " + strconv.Quote(name))
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, _ := Lookup(name)
+			if !enforce(w, r, p) {
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Global applies the "default" policy to state-changing requests (anything but GET, HEAD
+// and OPTIONS) outside the Exempt prefixes.
+func Global() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				next.ServeHTTP(w, r)
+				return
+			}
+			mu.RLock()
+			skip := hasPrefix(exempt, r.URL.Path)
+			mu.RUnlock()
+			if skip {
+				next.ServeHTTP(w, r)
+				return
+			}
+			p, ok := Lookup("default")
+			if ok && !enforce(w, r, p) {
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// enforce counts the request, writes the RateLimit-* headers and, when the limit is
+// exceeded, the 429 response. It reports whether the request may proceed.
+func enforce(w http.ResponseWriter, r *http.Request, p Policy) bool {
+	key := "gf:rl:" + p.Name + ":" + keyFor(r, p.By)
+	mu.RLock()
+	s := store
+	mu.RUnlock()
+	res, err := s.Take(r.Context(), key, p.Limit, p.Window)
+	if err != nil {
+		// Fail open rather than take the site down with the limiter.
+		slog.Error("ratelimit: store failed", "policy", p.Name, "error", err)
+		return true
+	}
+	reset := int(math.Ceil(res.Reset.Seconds()))
+	h := w.Header()
+	h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	h.Set("RateLimit-Reset", strconv.Itoa(reset))
+	h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", p.Limit, int(p.Window.Seconds())))
+	if res.Allowed {
+		return true
+	}
+	mu.Lock()
+	rejected[p.Name]++
+	mu.Unlock()
+	h.Set("Retry-After", strconv.Itoa(reset))
+	if r.Header.Get("HX-Request") == "true" {
+		// Rendered into the layout's #flash region; app.js lets HTMX swap 429 responses.
+		h.Set("Content-Type", "text/html; charset=utf-8")
+		h.Set("HX-Retarget", "#flash")
+		h.Set("HX-Reswap", "innerHTML")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = fmt.Fprintf(w, `<div role="alert" class="alert alert-warning"><span>%s</span></div>`,
+			html.EscapeString(fmt.Sprintf("Too many requests. Please try again in %d seconds.", reset)))
+		return false
+	}
+	http.Error(w, "too many requests", http.StatusTooManyRequests)
+	return false
+}
+
+// Rejections returns the number of 429 responses per policy since start.
+func Rejections() map[string]uint64 {
+	mu.RLock()
+	defer mu.RUnlock()
+	out := make(map[string]uint64, len(rejected))
+	for k, v := range rejected {
+		out[k] = v
+	}
+	return out
+}
+
+func keyFor(r *http.Request, by string) string {
+	switch by {
+	case BySubject:
+		if sub := auth.Subject(r); sub != "" {
+			return "sub:" + sub
+		}
+	case ByAPIKey:
+		if k := strings.TrimSpace(r.Header.Get("X-API-Key")); k != "" {
+			sum := sha256.Sum256([]byte(k))
+			return "key:" + hex.EncodeToString(sum[:12])
+		}
+	}
+	return "ip:" + realip.ClientIP(r)
+}
+
+func hasPrefix(prefixes []string, p string) bool {
+	for _, pre := range prefixes {
+		if strings.HasPrefix(p, pre) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	redigo "github.com/gomodule/redigo/redis"
+	"gothicforge3/internal/kv"
+)
+
+// Store counts requests per key in fixed windows.
+type Store interface {
+	// Take counts one request for key and reports the resulting state.
+	Take(ctx context.Context, key string, limit int, window time.Duration) (Result, error)
+}
+
+// MemoryStore keeps counters in process memory. Limits are per instance and reset on
+// restart; it is used when no Valkey URL is configured.
+type MemoryStore struct {
+	mu      sync.Mutex
+	windows map[string]*memWindow
+	sweep   time.Time
+}
+
+type memWindow struct {
+	count int
+	end   time.Time
+}
+
+// NewMemoryStore returns an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{windows: map[string]*memWindow{}}
+}
+
+// Take implements Store.
+func (m *MemoryStore) Take(_ context.Context, key string, limit int, window time.Duration) (Result, error) {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if now.After(m.sweep) {
+		for k, w := range m.windows {
+			if now.After(w.end) {
+				delete(m.windows, k)
+			}
+		}
+		m.sweep = now.Add(time.Minute)
+	}
+	w := m.windows[key]
+	if w == nil || now.After(w.end) {
+		w = &memWindow{end: now.Add(window)}
+		m.windows[key] = w
+	}
+	w.count++
+	return result(w.count, limit, w.end.Sub(now)), nil
+}
+
+// takeScript increments the window counter and starts its expiry on first use, returning
+// the count and the remaining TTL in milliseconds.
+var takeScript = redigo.NewScript(1, `
+local n = redis.call('INCR', KEYS[1])
+if n == 1 then redis.call('PEXPIRE', KEYS[1], ARGV[1]) end
+local ttl = redis.call('PTTL', KEYS[1])
+if ttl < 0 then
+  redis.call('PEXPIRE', KEYS[1], ARGV[1])
+  ttl = tonumber(ARGV[1])
+end
+return {n, ttl}
+`)
+
+// ValkeyStore keeps counters in Valkey so limits hold across instances and deploys.
+// When Valkey is unreachable it falls back to an in-memory store.
+type ValkeyStore struct {
+	pool     *redigo.Pool
+	fallback *MemoryStore
+	mu       sync.Mutex
+	warned   time.Time
+}
+
+// NewValkeyStore returns a store using pool.
+func NewValkeyStore(pool *redigo.Pool) *ValkeyStore {
+	return &ValkeyStore{pool: pool, fallback: NewMemoryStore()}
+}
+
+// Take implements Store.
+func (v *ValkeyStore) Take(ctx context.Context, key string, limit int, window time.Duration) (Result, error) {
+	conn, err := v.pool.GetContext(ctx)
+	if err != nil {
+		v.warn(err)
+		return v.fallback.Take(ctx, key, limit, window)
+	}
+	defer conn.Close()
+	vals, err := redigo.Int64s(takeScript.DoContext(ctx, conn, key, window.Milliseconds()))
+	if err == nil && len(vals) != 2 {
+		err = fmt.Errorf("unexpected reply %v", vals)
+	}
+	if err != nil {
+		v.warn(err)
+		return v.fallback.Take(ctx, key, limit, window)
+	}
+	return result(int(vals[0]), limit, time.Duration(vals[1])*time.Millisecond), nil
+}
+
+// warn counts the failure for metrics and logs it at most once a minute.
+func (v *ValkeyStore) warn(err error) {
+	kv.NoteError(err)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if time.Since(v.warned) < time.Minute {
+		return
+	}
+	v.warned = time.Now()
+	slog.Warn("ratelimit: valkey unavailable, using in-memory counters", "error", err)
+}
+
+func result(count, limit int, reset time.Duration) Result {
+	remaining := limit - count
+	if remaining < 0 {
+		remaining = 0
+	}
+	return Result{Limit: limit, Remaining: remaining, Reset: reset, Allowed: count <= limit}
+}
@@ -0,0 +1,247 @@
+// Package realip resolves the client IP address and scheme of a request. Forwarding headers
+// (RFC 7239 Forwarded, then X-Forwarded-For/X-Forwarded-Proto, then X-Real-IP) are honoured
+// only when the connection comes from a proxy listed in TRUSTED_PROXIES; otherwise the TCP
+// peer and the connection's own TLS state are used, so clients cannot spoof their address.
+//
+// Middleware resolves each request once; rate limiting, logging, tracing and URL building read
+// the result through ClientIP and Scheme.
+package realip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+
+	"gothicforge3/internal/config"
+)
+
+// Presets accepted in TRUSTED_PROXIES alongside CIDRs and single addresses.
+var Presets = map[string][]string{
+	// https://www.cloudflare.com/ips/
+	"cloudflare": {
+		"173.245.48.0/20", "103.21.244.0/22", "103.22.200.0/22", "103.31.4.0/22", "141.101.64.0/18",
+		"108.162.192.0/18", "190.93.240.0/20", "188.114.96.0/20", "197.234.240.0/22", "198.41.128.0/17",
+		"162.158.0.0/15", "104.16.0.0/13", "104.24.0.0/14", "172.64.0.0/13", "131.0.72.0/22",
+		"2400:cb00::/32", "2606:4700::/32", "2803:f800::/32", "2405:b500::/32", "2405:8100::/32",
+		"2a06:98c0::/29", "2c0f:f248::/32",
+	},
+	// Railway's edge proxy reaches services over its private network.
+	"railway":  {"10.0.0.0/8", "100.64.0.0/10", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7"},
+	"private":  {"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7"},
+	"loopback": {"127.0.0.0/8", "::1/128"},
+}
+
+var (
+	mu      sync.RWMutex
+	trusted []netip.Prefix
+)
+
+// Setup trusts the proxies in cfg.TrustedProxies. Invalid entries are skipped and reported
+// in the returned error; the valid ones still apply.
+func Setup(cfg *config.Config) error {
+	prefixes, err := ParseTrusted(cfg.TrustedProxies)
+	mu.Lock()
+	trusted = prefixes
+	mu.Unlock()
+	return err
+}
+
+// ParseTrusted parses TRUSTED_PROXIES entries: CIDRs ("10.0.0.0/8"), addresses ("127.0.0.1")
+// and preset names (see Presets).
+func ParseTrusted(entries []string) ([]netip.Prefix, error) {
+	var out []netip.Prefix
+	var errs []error
+	for _, e := range entries {
+		e = strings.TrimSpace(e)
+		if e == "" {
+			continue
+		}
+		if preset, ok := Presets[strings.ToLower(e)]; ok {
+			for _, c := range preset {
+				out = append(out, netip.MustParsePrefix(c))
+			}
+			continue
+		}
+		if p, err := netip.ParsePrefix(e); err == nil {
+			out = append(out, p.Masked())
+			continue
+		}
+		if a, err := netip.ParseAddr(e); err == nil {
+			a = a.Unmap()
+			out = append(out, netip.PrefixFrom(a, a.BitLen()))
+			continue
+		}
+		errs = append(errs, fmt.Errorf("TRUSTED_PROXIES: %q is not a CIDR, address or preset", e))
+	}
+	return out, errors.Join(errs...)
+}
+
+// Trusted reports whether ip belongs to a trusted proxy.
+func Trusted(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, p := range trusted {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Info is the resolved origin of a request.
+type Info struct {
+	IP     string // client address without port
+	Scheme string // "http" or "https" as seen by the client
+}
+
+type ctxKey struct{}
+
+// Middleware resolves the client and stores it in the request context. Like chi's RealIP it
+// also sets r.RemoteAddr to the client IP for code that reads it directly.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info := Resolve(r)
+		r = r.WithContext(context.WithValue(r.Context(), ctxKey{}, info))
+		r.RemoteAddr = info.IP
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ClientIP returns the client IP address of r.
+func ClientIP(r *http.Request) string { return FromRequest(r).IP }
+
+// Scheme returns "https" when the client connected over TLS (directly or to a trusted proxy).
+func Scheme(r *http.Request) string { return FromRequest(r).Scheme }
+
+// FromRequest returns the Info stored by Middleware, resolving it when Middleware did not run.
+func FromRequest(r *http.Request) Info {
+	if info, ok := r.Context().Value(ctxKey{}).(Info); ok {
+		return info
+	}
+	return Resolve(r)
+}
+
+// Resolve computes the client of r. When the peer is trusted, the forwarding chain is walked
+// from the nearest hop outwards and the first address that is not a trusted proxy is the
+// client (the leftmost one if every hop is trusted).
+func Resolve(r *http.Request) Info {
+	info := Info{IP: hostOnly(r.RemoteAddr), Scheme: "http"}
+	if r.TLS != nil {
+		info.Scheme = "https"
+	}
+	peer, err := netip.ParseAddr(info.IP)
+	if err != nil || !Trusted(peer) {
+		return info
+	}
+	hops := forwarded(r.Header)
+	if len(hops) == 0 {
+		hops = xForwarded(r.Header)
+	}
+	if len(hops) == 0 {
+		return info
+	}
+	client := hops[0]
+	for i := len(hops) - 1; i >= 0; i-- {
+		a, err := netip.ParseAddr(hops[i].addr)
+		if err != nil || !Trusted(a) {
+			client = hops[i]
+			break
+		}
+	}
+	if _, err := netip.ParseAddr(client.addr); err == nil {
+		info.IP = client.addr
+	}
+	if p := strings.ToLower(client.proto); p == "http" || p == "https" {
+		info.Scheme = p
+	}
+	return info
+}
+
+// hop is one forwarding element: the address a proxy received the request from and the
+// scheme it was received with.
+type hop struct{ addr, proto string }
+
+// forwarded parses RFC 7239 Forwarded headers, e.g.
+// `for=192.0.2.60;proto=https, for="[2001:db8::1]:4711"`.
+func forwarded(h http.Header) []hop {
+	var hops []hop
+	for _, line := range h.Values("Forwarded") {
+		for _, elem := range splitQuoted(line, ',') {
+			var hp hop
+			for _, pair := range splitQuoted(elem, ';') {
+				k, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if !ok {
+					continue
+				}
+				v = strings.Trim(strings.TrimSpace(v), `"`)
+				switch strings.ToLower(strings.TrimSpace(k)) {
+				case "for":
+					hp.addr = hostOnly(v)
+				case "proto":
+					hp.proto = v
+				}
+			}
+			hops = append(hops, hp)
+		}
+	}
+	return hops
+}
+
+// xForwarded reads X-Forwarded-For (and X-Forwarded-Proto, which applies to the client hop),
+// falling back to X-Real-IP.
+func xForwarded(h http.Header) []hop {
+	var hops []hop
+	for _, line := range h.Values("X-Forwarded-For") {
+		for _, a := range strings.Split(line, ",") {
+			if a = strings.TrimSpace(a); a != "" {
+				hops = append(hops, hop{addr: hostOnly(a)})
+			}
+		}
+	}
+	if len(hops) == 0 {
+		if a := strings.TrimSpace(h.Get("X-Real-IP")); a != "" {
+			hops = append(hops, hop{addr: hostOnly(a)})
+		}
+	}
+	proto, _, _ := strings.Cut(h.Get("X-Forwarded-Proto"), ",")
+	if proto = strings.TrimSpace(proto); proto != "" && len(hops) == 0 {
+		// Only the scheme was forwarded; the peer stays the client.
+		hops = append(hops, hop{})
+	}
+	for i := range hops {
+		hops[i].proto = proto
+	}
+	return hops
+}
+
+// hostOnly strips a port and IPv6 brackets: "[2001:db8::1]:4711" -> "2001:db8::1".
+func hostOnly(s string) string {
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		return host
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+}
+
+// splitQuoted splits s on sep outside double quotes.
+func splitQuoted(s string, sep byte) []string {
+	var parts []string
+	quoted, start := false, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			quoted = !quoted
+		case sep:
+			if !quoted {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
@@ -0,0 +1,260 @@
+// Package reports collects browser violation reports (CSP and Network Error Logging)
+// posted to the built-in /_reports/csp endpoint and stores them for later review
+// with `gforge reports`.
+package reports
+
+import (
+	"container/list"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Path is the collector endpoint referenced by report-uri/report-to.
+const Path = "/_reports/csp"
+
+// Group is the Reporting API endpoint group name used by CSP report-to and NEL.
+const Group = "default"
+
+// Violation is a normalized CSP or NEL report.
+type Violation struct {
+	Time        time.Time `json:"time"`
+	Type        string    `json:"type"` // csp-violation | network-error
+	DocumentURI string    `json:"document_uri"`
+	BlockedURI  string    `json:"blocked_uri,omitempty"`
+	Directive   string    `json:"directive"` // effective CSP directive, or NEL error type
+	Disposition string    `json:"disposition,omitempty"`
+	SourceFile  string    `json:"source_file,omitempty"`
+	Line        int       `json:"line,omitempty"`
+	UserAgent   string    `json:"user_agent,omitempty"`
+	Count       int       `json:"count"` // occurrences represented (includes suppressed duplicates)
+}
+
+// key identifies duplicates of the same violation.
+func (v Violation) key() string {
+	return v.Type + "|" + v.Directive + "|" + v.BlockedURI + "|" + v.DocumentURI + "|" + v.SourceFile
+}
+
+// Parse decodes a report body. It accepts the legacy report-uri format
+// (application/csp-report) and the Reporting API format (application/reports+json).
+func Parse(body []byte) ([]Violation, error) {
+	body = []byte(strings.TrimSpace(string(body)))
+	if len(body) == 0 {
+		return nil, errors.New("empty report")
+	}
+	if body[0] == '[' {
+		var list []struct {
+			Type      string          `json:"type"`
+			URL       string          `json:"url"`
+			UserAgent string          `json:"user_agent"`
+			Body      json.RawMessage `json:"body"`
+		}
+		if err := json.Unmarshal(body, &list); err != nil {
+			return nil, err
+		}
+		out := make([]Violation, 0, len(list))
+		for _, it := range list {
+			v := Violation{Type: it.Type, DocumentURI: it.URL, UserAgent: it.UserAgent}
+			switch it.Type {
+			case "csp-violation":
+				var b struct {
+					DocumentURL        string `json:"documentURL"`
+					BlockedURL         string `json:"blockedURL"`
+					EffectiveDirective string `json:"effectiveDirective"`
+					Disposition        string `json:"disposition"`
+					SourceFile         string `json:"sourceFile"`
+					LineNumber         int    `json:"lineNumber"`
+				}
+				_ = json.Unmarshal(it.Body, &b)
+				if b.DocumentURL != "" {
+					v.DocumentURI = b.DocumentURL
+				}
+				v.BlockedURI, v.Directive, v.Disposition = b.BlockedURL, b.EffectiveDirective, b.Disposition
+				v.SourceFile, v.Line = b.SourceFile, b.LineNumber
+			case "network-error":
+				var b struct {
+					Type  string `json:"type"`
+					Phase string `json:"phase"`
+				}
+				_ = json.Unmarshal(it.Body, &b)
+				v.Directive, v.Disposition = b.Type, b.Phase
+			default:
+				continue // deprecation/intervention reports etc. are ignored
+			}
+			out = append(out, v)
+		}
+		return out, nil
+	}
+	var legacy struct {
+		Report struct {
+			DocumentURI        string `json:"document-uri"`
+			BlockedURI         string `json:"blocked-uri"`
+			EffectiveDirective string `json:"effective-directive"`
+			ViolatedDirective  string `json:"violated-directive"`
+			Disposition        string `json:"disposition"`
+			SourceFile         string `json:"source-file"`
+			LineNumber         int    `json:"line-number"`
+		} `json:"csp-report"`
+	}
+	if err := json.Unmarshal(body, &legacy); err != nil {
+		return nil, err
+	}
+	rep := legacy.Report
+	dir := rep.EffectiveDirective
+	if dir == "" {
+		dir, _, _ = strings.Cut(rep.ViolatedDirective, " ")
+	}
+	return []Violation{{
+		Type:        "csp-violation",
+		DocumentURI: rep.DocumentURI,
+		BlockedURI:  rep.BlockedURI,
+		Directive:   dir,
+		Disposition: rep.Disposition,
+		SourceFile:  rep.SourceFile,
+		Line:        rep.LineNumber,
+	}}, nil
+}
+
+// Handler returns the collector. Each distinct violation is stored at most once per
+// dedupe window; suppressed duplicates are folded into the Count of the next stored copy.
+// Rate limiting is applied by the caller (see server.New).
+func Handler(store Store, dedupeWindow time.Duration) http.Handler {
+	d := newDeduper(dedupeWindow)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 64<<10))
+		if err != nil {
+			http.Error(w, "report too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		list, err := Parse(body)
+		if err != nil {
+			http.Error(w, "bad report", http.StatusBadRequest)
+			return
+		}
+		now := time.Now().UTC()
+		keep := list[:0]
+		for _, v := range list {
+			v.Time = now
+			if v.UserAgent == "" {
+				v.UserAgent = r.UserAgent()
+			}
+			if n, ok := d.admit(v.key(), now); ok {
+				v.Count = n
+				keep = append(keep, v)
+			}
+		}
+		if len(keep) > 0 {
+			if err := store.Save(r.Context(), keep); err != nil {
+				http.Error(w, "store error", http.StatusInternalServerError)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// maxDedupeKeys caps the violations remembered by the deduper; beyond it the oldest are
+// forgotten even inside their window, so a flood of distinct reports cannot grow memory.
+const maxDedupeKeys = 10000
+
+type seenEntry struct {
+	key        string
+	first      time.Time
+	suppressed int
+}
+
+type deduper struct {
+	mu     sync.Mutex
+	window time.Duration
+	seen   map[string]*list.Element // of *seenEntry
+	order  *list.List               // oldest first
+}
+
+func newDeduper(window time.Duration) *deduper {
+	return &deduper{window: window, seen: map[string]*list.Element{}, order: list.New()}
+}
+
+// admit reports whether a violation should be stored and how many occurrences it represents.
+func (d *deduper) admit(key string, now time.Time) (int, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	n := 1
+	if el := d.seen[key]; el != nil {
+		e := el.Value.(*seenEntry)
+		if now.Sub(e.first) < d.window {
+			e.suppressed++
+			return 0, false
+		}
+		n += e.suppressed
+		d.order.Remove(el)
+		delete(d.seen, key)
+	}
+	for front := d.order.Front(); front != nil; front = d.order.Front() {
+		e := front.Value.(*seenEntry)
+		if now.Sub(e.first) < d.window && d.order.Len() < maxDedupeKeys {
+			break
+		}
+		d.order.Remove(front)
+		delete(d.seen, e.key)
+	}
+	d.seen[key] = d.order.PushBack(&seenEntry{key: key, first: now})
+	return n, true
+}
+
+// Summary aggregates violations that share type, directive and blocked URI.
+type Summary struct {
+	Type       string
+	Directive  string
+	BlockedURI string
+	Count      int
+	Documents  int
+	FirstSeen  time.Time
+	LastSeen   time.Time
+	Sample     string // one affected document
+}
+
+// Summarize groups violations and orders them by descending count.
+func Summarize(list []Violation) []Summary {
+	type agg struct {
+		Summary
+		docs map[string]struct{}
+	}
+	groups := map[string]*agg{}
+	for _, v := range list {
+		k := v.Type + "|" + v.Directive + "|" + v.BlockedURI
+		g := groups[k]
+		if g == nil {
+			g = &agg{Summary: Summary{Type: v.Type, Directive: v.Directive, BlockedURI: v.BlockedURI, FirstSeen: v.Time, Sample: v.DocumentURI}, docs: map[string]struct{}{}}
+			groups[k] = g
+		}
+		n := v.Count
+		if n <= 0 {
+			n = 1
+		}
+		g.Count += n
+		g.docs[v.DocumentURI] = struct{}{}
+		if v.Time.Before(g.FirstSeen) {
+			g.FirstSeen = v.Time
+		}
+		if v.Time.After(g.LastSeen) {
+			g.LastSeen = v.Time
+		}
+	}
+	out := make([]Summary, 0, len(groups))
+	for _, g := range groups {
+		g.Documents = len(g.docs)
+		out = append(out, g.Summary)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Directive+out[i].BlockedURI < out[j].Directive+out[j].BlockedURI
+	})
+	return out
+}
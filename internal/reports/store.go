@@ -0,0 +1,138 @@
+package reports
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gothicforge3/internal/config"
+	"gothicforge3/internal/db"
+)
+
+// Store persists violations.
+type Store interface {
+	Save(ctx context.Context, list []Violation) error
+}
+
+// NewStore returns the store selected by REPORTS_STORE, or nil when reporting is off.
+func NewStore(cfg *config.Config) Store {
+	switch strings.ToLower(cfg.ReportsStore) {
+	case "off":
+		return nil
+	case "file":
+		return &FileStore{Path: cfg.ReportsFile}
+	case "postgres":
+		return PostgresStore{}
+	default:
+		return LogStore{}
+	}
+}
+
+// LogStore writes each violation as a structured log line.
+type LogStore struct{}
+
+// Save implements Store.
+func (LogStore) Save(_ context.Context, list []Violation) error {
+	for _, v := range list {
+		slog.Warn("report: violation", "type", v.Type, "directive", v.Directive, "blocked_uri", v.BlockedURI,
+			"document_uri", v.DocumentURI, "source_file", v.SourceFile, "line", v.Line, "count", v.Count)
+	}
+	return nil
+}
+
+// FileStore appends violations as JSON lines.
+type FileStore struct {
+	Path string
+	mu   sync.Mutex
+}
+
+// Save implements Store.
+func (s *FileStore) Save(_ context.Context, list []Violation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	for _, v := range list {
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadFile loads violations written by FileStore, keeping those at or after since.
+func ReadFile(path string, since time.Time) ([]Violation, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var out []Violation
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	for sc.Scan() {
+		var v Violation
+		if err := json.Unmarshal(sc.Bytes(), &v); err != nil {
+			continue // skip partial/corrupt lines
+		}
+		if !v.Time.Before(since) {
+			out = append(out, v)
+		}
+	}
+	return out, sc.Err()
+}
+
+// PostgresStore inserts violations into the csp_reports table
+// (see app/db/migrations/*_create_csp_reports.sql).
+type PostgresStore struct{}
+
+// Save implements Store.
+func (PostgresStore) Save(ctx context.Context, list []Violation) error {
+	cctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err := db.Connect(cctx); err != nil {
+		return err
+	}
+	for _, v := range list {
+		if _, err := db.Pool().Exec(cctx, `INSERT INTO csp_reports (received_at, type, document_uri, blocked_uri, directive, disposition, source_file, line, user_agent, count) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)`,
+			v.Time, v.Type, v.DocumentURI, v.BlockedURI, v.Directive, v.Disposition, v.SourceFile, v.Line, v.UserAgent, v.Count); err != nil {
+			return fmt.Errorf("insert report: %w", err)
+		}
+	}
+	return nil
+}
+
+// QueryPostgres loads violations stored by PostgresStore at or after since.
+func QueryPostgres(ctx context.Context, since time.Time) ([]Violation, error) {
+	if err := db.Connect(ctx); err != nil {
+		return nil, err
+	}
+	rows, err := db.Pool().Query(ctx, `SELECT received_at, type, document_uri, blocked_uri, directive, disposition, source_file, line, user_agent, count FROM csp_reports WHERE received_at >= $1`, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Violation
+	for rows.Next() {
+		var v Violation
+		if err := rows.Scan(&v.Time, &v.Type, &v.DocumentURI, &v.BlockedURI, &v.Directive, &v.Disposition, &v.SourceFile, &v.Line, &v.UserAgent, &v.Count); err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"strings"
+
+	"github.com/a-h/templ"
+	"gothicforge3/internal/config"
+	"gothicforge3/internal/reports"
+	"gothicforge3/internal/vendored"
+)
+
+// CSPMiddleware sets Content-Security-Policy with a fresh nonce per request.
+// The nonce is stored in the request context via templ.WithNonce so templates can
+// read it with templates.Nonce(ctx) and stamp it on every <script> they render.
+//
+// Development keeps a permissive policy for DX (inline scripts, eval, any https CDN).
+// Everywhere else scripts must carry the nonce; 'strict-dynamic' lets those trusted
+// scripts load their own dependencies (e.g. HTMX swapping in <script> elements).
+// Sources are 'self' only when the front-end libraries are vendored (VENDOR_MODE=local
+// with a lock, see package vendored); otherwise the pinned CDN origins are allowed.
+//
+// Unless REPORTS_STORE=off, violations are sent to the built-in collector via both
+// report-uri (legacy) and report-to (Reporting API). NEL is enabled as well when
+// SITE_BASE_URL is https, since browsers only honour it on secure origins.
+func CSPMiddleware(cfg *config.Config) func(http.Handler) http.Handler {
+	dev := cfg.IsDevelopment()
+	reporting := strings.ToLower(cfg.ReportsStore) != "off"
+	endpoint := strings.TrimRight(cfg.SiteBaseURL, "/") + reports.Path
+	nel := strings.HasPrefix(endpoint, "https://")
+	cdn := ""
+	if origins := vendored.Origins(); len(origins) > 0 {
+		cdn = " " + strings.Join(origins, " ")
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			nonce := newNonce()
+			var csp []string
+			if dev {
+				csp = []string{
+					"default-src 'self'",
+					"script-src 'self' https: 'unsafe-eval' 'unsafe-inline'",
+					"style-src 'self' https: 'unsafe-inline'",
+					"img-src 'self' data: https:",
+					"font-src 'self' https:",
+					"connect-src 'self' https:",
+				}
+			} else {
+				csp = []string{
+					"default-src 'self'",
+					"script-src 'nonce-" + nonce + "' 'strict-dynamic' 'self'" + cdn,
+					"style-src 'self' 'unsafe-inline'" + cdn,
+					"img-src 'self' data:",
+					"font-src 'self'" + cdn,
+					"connect-src 'self'",
+				}
+			}
+			csp = append(csp, "object-src 'none'", "base-uri 'self'", "frame-ancestors 'self'")
+			if reporting {
+				csp = append(csp, "report-uri "+endpoint, "report-to "+reports.Group)
+				w.Header().Set("Reporting-Endpoints", reports.Group+`="`+endpoint+`"`)
+				if nel {
+					w.Header().Set("Report-To", `{"group":"`+reports.Group+`","max_age":2592000,"endpoints":[{"url":"`+endpoint+`"}]}`)
+					w.Header().Set("NEL", `{"report_to":"`+reports.Group+`","max_age":2592000}`)
+				}
+			}
+			w.Header().Set("Content-Security-Policy", strings.Join(csp, "; "))
+			next.ServeHTTP(w, r.WithContext(templ.WithNonce(r.Context(), nonce)))
+		})
+	}
+}
+
+// newNonce returns 128 bits of randomness, base64-encoded.
+func newNonce() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return base64.StdEncoding.EncodeToString(b)
+}
@@ -0,0 +1,23 @@
+//go:build !unix
+
+package server
+
+import (
+	"errors"
+	"net"
+	"os"
+	"time"
+)
+
+// Handoff and inherited descriptors need Unix process semantics.
+var upgradeSignals []os.Signal
+
+func fileListener(fd int, name string) (net.Listener, error) {
+	return nil, errors.New("inherited listeners are not supported on this platform")
+}
+
+func handoff(time.Duration) error {
+	return errors.New("listener handoff is not supported on this platform")
+}
+
+func notifyReady() error { return nil }
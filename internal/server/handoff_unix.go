@@ -0,0 +1,151 @@
+//go:build unix
+
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// upgradeSignals start a handoff to a new process (see handoff).
+var upgradeSignals = []os.Signal{syscall.SIGHUP, syscall.SIGUSR2}
+
+func fileListener(fd int, name string) (net.Listener, error) {
+	syscall.CloseOnExec(fd)
+	f := os.NewFile(uintptr(fd), name)
+	defer f.Close()
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("fd %d (%s): %w", fd, name, err)
+	}
+	return ln, nil
+}
+
+// handoff starts the current executable with the same arguments, passing every recorded
+// listener, and waits until the new process reports ready (after its start hooks) or timeout
+// elapses. On success the caller drains and exits while the new process keeps accepting on
+// the same sockets, so no connection is refused.
+func handoff(timeout time.Duration) error {
+	names, lns := activeListeners()
+	files := make([]*os.File, 0, len(lns)+1)
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	for i, ln := range lns {
+		fl, ok := ln.(interface{ File() (*os.File, error) })
+		if !ok {
+			return fmt.Errorf("listener %s cannot be passed on", names[i])
+		}
+		f, err := fl.File()
+		if err != nil {
+			return fmt.Errorf("listener %s: %w", names[i], err)
+		}
+		files = append(files, f)
+	}
+	ready, readyW, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer ready.Close()
+	files = append(files, readyW)
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.ExtraFiles = files
+	cmd.Env = append(handoffEnv(),
+		envListenFDs+"="+strconv.Itoa(len(lns)),
+		envListenFDNames+"="+strings.Join(names, ":"),
+		envReadyFD+"="+strconv.Itoa(listenFDStart+len(lns)),
+	)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("start %s: %w", exe, err)
+	}
+	readyW.Close()
+	files = files[:len(files)-1]
+
+	result := make(chan error, 2)
+	go func() {
+		line, err := bufio.NewReader(ready).ReadString('\n')
+		if strings.TrimSpace(line) == "ready" {
+			result <- nil
+			return
+		}
+		result <- fmt.Errorf("new process %d exited before becoming ready (%v)", cmd.Process.Pid, err)
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err = <-result:
+	case <-timer.C:
+		err = fmt.Errorf("new process %d not ready after %s", cmd.Process.Pid, timeout)
+	}
+	if err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return err
+	}
+	// The sockets now belong to the new process too: closing ours must not unlink them.
+	for _, ln := range lns {
+		if ul, ok := ln.(*net.UnixListener); ok {
+			ul.SetUnlinkOnClose(false)
+		}
+	}
+	go func() { _ = cmd.Wait() }()
+	return nil
+}
+
+// handoffEnv is the environment without listener variables from an earlier generation.
+func handoffEnv() []string {
+	var env []string
+	for _, kv := range os.Environ() {
+		k, _, _ := strings.Cut(kv, "=")
+		switch k {
+		case envListenFDs, envListenFDNames, envReadyFD, "LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES":
+			continue
+		}
+		env = append(env, kv)
+	}
+	return env
+}
+
+// notifyReady tells the parent of a handoff that this process is serving, and systemd
+// (Type=notify) that it is ready and, after a handoff, that it is the new main process
+// (requires NotifyAccess=all).
+func notifyReady() error {
+	var errs []error
+	if v := os.Getenv(envReadyFD); v != "" {
+		_ = os.Unsetenv(envReadyFD)
+		if fd, err := strconv.Atoi(v); err == nil {
+			f := os.NewFile(uintptr(fd), "ready")
+			_, err = f.WriteString("ready\n")
+			f.Close()
+			errs = append(errs, err)
+		}
+	}
+	if sock := os.Getenv("NOTIFY_SOCKET"); sock != "" {
+		if strings.HasPrefix(sock, "@") {
+			sock = "\x00" + sock[1:]
+		}
+		c, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: sock, Net: "unixgram"})
+		if err == nil {
+			_, err = c.Write([]byte("READY=1\nMAINPID=" + strconv.Itoa(os.Getpid())))
+			c.Close()
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
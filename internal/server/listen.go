@@ -0,0 +1,164 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Listener names, in the order systemd sockets without FileDescriptorName= are assigned.
+var listenerNames = []string{"http", "redirect", "metrics"}
+
+// Environment used to pass listeners to a new process during a handoff (see Run).
+const (
+	envListenFDs     = "GFORGE_LISTEN_FDS"
+	envListenFDNames = "GFORGE_LISTEN_FDNAMES"
+	envReadyFD       = "GFORGE_READY_FD"
+
+	// listenFDStart is the first inherited descriptor (after stdin, stdout and stderr).
+	listenFDStart = 3
+)
+
+var (
+	listenMu      sync.Mutex
+	inheritOnce   sync.Once
+	inherited     map[string]net.Listener
+	active        = map[string]net.Listener{}
+	inheritSource string
+)
+
+// Listen returns the listener called name ("http", "redirect" or "metrics"). A listener
+// inherited from the previous process during a handoff, or passed by systemd socket
+// activation (LISTEN_FDS), is used when present; otherwise addr is bound. An addr of the form
+// "unix:/run/gforge/http.sock" listens on a Unix socket, replacing a stale socket file.
+//
+// Listeners are recorded under their name so a handoff can pass them on.
+func Listen(name, addr string) (net.Listener, error) {
+	inheritOnce.Do(func() { inherited, inheritSource = inheritListeners() })
+	listenMu.Lock()
+	defer listenMu.Unlock()
+	if ln, ok := inherited[name]; ok {
+		delete(inherited, name)
+		active[name] = ln
+		return ln, nil
+	}
+	ln, err := listenAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	active[name] = ln
+	return ln, nil
+}
+
+// InheritedFrom reports where inherited listeners came from: "handoff", "systemd" or "".
+func InheritedFrom() string {
+	inheritOnce.Do(func() { inherited, inheritSource = inheritListeners() })
+	return inheritSource
+}
+
+// track records a listener created by the caller (Options.Listener).
+func track(name string, ln net.Listener) {
+	listenMu.Lock()
+	defer listenMu.Unlock()
+	active[name] = ln
+}
+
+// forget drops listeners that are no longer served.
+func forget(names ...string) {
+	listenMu.Lock()
+	defer listenMu.Unlock()
+	for _, n := range names {
+		delete(active, n)
+	}
+}
+
+// activeListeners returns the recorded listeners sorted by name.
+func activeListeners() ([]string, []net.Listener) {
+	listenMu.Lock()
+	defer listenMu.Unlock()
+	names := make([]string, 0, len(active))
+	for n := range active {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	lns := make([]net.Listener, len(names))
+	for i, n := range names {
+		lns[i] = active[n]
+	}
+	return names, lns
+}
+
+func listenAddr(addr string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, "unix:")
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+	if st, err := os.Stat(path); err == nil && st.Mode()&fs.ModeSocket != 0 {
+		// A socket file left by a crashed process; a live server would still accept on it.
+		if c, err := net.Dial("unix", path); err == nil {
+			c.Close()
+			return nil, fmt.Errorf("listen %s: socket in use", addr)
+		}
+		_ = os.Remove(path)
+	}
+	return net.Listen("unix", path)
+}
+
+// inheritListeners reads listeners passed by a handoff parent (GFORGE_LISTEN_FDS) or by
+// systemd (LISTEN_PID/LISTEN_FDS). The variables are cleared so child processes do not
+// inherit them.
+func inheritListeners() (map[string]net.Listener, string) {
+	source, n, names := "", 0, ""
+	if v := os.Getenv(envListenFDs); v != "" {
+		source, names = "handoff", os.Getenv(envListenFDNames)
+		n, _ = strconv.Atoi(v)
+	} else if pid, _ := strconv.Atoi(os.Getenv("LISTEN_PID")); pid == os.Getpid() {
+		source, names = "systemd", os.Getenv("LISTEN_FDNAMES")
+		n, _ = strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	}
+	for _, k := range []string{envListenFDs, envListenFDNames, "LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+		_ = os.Unsetenv(k)
+	}
+	if n <= 0 {
+		return nil, ""
+	}
+	fdNames := strings.Split(names, ":")
+	out := map[string]net.Listener{}
+	var errs []error
+	for i := 0; i < n; i++ {
+		name := ""
+		if i < len(fdNames) && isListenerName(fdNames[i]) {
+			name = fdNames[i]
+		} else if i < len(listenerNames) {
+			name = listenerNames[i]
+		} else {
+			continue
+		}
+		ln, err := fileListener(listenFDStart+i, name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		out[name] = ln
+	}
+	if err := errors.Join(errs...); err != nil {
+		slog.Warn("server: inherited listeners", "source", source, "error", err)
+	}
+	return out, source
+}
+
+func isListenerName(s string) bool {
+	for _, n := range listenerNames {
+		if s == n {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,316 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+
+	"gothicforge3/internal/health"
+)
+
+// Options configures the HTTP server started by Run.
+// Zero values are replaced with the defaults from DefaultOptions.
+type Options struct {
+	Addr              string
+	Listener          net.Listener // optional pre-bound listener; Addr is ignored when set (see Listen)
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	ShutdownTimeout   time.Duration // grace period for draining connections and running shutdown hooks
+	Handoff           bool          // hand listeners to a new process on SIGHUP/SIGUSR2 (Unix only)
+	HandoffTimeout    time.Duration // how long a handoff waits for the new process to become ready
+
+	TLSConfig       *tls.Config  // serve HTTPS (HTTP/2 and HTTP/1.1) when set; see TLS
+	RedirectAddr    string       // optional plain-HTTP listener, e.g. ":80" (requires TLSConfig)
+	RedirectHandler http.Handler // served on RedirectAddr; defaults to RedirectHTTPS(Addr)
+}
+
+// DefaultOptions returns conservative timeouts suitable for most deployments.
+func DefaultOptions(addr string) Options {
+	return Options{
+		Addr:              addr,
+		ReadTimeout:       30 * time.Second,
+		ReadHeaderTimeout: 10 * time.Second,
+		WriteTimeout:      60 * time.Second,
+		IdleTimeout:       120 * time.Second,
+		ShutdownTimeout:   20 * time.Second,
+		HandoffTimeout:    60 * time.Second,
+	}
+}
+
+// Hook is a lifecycle callback. The context carries the deadline for the current phase.
+type Hook func(ctx context.Context) error
+
+type namedHook struct {
+	id   uint64
+	name string
+	fn   Hook
+}
+
+var (
+	hooksMu       sync.Mutex
+	hookSeq       uint64
+	startHooks    []namedHook
+	shutdownHooks []namedHook
+)
+
+// OnStart registers a hook that runs before the server accepts connections.
+// Hooks run in registration order; the first error aborts startup. The returned
+// function unregisters the hook (tests call it from t.Cleanup).
+func OnStart(name string, fn Hook) (remove func()) {
+	return addHook(&startHooks, name, fn)
+}
+
+// OnShutdown registers a hook that runs after in-flight requests have drained.
+// Hooks run in reverse registration order (like defer), so resources registered
+// first are released last. The returned function unregisters the hook.
+func OnShutdown(name string, fn Hook) (remove func()) {
+	return addHook(&shutdownHooks, name, fn)
+}
+
+func addHook(hooks *[]namedHook, name string, fn Hook) func() {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	hookSeq++
+	id := hookSeq
+	*hooks = append(*hooks, namedHook{id: id, name: name, fn: fn})
+	return func() {
+		hooksMu.Lock()
+		defer hooksMu.Unlock()
+		*hooks = slices.DeleteFunc(*hooks, func(h namedHook) bool { return h.id == id })
+	}
+}
+
+// Run serves h until ctx is cancelled or SIGINT/SIGTERM is received, then stops
+// accepting connections, waits up to opts.ShutdownTimeout for in-flight requests
+// and runs the registered shutdown hooks (each phase gets its own grace budget).
+//
+// With opts.Handoff on Unix, SIGHUP or SIGUSR2 hands the listeners over to a freshly started copy of the
+// executable (e.g. a new binary installed over the old one). Once the new process has run
+// its start hooks and reports ready, this one drains as above and returns; if it fails to
+// start, this one keeps serving. Listeners come from Listen, so the new process, or one
+// started by systemd socket activation, accepts on the inherited sockets.
+func Run(ctx context.Context, h http.Handler, opts Options) error {
+	opts = withDefaults(opts)
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	upgrade := make(chan os.Signal, 1)
+	if opts.Handoff && len(upgradeSignals) > 0 {
+		signal.Notify(upgrade, upgradeSignals...)
+		defer signal.Stop(upgrade)
+	}
+	defer forget("http", "redirect")
+
+	ln := opts.Listener
+	if ln == nil {
+		var err error
+		ln, err = Listen("http", opts.Addr)
+		if err != nil {
+			return err
+		}
+	} else {
+		track("http", ln)
+	}
+	var redirect *http.Server
+	var redirectLn net.Listener
+	if opts.TLSConfig != nil && opts.RedirectAddr != "" {
+		var err error
+		if redirectLn, err = Listen("redirect", opts.RedirectAddr); err != nil {
+			_ = ln.Close()
+			return fmt.Errorf("redirect listener: %w", err)
+		}
+		h := opts.RedirectHandler
+		if h == nil {
+			h = RedirectHTTPS(ln.Addr().String())
+		}
+		redirect = &http.Server{Handler: h, ReadHeaderTimeout: opts.ReadHeaderTimeout, IdleTimeout: opts.IdleTimeout}
+	}
+
+	if err := runHooks(ctx, "start", hooksFor("start")); err != nil {
+		_ = ln.Close()
+		if redirectLn != nil {
+			_ = redirectLn.Close()
+		}
+		sctx, cancel := context.WithTimeout(context.Background(), opts.ShutdownTimeout)
+		defer cancel()
+		return errors.Join(err, runHooks(sctx, "shutdown", hooksFor("shutdown")))
+	}
+
+	health.MarkStarted()
+	if err := notifyReady(); err != nil {
+		slog.Warn("server: readiness notification failed", "error", err)
+	}
+
+	// ln is closed early on handoff and again by Shutdown.
+	ln = &onceCloseListener{Listener: ln}
+	fresh := &newConns{conns: map[net.Conn]struct{}{}}
+	srv := &http.Server{
+		ConnState:         fresh.track,
+		Handler:           h,
+		ReadTimeout:       opts.ReadTimeout,
+		ReadHeaderTimeout: opts.ReadHeaderTimeout,
+		WriteTimeout:      opts.WriteTimeout,
+		IdleTimeout:       opts.IdleTimeout,
+	}
+	serveErr := make(chan error, 2)
+	if opts.TLSConfig != nil {
+		// ServeTLS adds "h2" to NextProtos, so clients negotiate HTTP/2 via ALPN.
+		srv.TLSConfig = opts.TLSConfig.Clone()
+		go func() { serveErr <- srv.ServeTLS(ln, "", "") }()
+	} else {
+		go func() { serveErr <- srv.Serve(ln) }()
+	}
+	if redirect != nil {
+		go func() { serveErr <- redirect.Serve(redirectLn) }()
+	}
+
+	var err error
+wait:
+	for {
+		select {
+		case err = <-serveErr:
+			if errors.Is(err, http.ErrServerClosed) {
+				err = nil
+			}
+			break wait
+		case <-ctx.Done():
+			slog.Info("server: shutting down", "grace", opts.ShutdownTimeout)
+			break wait
+		case sig := <-upgrade:
+			slog.Info("server: handoff requested", "signal", sig.String())
+			if herr := handoff(opts.HandoffTimeout); herr != nil {
+				slog.Error("server: handoff failed; still serving", "error", herr)
+				continue
+			}
+			slog.Info("server: new process ready; draining", "grace", opts.ShutdownTimeout)
+			// Shutdown drops accepted connections that have not sent a request yet; stop
+			// accepting first so those requests are served here instead of failing.
+			_ = ln.Close()
+			fresh.wait(handoffSettle)
+			break wait
+		}
+	}
+
+	sctx, cancel := context.WithTimeout(context.Background(), opts.ShutdownTimeout)
+	defer cancel()
+	if serr := srv.Shutdown(sctx); serr != nil {
+		err = errors.Join(err, fmt.Errorf("drain: %w", serr))
+		_ = srv.Close()
+	}
+	if redirect != nil {
+		_ = redirect.Shutdown(sctx)
+	}
+	// Hooks get their own budget so a slow drain cannot starve resource cleanup.
+	hctx, hcancel := context.WithTimeout(context.Background(), opts.ShutdownTimeout)
+	defer hcancel()
+	return errors.Join(err, runHooks(hctx, "shutdown", hooksFor("shutdown")))
+}
+
+func withDefaults(opts Options) Options {
+	def := DefaultOptions(opts.Addr)
+	if opts.ReadTimeout <= 0 {
+		opts.ReadTimeout = def.ReadTimeout
+	}
+	if opts.ReadHeaderTimeout <= 0 {
+		opts.ReadHeaderTimeout = def.ReadHeaderTimeout
+	}
+	if opts.WriteTimeout <= 0 {
+		opts.WriteTimeout = def.WriteTimeout
+	}
+	if opts.IdleTimeout <= 0 {
+		opts.IdleTimeout = def.IdleTimeout
+	}
+	if opts.ShutdownTimeout <= 0 {
+		opts.ShutdownTimeout = def.ShutdownTimeout
+	}
+	if opts.HandoffTimeout <= 0 {
+		opts.HandoffTimeout = def.HandoffTimeout
+	}
+	return opts
+}
+
+// hooksFor returns a copy of the hooks for a phase in execution order.
+func hooksFor(phase string) []namedHook {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	if phase == "start" {
+		return append([]namedHook(nil), startHooks...)
+	}
+	out := make([]namedHook, 0, len(shutdownHooks))
+	for i := len(shutdownHooks) - 1; i >= 0; i-- {
+		out = append(out, shutdownHooks[i])
+	}
+	return out
+}
+
+// runHooks runs hooks sequentially. Start hooks stop at the first error;
+// shutdown hooks always all run and their errors are joined.
+func runHooks(ctx context.Context, phase string, hooks []namedHook) error {
+	var errs []error
+	for _, hk := range hooks {
+		if err := hk.fn(ctx); err != nil {
+			err = fmt.Errorf("%s hook %q: %w", phase, hk.name, err)
+			if phase == "start" {
+				return err
+			}
+			slog.Error("server: hook failed", "error", err)
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// handoffSettle bounds how long a handed-off process waits for just-accepted connections to
+// send their first request before draining.
+const handoffSettle = time.Second
+
+type onceCloseListener struct {
+	net.Listener
+	once sync.Once
+	err  error
+}
+
+func (l *onceCloseListener) Close() error {
+	l.once.Do(func() { l.err = l.Listener.Close() })
+	return l.err
+}
+
+// newConns tracks connections in http.StateNew (accepted, no request read yet).
+type newConns struct {
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+}
+
+func (n *newConns) track(c net.Conn, st http.ConnState) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if st == http.StateNew {
+		n.conns[c] = struct{}{}
+	} else {
+		delete(n.conns, c)
+	}
+}
+
+func (n *newConns) wait(max time.Duration) {
+	deadline := time.Now().Add(max)
+	for time.Now().Before(deadline) {
+		n.mu.Lock()
+		left := len(n.conns)
+		n.mu.Unlock()
+		if left == 0 {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -1,16 +1,11 @@
 package server
 
 import (
-    "crypto/tls"
-    "fmt"
-    "log"
+    "context"
+    "log/slog"
     "net/http"
-    pprof "net/http/pprof"
-    "net/url"
-    "os"
-    "path/filepath"
-    "strconv"
     "strings"
+    pprof "net/http/pprof"
     "time"
 
     "github.com/alexedwards/scs/v2"
@@ -18,59 +13,60 @@ import (
     "github.com/go-chi/chi/v5"
     "github.com/go-chi/chi/v5/middleware"
     "github.com/go-chi/cors"
-    "github.com/go-chi/httprate"
-    redigo "github.com/gomodule/redigo/redis"
-    "gothicforge3/internal/env"
+    "gothicforge3/app"
+    "gothicforge3/internal/assets"
+    "gothicforge3/internal/auth"
+    "gothicforge3/internal/config"
+    "gothicforge3/internal/health"
+    "gothicforge3/internal/httpcache"
+    "gothicforge3/internal/kv"
+    "gothicforge3/internal/logging"
+    "gothicforge3/internal/metrics"
+    "gothicforge3/internal/ratelimit"
+    "gothicforge3/internal/realip"
+    "gothicforge3/internal/reports"
+    "gothicforge3/internal/tracing"
+    "gothicforge3/internal/vendored"
 )
 
 var sessionManager *scs.SessionManager
+
+func init() {
+    // Drain the shared Valkey pool (sessions, rate limits, cache) after in-flight requests have finished.
+    OnShutdown("kv", func(context.Context) error { return kv.Close() })
+    // The report collector has its own "reports" policy.
+    ratelimit.Exempt(reports.Path)
+}
+
 // Sessions exposes the global session manager
 func Sessions() *scs.SessionManager { return sessionManager }
-// New creates the chi router with defaults
-func New() *chi.Mux {
+// New creates the chi router with defaults. A nil cfg falls back to config.Current().
+func New(cfg *config.Config) *chi.Mux {
+    if cfg == nil { cfg = config.Current() }
+    // Bad JWT keys fall back to JWT_SECRET in development only; production signs nothing.
+    if err := auth.Init(cfg); err != nil { slog.Error("jwt keys", "error", err, "fallback", !cfg.IsProduction()) }
     r := chi.NewRouter()
     // Core middlewares
     r.Use(middleware.RequestID)
-    r.Use(middleware.RealIP)
-    r.Use(middleware.Recoverer)
-    switch strings.ToLower(env.Get("LOG_FORMAT", "")) {
-    case "json":
-        r.Use(jsonLoggerMiddleware)
-    case "off", "silent", "none":
-        // no request logging middleware
-    default:
-        r.Use(middleware.Logger)
-    }
-    r.Use(middleware.Compress(5))
+    // Client IP and scheme: forwarding headers count only from TRUSTED_PROXIES
+    if err := realip.Setup(cfg); err != nil { slog.Warn("trusted proxies", "error", err) }
+    r.Use(realip.Middleware)
+    // One JWT verification (and session lookup) per request, shared by logging, rate limits and handlers
+    r.Use(auth.Memoize)
+    // HSTS on HTTPS responses when the server terminates TLS itself (TLS_CERT_FILE or ACME_DOMAINS)
+    if cfg.TLSMode() != "" && cfg.HSTSMaxAge > 0 { r.Use(HSTS(cfg.HSTSMaxAge, cfg.HSTSIncludeSubdomains, cfg.HSTSPreload)) }
+    // OpenTelemetry server span per request (no-op unless tracing is configured in cmd/server)
+    r.Use(tracing.Middleware)
+    // Structured request logging (log/slog) with panic recovery; LOG_FORMAT=off silences request lines.
+    logging.Setup(cfg)
+    r.Use(logging.Middleware)
+    // Prometheus request metrics (opt-in)
+    if cfg.MetricsEnable { r.Use(metrics.Middleware) }
+    // Dynamic compression for pages and fragments; /static serves build-time .br/.gz siblings instead.
+    r.Use(compressDynamic(5))
 
     // CORS
-    r.Use(configureCORS())
-
-    // Rate limit (bypass safe paths)
-    maxReq := 120
-    if v := strings.TrimSpace(env.Get("RATE_LIMIT_MAX", "")); v != "" {
-        if n, err := strconv.Atoi(v); err == nil && n > 0 {
-            maxReq = n
-        }
-    }
-    window := time.Minute
-    if v := strings.TrimSpace(env.Get("RATE_LIMIT_WINDOW_SECONDS", "")); v != "" {
-        if n, err := strconv.Atoi(v); err == nil && n > 0 {
-            window = time.Duration(n) * time.Second
-        }
-    }
-    lim := httprate.LimitByIP(maxReq, window)
-    r.Use(func(next http.Handler) http.Handler {
-        limited := lim(next)
-        return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-            p := req.URL.Path
-            if req.Method == http.MethodGet || req.Method == http.MethodHead || req.Method == http.MethodOptions || strings.HasPrefix(p, "/static/") || p == "/favicon.ico" || p == "/robots.txt" || p == "/sitemap.xml" || p == "/healthz" {
-                next.ServeHTTP(w, req)
-                return
-            }
-            limited.ServeHTTP(w, req)
-        })
-    })
+    r.Use(configureCORS(cfg.CORSOrigins))
 
     // Sessions (cookie-based)
     sessionManager = scs.New()
@@ -78,102 +74,64 @@ func New() *chi.Mux {
     sessionManager.Lifetime = 24 * time.Hour
     sessionManager.Cookie.HttpOnly = true
     sessionManager.Cookie.SameSite = http.SameSiteLaxMode
-    sessionManager.Cookie.Secure = env.Get("APP_ENV", "development") == "production"
-    // Valkey/Redis session store if URL provided (redigo pool)
-    ru := strings.TrimSpace(env.Get("VALKEY_URL", ""))
-    if ru == "" {
-        ru = strings.TrimSpace(env.Get("REDIS_URL", ""))
+    sessionManager.Cookie.Secure = cfg.IsProduction()
+    sessionManager.ErrorFunc = func(w http.ResponseWriter, req *http.Request, err error) {
+        metrics.SessionErrors.Inc()
+        logging.FromContext(req.Context()).Error("session store", "error", err)
+        http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
     }
-    if ru != "" {
-        // Support TLS (rediss://) and optional skip-verify via VALKEY_TLS_SKIP_VERIFY=1
-        skipVerify := strings.EqualFold(strings.TrimSpace(env.Get("VALKEY_TLS_SKIP_VERIFY", "")), "1")
-        u, perr := url.Parse(ru)
-        pool := &redigo.Pool{
-            MaxIdle:     4,
-            IdleTimeout: 300 * time.Second,
-            Dial: func() (redigo.Conn, error) {
-                if perr == nil {
-                    // If we need custom TLS config or scheme is non-rediss, compose Dial options
-                    scheme := strings.ToLower(u.Scheme)
-                    if scheme == "rediss" || skipVerify {
-                        opts := []redigo.DialOption{}
-                        // Password
-                        if u.User != nil {
-                            if pw, ok := u.User.Password(); ok { opts = append(opts, redigo.DialPassword(pw)) }
-                        }
-                        // Database index from path (e.g., /0)
-                        if dbStr := strings.TrimPrefix(u.Path, "/"); dbStr != "" {
-                            if n, err := strconv.Atoi(dbStr); err == nil { opts = append(opts, redigo.DialDatabase(n)) }
-                        }
-                        // TLS settings
-                        if scheme == "rediss" || skipVerify {
-                            opts = append(opts, redigo.DialUseTLS(true))
-                            if skipVerify {
-                                opts = append(opts, redigo.DialTLSConfig(&tls.Config{InsecureSkipVerify: true}))
-                            }
-                        }
-                        host := u.Host
-                        return redigo.Dial("tcp", host, opts...)
-                    }
-                }
-                // Fallback to DialURL for plain redis:// URLs
-                return redigo.DialURL(ru)
-            },
-            TestOnBorrow: func(c redigo.Conn, t time.Time) error {
-                if time.Since(t) < time.Minute { return nil }
-                _, err := c.Do("PING")
-                return err
-            },
-        }
-        sessionManager.Store = redisstore.New(pool)
+    // Valkey/Redis session store when configured (shared internal/kv pool)
+    kv.Init(cfg)
+    if pool := kv.Pool(); pool != nil {
+        sessionManager.Store = tracing.SessionStore(redisstore.New(pool))
     }
     r.Use(sessionManager.LoadAndSave)
 
-    // Content-Security-Policy
-    r.Use(func(next http.Handler) http.Handler {
-        return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-            var csp []string
-            if env.Get("APP_ENV", "development") == "development" {
-                csp = []string{
-                    "default-src 'self'",
-                    "script-src 'self' https: 'unsafe-eval' 'unsafe-inline'",
-                    "style-src 'self' https: 'unsafe-inline'",
-                    "img-src 'self' data: https:",
-                    "font-src 'self' https:",
-                    "connect-src 'self' https:",
-                    "object-src 'none'",
-                    "base-uri 'self'",
-                    "frame-ancestors 'self'",
-                }
-            } else {
-                csp = []string{
-                    "default-src 'self'",
-                    // Allow CDNs used in Layout/SEO and inline JSON-LD
-                    "script-src 'self' https://unpkg.com https://cdn.jsdelivr.net 'unsafe-inline'",
-                    "style-src 'self' https: 'unsafe-inline'",
-                    "img-src 'self' data: https:",
-                    "font-src 'self' https:",
-                    "connect-src 'self' https:",
-                    "object-src 'none'",
-                    "base-uri 'self'",
-                    "frame-ancestors 'self'",
-                }
-            }
-            w.Header().Set("Content-Security-Policy", strings.Join(csp, "; "))
-            next.ServeHTTP(w, req)
-        })
-    })
+    // Rate limits: named policies shared through Valkey when configured, else per process.
+    // The "default" policy covers state-changing requests; routes attach others with
+    // ratelimit.Limit(name).
+    if err := ratelimit.Setup(cfg, kv.Pool()); err != nil { slog.Warn("rate limit policies", "error", err) }
+    r.Use(ratelimit.Global())
+
+    // Third-party libraries (htmx, Alpine, DaisyUI): vendored copies or pinned CDN URLs; decides CSP origins.
+    if err := vendored.Init(app.Static(), cfg.VendorMode, cfg.IsProduction()); err != nil { slog.Warn(err.Error()) }
 
-    // CSRF (prod only): simple same-origin check for state-changing requests
-    if env.Get("APP_ENV", "development") == "production" {
-        r.Use(CSRFMiddleware)
+    // Content-Security-Policy (per-request nonce for scripts)
+    r.Use(CSPMiddleware(cfg))
+
+    // CSRF: session-bound synchronizer tokens for state-changing requests (all environments)
+    r.Use(CSRFMiddleware())
+
+    // ETag + 304 for rendered HTML (opt-in). Runs inside CSP (the nonce is left out of the hash)
+    // and inside compression, so validators describe the uncompressed page.
+    // Routes wrapped in httpcache.Cache and httpcache.Fragment components share the kv store.
+    httpcache.Enable(!cfg.HTTPCacheDisable)
+    if cfg.ETagEnable { r.Use(httpcache.ETag(httpcache.Options{Weak: cfg.ETagWeak})) }
+
+    // CSP/NEL violation collector (own per-IP limit; exempt from the global limiter and CSRF)
+    if store := reports.NewStore(cfg); store != nil {
+        r.With(ratelimit.Limit("reports")).Method(http.MethodPost, reports.Path, reports.Handler(store, cfg.ReportsDedupeWindow))
     }
 
+    // /metrics on the main router requires METRICS_TOKEN; with METRICS_ADDR it has its own listener (cmd/server).
+    if cfg.MetricsEnable && cfg.MetricsAddr == "" {
+        if cfg.MetricsToken != "" {
+            r.Method(http.MethodGet, metrics.Path, metrics.Handler(cfg.MetricsToken))
+        } else {
+            slog.Warn("metrics: not mounted; set METRICS_TOKEN or METRICS_ADDR")
+        }
+    }
+
+    // Probes: /livez, /readyz, /startupz (text, or JSON with ?format=json); /healthz is kept as a liveness alias.
+    health.Register(health.Check{Name: "valkey", Critical: true, Timeout: 2 * time.Second, CacheTTL: 2 * time.Second, Fn: valkeyCheck})
+    for _, p := range health.Probes { r.Method(http.MethodGet, "/"+p, health.Handler(p)) }
+    r.Method(http.MethodGet, "/healthz", health.Handler(health.Livez))
+
     // Static assets (CSS/JS/images)
     mountStatic(r)
 
     // pprof (dev or when enabled): /debug/pprof
-    if env.Get("APP_ENV", "development") == "development" || strings.EqualFold(env.Get("PPROF_ENABLE", ""), "1") {
+    if cfg.IsDevelopment() || cfg.PprofEnable {
         r.Route("/debug/pprof", func(rr chi.Router) {
             rr.Get("/", pprof.Index)
             rr.Get("/cmdline", pprof.Cmdline)
@@ -192,56 +150,54 @@ func New() *chi.Mux {
     return r
 }
 
-func mountStatic(r *chi.Mux) {
-    // serve app/static under /static
-    staticDir := detectStaticDir()
-    fs := http.StripPrefix("/static", http.FileServer(http.Dir(staticDir)))
-    r.Handle("/static/*", fs)
-    // also serve styles directly for convenience
-    styles := http.StripPrefix("/static/styles", http.FileServer(http.Dir(filepath.Join("app", "styles"))))
-    r.Handle("/static/styles/*", styles)
+// valkeyCheck PINGs the shared pool; it is skipped with the in-memory backend.
+func valkeyCheck(ctx context.Context) error {
+    if kv.Backend() != "valkey" { return health.ErrSkip }
+    return kv.Ping(ctx)
 }
 
-func detectStaticDir() string {
-    if base := strings.TrimSpace(env.Get("GFORGE_BASEDIR", "")); base != "" {
-        return filepath.Join(base, "app", "static")
-    }
-    wd, _ := os.Getwd()
-    cur := wd
-    for {
-        if _, err := os.Stat(filepath.Join(cur, "go.mod")); err == nil {
-            p := filepath.Join(cur, "app", "static")
-            if _, err := os.Stat(p); err == nil {
-                return p
-            }
-            break
+// mountStatic serves app/static under /static and app/styles under /static/styles, from the
+// binary (default) or from disk in devfs builds (see package app). Fingerprinted names from the
+// asset manifest are served with an immutable Cache-Control (see package assets).
+func mountStatic(r *chi.Mux) {
+    dev := app.Source() == "disk"
+    m := assets.Manifest{}
+    if !dev {
+        var err error
+        if m, err = assets.Load(app.Static(), app.Styles()); err != nil {
+            slog.Warn("assets: fingerprinting disabled", "error", err)
+            m = assets.Manifest{}
         }
-        parent := filepath.Dir(cur)
-        if parent == cur { break }
-        cur = parent
     }
-    return filepath.Join("app", "static")
+    assets.Use(m, dev)
+    r.Handle("/static/*", http.StripPrefix("/static", assets.Handler(app.Static(), app.Styles())))
+}
+
+// compressDynamic is middleware.Compress for everything except /static/: assets.Handler serves
+// build-time siblings (see assets.Compress) and compresses files without one itself.
+func compressDynamic(level int) func(http.Handler) http.Handler {
+    compress := middleware.Compress(level)
+    return func(next http.Handler) http.Handler {
+        c := compress(next)
+        return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+            if strings.HasPrefix(req.URL.Path, assets.Prefix) { next.ServeHTTP(w, req); return }
+            c.ServeHTTP(w, req)
+        })
+    }
 }
 
-func configureCORS() func(http.Handler) http.Handler {
-	origins := strings.TrimSpace(env.Get("CORS_ORIGINS", ""))
+func configureCORS(origins []string) func(http.Handler) http.Handler {
 	opts := cors.Options{
 		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Requested-With"},
+		AllowedHeaders:   []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Requested-With", "X-CSRF-Token"},
 		ExposedHeaders:   []string{"Link"},
 		AllowCredentials: false,
 		MaxAge:           300,
 	}
-	if origins == "" {
+	if len(origins) == 0 {
 		opts.AllowedOrigins = []string{"*"}
 	} else {
-		parts := strings.Split(origins, ",")
-		out := make([]string, 0, len(parts))
-		for _, p := range parts {
-			p = strings.TrimSpace(p)
-			if p != "" { out = append(out, p) }
-		}
-		if len(out) == 0 { out = []string{"*"} }
+		out := origins
 		opts.AllowedOrigins = out
 		allowCreds := true
 		for _, o := range out { if o == "*" { allowCreds = false; break } }
@@ -249,14 +205,3 @@ func configureCORS() func(http.Handler) http.Handler {
 	}
 	return cors.Handler(opts)
 }
-
-func jsonLoggerMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
-		next.ServeHTTP(ww, r)
-		entry := fmt.Sprintf(`{"time":"%s","ip":"%s","method":"%s","path":"%s","status":%d,"bytes":%d,"latency":"%s","ua":"%s"}`,
-			time.Now().Format(time.RFC3339), r.RemoteAddr, r.Method, r.URL.Path, ww.Status(), ww.BytesWritten(), time.Since(start).String(), r.UserAgent())
-		log.Println(entry)
-	})
-}
@@ -0,0 +1,206 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+	"gothicforge3/internal/config"
+	"gothicforge3/internal/kv"
+)
+
+// TLS returns the TLS configuration for cfg and the handler for the plain-HTTP redirect
+// listener (HTTP_REDIRECT_ADDR), or nil, nil when TLS is off.
+//
+// With TLS_CERT_FILE/TLS_KEY_FILE the pair is reloaded when either file changes (certbot
+// renewals need no restart). With ACME_DOMAINS certificates are obtained and renewed by
+// autocert from ACME_DIRECTORY_URL (Let's Encrypt by default; point it at Pebble to test),
+// cached in ACME_CACHE_DIR or, with ACME_CACHE=valkey, in the shared kv store. The redirect
+// handler then also answers http-01 challenges; tls-alpn-01 works on the HTTPS port alone.
+func TLS(cfg *config.Config) (*tls.Config, http.Handler, error) {
+	redirect := RedirectHTTPS(cfg.Addr())
+	switch cfg.TLSMode() {
+	case "files":
+		kp, err := newKeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: kp.GetCertificate}, redirect, nil
+	case "acme":
+		m, err := acmeManager(cfg)
+		if err != nil {
+			return nil, nil, err
+		}
+		tc := m.TLSConfig()
+		tc.MinVersion = tls.VersionTLS12
+		return tc, m.HTTPHandler(redirect), nil
+	}
+	return nil, nil, nil
+}
+
+func acmeManager(cfg *config.Config) (*autocert.Manager, error) {
+	m := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(cfg.ACMEDomains...),
+		Email:      cfg.ACMEEmail,
+	}
+	if strings.EqualFold(cfg.ACMECache, "valkey") {
+		m.Cache = KVCertCache{}
+	} else {
+		m.Cache = autocert.DirCache(cfg.ACMECacheDir)
+	}
+	if cfg.ACMEDirectoryURL != "" || cfg.ACMECAFile != "" {
+		client := &acme.Client{DirectoryURL: cfg.ACMEDirectoryURL}
+		if cfg.ACMECAFile != "" {
+			pem, err := os.ReadFile(cfg.ACMECAFile)
+			if err != nil {
+				return nil, fmt.Errorf("ACME_CA_FILE: %w", err)
+			}
+			roots := x509.NewCertPool()
+			if !roots.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("ACME_CA_FILE: no PEM certificates in %s", cfg.ACMECAFile)
+			}
+			tr := http.DefaultTransport.(*http.Transport).Clone()
+			tr.TLSClientConfig = &tls.Config{RootCAs: roots}
+			client.HTTPClient = &http.Client{Transport: tr, Timeout: 30 * time.Second}
+		}
+		m.Client = client
+	}
+	return m, nil
+}
+
+// KVCertCache stores ACME account keys and certificates in the kv store (Valkey), so every
+// instance behind a load balancer shares them and restarts do not re-issue.
+type KVCertCache struct{}
+
+const certCachePrefix = "acme:"
+
+func (KVCertCache) Get(ctx context.Context, name string) ([]byte, error) {
+	b, ok, err := kv.Get(ctx, certCachePrefix+name)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, autocert.ErrCacheMiss
+	}
+	return b, nil
+}
+
+func (KVCertCache) Put(ctx context.Context, name string, data []byte) error {
+	return kv.Set(ctx, certCachePrefix+name, data, 0)
+}
+
+func (KVCertCache) Delete(ctx context.Context, name string) error {
+	return kv.Delete(ctx, certCachePrefix+name)
+}
+
+// keyPair serves a certificate/key file pair, reloading it when a file's mtime changes
+// (checked at most every few seconds).
+type keyPair struct {
+	certFile, keyFile string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	mod     time.Time
+	checked time.Time
+}
+
+const keyPairCheckEvery = 5 * time.Second
+
+func newKeyPair(certFile, keyFile string) (*keyPair, error) {
+	kp := &keyPair{certFile: certFile, keyFile: keyFile}
+	if err := kp.load(); err != nil {
+		return nil, err
+	}
+	return kp, nil
+}
+
+func (kp *keyPair) load() error {
+	cert, err := tls.LoadX509KeyPair(kp.certFile, kp.keyFile)
+	if err != nil {
+		return fmt.Errorf("tls: %w", err)
+	}
+	kp.cert, kp.mod, kp.checked = &cert, kp.modTime(), time.Now()
+	return nil
+}
+
+func (kp *keyPair) modTime() time.Time {
+	var latest time.Time
+	for _, f := range []string{kp.certFile, kp.keyFile} {
+		if st, err := os.Stat(f); err == nil && st.ModTime().After(latest) {
+			latest = st.ModTime()
+		}
+	}
+	return latest
+}
+
+// GetCertificate implements tls.Config.GetCertificate. A failed reload keeps the previous pair.
+func (kp *keyPair) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	kp.mu.Lock()
+	defer kp.mu.Unlock()
+	if time.Since(kp.checked) >= keyPairCheckEvery {
+		kp.checked = time.Now()
+		if !kp.modTime().Equal(kp.mod) {
+			if err := kp.load(); err != nil {
+				return kp.cert, nil
+			}
+		}
+	}
+	return kp.cert, nil
+}
+
+// RedirectHTTPS redirects every request to the same host and URI over HTTPS. httpsAddr is the
+// HTTPS listen address; its port is kept in the target unless it is 443.
+func RedirectHTTPS(httpsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if host == "" {
+			http.Error(w, "missing Host header", http.StatusBadRequest)
+			return
+		}
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		if port != "" && port != "443" {
+			host += ":" + port
+		}
+		code := http.StatusPermanentRedirect
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			code = http.StatusMovedPermanently
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), code)
+	})
+}
+
+// HSTS sets Strict-Transport-Security on responses served over TLS.
+func HSTS(maxAge time.Duration, includeSubdomains, preload bool) func(http.Handler) http.Handler {
+	v := "max-age=" + strconv.Itoa(int(maxAge.Seconds()))
+	if includeSubdomains {
+		v += "; includeSubDomains"
+	}
+	if preload {
+		v += "; preload"
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.TLS != nil {
+				w.Header().Set("Strict-Transport-Security", v)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	redigo "github.com/gomodule/redigo/redis"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// WrapRedis returns c with a client span for every command issued through DoContext (as
+// redigo.DoContext and Script.DoContext do). Commands without a context (Do, Send) are passed
+// through untraced, since they have no request span to attach to.
+func WrapRedis(c redigo.Conn) redigo.Conn { return &redisConn{Conn: c} }
+
+type redisConn struct{ redigo.Conn }
+
+var (
+	_ redigo.ConnWithContext = (*redisConn)(nil)
+	_ redigo.ConnWithTimeout = (*redisConn)(nil)
+)
+
+func (c *redisConn) DoContext(ctx context.Context, cmd string, args ...interface{}) (interface{}, error) {
+	if cmd == "" {
+		// Flush of pipelined commands (Pool bookkeeping); nothing to name.
+		return redigo.DoContext(c.Conn, ctx, cmd, args...)
+	}
+	ctx, span := Tracer().Start(ctx, "valkey "+strings.ToUpper(cmd),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemNameRedis,
+			semconv.DBOperationName(strings.ToUpper(cmd)),
+		),
+	)
+	defer span.End()
+	reply, err := redigo.DoContext(c.Conn, ctx, cmd, args...)
+	if err != nil && !errors.Is(err, redigo.ErrNil) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return reply, err
+}
+
+func (c *redisConn) ReceiveContext(ctx context.Context) (interface{}, error) {
+	return redigo.ReceiveContext(c.Conn, ctx)
+}
+
+func (c *redisConn) DoWithTimeout(timeout time.Duration, cmd string, args ...interface{}) (interface{}, error) {
+	return redigo.DoWithTimeout(c.Conn, timeout, cmd, args...)
+}
+
+func (c *redisConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	return redigo.ReceiveWithTimeout(c.Conn, timeout)
+}
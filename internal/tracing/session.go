@@ -0,0 +1,59 @@
+package tracing
+
+import (
+	"context"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SessionStore wraps an scs store so session loads and commits appear as "session.find",
+// "session.commit" and "session.delete" spans. Stores that do not take a context are called
+// through their plain methods.
+func SessionStore(s scs.Store) scs.Store { return &sessionStore{Store: s} }
+
+type sessionStore struct{ scs.Store }
+
+var _ scs.CtxStore = (*sessionStore)(nil)
+
+func (s *sessionStore) FindCtx(ctx context.Context, token string) ([]byte, bool, error) {
+	ctx, span := Tracer().Start(ctx, "session.find", trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+	var b []byte
+	var found bool
+	var err error
+	if cs, ok := s.Store.(scs.CtxStore); ok {
+		b, found, err = cs.FindCtx(ctx, token)
+	} else {
+		b, found, err = s.Store.Find(token)
+	}
+	return b, found, endErr(span, err)
+}
+
+func (s *sessionStore) CommitCtx(ctx context.Context, token string, b []byte, expiry time.Time) error {
+	ctx, span := Tracer().Start(ctx, "session.commit", trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+	if cs, ok := s.Store.(scs.CtxStore); ok {
+		return endErr(span, cs.CommitCtx(ctx, token, b, expiry))
+	}
+	return endErr(span, s.Store.Commit(token, b, expiry))
+}
+
+func (s *sessionStore) DeleteCtx(ctx context.Context, token string) error {
+	ctx, span := Tracer().Start(ctx, "session.delete", trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+	if cs, ok := s.Store.(scs.CtxStore); ok {
+		return endErr(span, cs.DeleteCtx(ctx, token))
+	}
+	return endErr(span, s.Store.Delete(token))
+}
+
+func endErr(span trace.Span, err error) error {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
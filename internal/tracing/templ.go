@@ -0,0 +1,18 @@
+package tracing
+
+import (
+	"context"
+	"io"
+
+	"github.com/a-h/templ"
+)
+
+// Component wraps c so each render is recorded as a "render <name>" span. Child components
+// rendered inside it nest under the span.
+func Component(name string, c templ.Component) templ.Component {
+	return templ.ComponentFunc(func(ctx context.Context, w io.Writer) error {
+		ctx, span := Tracer().Start(ctx, "render "+name)
+		defer span.End()
+		return endErr(span, c.Render(ctx, w))
+	})
+}
@@ -0,0 +1,113 @@
+// Package tracing wires optional OpenTelemetry tracing: inbound HTTP requests, pgx queries,
+// Valkey commands, session store round trips and templ component rendering each get a span.
+//
+// Exporters are selected by environment (see config):
+//
+//	OTEL_TRACES_EXPORTER=otlp     OTLP/HTTP to OTEL_EXPORTER_OTLP_ENDPOINT (the default when an endpoint is set)
+//	OTEL_TRACES_EXPORTER=stdout   pretty-printed spans on stdout (gforge dev --trace)
+//	OTEL_TRACES_EXPORTER=none     disabled (the default)
+//
+// When disabled the global no-op provider stays in place and instrumentation costs almost nothing.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+	"gothicforge3/internal/config"
+)
+
+// Name is the instrumentation scope used for every span created by this module.
+const Name = "gothicforge3"
+
+// Tracer returns the module tracer from the global provider.
+func Tracer() trace.Tracer { return otel.Tracer(Name) }
+
+// Exporter reports the exporter selected by cfg: "otlp", "stdout" or "none".
+func Exporter(cfg *config.Config) string {
+	e := strings.ToLower(cfg.OTelTracesExporter)
+	if e == "" {
+		if cfg.OTelEndpoint != "" {
+			return "otlp"
+		}
+		return "none"
+	}
+	return e
+}
+
+// Setup installs the global tracer provider and W3C trace-context propagation. The returned
+// function flushes and stops the exporter; register it as a shutdown hook. With the "none"
+// exporter it does nothing and returns a no-op shutdown.
+func Setup(ctx context.Context, cfg *config.Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	var exp sdktrace.SpanExporter
+	var err error
+	switch Exporter(cfg) {
+	case "none":
+		return func(context.Context) error { return nil }, nil
+	case "stdout":
+		exp, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout), stdouttrace.WithPrettyPrint())
+	case "otlp":
+		exp, err = otlpExporter(ctx, cfg)
+	default:
+		return nil, fmt.Errorf("tracing: unknown exporter %q", cfg.OTelTracesExporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("tracing: %w", err)
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(cfg.OTelServiceName),
+		semconv.DeploymentEnvironmentName(cfg.AppEnv),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("tracing: %w", err)
+	}
+	var spanProc sdktrace.SpanProcessor = sdktrace.NewBatchSpanProcessor(exp)
+	if Exporter(cfg) == "stdout" {
+		spanProc = sdktrace.NewSimpleSpanProcessor(exp)
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithResource(res),
+		sdktrace.WithSpanProcessor(spanProc),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.OTelSampleRatio))),
+	)
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+// otlpExporter builds an OTLP/HTTP exporter. OTEL_EXPORTER_OTLP_ENDPOINT is a base URL
+// (e.g. http://localhost:4318); /v1/traces is appended unless a path is given.
+func otlpExporter(ctx context.Context, cfg *config.Config) (sdktrace.SpanExporter, error) {
+	if cfg.OTelEndpoint == "" {
+		return nil, fmt.Errorf("OTEL_EXPORTER_OTLP_ENDPOINT is required for the otlp exporter")
+	}
+	u, err := url.Parse(cfg.OTelEndpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid OTEL_EXPORTER_OTLP_ENDPOINT %q", cfg.OTelEndpoint)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/v1/traces"
+	}
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpointURL(u.String())}
+	if len(cfg.OTelHeaders) > 0 {
+		h := map[string]string{}
+		for _, kv := range cfg.OTelHeaders {
+			if k, v, ok := strings.Cut(kv, "="); ok {
+				h[strings.TrimSpace(k)] = strings.TrimSpace(v)
+			}
+		}
+		opts = append(opts, otlptracehttp.WithHeaders(h))
+	}
+	return otlptracehttp.New(ctx, opts...)
+}
@@ -0,0 +1,238 @@
+// Package vendored pins the third-party front-end libraries used by the layouts (htmx, Alpine
+// CSP build, DaisyUI) and decides how pages load them.
+//
+// `gforge vendor` downloads each pinned version into app/static/vendor and records it, with a
+// sha384 Subresource Integrity hash, in app/static/vendor/vendor.lock.json. At runtime
+// VENDOR_MODE picks how the layout links them:
+//
+//	local  (default) /static/vendor/... copies served by this server; production CSP is 'self' only
+//	cdn              the pinned CDN URLs with integrity= and crossorigin="anonymous"
+//
+// Without a lock file (vendoring not run yet) development falls back to the pinned CDN URLs
+// without integrity and the CSP allows their origins; production links nothing unverified
+// (`gforge build` vendors when the lock is missing).
+package vendored
+
+import (
+	"context"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Dir is the vendor directory inside app/static; LockFile is the lock's path relative to it.
+const (
+	Dir      = "vendor"
+	LockFile = "vendor.lock.json"
+)
+
+// Lib is a pinned third-party file.
+type Lib struct {
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+	Kind      string `json:"kind"` // "script" or "style"
+	Defer     bool   `json:"defer,omitempty"`
+	URL       string `json:"url"`
+	File      string `json:"file"` // path below app/static/vendor
+	Integrity string `json:"integrity,omitempty"`
+}
+
+// Lock is the content of vendor.lock.json.
+type Lock struct {
+	Libs []Lib `json:"libs"`
+}
+
+// Defaults are the pinned versions `gforge vendor` downloads. Bump a version here and re-run it.
+var Defaults = []Lib{
+	{Name: "daisyui", Version: "4.12.24", Kind: "style",
+		URL: "https://cdn.jsdelivr.net/npm/daisyui@4.12.24/dist/full.min.css", File: "daisyui@4.12.24/full.min.css"},
+	{Name: "@alpinejs/csp", Version: "3.14.9", Kind: "script", Defer: true,
+		URL: "https://cdn.jsdelivr.net/npm/@alpinejs/csp@3.14.9/dist/cdn.min.js", File: "alpinejs-csp@3.14.9/cdn.min.js"},
+	{Name: "htmx.org", Version: "2.0.4", Kind: "script",
+		URL: "https://cdn.jsdelivr.net/npm/htmx.org@2.0.4/dist/htmx.min.js", File: "htmx.org@2.0.4/htmx.min.js"},
+}
+
+// Integrity returns the sha384 Subresource Integrity value for b.
+func Integrity(b []byte) string {
+	sum := sha512.Sum384(b)
+	return "sha384-" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// Download fetches every lib into dir/<File>, failing on non-2xx responses, and returns the
+// lock recording their hashes.
+func Download(ctx context.Context, client *http.Client, libs []Lib, dir string) (Lock, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	lock := Lock{Libs: make([]Lib, 0, len(libs))}
+	for _, l := range libs {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, l.URL, nil)
+		if err != nil {
+			return lock, err
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			return lock, fmt.Errorf("%s: %w", l.Name, err)
+		}
+		b, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return lock, fmt.Errorf("%s: %w", l.Name, err)
+		}
+		if res.StatusCode/100 != 2 {
+			return lock, fmt.Errorf("%s: GET %s: %s", l.Name, l.URL, res.Status)
+		}
+		dest := filepath.Join(dir, filepath.FromSlash(l.File))
+		if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+			return lock, err
+		}
+		if err := os.WriteFile(dest, b, 0o644); err != nil {
+			return lock, err
+		}
+		l.Integrity = Integrity(b)
+		lock.Libs = append(lock.Libs, l)
+	}
+	return lock, nil
+}
+
+// WriteLock writes lock to dir/vendor.lock.json.
+func WriteLock(dir string, lock Lock) error {
+	b, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, LockFile), append(b, '\n'), 0o644)
+}
+
+// Verify checks every locked file in fsys (rooted at the vendor directory) against its hash.
+func Verify(fsys fs.FS, lock Lock) error {
+	var errs []error
+	for _, l := range lock.Libs {
+		b, err := fs.ReadFile(fsys, l.File)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", l.Name, err))
+			continue
+		}
+		if got := Integrity(b); got != l.Integrity {
+			errs = append(errs, fmt.Errorf("%s: %s has %s, lock says %s", l.Name, l.File, got, l.Integrity))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ReadLock reads vendor.lock.json from fsys (rooted at the vendor directory).
+func ReadLock(fsys fs.FS) (Lock, error) {
+	var lock Lock
+	b, err := fs.ReadFile(fsys, LockFile)
+	if err != nil {
+		return lock, err
+	}
+	return lock, json.Unmarshal(b, &lock)
+}
+
+var (
+	mu     sync.RWMutex
+	libs   = Defaults
+	local  bool
+	locked bool
+)
+
+// Init selects what pages link. static is app/static; mode is VENDOR_MODE ("local" or "cdn").
+// Local mode needs a lock whose files are present; otherwise the pinned CDN URLs are used. In
+// production CDN URLs are only linked with the lock's integrity hashes: without a usable lock
+// pages load no libraries at all. The returned error explains a fallback and is meant to be
+// logged.
+func Init(static fs.FS, mode string, production bool) error {
+	ls, isLocal, isLocked := Defaults, false, false
+	vfs, subErr := fs.Sub(static, Dir)
+	lock, lerr := Lock{}, subErr
+	if subErr == nil {
+		lock, lerr = ReadLock(vfs)
+	}
+	var reason error
+	switch {
+	case lerr != nil && errors.Is(lerr, fs.ErrNotExist):
+		if mode != "cdn" || production {
+			reason = errors.New("no app/static/vendor/vendor.lock.json (run `gforge vendor`)")
+		}
+	case lerr != nil:
+		reason = lerr
+	default:
+		ls, isLocked = lock.Libs, true
+		if mode != "cdn" {
+			if verr := Verify(vfs, lock); verr != nil {
+				reason = fmt.Errorf("local copies do not match the lock (%w)", verr)
+			} else {
+				isLocal = true
+			}
+		}
+	}
+	var err error
+	switch {
+	case reason == nil:
+	case production && !isLocked:
+		ls = nil
+		err = fmt.Errorf("vendor: %w; production pages load no front-end libraries without integrity hashes", reason)
+	default:
+		err = fmt.Errorf("vendor: %w; loading pinned CDN URLs", reason)
+	}
+	mu.Lock()
+	libs, local, locked = ls, isLocal, isLocked
+	mu.Unlock()
+	return err
+}
+
+// Libs returns the libraries pages should load, in order.
+func Libs() []Lib {
+	mu.RLock()
+	defer mu.RUnlock()
+	return append([]Lib(nil), libs...)
+}
+
+// Local reports whether pages load the vendored copies from /static/vendor.
+func Local() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return local
+}
+
+// Locked reports whether a lock file was found (so CDN links carry integrity=).
+func Locked() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return locked
+}
+
+// AssetName returns l's name for assets.URL ("vendor/htmx.org@2.0.4/htmx.min.js").
+func (l Lib) AssetName() string { return path.Join(Dir, l.File) }
+
+// Origins returns the CDN origins pages load from: none in local mode.
+func Origins() []string {
+	if Local() {
+		return nil
+	}
+	seen := map[string]bool{}
+	var out []string
+	for _, l := range Libs() {
+		if u, err := url.Parse(l.URL); err == nil && u.Host != "" {
+			o := u.Scheme + "://" + u.Host
+			if !seen[o] {
+				seen[o] = true
+				out = append(out, o)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
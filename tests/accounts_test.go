@@ -0,0 +1,211 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"gothicforge3/internal/accounts"
+	"gothicforge3/internal/auth"
+	"gothicforge3/internal/csrf"
+)
+
+// captureMailer records account emails so tests can follow the links in them.
+type captureMailer struct {
+	mu   sync.Mutex
+	sent []accounts.Message
+}
+
+func (m *captureMailer) Send(_ context.Context, msg accounts.Message) error {
+	m.mu.Lock(); defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+var tokenLink = regexp.MustCompile(`(/verify-email|/password/reset)\?token=([A-Za-z0-9_-]+)`)
+
+// lastLink returns the path and token of the newest emailed link.
+func (m *captureMailer) lastLink(t *testing.T) (string, string) {
+	t.Helper()
+	m.mu.Lock(); defer m.mu.Unlock()
+	if len(m.sent) == 0 { t.Fatalf("no email sent") }
+	l := tokenLink.FindStringSubmatch(m.sent[len(m.sent)-1].Body)
+	if l == nil { t.Fatalf("no link in email: %q", m.sent[len(m.sent)-1].Body) }
+	return l[1], l[2]
+}
+
+// browser keeps cookies across requests and refreshes the CSRF token after sign-in/out.
+type browser struct {
+	t       *testing.T
+	h       http.Handler
+	cookies map[string]*http.Cookie
+	token   string
+}
+
+func newBrowser(t *testing.T, h http.Handler) *browser {
+	b := &browser{t: t, h: h, cookies: map[string]*http.Cookie{}}
+	b.refresh()
+	return b
+}
+
+func (b *browser) do(req *http.Request) *httptest.ResponseRecorder {
+	for _, c := range b.cookies { req.AddCookie(c) }
+	rec := httptest.NewRecorder()
+	b.h.ServeHTTP(rec, req)
+	for _, c := range rec.Result().Cookies() {
+		if c.MaxAge < 0 { delete(b.cookies, c.Name) } else { b.cookies[c.Name] = c }
+	}
+	return rec
+}
+
+func (b *browser) refresh() {
+	b.t.Helper()
+	rec := b.do(httptest.NewRequest(http.MethodGet, "/", nil))
+	m := csrfMeta.FindStringSubmatch(rec.Body.String())
+	if m == nil { b.t.Fatalf("csrf-token meta tag not rendered") }
+	b.token = m[1]
+}
+
+func (b *browser) get(target string) *httptest.ResponseRecorder {
+	rec := b.do(httptest.NewRequest(http.MethodGet, target, nil))
+	b.refresh() // /verify-email may sign in again, which rotates the CSRF token
+	return rec
+}
+
+func (b *browser) post(target string, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set(csrf.HeaderName, b.token)
+	rec := b.do(req)
+	b.refresh()
+	return rec
+}
+
+func (b *browser) subject() string {
+	c, ok := b.cookies["gf_jwt"]
+	if !ok { return "" }
+	claims, err := auth.Verify(context.Background(), c.Value)
+	if err != nil { b.t.Fatalf("gf_jwt does not verify: %v", err) }
+	sub, _ := claims["sub"].(string)
+	return sub
+}
+
+func newAccountsRouter(t *testing.T, env map[string]string) (*chi.Mux, *captureMailer) {
+	t.Helper()
+	env["RATE_LIMIT_POLICIES"] = "auth=100/1m" // the flows below post more than the default 10/min
+	r := newLimitedRouter(t, env)
+	accounts.SetParams(accounts.Params{Memory: 64, Time: 1, Threads: 1, KeyLen: 32, SaltLen: 16})
+	m := &captureMailer{}
+	accounts.SetMailer(m)
+	return r, m
+}
+
+func Test_Accounts_Hash_Verify_And_Rehash(t *testing.T) {
+	old := accounts.Params{Memory: 64, Time: 1, Threads: 1, KeyLen: 32, SaltLen: 16}
+	h, err := accounts.HashPassword("correct horse", old)
+	if err != nil { t.Fatalf("hash: %v", err) }
+	if !strings.HasPrefix(h, "$argon2id$v=19$m=64,t=1,p=1$") { t.Fatalf("unexpected encoding: %s", h) }
+	h2, _ := accounts.HashPassword("correct horse", old)
+	if h == h2 { t.Fatalf("salt not random") }
+
+	ok, rehash, err := accounts.VerifyPassword(h, "correct horse", old)
+	if err != nil || !ok || rehash { t.Fatalf("verify same params: ok=%v rehash=%v err=%v", ok, rehash, err) }
+	ok, _, _ = accounts.VerifyPassword(h, "wrong horse", old)
+	if ok { t.Fatalf("wrong password accepted") }
+	stronger := old
+	stronger.Time = 2
+	ok, rehash, _ = accounts.VerifyPassword(h, "correct horse", stronger)
+	if !ok || !rehash { t.Fatalf("outdated params not flagged: ok=%v rehash=%v", ok, rehash) }
+	if _, _, err := accounts.VerifyPassword("$2a$10$bcrypt", "x", old); err == nil { t.Fatalf("foreign hash accepted") }
+}
+
+func Test_Accounts_Signup_Verify_Login_Reset_Flow(t *testing.T) {
+	r, mail := newAccountsRouter(t, map[string]string{})
+	b := newBrowser(t, r)
+
+	rec := b.post("/signup", url.Values{"email": {"Ada@Example.com"}, "password": {"short"}})
+	if rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), "at least 8") { t.Fatalf("weak password: %d", rec.Code) }
+
+	rec = b.post("/signup", url.Values{"email": {"Ada@Example.com"}, "password": {"first-password"}})
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/account" { t.Fatalf("signup: %d %s", rec.Code, rec.Body.String()) }
+	id := b.subject()
+	if id == "" { t.Fatalf("signup did not set gf_jwt") }
+	if rec := b.get("/account"); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "ada@example.com") || !strings.Contains(rec.Body.String(), "not verified") {
+		t.Fatalf("account page: %d", rec.Code)
+	}
+	if rec := b.post("/signup", url.Values{"email": {"ada@example.com"}, "password": {"other-password"}}); rec.Code != http.StatusUnprocessableEntity { t.Fatalf("duplicate signup: %d", rec.Code) }
+
+	path, tok := mail.lastLink(t)
+	if path != "/verify-email" { t.Fatalf("expected verification link, got %s", path) }
+	if rec := b.get(path + "?token=" + tok); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Email verified") { t.Fatalf("verify: %d", rec.Code) }
+	if rec := b.get(path + "?token=" + tok); rec.Code != http.StatusUnprocessableEntity { t.Fatalf("verification token reused: %d", rec.Code) }
+	if rec := b.get("/account"); !strings.Contains(rec.Body.String(), "Email verified") { t.Fatalf("account not verified") }
+
+	if rec := b.post("/logout", nil); rec.Code != http.StatusSeeOther || b.subject() != "" { t.Fatalf("logout: %d", rec.Code) }
+	if rec := b.get("/account"); rec.Code != http.StatusSeeOther { t.Fatalf("account without login: %d", rec.Code) }
+
+	if rec := b.post("/login", url.Values{"email": {"ada@example.com"}, "password": {"wrong-password"}}); rec.Code != http.StatusUnprocessableEntity || b.subject() != "" { t.Fatalf("wrong password: %d", rec.Code) }
+	rec = b.post("/login", url.Values{"email": {"ADA@example.com"}, "password": {"first-password"}, "next": {"/account"}})
+	if rec.Code != http.StatusSeeOther || b.subject() != id { t.Fatalf("login: %d sub=%q", rec.Code, b.subject()) }
+	b.post("/logout", nil)
+
+	n := len(mail.sent)
+	if rec := b.post("/password/forgot", url.Values{"email": {"nobody@example.com"}}); rec.Code != http.StatusOK || len(mail.sent) != n { t.Fatalf("unknown address: %d", rec.Code) }
+	if rec := b.post("/password/forgot", url.Values{"email": {"ada@example.com"}}); rec.Code != http.StatusOK { t.Fatalf("forgot: %d", rec.Code) }
+	path, tok = mail.lastLink(t)
+	if path != "/password/reset" { t.Fatalf("expected reset link, got %s", path) }
+	rec = b.post("/password/reset", url.Values{"token": {tok}, "password": {"second-password"}})
+	if rec.Code != http.StatusSeeOther || b.subject() != id { t.Fatalf("reset: %d", rec.Code) }
+	if rec := b.post("/password/reset", url.Values{"token": {tok}, "password": {"third-password"}}); rec.Code != http.StatusUnprocessableEntity { t.Fatalf("reset token reused: %d", rec.Code) }
+	b.post("/logout", nil)
+
+	if rec := b.post("/login", url.Values{"email": {"ada@example.com"}, "password": {"first-password"}}); rec.Code != http.StatusUnprocessableEntity { t.Fatalf("old password still works: %d", rec.Code) }
+	if rec := b.post("/login", url.Values{"email": {"ada@example.com"}, "password": {"second-password"}}); rec.Code != http.StatusSeeOther { t.Fatalf("new password: %d", rec.Code) }
+}
+
+func Test_Accounts_Login_Upgrades_Hash_Params(t *testing.T) {
+	newAccountsRouter(t, map[string]string{})
+	ctx := context.Background()
+	st := accounts.NewMemoryStore()
+	accounts.SetStore(st)
+	weak := accounts.Params{Memory: 32, Time: 1, Threads: 1, KeyLen: 32, SaltLen: 16}
+	h, _ := accounts.HashPassword("long-enough", weak)
+	u, err := st.CreateUser(ctx, "grace@example.com", h)
+	if err != nil { t.Fatalf("create: %v", err) }
+
+	if _, err := accounts.Authenticate(ctx, "grace@example.com", "long-enough"); err != nil { t.Fatalf("login: %v", err) }
+	got, _ := st.UserByID(ctx, u.ID)
+	if got.PasswordHash == h || !strings.Contains(got.PasswordHash, "m=64,t=1,p=1") { t.Fatalf("hash not upgraded: %s", got.PasswordHash) }
+	if _, err := accounts.Authenticate(ctx, "grace@example.com", "long-enough"); err != nil { t.Fatalf("login after upgrade: %v", err) }
+}
+
+func Test_Accounts_Require_Verified_And_Local_Next(t *testing.T) {
+	r, mail := newAccountsRouter(t, map[string]string{"ACCOUNTS_REQUIRE_VERIFIED": "true"})
+	b := newBrowser(t, r)
+	rec := b.post("/signup", url.Values{"email": {"lin@example.com"}, "password": {"pass-phrase"}})
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Check your email") || b.subject() != "" { t.Fatalf("signup signed in an unverified account: %d sub=%q", rec.Code, b.subject()) }
+	if rec := b.get("/account"); rec.Code != http.StatusSeeOther { t.Fatalf("account before verification: %d", rec.Code) }
+
+	if rec := b.post("/login", url.Values{"email": {"lin@example.com"}, "password": {"pass-phrase"}}); rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), "confirm your email") {
+		t.Fatalf("unverified login: %d", rec.Code)
+	}
+	path, tok := mail.lastLink(t)
+	if rec := b.get(path + "?token=" + tok); rec.Code != http.StatusOK || b.subject() != "" { t.Fatalf("verify: %d sub=%q", rec.Code, b.subject()) }
+	if rec := b.post("/login", url.Values{"email": {"lin@example.com"}, "password": {"pass-phrase"}}); rec.Code != http.StatusSeeOther || b.subject() == "" { t.Fatalf("verified login: %d", rec.Code) }
+
+	r, _ = newAccountsRouter(t, map[string]string{})
+	b = newBrowser(t, r)
+	b.post("/signup", url.Values{"email": {"lin@example.com"}, "password": {"pass-phrase"}})
+	b.post("/logout", nil)
+	for _, next := range []string{"https://evil.example/", "//evil.example", "/\\evil.example"} {
+		rec := b.post("/login", url.Values{"email": {"lin@example.com"}, "password": {"pass-phrase"}, "next": {next}})
+		if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/account" { t.Fatalf("next %q: %d %s", next, rec.Code, rec.Header().Get("Location")) }
+		b.post("/logout", nil)
+	}
+}
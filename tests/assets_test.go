@@ -0,0 +1,154 @@
+package tests
+
+import (
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"gothicforge3/app"
+	"gothicforge3/app/routes"
+	"gothicforge3/app/templates"
+	"gothicforge3/internal/assets"
+	"gothicforge3/internal/server"
+)
+
+// The default build embeds assets, so the server works from a directory without the source tree.
+func Test_Assets_Embedded_Without_Source_Tree(t *testing.T) {
+	if app.Source() != "embed" { t.Skip("devfs build reads assets from disk") }
+	cfg := mustConfig(t)
+	t.Chdir(t.TempDir())
+	r := server.New(cfg)
+	routes.Register(r, cfg)
+	for path, want := range map[string]string{
+		"/static/app.js":               "csrf-token",
+		"/static/favicon.svg":          "<svg",
+		"/static/styles/overrides.css": "",
+		"/robots.txt":                  "User-agent",
+	} {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK { t.Fatalf("%s: want 200, got %d", path, rec.Code) }
+		if !strings.Contains(rec.Body.String(), want) { t.Fatalf("%s: body missing %q", path, want) }
+	}
+
+	migs, err := fs.Glob(app.Migrations(), "*.sql")
+	if err != nil || len(migs) == 0 { t.Fatalf("embedded migrations: %v %v", migs, err) }
+}
+
+func Test_Assets_Fingerprinted_URLs_And_Cache_Control(t *testing.T) {
+	if app.Source() != "embed" { t.Skip("devfs build serves plain URLs") }
+	cfg := mustConfig(t)
+	r := server.New(cfg)
+	js, _ := fs.ReadFile(app.Static(), "app.js")
+	want := "/static/" + assets.Fingerprint("app.js", js)
+	if got := templates.Asset("app.js"); got != want { t.Fatalf("Asset(app.js): want %s, got %s", want, got) }
+	css := templates.Asset("styles/overrides.css")
+	if !strings.HasPrefix(css, "/static/styles/overrides.") || css == "/static/styles/overrides.css" { t.Fatalf("styles not fingerprinted: %s", css) }
+	if got := templates.Asset("missing.png"); got != "/static/missing.png" { t.Fatalf("unknown asset: %s", got) }
+
+	for path, cc := range map[string]string{
+		want:                           assets.CacheImmutable,
+		css:                            assets.CacheImmutable,
+		"/static/app.js":               assets.CacheShort,
+		"/static/styles/overrides.css": assets.CacheShort,
+	} {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK { t.Fatalf("%s: want 200, got %d", path, rec.Code) }
+		if got := rec.Header().Get("Cache-Control"); got != cc { t.Fatalf("%s: Cache-Control %q, want %q", path, got, cc) }
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/static/app.0000000000.js", nil))
+	if rec.Code != http.StatusNotFound { t.Fatalf("stale hash should 404, got %d", rec.Code) }
+}
+
+func Test_Assets_Precompressed_Negotiation(t *testing.T) {
+	dir := t.TempDir()
+	staticDir, stylesDir := filepath.Join(dir, "static"), filepath.Join(dir, "styles")
+	_ = os.MkdirAll(staticDir, 0o755)
+	_ = os.MkdirAll(stylesDir, 0o755)
+	js := strings.Repeat("console.log('gothic forge');\n", 200)
+	css := strings.Repeat(".btn{color:red}\n", 200)
+	_ = os.WriteFile(filepath.Join(staticDir, "app.js"), []byte(js), 0o644)
+	_ = os.WriteFile(filepath.Join(staticDir, "tiny.js"), []byte("x()"), 0o644)
+	_ = os.WriteFile(filepath.Join(stylesDir, "site.css"), []byte(css), 0o644)
+	_ = os.WriteFile(filepath.Join(staticDir, "gone.js.br"), []byte("stale"), 0o644)
+	n1, err := assets.Compress(staticDir)
+	if err != nil { t.Fatal(err) }
+	n2, err := assets.Compress(stylesDir)
+	if err != nil { t.Fatal(err) }
+	if n1+n2 != 4 { t.Fatalf("want .br and .gz for app.js and site.css, wrote %d", n1+n2) }
+	if _, err := os.Stat(filepath.Join(staticDir, "tiny.js.gz")); err == nil { t.Fatalf("tiny files should not be precompressed") }
+	if _, err := os.Stat(filepath.Join(staticDir, "gone.js.br")); err == nil { t.Fatalf("orphaned sibling should be removed") }
+
+	m, _ := assets.Generate(os.DirFS(staticDir), os.DirFS(stylesDir))
+	if _, ok := m["app.js.br"]; ok { t.Fatalf("siblings must not be fingerprinted: %v", m) }
+	assets.Use(m, false)
+	t.Cleanup(func() { assets.Use(assets.Manifest{}, false) })
+	h := http.StripPrefix("/static", assets.Handler(os.DirFS(staticDir), os.DirFS(stylesDir)))
+
+	get := func(path, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if accept != "" { req.Header.Set("Accept-Encoding", accept) }
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	cases := []struct{ path, accept, enc, ctype, body string }{
+		{"/static/app.js", "gzip, deflate, br", "br", "text/javascript; charset=utf-8", js},
+		{"/static/app.js", "br;q=0, gzip", "gzip", "text/javascript; charset=utf-8", js},
+		{"/static/app.js", "", "", "text/javascript; charset=utf-8", js},
+		{assets.URL("styles/site.css"), "br", "br", "text/css; charset=utf-8", css},
+	}
+	for _, c := range cases {
+		rec := get(c.path, c.accept)
+		if rec.Code != http.StatusOK { t.Fatalf("%s (%s): %d", c.path, c.accept, rec.Code) }
+		if got := rec.Header().Get("Content-Encoding"); got != c.enc { t.Fatalf("%s (%s): Content-Encoding %q, want %q", c.path, c.accept, got, c.enc) }
+		if got := rec.Header().Get("Content-Type"); got != c.ctype { t.Fatalf("%s: Content-Type %q", c.path, got) }
+		if got := rec.Header().Get("Vary"); got != "Accept-Encoding" { t.Fatalf("%s: Vary %q", c.path, got) }
+		var body []byte
+		switch c.enc {
+		case "br":
+			body, _ = io.ReadAll(brotli.NewReader(rec.Body))
+		case "gzip":
+			zr, err := gzip.NewReader(rec.Body)
+			if err != nil { t.Fatal(err) }
+			body, _ = io.ReadAll(zr)
+		default:
+			body = rec.Body.Bytes()
+		}
+		if string(body) != c.body { t.Fatalf("%s (%s): body mismatch", c.path, c.accept) }
+	}
+	if rec := get("/static/tiny.js", "br"); rec.Header().Get("Content-Encoding") != "" {
+		t.Fatalf("br is only served from siblings: %v", rec.Header())
+	}
+	// Files without siblings (plain go build, assets added later) are compressed on the fly.
+	rec := get("/static/tiny.js", "gzip")
+	if rec.Header().Get("Content-Encoding") != "gzip" { t.Fatalf("file without sibling not compressed: %v", rec.Header()) }
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil { t.Fatal(err) }
+	if body, _ := io.ReadAll(zr); string(body) != "x()" { t.Fatalf("tiny.js body %q", body) }
+}
+
+func Test_Assets_Static_Compressed_With_Or_Without_Siblings(t *testing.T) {
+	r := server.New(mustConfig(t))
+	req := httptest.NewRequest(http.MethodGet, "/static/app.js", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK { t.Fatalf("want 200, got %d", rec.Code) }
+	// A build-time sibling when there is one, on the fly otherwise; never both.
+	if got := rec.Header().Get("Content-Encoding"); got != "gzip" { t.Fatalf("static asset not compressed: %q", got) }
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil { t.Fatalf("gzip: %v", err) }
+	body, _ := io.ReadAll(zr)
+	want, _ := fs.ReadFile(app.Static(), "app.js")
+	if string(body) != string(want) { t.Fatalf("body is not app.js (double-compressed?)") }
+}
@@ -15,8 +15,9 @@ import (
 
 func Test_API_Me_Unauthorized(t *testing.T) {
 	_ = os.Setenv("LOG_FORMAT", "off")
-	r := server.New()
-	routes.Register(r)
+	cfg := mustConfig(t)
+	r := server.New(cfg)
+	routes.Register(r, cfg)
 	req := httptest.NewRequest(http.MethodGet, "/api/me", nil)
 	rec := httptest.NewRecorder()
 	r.ServeHTTP(rec, req)
@@ -28,12 +29,13 @@ func Test_API_Me_Unauthorized(t *testing.T) {
 func Test_API_Me_Authorized(t *testing.T) {
 	_ = os.Setenv("LOG_FORMAT", "off")
 	_ = os.Setenv("JWT_SECRET", "testsecret")
-	auth.Init()
+	auth.Init(mustConfig(t))
 	tok, _, err := auth.Issue(1*time.Hour, map[string]any{"sub": 1, "login": "tester"})
 	if err != nil { t.Fatalf("issue token: %v", err) }
 
-	r := server.New()
-	routes.Register(r)
+	cfg := mustConfig(t)
+	r := server.New(cfg)
+	routes.Register(r, cfg)
 	req := httptest.NewRequest(http.MethodGet, "/api/me", nil)
 	req.AddCookie(&http.Cookie{Name: "gf_jwt", Value: tok, Path: "/"})
 	rec := httptest.NewRecorder()
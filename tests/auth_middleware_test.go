@@ -0,0 +1,110 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"gothicforge3/internal/auth"
+)
+
+// newAuthRouter mounts /private (RequireAuth), /maybe (OptionalAuth) and /custom
+// (RequireAuthWith) echoing the typed claims.
+func newAuthRouter(t *testing.T) *chi.Mux {
+	t.Helper()
+	t.Setenv("JWT_SECRET", "testsecret")
+	auth.Init(mustConfig(t))
+	echo := func(w http.ResponseWriter, r *http.Request) {
+		c, ok := auth.FromContext(r.Context())
+		if !ok { _, _ = w.Write([]byte("anonymous")); return }
+		_ = json.NewEncoder(w).Encode(map[string]any{"sub": c.Subject, "email": c.Email, "verified": c.EmailVerified, "provider": c.Provider, "exp": c.ExpiresAt.Unix(), "team": c.Raw["team"]})
+	}
+	r := chi.NewRouter()
+	r.With(auth.RequireAuth).Get("/private", echo)
+	r.With(auth.RequireAuth).Post("/private", echo)
+	r.With(auth.RequireAuth).Get("/api/private", echo)
+	r.With(auth.OptionalAuth).Get("/maybe", echo)
+	r.With(auth.RequireAuthWith(auth.AuthOptions{LoginPath: "/signin"})).Get("/custom", echo)
+	r.With(auth.RequireAuthWith(auth.AuthOptions{Unauthorized: func(w http.ResponseWriter, _ *http.Request, _ error) { w.WriteHeader(http.StatusTeapot) }})).Get("/teapot", echo)
+	return r
+}
+
+func issueTestToken(t *testing.T) (string, time.Time) {
+	t.Helper()
+	tok, exp, err := auth.Issue(time.Hour, map[string]any{"sub": 42, "email": "ada@example.com", "email_verified": true, "provider": "password", "team": "core"})
+	if err != nil { t.Fatalf("issue: %v", err) }
+	return tok, exp
+}
+
+func Test_Auth_RequireAuth_Cookie_And_Bearer_Typed_Claims(t *testing.T) {
+	r := newAuthRouter(t)
+	tok, exp := issueTestToken(t)
+
+	for name, set := range map[string]func(*http.Request){
+		"cookie": func(req *http.Request) { req.AddCookie(&http.Cookie{Name: auth.CookieName, Value: tok}) },
+		"bearer": func(req *http.Request) { req.Header.Set("Authorization", "Bearer "+tok) },
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/private", nil)
+		set(req)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK { t.Fatalf("%s: want 200, got %d", name, rec.Code) }
+		var got map[string]any
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil { t.Fatalf("%s: %v", name, err) }
+		if got["sub"] != "42" || got["email"] != "ada@example.com" || got["verified"] != true || got["provider"] != "password" || got["team"] != "core" {
+			t.Fatalf("%s: claims not typed: %v", name, got)
+		}
+		if int64(got["exp"].(float64)) != exp.Unix() { t.Fatalf("%s: exp %v, want %d", name, got["exp"], exp.Unix()) }
+	}
+}
+
+func Test_Auth_RequireAuth_Unauthenticated_Responses(t *testing.T) {
+	r := newAuthRouter(t)
+	serve := func(method, target string, hdr map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		for k, v := range hdr { req.Header.Set(k, v) }
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve(http.MethodGet, "/private?tab=1", nil)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/login?next=%2Fprivate%3Ftab%3D1" { t.Fatalf("html: %d %q", rec.Code, rec.Header().Get("Location")) }
+	rec = serve(http.MethodPost, "/private", nil)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/login" { t.Fatalf("form post: %d %q", rec.Code, rec.Header().Get("Location")) }
+
+	rec = serve(http.MethodPost, "/private", map[string]string{"HX-Request": "true", "HX-Current-URL": "http://example.com/dashboard"})
+	if rec.Code != http.StatusUnauthorized || rec.Header().Get("HX-Redirect") != "/login?next=%2Fdashboard" { t.Fatalf("htmx: %d %q", rec.Code, rec.Header().Get("HX-Redirect")) }
+
+	rec = serve(http.MethodGet, "/api/private", nil)
+	if rec.Code != http.StatusUnauthorized || rec.Header().Get("Content-Type") != "application/json; charset=utf-8" || rec.Header().Get("WWW-Authenticate") == "" { t.Fatalf("api: %d %v", rec.Code, rec.Header()) }
+	rec = serve(http.MethodGet, "/private", map[string]string{"Authorization": "Bearer not-a-jwt"})
+	if rec.Code != http.StatusUnauthorized || rec.Body.String() != "{\"error\":\"invalid_token\"}\n" { t.Fatalf("bad bearer: %d %q", rec.Code, rec.Body.String()) }
+
+	if rec := serve(http.MethodGet, "/custom", nil); rec.Header().Get("Location") != "/signin?next=%2Fcustom" { t.Fatalf("login path: %q", rec.Header().Get("Location")) }
+	if rec := serve(http.MethodGet, "/teapot", nil); rec.Code != http.StatusTeapot { t.Fatalf("custom responder: %d", rec.Code) }
+}
+
+func Test_Auth_OptionalAuth(t *testing.T) {
+	r := newAuthRouter(t)
+	tok, _ := issueTestToken(t)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/maybe", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "anonymous" { t.Fatalf("anonymous: %d %q", rec.Code, rec.Body.String()) }
+
+	req := httptest.NewRequest(http.MethodGet, "/maybe", nil)
+	req.AddCookie(&http.Cookie{Name: auth.CookieName, Value: "tampered"})
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Body.String() != "anonymous" { t.Fatalf("invalid token must be ignored: %q", rec.Body.String()) }
+
+	req = httptest.NewRequest(http.MethodGet, "/maybe", nil)
+	req.AddCookie(&http.Cookie{Name: auth.CookieName, Value: tok})
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Body.String() == "anonymous" { t.Fatalf("valid token not attached") }
+}
@@ -1,9 +1,11 @@
 package tests
 
 import (
+	"encoding/json"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -30,4 +32,21 @@ func Test_CLI_Export_Generates_Dist(t *testing.T) {
 	if _, err := os.Stat(filepath.Join(outDir, "static")); err != nil {
 		t.Fatalf("expected %s to exist: %v", filepath.Join(outDir, "static"), err)
 	}
+
+	// Pages link fingerprinted assets, the hashed copies exist, and only they are immutable.
+	b, err := os.ReadFile(filepath.Join(outDir, "static", "manifest.json"))
+	if err != nil { t.Fatalf("manifest: %v", err) }
+	var manifest map[string]string
+	if err := json.Unmarshal(b, &manifest); err != nil { t.Fatalf("manifest: %v", err) }
+	hashed := manifest["app.js"]
+	if hashed == "" || hashed == "app.js" { t.Fatalf("app.js not fingerprinted: %v", manifest) }
+	if _, err := os.Stat(filepath.Join(outDir, "static", hashed)); err != nil { t.Fatalf("hashed copy missing: %v", err) }
+	index, _ := os.ReadFile(p)
+	if !strings.Contains(string(index), `src="/static/`+hashed+`"`) { t.Fatalf("index.html does not link %s", hashed) }
+	headers, err := os.ReadFile(filepath.Join(outDir, "_headers"))
+	if err != nil { t.Fatalf("_headers: %v", err) }
+	if strings.Contains(string(headers), "/static/*") { t.Fatalf("_headers must not mark all of /static immutable:\n%s", headers) }
+	if !strings.Contains(string(headers), "/static/"+hashed+"\n  Cache-Control: public, max-age=31536000, immutable") {
+		t.Fatalf("_headers missing immutable rule for %s:\n%s", hashed, headers)
+	}
 }
@@ -0,0 +1,84 @@
+package tests
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gothicforge3/internal/config"
+)
+
+// mustConfig loads the configuration from the current process environment.
+func mustConfig(t *testing.T) *config.Config {
+	t.Helper()
+	cfg, err := config.Load()
+	if err != nil { t.Fatalf("config: %v", err) }
+	return cfg
+}
+
+func lookupMap(m map[string]string) func(string) (string, bool) {
+	return func(k string) (string, bool) { v, ok := m[k]; return v, ok }
+}
+
+func Test_Config_Defaults_And_Types(t *testing.T) {
+	cfg, err := config.LoadFrom(lookupMap(map[string]string{
+		"RATE_LIMIT_MAX":            "10",
+		"RATE_LIMIT_WINDOW_SECONDS": "30",
+		"CORS_ORIGINS":              "https://a.example, https://b.example,",
+		"PPROF_ENABLE":              "1",
+	}))
+	if err != nil { t.Fatalf("load: %v", err) }
+	if cfg.AppEnv != "development" || cfg.HTTPPort != "8080" {
+		t.Fatalf("defaults not applied: %+v", cfg)
+	}
+	if cfg.RateLimitMax != 10 || cfg.RateLimitWindow != 30*time.Second || !cfg.PprofEnable {
+		t.Fatalf("typed values not parsed: %+v", cfg)
+	}
+	if len(cfg.CORSOrigins) != 2 || cfg.CORSOrigins[1] != "https://b.example" {
+		t.Fatalf("unexpected CORS origins: %q", cfg.CORSOrigins)
+	}
+	if cfg.Addr() != "127.0.0.1:8080" {
+		t.Fatalf("unexpected addr: %s", cfg.Addr())
+	}
+}
+
+func Test_Config_Production_Requires_Real_JWTSecret(t *testing.T) {
+	_, err := config.LoadFrom(lookupMap(map[string]string{
+		"APP_ENV":        "production",
+		"RATE_LIMIT_MAX": "lots",
+	}))
+	var cerr *config.Error
+	if !errors.As(err, &cerr) {
+		t.Fatalf("want *config.Error, got %v", err)
+	}
+	msg := err.Error()
+	if !strings.Contains(msg, "JWT_SECRET") || !strings.Contains(msg, "RATE_LIMIT_MAX") || !strings.Contains(msg, "SITE_BASE_URL") {
+		t.Fatalf("report should list every problem, got:\n%s", msg)
+	}
+}
+
+func Test_Config_File_Indirection(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "jwt")
+	if err := os.WriteFile(p, []byte("from-file-secret\n"), 0o600); err != nil { t.Fatal(err) }
+	cfg, err := config.LoadFrom(lookupMap(map[string]string{"APP_ENV": "production", "SITE_BASE_URL": "https://app.example", "JWT_SECRET_FILE": p}))
+	if err != nil { t.Fatalf("load: %v", err) }
+	if cfg.JWTSecret != "from-file-secret" {
+		t.Fatalf("want secret from file, got %q", cfg.JWTSecret)
+	}
+	if strings.Contains(cfg.Report(), "from-file-secret") {
+		t.Fatalf("report leaks secret:\n%s", cfg.Report())
+	}
+	_, err = config.LoadFrom(lookupMap(map[string]string{"JWT_SECRET": "x", "JWT_SECRET_FILE": p}))
+	if err == nil { t.Fatalf("want error when both JWT_SECRET and JWT_SECRET_FILE are set") }
+}
+
+func Test_Config_Unix_Socket_Listen_Addr(t *testing.T) {
+	cfg, err := config.LoadFrom(lookupMap(map[string]string{"HTTP_SOCKET": "/run/gforge/http.sock", "HTTP_SOCKET_MODE": "0600"}))
+	if err != nil { t.Fatalf("config: %v", err) }
+	if cfg.ListenAddr() != "unix:/run/gforge/http.sock" || cfg.SocketMode() != 0o600 { t.Fatalf("addr %q mode %o", cfg.ListenAddr(), cfg.SocketMode()) }
+	if cfg, _ := config.LoadFrom(lookupMap(nil)); cfg.ListenAddr() != cfg.Addr() || cfg.HandoffTimeout != time.Minute { t.Fatalf("defaults: %q %v", cfg.ListenAddr(), cfg.HandoffTimeout) }
+	if _, err := config.LoadFrom(lookupMap(map[string]string{"HTTP_SOCKET": "/tmp/s", "HTTP_SOCKET_MODE": "rw"})); err == nil || !strings.Contains(err.Error(), "HTTP_SOCKET_MODE") { t.Fatalf("want mode problem, got %v", err) }
+}
@@ -11,6 +11,7 @@ import (
 
 	"gothicforge3/app/routes"
 	"gothicforge3/internal/auth"
+	"gothicforge3/internal/csrf"
 	"gothicforge3/internal/server"
 )
 
@@ -30,8 +31,9 @@ func Test_CRUD_Posts_Routes_Exist(t *testing.T) {
 	ensurePostsCrudPresent(t)
 	_ = os.Setenv("LOG_FORMAT", "off")
 
-	r := server.New()
-	routes.Register(r)
+	cfg := mustConfig(t)
+	r := server.New(cfg)
+	routes.Register(r, cfg)
 
 	// List
 	rec := httptest.NewRecorder()
@@ -52,15 +54,20 @@ func Test_CRUD_Posts_Create_Unauthorized(t *testing.T) {
 	ensurePostsCrudPresent(t)
 	_ = os.Setenv("LOG_FORMAT", "off")
 
-	r := server.New()
-	routes.Register(r)
+	cfg := mustConfig(t)
+	r := server.New(cfg)
+	routes.Register(r, cfg)
 
+	cookies, tok := csrfSession(t, r)
 	rec := httptest.NewRecorder()
 	req := httptest.NewRequest(http.MethodPost, "/posts", strings.NewReader("name=hello&description=world"))
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set(csrf.HeaderName, tok)
+	for _, c := range cookies { req.AddCookie(c) }
 	r.ServeHTTP(rec, req)
-	if rec.Code != http.StatusUnauthorized {
-		t.Fatalf("POST /posts (no JWT) want 401, got %d", rec.Code)
+	// auth.RequireAuth sends signed-out form posts to the login page.
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/login" {
+		t.Fatalf("POST /posts (no JWT) want 303 to /login, got %d %q", rec.Code, rec.Header().Get("Location"))
 	}
 }
 
@@ -68,19 +75,23 @@ func Test_CRUD_Posts_Create_Authorized(t *testing.T) {
 	ensurePostsCrudPresent(t)
 	_ = os.Setenv("LOG_FORMAT", "off")
 	_ = os.Setenv("JWT_SECRET", "testsecret")
-	auth.Init()
+	auth.Init(mustConfig(t))
 
-	r := server.New()
-	routes.Register(r)
+	cfg := mustConfig(t)
+	r := server.New(cfg)
+	routes.Register(r, cfg)
 
 	// Issue JWT cookie
 	tok, _, err := auth.Issue(30*time.Minute, map[string]any{"sub": "tester"})
 	if err != nil { t.Fatalf("issue token: %v", err) }
 
+	cookies, csrfTok := csrfSession(t, r)
 	name := "post-" + time.Now().Format("20060102150405")
 	rec := httptest.NewRecorder()
 	req := httptest.NewRequest(http.MethodPost, "/posts", strings.NewReader("name="+name+"&description=desc"))
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set(csrf.HeaderName, csrfTok)
+	for _, c := range cookies { req.AddCookie(c) }
 	req.AddCookie(&http.Cookie{Name: "gf_jwt", Value: tok, Path: "/"})
 	r.ServeHTTP(rec, req)
 	if rec.Code != http.StatusSeeOther {
@@ -0,0 +1,54 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"gothicforge3/app/routes"
+	"gothicforge3/app/templates"
+	"gothicforge3/internal/config"
+	"gothicforge3/internal/server"
+)
+
+func Test_CSP_Production_Uses_Nonce_Without_UnsafeInline(t *testing.T) {
+	cfg, err := config.LoadFrom(lookupMap(map[string]string{
+		"APP_ENV":       "production",
+		"SITE_BASE_URL": "https://app.example",
+		"JWT_SECRET":    "prod-test-secret",
+		"LOG_FORMAT":    "off",
+	}))
+	if err != nil { t.Fatalf("config: %v", err) }
+	r := server.New(cfg)
+	routes.Register(r, cfg)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK { t.Fatalf("want 200, got %d", rec.Code) }
+
+	csp := rec.Header().Get("Content-Security-Policy")
+	m := regexp.MustCompile(`script-src 'nonce-([^']+)' 'strict-dynamic'`).FindStringSubmatch(csp)
+	if m == nil { t.Fatalf("script-src lacks nonce/strict-dynamic: %q", csp) }
+	for _, d := range strings.Split(csp, ";") {
+		if strings.HasPrefix(strings.TrimSpace(d), "script-src") && strings.Contains(d, "'unsafe-inline'") {
+			t.Fatalf("production script-src must not allow 'unsafe-inline': %q", d)
+		}
+	}
+	body := rec.Body.String()
+	nonceAttr := `nonce="` + m[1] + `"`
+	if !strings.Contains(body, `<script type="application/ld+json" `+nonceAttr) {
+		t.Fatalf("JSON-LD block missing nonce %s", nonceAttr)
+	}
+	if !strings.Contains(body, `src="`+templates.Asset("app.js")+`" `+nonceAttr) {
+		t.Fatalf("app.js script missing nonce %s", nonceAttr)
+	}
+
+	// Nonces are fresh per request.
+	rec2 := httptest.NewRecorder()
+	r.ServeHTTP(rec2, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec2.Header().Get("Content-Security-Policy") == csp {
+		t.Fatalf("nonce reused across requests")
+	}
+}
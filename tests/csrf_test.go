@@ -0,0 +1,108 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"gothicforge3/app/routes"
+	"gothicforge3/internal/csrf"
+	"gothicforge3/internal/server"
+)
+
+var csrfMeta = regexp.MustCompile(`<meta name="csrf-token" content="([^"]+)"`)
+
+// csrfSession loads the home page and returns the session cookies and the CSRF token
+// rendered into the layout, ready to be replayed on a state-changing request.
+func csrfSession(t *testing.T, h http.Handler) ([]*http.Cookie, string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	m := csrfMeta.FindStringSubmatch(rec.Body.String())
+	if m == nil { t.Fatalf("csrf-token meta tag not rendered") }
+	cookies := rec.Result().Cookies()
+	if len(cookies) == 0 { t.Fatalf("session cookie not set on first visit") }
+	return cookies, m[1]
+}
+
+func newCSRFRouter(t *testing.T) *chi.Mux {
+	t.Setenv("LOG_FORMAT", "off")
+	cfg := mustConfig(t)
+	r := server.New(cfg)
+	routes.Register(r, cfg)
+	return r
+}
+
+func Test_CSRF_Rejects_Missing_Or_Wrong_Token(t *testing.T) {
+	r := newCSRFRouter(t)
+	cookies, _ := csrfSession(t, r)
+	for _, tok := range []string{"", "not-the-token"} {
+		req := httptest.NewRequest(http.MethodPost, "/counter/sync", strings.NewReader("count=1"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("HX-Request", "true")
+		if tok != "" { req.Header.Set(csrf.HeaderName, tok) }
+		for _, c := range cookies { req.AddCookie(c) }
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if rec.Code != http.StatusForbidden { t.Fatalf("token %q: want 403, got %d", tok, rec.Code) }
+		if rec.Header().Get("HX-Reswap") != "none" { t.Fatalf("HTMX rejection should not swap") }
+	}
+}
+
+func Test_CSRF_Accepts_Header_And_Form_Field(t *testing.T) {
+	r := newCSRFRouter(t)
+	cookies, tok := csrfSession(t, r)
+
+	req := httptest.NewRequest(http.MethodPost, "/counter/sync", strings.NewReader("count=2"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set(csrf.HeaderName, tok)
+	for _, c := range cookies { req.AddCookie(c) }
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK { t.Fatalf("header token: want 200, got %d", rec.Code) }
+
+	form := url.Values{"count": {"3"}, csrf.FieldName: {tok}}
+	req = httptest.NewRequest(http.MethodPost, "/counter/sync", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, c := range cookies { req.AddCookie(c) }
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK { t.Fatalf("form token: want 200, got %d", rec.Code) }
+}
+
+func Test_CSRF_Bearer_Exempt_Only_Under_API(t *testing.T) {
+	r := newCSRFRouter(t)
+	ok := func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusNoContent) }
+	r.Post("/api/ping", ok)
+	r.Post("/ping", ok)
+
+	for path, want := range map[string]int{"/api/ping": http.StatusNoContent, "/ping": http.StatusForbidden} {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.Header.Set("Authorization", "Bearer abc")
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if rec.Code != want { t.Fatalf("%s with Bearer: want %d, got %d", path, want, rec.Code) }
+	}
+}
+
+func Test_CSRF_No_Session_Without_A_Page(t *testing.T) {
+	r := newCSRFRouter(t)
+	tok, _ := issueTestToken(t)
+	for _, path := range []string{"/livez", "/readyz", "/healthz", "/.well-known/jwks.json", "/api/me"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if path == "/api/me" { req.Header.Set("Authorization", "Bearer "+tok) }
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if c := rec.Header().Values("Set-Cookie"); len(c) != 0 { t.Fatalf("%s started a session (%d): %v", path, rec.Code, c) }
+	}
+	// Pages still get a token, including those that write their status before rendering.
+	csrfSession(t, r)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/login", nil))
+	m := csrfMeta.FindStringSubmatch(rec.Body.String())
+	if m == nil || len(rec.Result().Cookies()) == 0 { t.Fatalf("login page: no token or session cookie") }
+}
@@ -0,0 +1,191 @@
+//go:build unix
+
+package tests
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"gothicforge3/internal/server"
+)
+
+// Unix socket listener: a stale socket file is replaced, requests are served, and the file is
+// removed on shutdown.
+func Test_Run_Unix_Socket(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "http.sock")
+	stale, err := net.Listen("unix", sock)
+	if err != nil { t.Fatal(err) }
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	_ = stale.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	opts := server.DefaultOptions("unix:" + sock)
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- server.Run(ctx, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte("unix ok")) }), opts)
+	}()
+
+	client := &http.Client{Timeout: 2 * time.Second, Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) { return (&net.Dialer{}).DialContext(ctx, "unix", sock) },
+	}}
+	var body string
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		if resp, err := client.Get("http://gforge/"); err == nil {
+			b, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			body = string(b)
+			break
+		}
+	}
+	if body != "unix ok" { t.Fatalf("body over unix socket = %q", body) }
+
+	if _, err := server.Listen("test-busy", "unix:"+sock); err == nil { t.Fatalf("listening on a live socket should fail") }
+
+	cancel()
+	if err := <-runErr; err != nil { t.Fatalf("run: %v", err) }
+	if _, err := os.Stat(sock); !os.IsNotExist(err) { t.Fatalf("socket file should be removed on shutdown, stat err=%v", err) }
+}
+
+// buildServer compiles cmd/server once per test into a temp dir.
+func buildServer(t *testing.T) string {
+	t.Helper()
+	if testing.Short() { t.Skip("builds the server binary") }
+	bin := filepath.Join(t.TempDir(), "server")
+	cmd := exec.Command("go", "build", "-o", bin, "./cmd/server")
+	cmd.Dir = ".."
+	if out, err := cmd.CombinedOutput(); err != nil { t.Fatalf("build server: %v\n%s", err, out) }
+	return bin
+}
+
+// waitOK polls url until it answers 200.
+func waitOK(t *testing.T, url string) {
+	t.Helper()
+	for deadline := time.Now().Add(15 * time.Second); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		if resp, err := http.Get(url); err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK { return }
+		}
+	}
+	t.Fatalf("%s never became ready", url)
+}
+
+var pidRe = regexp.MustCompile(`listening.* pid=(\d+)`)
+
+// listeningPIDs returns the pids that logged "listening" to the log file, in order.
+func listeningPIDs(t *testing.T, logFile string) []int {
+	t.Helper()
+	b, _ := os.ReadFile(logFile)
+	var pids []int
+	for _, m := range pidRe.FindAllSubmatch(b, -1) {
+		n, _ := strconv.Atoi(string(m[1]))
+		pids = append(pids, n)
+	}
+	return pids
+}
+
+// SIGHUP hands the listener to a new process; no request fails while the old one drains and exits.
+func Test_Handoff_Zero_Downtime(t *testing.T) {
+	bin := buildServer(t)
+	addr := freeAddr(t)
+	_, port, _ := net.SplitHostPort(addr)
+	logFile := filepath.Join(t.TempDir(), "server.log")
+	logOut, err := os.Create(logFile)
+	if err != nil { t.Fatal(err) }
+	defer logOut.Close()
+
+	old := exec.Command(bin)
+	old.Dir = ".."
+	old.Env = append(os.Environ(), "HTTP_PORT="+port, "HANDOFF_ENABLE=1", "LOG_FORMAT=text", "SHUTDOWN_GRACE_SECONDS=5")
+	// A file, not a pipe: the new process keeps writing to it after the old one exits.
+	old.Stdout, old.Stderr = logOut, logOut
+	if err := old.Start(); err != nil { t.Fatal(err) }
+	exited := make(chan error, 1)
+	go func() { exited <- old.Wait() }()
+	t.Cleanup(func() {
+		_ = old.Process.Kill()
+		for _, pid := range listeningPIDs(t, logFile) { _ = syscall.Kill(pid, syscall.SIGKILL) }
+	})
+	url := "http://" + addr + "/healthz"
+	waitOK(t, url)
+
+	var failures, served atomic.Int64
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		client := &http.Client{Timeout: 5 * time.Second, Transport: &http.Transport{DisableKeepAlives: true}}
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			resp, err := client.Get(url)
+			if err != nil || resp.StatusCode != http.StatusOK {
+				failures.Add(1)
+			} else {
+				served.Add(1)
+			}
+			if resp != nil { resp.Body.Close() }
+		}
+	}()
+
+	time.Sleep(200 * time.Millisecond)
+	if err := old.Process.Signal(syscall.SIGHUP); err != nil { t.Fatal(err) }
+	select {
+	case err := <-exited:
+		if err != nil { t.Fatalf("old process: %v", err) }
+	case <-time.After(30 * time.Second):
+		t.Fatalf("old process did not exit after handoff")
+	}
+	time.Sleep(200 * time.Millisecond)
+	close(stop)
+	<-done
+
+	if failures.Load() != 0 { t.Fatalf("%d requests failed during handoff (%d served)", failures.Load(), served.Load()) }
+	pids := listeningPIDs(t, logFile)
+	if len(pids) != 2 || pids[1] == old.Process.Pid { t.Fatalf("want old and new pid in log, got %v", pids) }
+	waitOK(t, url)
+
+	if err := syscall.Kill(pids[1], syscall.SIGTERM); err != nil { t.Fatal(err) }
+	for deadline := time.Now().Add(10 * time.Second); syscall.Kill(pids[1], 0) == nil; time.Sleep(50 * time.Millisecond) {
+		if time.Now().After(deadline) { t.Fatalf("new process did not stop") }
+	}
+}
+
+// systemd socket activation: LISTEN_PID/LISTEN_FDS hand the server a bound socket on fd 3.
+func Test_Systemd_Socket_Activation(t *testing.T) {
+	bin := buildServer(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil { t.Fatal(err) }
+	f, err := ln.(*net.TCPListener).File()
+	if err != nil { t.Fatal(err) }
+	_ = ln.Close()
+	defer f.Close()
+
+	// LISTEN_PID must be the server's pid: set it in a shell that then execs the server.
+	cmd := exec.Command("sh", "-c", `LISTEN_PID=$$ LISTEN_FDS=1 LISTEN_FDNAMES=http exec "$0"`, bin)
+	cmd.Dir = ".."
+	_, unused, _ := net.SplitHostPort(freeAddr(t))
+	cmd.Env = append(os.Environ(), "HTTP_PORT="+unused, "LOG_FORMAT=off")
+	cmd.ExtraFiles = []*os.File{f}
+	if err := cmd.Start(); err != nil { t.Fatal(err) }
+	defer func() { _ = cmd.Process.Signal(syscall.SIGTERM); _ = cmd.Wait() }()
+
+	waitOK(t, "http://"+ln.Addr().String()+"/healthz")
+	if c, err := net.DialTimeout("tcp", "127.0.0.1:"+unused, time.Second); err == nil {
+		c.Close()
+		t.Fatalf("server bound HTTP_PORT despite an activated socket")
+	}
+}
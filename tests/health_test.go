@@ -0,0 +1,112 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gothicforge3/app/routes"
+	"gothicforge3/internal/health"
+	"gothicforge3/internal/server"
+)
+
+func probe(t *testing.T, h http.Handler, path string) (int, string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec.Code, rec.Body.String()
+}
+
+func Test_Health_Readyz_Critical_And_NonCritical(t *testing.T) {
+	cfg := mustConfig(t)
+	r := server.New(cfg)
+	routes.Register(r, cfg)
+	t.Cleanup(func() { health.Unregister("test-critical"); health.Unregister("test-optional") })
+
+	code, body := probe(t, r, "/readyz")
+	if code != http.StatusOK || body != "ok" { t.Fatalf("defaults (valkey/db skipped): want 200 ok, got %d %q", code, body) }
+
+	health.Register(health.Check{Name: "test-optional", Fn: func(context.Context) error { return errors.New("mail relay down") }})
+	code, body = probe(t, r, "/readyz?verbose")
+	if code != http.StatusOK || !strings.Contains(body, "[-] test-optional fail: mail relay down (non-critical)") || !strings.Contains(body, "readyz check degraded") {
+		t.Fatalf("non-critical failure should degrade, not fail: %d %q", code, body)
+	}
+	if !strings.Contains(body, "[~] db skip") || !strings.Contains(body, "[~] valkey skip") { t.Fatalf("unconfigured deps should be skipped: %q", body) }
+
+	health.Register(health.Check{Name: "test-critical", Critical: true, Fn: func(context.Context) error { return errors.New("primary unreachable") }})
+	code, body = probe(t, r, "/readyz")
+	if code != http.StatusServiceUnavailable || !strings.Contains(body, "[-] test-critical fail: primary unreachable") {
+		t.Fatalf("critical failure: want 503 with details, got %d %q", code, body)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/readyz", nil)
+	req.Header.Set("Accept", "application/json")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	var rep health.Report
+	if err := json.Unmarshal(rec.Body.Bytes(), &rep); err != nil { t.Fatalf("json: %v %q", err, rec.Body.String()) }
+	if rep.Probe != "readyz" || rep.Status != health.StatusFail || len(rep.Checks) != 4 { t.Fatalf("unexpected report: %+v", rep) }
+
+	// Liveness ignores readiness checks; /healthz stays a plain "ok".
+	if code, body := probe(t, r, "/livez"); code != http.StatusOK || body != "ok" { t.Fatalf("livez: %d %q", code, body) }
+	if code, body := probe(t, r, "/healthz"); code != http.StatusOK || body != "ok" { t.Fatalf("healthz: %d %q", code, body) }
+}
+
+func Test_Health_Parallel_Timeout_And_Cache(t *testing.T) {
+	var calls atomic.Int32
+	names := []string{"test-slow-a", "test-slow-b", "test-hang", "test-cached"}
+	t.Cleanup(func() { for _, n := range names { health.Unregister(n) } })
+	sleep := func(ctx context.Context) error {
+		select {
+		case <-time.After(150 * time.Millisecond):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	health.Register(health.Check{Name: "test-slow-a", Scope: health.Startup, Fn: sleep})
+	health.Register(health.Check{Name: "test-slow-b", Scope: health.Startup, Fn: sleep})
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	// Ignores its context: the registry must still give up after Timeout.
+	health.Register(health.Check{Name: "test-hang", Scope: health.Startup, Timeout: 50 * time.Millisecond, Fn: func(context.Context) error { <-release; return nil }})
+	health.Register(health.Check{Name: "test-cached", Scope: health.Startup, CacheTTL: time.Minute, Fn: func(context.Context) error { calls.Add(1); return nil }})
+
+	start := time.Now()
+	rep := health.Run(context.Background(), "startupz", health.Startup)
+	if d := time.Since(start); d > 280*time.Millisecond { t.Fatalf("checks should run in parallel, took %s", d) }
+	byName := map[string]health.Result{}
+	for _, c := range rep.Checks { byName[c.Name] = c }
+	if c := byName["test-hang"]; c.Status != health.StatusFail || !strings.Contains(c.Error, "timeout") { t.Fatalf("hung check should time out: %+v", c) }
+	if rep.Status != health.StatusDegraded { t.Fatalf("non-critical timeout should degrade: %s", rep.Status) }
+
+	rep = health.Run(context.Background(), "startupz", health.Startup)
+	for _, c := range rep.Checks {
+		if c.Name == "test-cached" && !c.Cached { t.Fatalf("second run should reuse the cached result") }
+	}
+	if n := calls.Load(); n != 1 { t.Fatalf("cached check ran %d times", n) }
+}
+
+func Test_Health_Startupz_And_Fetch(t *testing.T) {
+	cfg := mustConfig(t)
+	r := server.New(cfg)
+	if !health.Started() {
+		if code, body := probe(t, r, "/startupz"); code != http.StatusServiceUnavailable || !strings.Contains(body, "startup hooks still running") {
+			t.Fatalf("before MarkStarted: want 503, got %d %q", code, body)
+		}
+	}
+	health.MarkStarted()
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	for _, p := range health.Probes {
+		rep, err := health.Fetch(context.Background(), srv.URL, p)
+		if err != nil { t.Fatalf("fetch %s: %v", p, err) }
+		if rep.Probe != p || !rep.Healthy() { t.Fatalf("%s: %+v", p, rep) }
+	}
+}
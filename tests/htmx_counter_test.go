@@ -9,17 +9,22 @@ import (
 	"testing"
 
 	"gothicforge3/app/routes"
+	"gothicforge3/internal/csrf"
 	"gothicforge3/internal/server"
 )
 
 func Test_HTMX_CounterSync(t *testing.T) {
 	_ = os.Setenv("LOG_FORMAT", "off")
-	r := server.New()
-	routes.Register(r)
+	cfg := mustConfig(t)
+	r := server.New(cfg)
+	routes.Register(r, cfg)
+	cookies, tok := csrfSession(t, r)
 	form := url.Values{}
 	form.Set("count", "7")
 	req := httptest.NewRequest(http.MethodPost, "/counter/sync", strings.NewReader(form.Encode()))
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set(csrf.HeaderName, tok)
+	for _, c := range cookies { req.AddCookie(c) }
 	rec := httptest.NewRecorder()
 	r.ServeHTTP(rec, req)
 	if rec.Code != http.StatusOK {
@@ -0,0 +1,235 @@
+package tests
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/a-h/templ"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-chi/chi/v5"
+	"gothicforge3/app/routes"
+	"gothicforge3/internal/config"
+	"gothicforge3/internal/csrf"
+	"gothicforge3/internal/httpcache"
+	"gothicforge3/internal/kv"
+	"gothicforge3/internal/server"
+)
+
+func newETagRouter(t *testing.T) *chi.Mux {
+	t.Helper()
+	cfg, err := config.LoadFrom(lookupMap(map[string]string{
+		"APP_ENV":       "production",
+		"SITE_BASE_URL": "https://app.example",
+		"JWT_SECRET":    "prod-test-secret",
+		"LOG_FORMAT":    "off",
+		"ETAG_ENABLE":   "1",
+	}))
+	if err != nil { t.Fatalf("config: %v", err) }
+	r := server.New(cfg)
+	r.With(httpcache.Policy(httpcache.Public(5*time.Minute))).Get("/t/public", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, "<p>public</p>")
+	})
+	r.With(httpcache.Policy(httpcache.NoStore)).Get("/t/nostore", func(w http.ResponseWriter, _ *http.Request) {
+		io.WriteString(w, "<!doctype html><p>secret</p>")
+	})
+	r.Get("/t/json", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"ok": "yes"})
+	})
+	r.Get("/t/events", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "<p>one</p>")
+		http.NewResponseController(w).Flush()
+		io.WriteString(w, "<p>two</p>")
+	})
+	routes.Register(r, cfg)
+	return r
+}
+
+func get(h http.Handler, path string, hdr map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for k, v := range hdr { req.Header.Set(k, v) }
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// Pages revalidate with 304 even though every response carries a fresh CSP nonce.
+func Test_ETag_Page_304_On_If_None_Match(t *testing.T) {
+	r := newETagRouter(t)
+	first := get(r, "/", nil)
+	if first.Code != http.StatusOK { t.Fatalf("want 200, got %d", first.Code) }
+	tag := first.Header().Get("ETag")
+	if tag == "" || strings.HasPrefix(tag, "W/") { t.Fatalf("want strong ETag, got %q", tag) }
+	if cc := first.Header().Get("Cache-Control"); !strings.Contains(cc, httpcache.NoCache) { t.Fatalf("default Cache-Control: %q", cc) }
+	if !strings.Contains(strings.Join(first.Header().Values("Vary"), ","), "HX-Request") { t.Fatalf("missing Vary: HX-Request") }
+	cookie := first.Header().Get("Set-Cookie")
+	if cookie == "" { t.Fatalf("want a session cookie (CSRF token)") }
+	cookie, _, _ = strings.Cut(cookie, ";")
+
+	second := get(r, "/", map[string]string{"Cookie": cookie})
+	if second.Header().Get("ETag") != tag { t.Fatalf("ETag changed between identical renders: %q vs %q", tag, second.Header().Get("ETag")) }
+	if second.Header().Get("Content-Security-Policy") == first.Header().Get("Content-Security-Policy") { t.Fatalf("nonce reused") }
+
+	nm := get(r, "/", map[string]string{"Cookie": cookie, "If-None-Match": `"other", ` + tag})
+	if nm.Code != http.StatusNotModified { t.Fatalf("want 304, got %d", nm.Code) }
+	if nm.Body.Len() != 0 { t.Fatalf("304 with body") }
+	for _, k := range []string{"Content-Security-Policy", "Content-Type", "Content-Length"} {
+		if nm.Header().Get(k) != "" { t.Fatalf("304 carries %s", k) }
+	}
+	if nm.Header().Get("ETag") != tag { t.Fatalf("304 ETag %q", nm.Header().Get("ETag")) }
+
+	// Another session renders another CSRF token, so the validator does not match.
+	if other := get(r, "/", map[string]string{"If-None-Match": tag}); other.Code != http.StatusOK { t.Fatalf("other session: want 200, got %d", other.Code) }
+}
+
+// Compressed responses get weak validators, and a 304 is not content-coded.
+func Test_ETag_Weak_With_Compression(t *testing.T) {
+	r := newETagRouter(t)
+	hdr := map[string]string{"Accept-Encoding": "gzip"}
+	rec := get(r, "/t/public", hdr)
+	if rec.Header().Get("Content-Encoding") != "gzip" { t.Fatalf("want gzip, got %q", rec.Header().Get("Content-Encoding")) }
+	tag := rec.Header().Get("ETag")
+	if !strings.HasPrefix(tag, `W/"`) { t.Fatalf("want weak ETag, got %q", tag) }
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil { t.Fatalf("gzip: %v", err) }
+	if b, _ := io.ReadAll(zr); string(b) != "<p>public</p>" { t.Fatalf("body %q", b) }
+	if cc := rec.Header().Get("Cache-Control"); cc != "public, max-age=300" { t.Fatalf("policy Cache-Control: %q", cc) }
+
+	hdr["If-None-Match"] = tag
+	nm := get(r, "/t/public", hdr)
+	if nm.Code != http.StatusNotModified { t.Fatalf("want 304, got %d", nm.Code) }
+	if nm.Header().Get("Content-Encoding") != "" || nm.Body.Len() != 0 { t.Fatalf("304 is content-coded") }
+
+	// Weak comparison: the identity response matches the gzip validator.
+	if id := get(r, "/t/public", map[string]string{"If-None-Match": tag}); id.Code != http.StatusNotModified { t.Fatalf("identity: want 304, got %d", id.Code) }
+}
+
+func Test_ETag_Skips_NoStore_And_NonHTML(t *testing.T) {
+	r := newETagRouter(t)
+	for _, path := range []string{"/t/nostore", "/t/json", "/t/events", "/readyz"} {
+		rec := get(r, path, map[string]string{"If-None-Match": "*"})
+		if rec.Code != http.StatusOK { t.Fatalf("%s: want 200, got %d", path, rec.Code) }
+		if rec.Header().Get("ETag") != "" { t.Fatalf("%s: unexpected ETag", path) }
+	}
+	if b := get(r, "/t/events", nil).Body.String(); b != "<p>one</p><p>two</p>" { t.Fatalf("streamed body %q", b) }
+	if cc := get(r, "/t/nostore", nil).Header().Get("Cache-Control"); cc != "no-store" { t.Fatalf("no-store policy: %q", cc) }
+}
+
+func Test_ETag_Match(t *testing.T) {
+	for _, tc := range []struct {
+		header, tag string
+		want        bool
+	}{
+		{`"a"`, `"a"`, true},
+		{`W/"a"`, `"a"`, true},
+		{`"b", W/"a"`, `W/"a"`, true},
+		{`*`, `"a"`, true},
+		{`"b"`, `"a"`, false},
+		{``, `"a"`, false},
+	} {
+		if got := httpcache.Match(tc.header, tc.tag); got != tc.want { t.Fatalf("Match(%q, %q) = %v", tc.header, tc.tag, got) }
+	}
+	if httpcache.Tag([]byte("x n1 y"), "n1", false) != httpcache.Tag([]byte("x n2 y"), "n2", false) { t.Fatalf("nonce not ignored") }
+}
+
+func newCacheRouter(t *testing.T, valkey bool) (*chi.Mux, *atomic.Int64) {
+	t.Helper()
+	env := map[string]string{"APP_ENV": "production", "SITE_BASE_URL": "https://app.example", "JWT_SECRET": "prod-test-secret", "LOG_FORMAT": "off"}
+	if valkey { env["VALKEY_URL"] = "redis://" + miniredis.RunT(t).Addr() }
+	cfg, err := config.LoadFrom(lookupMap(env))
+	if err != nil { t.Fatalf("config: %v", err) }
+	r := server.New(cfg)
+	t.Cleanup(func() { _ = kv.Close() })
+	var calls atomic.Int64
+	page := func(w http.ResponseWriter, req *http.Request) {
+		n := calls.Add(1)
+		if req.URL.Query().Get("fail") != "" { http.Error(w, "boom", http.StatusInternalServerError); return }
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprintf(w, `<script nonce="%s"></script><input name="csrf_token" value="%s"><p>render %d</p>`, templ.GetNonce(req.Context()), csrf.Token(req.Context()), n)
+	}
+	r.With(httpcache.Cache(httpcache.CacheOptions{TTL: time.Minute, Tags: []string{"items"}, Vary: []string{"Accept-Language"}})).Get("/t/items", page)
+	return r, &calls
+}
+
+// Cached pages are rendered once and served to other sessions with their own nonce and CSRF token.
+func Test_Cache_Response_Hit_Substitutes_Nonce_And_CSRF(t *testing.T) {
+	for _, valkey := range []bool{false, true} {
+		t.Run(map[bool]string{false: "memory", true: "valkey"}[valkey], func(t *testing.T) {
+			r, calls := newCacheRouter(t, valkey)
+			miss := get(r, "/t/items", nil)
+			if miss.Code != http.StatusOK || miss.Header().Get("X-Cache") != "MISS" { t.Fatalf("first: %d %q", miss.Code, miss.Header().Get("X-Cache")) }
+			hit := get(r, "/t/items", nil)
+			if hit.Header().Get("X-Cache") != "HIT" { t.Fatalf("second: X-Cache %q", hit.Header().Get("X-Cache")) }
+			if calls.Load() != 1 { t.Fatalf("handler ran %d times", calls.Load()) }
+			if hit.Header().Get("Content-Type") != "text/html; charset=utf-8" { t.Fatalf("Content-Type %q", hit.Header().Get("Content-Type")) }
+			body := hit.Body.String()
+			if !strings.Contains(body, "render 1") { t.Fatalf("hit body %q", body) }
+			nonce := regexp.MustCompile(`'nonce-([^']+)'`).FindStringSubmatch(hit.Header().Get("Content-Security-Policy"))
+			if nonce == nil || !strings.Contains(body, `nonce="`+nonce[1]+`"`) { t.Fatalf("hit does not carry its own nonce: %q", body) }
+			if strings.Contains(body, `value=""`) || strings.Contains(body, "\x00") { t.Fatalf("placeholder leaked: %q", body) }
+			token := func(s string) string { return regexp.MustCompile(`value="([^"]+)"`).FindStringSubmatch(s)[1] }
+			if token(body) == token(miss.Body.String()) { t.Fatalf("hit reused another session's CSRF token") }
+
+			// Vary dimensions and the query string select separate entries.
+			for _, tc := range []struct {
+				path string
+				hdr  map[string]string
+			}{
+				{"/t/items?page=2", nil},
+				{"/t/items", map[string]string{"Accept-Language": "de"}},
+				{"/t/items", map[string]string{"HX-Request": "true"}},
+			} {
+				if rec := get(r, tc.path, tc.hdr); rec.Header().Get("X-Cache") != "MISS" { t.Fatalf("%s %v: want MISS, got %q", tc.path, tc.hdr, rec.Header().Get("X-Cache")) }
+			}
+			if !strings.Contains(strings.Join(hit.Header().Values("Vary"), ","), "Accept-Language") { t.Fatalf("Vary %v", hit.Header().Values("Vary")) }
+
+			// Errors are never stored.
+			get(r, "/t/items?fail=1", nil)
+			if rec := get(r, "/t/items?fail=1", nil); rec.Code != http.StatusInternalServerError || rec.Header().Get("X-Cache") != "MISS" { t.Fatalf("error cached: %d %q", rec.Code, rec.Header().Get("X-Cache")) }
+
+			// Invalidation drops the entry and runs hooks.
+			before := calls.Load()
+			if err := httpcache.Invalidate(context.Background(), "items"); err != nil { t.Fatalf("invalidate: %v", err) }
+			if rec := get(r, "/t/items", nil); rec.Header().Get("X-Cache") != "MISS" || calls.Load() != before+1 { t.Fatalf("after invalidate: %q", rec.Header().Get("X-Cache")) }
+		})
+	}
+}
+
+func Test_Cache_Fragment_And_Invalidate_Hooks(t *testing.T) {
+	initKV(t, false)
+	var renders atomic.Int64
+	recent := templ.ComponentFunc(func(ctx context.Context, w io.Writer) error {
+		_, err := fmt.Fprintf(w, `<ul nonce="%s">%d</ul>`, templ.GetNonce(ctx), renders.Add(1))
+		return err
+	})
+	frag := httpcache.Fragment("recent", time.Minute, recent, "posts")
+	render := func(nonce string) string {
+		var b strings.Builder
+		if err := frag.Render(templ.WithNonce(context.Background(), nonce), &b); err != nil { t.Fatalf("render: %v", err) }
+		return b.String()
+	}
+	if got := render("n1"); got != `<ul nonce="n1">1</ul>` { t.Fatalf("first %q", got) }
+	if got := render("n2"); got != `<ul nonce="n2">1</ul>` { t.Fatalf("cached %q", got) }
+
+	var seen []string
+	httpcache.OnInvalidate(func(_ context.Context, tags []string) { seen = append(seen, tags...) })
+	if err := httpcache.Invalidate(context.Background(), "posts"); err != nil { t.Fatalf("invalidate: %v", err) }
+	if len(seen) != 1 || seen[0] != "posts" { t.Fatalf("hook saw %v", seen) }
+	if got := render("n3"); got != `<ul nonce="n3">2</ul>` { t.Fatalf("after invalidate %q", got) }
+
+	httpcache.Enable(false)
+	t.Cleanup(func() { httpcache.Enable(true) })
+	if got := render("n4"); got != `<ul nonce="n4">3</ul>` { t.Fatalf("disabled %q", got) }
+}
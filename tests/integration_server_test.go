@@ -14,8 +14,9 @@ import (
 
 func Test_Healthz_OK(t *testing.T) {
 	_ = os.Setenv("LOG_FORMAT", "off")
-	r := server.New()
-	routes.Register(r)
+	cfg := mustConfig(t)
+	r := server.New(cfg)
+	routes.Register(r, cfg)
 	req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
 	rec := httptest.NewRecorder()
 	r.ServeHTTP(rec, req)
@@ -29,8 +30,9 @@ func Test_Healthz_OK(t *testing.T) {
 
 func Test_Favicon_Redirect(t *testing.T) {
 	_ = os.Setenv("LOG_FORMAT", "off")
-	r := server.New()
-	routes.Register(r)
+	cfg := mustConfig(t)
+	r := server.New(cfg)
+	routes.Register(r, cfg)
 	req := httptest.NewRequest(http.MethodGet, "/favicon.ico", nil)
 	rec := httptest.NewRecorder()
 	r.ServeHTTP(rec, req)
@@ -44,8 +46,9 @@ func Test_Favicon_Redirect(t *testing.T) {
 
 func Test_Robots_ServesOrGenerates(t *testing.T) {
 	_ = os.Setenv("LOG_FORMAT", "off")
-	r := server.New()
-	routes.Register(r)
+	cfg := mustConfig(t)
+	r := server.New(cfg)
+	routes.Register(r, cfg)
 	req := httptest.NewRequest(http.MethodGet, "/robots.txt", nil)
 	rec := httptest.NewRecorder()
 	r.ServeHTTP(rec, req)
@@ -60,8 +63,9 @@ func Test_Robots_ServesOrGenerates(t *testing.T) {
 
 func Test_Sitemap_ServesOrGenerates(t *testing.T) {
     _ = os.Setenv("LOG_FORMAT", "off")
-    r := server.New()
-    routes.Register(r)
+    cfg := mustConfig(t)
+    r := server.New(cfg)
+    routes.Register(r, cfg)
     req := httptest.NewRequest(http.MethodGet, "/sitemap.xml", nil)
     rec := httptest.NewRecorder()
     r.ServeHTTP(rec, req)
@@ -78,7 +82,7 @@ func Test_Static_Exists_Defaults(t *testing.T) {
     _ = os.Setenv("LOG_FORMAT", "off")
     _ = os.Setenv("GFORGE_BASEDIR", "")
     // ensure default static is mounted
-    r := server.New()
+    r := server.New(mustConfig(t))
     req := httptest.NewRequest(http.MethodGet, "/static/", nil)
     rec := httptest.NewRecorder()
     r.ServeHTTP(rec, req)
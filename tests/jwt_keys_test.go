@@ -0,0 +1,142 @@
+package tests
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gothicforge3/app/routes"
+	"gothicforge3/internal/auth"
+	"gothicforge3/internal/config"
+	"gothicforge3/internal/server"
+)
+
+// initAuth loads env into a config and re-initialises the auth keys from it.
+func initAuth(t *testing.T, env map[string]string) *config.Config {
+	t.Helper()
+	cfg, err := config.LoadFrom(lookupMap(env))
+	if err != nil { t.Fatalf("config: %v", err) }
+	if err := auth.Init(cfg); err != nil { t.Fatalf("auth init: %v", err) }
+	t.Cleanup(func() { _ = auth.Init(mustConfig(t)) })
+	return cfg
+}
+
+func jwtHeader(t *testing.T, tok string) map[string]any {
+	t.Helper()
+	b, err := base64.RawURLEncoding.DecodeString(strings.SplitN(tok, ".", 2)[0])
+	if err != nil { t.Fatalf("header: %v", err) }
+	var h map[string]any
+	_ = json.Unmarshal(b, &h)
+	return h
+}
+
+func issue(t *testing.T) string {
+	t.Helper()
+	tok, _, err := auth.Issue(time.Hour, map[string]any{"sub": "7"})
+	if err != nil { t.Fatalf("issue: %v", err) }
+	return tok
+}
+
+func Test_JWT_Rotation_Keeps_Old_Tokens_Valid_For_Grace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jwt-keys.json")
+	initAuth(t, map[string]string{"JWT_SECRET": "old-secret"})
+	legacy := issue(t)
+	if _, ok := jwtHeader(t, legacy)["kid"]; ok { t.Fatalf("JWT_SECRET tokens carry no kid") }
+
+	now := time.Now()
+	kf := &auth.KeyFile{Keys: []auth.StoredKey{auth.SecretKey(auth.LegacyKID, "old-secret", now)}}
+	first, err := kf.Rotate(auth.EdDSA, time.Hour, now)
+	if err != nil { t.Fatalf("rotate: %v", err) }
+	if err := kf.Write(path); err != nil { t.Fatalf("write: %v", err) }
+
+	initAuth(t, map[string]string{"JWT_KEYS_FILE": path})
+	ed := issue(t)
+	if h := jwtHeader(t, ed); h["kid"] != first.KID || h["alg"] != "EdDSA" { t.Fatalf("header: %v", h) }
+	for name, tok := range map[string]string{"legacy": legacy, "eddsa": ed} {
+		if c, err := auth.Verify(context.Background(), tok); err != nil || c["sub"] != "7" { t.Fatalf("%s token rejected: %v", name, err) }
+	}
+
+	// A second rotation with no grace retires the EdDSA key now; the legacy key keeps the
+	// grace period it was given by the first rotation.
+	second, err := kf.Rotate(auth.RS256, 0, time.Now())
+	if err != nil { t.Fatalf("rotate: %v", err) }
+	if err := kf.Write(path); err != nil { t.Fatalf("write: %v", err) }
+	initAuth(t, map[string]string{"JWT_KEYS_FILE": path})
+	rs := issue(t)
+	if h := jwtHeader(t, rs); h["kid"] != second.KID || h["alg"] != "RS256" { t.Fatalf("header: %v", h) }
+	if _, err := auth.Verify(context.Background(), rs); err != nil { t.Fatalf("rs256 token rejected: %v", err) }
+	if _, err := auth.Verify(context.Background(), ed); err == nil { t.Fatalf("eddsa token accepted after its key retired") }
+	if _, err := auth.Verify(context.Background(), legacy); err != nil { t.Fatalf("legacy token rejected within its grace: %v", err) }
+}
+
+func Test_JWT_Issuer_And_Audience(t *testing.T) {
+	base := map[string]string{"JWT_SECRET": "s", "JWT_ISSUER": "https://a.example", "JWT_AUDIENCE": "web,api"}
+	initAuth(t, base)
+	tok := issue(t)
+	c, err := auth.Verify(context.Background(), tok)
+	if err != nil { t.Fatalf("verify: %v", err) }
+	if c["iss"] != "https://a.example" { t.Fatalf("iss: %v", c["iss"]) }
+
+	initAuth(t, map[string]string{"JWT_SECRET": "s", "JWT_ISSUER": "https://b.example"})
+	if _, err := auth.Verify(context.Background(), tok); err == nil { t.Fatalf("foreign issuer accepted") }
+	initAuth(t, map[string]string{"JWT_SECRET": "s", "JWT_ISSUER": "https://a.example", "JWT_AUDIENCE": "api"})
+	if _, err := auth.Verify(context.Background(), tok); err != nil { t.Fatalf("overlapping audience rejected: %v", err) }
+	initAuth(t, map[string]string{"JWT_SECRET": "s", "JWT_ISSUER": "https://a.example", "JWT_AUDIENCE": "billing"})
+	if _, err := auth.Verify(context.Background(), tok); err == nil { t.Fatalf("foreign audience accepted") }
+}
+
+func Test_JWT_JWKS_Endpoint_Publishes_Public_Keys_Only(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jwt-keys.json")
+	kf := &auth.KeyFile{}
+	for _, alg := range []string{auth.HS256, auth.RS256, auth.EdDSA} {
+		if _, err := kf.Rotate(alg, time.Hour, time.Now()); err != nil { t.Fatalf("rotate %s: %v", alg, err) }
+	}
+	if err := kf.Write(path); err != nil { t.Fatalf("write: %v", err) }
+
+	cfg := initAuth(t, map[string]string{"JWT_KEYS_FILE": path, "LOG_FORMAT": "off"})
+	r := server.New(cfg)
+	routes.Register(r, cfg)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/jwk-set+json" { t.Fatalf("jwks: %d %v", rec.Code, rec.Header()) }
+	var set struct{ Keys []map[string]any }
+	if err := json.Unmarshal(rec.Body.Bytes(), &set); err != nil { t.Fatalf("jwks body: %v", err) }
+	if len(set.Keys) != 2 { t.Fatalf("want the RSA and Ed25519 keys only, got %s", rec.Body.String()) }
+	for _, k := range set.Keys {
+		if _, private := k["d"]; private || k["kid"] == "" || (k["kty"] != "RSA" && k["kty"] != "OKP") { t.Fatalf("bad key: %v", k) }
+	}
+}
+
+func Test_JWT_Config_Problems(t *testing.T) {
+	if _, err := config.LoadFrom(lookupMap(map[string]string{"APP_ENV": "production", "SITE_BASE_URL": "https://app.example", "JWT_ALG": "EdDSA", "JWT_SECRET": "x"})); err == nil || !strings.Contains(err.Error(), "JWT_KEYS_FILE") {
+		t.Fatalf("want JWT_KEYS_FILE problem, got %v", err)
+	}
+	if _, err := config.LoadFrom(lookupMap(map[string]string{"APP_ENV": "production", "SITE_BASE_URL": "https://app.example", "JWT_KEYS_FILE": "/run/secrets/jwt-keys.json"})); err != nil {
+		t.Fatalf("key file should replace JWT_SECRET: %v", err)
+	}
+	if _, err := config.LoadFrom(lookupMap(map[string]string{"JWT_ALG": "HS512"})); err == nil { t.Fatalf("unsupported JWT_ALG accepted") }
+}
+
+func Test_JWT_Bad_Keys_File_Fails_Closed_In_Production(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.json")
+	t.Cleanup(func() { _ = auth.Init(mustConfig(t)) })
+	dev, err := config.LoadFrom(lookupMap(map[string]string{"JWT_KEYS_FILE": missing}))
+	if err != nil { t.Fatalf("config: %v", err) }
+	if err := auth.Init(dev); err == nil { t.Fatalf("dev: want an error for a missing key file") }
+	if _, _, err := auth.Issue(time.Hour, map[string]any{"sub": "7"}); err != nil { t.Fatalf("dev falls back to JWT_SECRET: %v", err) }
+
+	// JWT_KEYS_FILE exempts JWT_SECRET from the production checks, so the default must not be used.
+	prod, err := config.LoadFrom(lookupMap(map[string]string{"APP_ENV": "production", "SITE_BASE_URL": "https://app.example", "JWT_KEYS_FILE": missing}))
+	if err != nil { t.Fatalf("config: %v", err) }
+	if err := auth.CheckKeys(prod); err == nil { t.Fatalf("CheckKeys: want an error") }
+	forged := issue(t) // signed with the dev default secret
+	if err := auth.Init(prod); err == nil { t.Fatalf("prod: want an error") }
+	if _, _, err := auth.Issue(time.Hour, map[string]any{"sub": "7"}); err == nil { t.Fatalf("prod signed with an unchecked secret") }
+	if _, err := auth.Verify(context.Background(), forged); err == nil { t.Fatalf("prod accepted a token signed with the default secret") }
+}
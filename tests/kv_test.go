@@ -0,0 +1,128 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"gothicforge3/internal/config"
+	"gothicforge3/internal/kv"
+)
+
+// initKV points internal/kv at a fresh backend: miniredis when valkey is true, memory otherwise.
+func initKV(t *testing.T, valkey bool) *miniredis.Miniredis {
+	t.Helper()
+	env := map[string]string{}
+	var mr *miniredis.Miniredis
+	if valkey {
+		mr = miniredis.RunT(t)
+		env["VALKEY_URL"] = "redis://" + mr.Addr()
+	}
+	cfg, err := config.LoadFrom(lookupMap(env))
+	if err != nil { t.Fatalf("config: %v", err) }
+	kv.Init(cfg)
+	t.Cleanup(func() { _ = kv.Close() })
+	return mr
+}
+
+func Test_KV_Backends_TTL_And_Tags(t *testing.T) {
+	for _, valkey := range []bool{false, true} {
+		name := map[bool]string{false: "memory", true: "valkey"}[valkey]
+		t.Run(name, func(t *testing.T) {
+			mr := initKV(t, valkey)
+			if kv.Backend() != name { t.Fatalf("backend: want %s, got %s", name, kv.Backend()) }
+			ctx := context.Background()
+			if err := kv.Set(ctx, "post:1", []byte("one"), 50*time.Millisecond, "posts"); err != nil { t.Fatal(err) }
+			if err := kv.Set(ctx, "post:2", []byte("two"), time.Minute, "posts", "post:2"); err != nil { t.Fatal(err) }
+			if err := kv.SetJSON(ctx, "user:1", map[string]string{"name": "ada"}, time.Minute); err != nil { t.Fatal(err) }
+
+			if b, ok, _ := kv.Get(ctx, "post:1"); !ok || string(b) != "one" { t.Fatalf("get post:1: %q %v", b, ok) }
+			if mr != nil { mr.FastForward(100 * time.Millisecond) } else { time.Sleep(100 * time.Millisecond) }
+			if _, ok, _ := kv.Get(ctx, "post:1"); ok { t.Fatalf("post:1 should have expired") }
+
+			if err := kv.InvalidateTags(ctx, "posts"); err != nil { t.Fatal(err) }
+			if _, ok, _ := kv.Get(ctx, "post:2"); ok { t.Fatalf("post:2 should be invalidated by tag") }
+			var u map[string]string
+			if ok, err := kv.GetJSON(ctx, "user:1", &u); !ok || err != nil || u["name"] != "ada" {
+				t.Fatalf("untagged entry should survive: %v %v %v", u, ok, err)
+			}
+		})
+	}
+}
+
+func Test_KV_GetOrCompute_Collapses_Concurrent_Misses(t *testing.T) {
+	for _, valkey := range []bool{false, true} {
+		initKV(t, valkey)
+		ctx := context.Background()
+		var calls int32
+		compute := func(context.Context) ([]byte, error) {
+			atomic.AddInt32(&calls, 1)
+			time.Sleep(50 * time.Millisecond)
+			return []byte("v"), nil
+		}
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				b, err := kv.GetOrCompute(ctx, "hot", time.Minute, compute)
+				if err != nil || string(b) != "v" { t.Errorf("got %q, %v", b, err) }
+			}()
+		}
+		wg.Wait()
+		if calls != 1 { t.Fatalf("valkey=%v: compute ran %d times, want 1", valkey, calls) }
+	}
+}
+
+func Test_KV_GetOrCompute_Waits_For_Other_Instance(t *testing.T) {
+	initKV(t, true)
+	ctx := context.Background()
+	// Another instance holds the compute lock for "report".
+	release, ok, err := kv.Default().Lock(ctx, "lock:report", 5*time.Second)
+	if err != nil || !ok { t.Fatalf("lock: %v %v", ok, err) }
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		_ = kv.Set(ctx, "report", []byte("from-peer"), time.Minute)
+		release()
+	}()
+	b, err := kv.GetOrCompute(ctx, "report", time.Minute, func(context.Context) ([]byte, error) {
+		return []byte("local"), nil
+	})
+	if err != nil || string(b) != "from-peer" { t.Fatalf("want peer's value, got %q (%v)", b, err) }
+}
+
+func Test_KV_GetOrCompute_Survives_Canceled_Leader(t *testing.T) {
+	initKV(t, false)
+	started, finish := make(chan struct{}), make(chan struct{})
+	var calls int32
+	compute := func(ctx context.Context) ([]byte, error) {
+		atomic.AddInt32(&calls, 1)
+		close(started)
+		<-finish
+		if err := ctx.Err(); err != nil { return nil, err }
+		return []byte("v"), nil
+	}
+	leaderCtx, cancel := context.WithCancel(context.Background())
+	leader := make(chan error, 1)
+	go func() {
+		_, err := kv.GetOrCompute(leaderCtx, "shared", time.Minute, compute)
+		leader <- err
+	}()
+	<-started
+	waiter := make(chan []byte, 1)
+	go func() {
+		b, err := kv.GetOrCompute(context.Background(), "shared", time.Minute, compute)
+		if err != nil { t.Errorf("waiter: %v", err) }
+		waiter <- b
+	}()
+	time.Sleep(20 * time.Millisecond) // let the waiter join the flight
+	cancel()
+	close(finish)
+	if err := <-leader; !errors.Is(err, context.Canceled) { t.Fatalf("leader: want context.Canceled, got %v", err) }
+	if b := <-waiter; string(b) != "v" { t.Fatalf("waiter got %q after the leader went away", b) }
+	if calls != 1 { t.Fatalf("compute ran %d times, want 1", calls) }
+}
@@ -0,0 +1,84 @@
+package tests
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"gothicforge3/internal/server"
+)
+
+func Test_Run_Drains_InFlight_And_Runs_Hooks(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil { t.Fatalf("listen: %v", err) }
+
+	var mu sync.Mutex
+	var order []string
+	record := func(s string) { mu.Lock(); order = append(order, s); mu.Unlock() }
+	t.Cleanup(server.OnStart("test-start", func(context.Context) error { record("start"); return nil }))
+	t.Cleanup(server.OnShutdown("test-first", func(context.Context) error { record("first"); return nil }))
+	t.Cleanup(server.OnShutdown("test-second", func(context.Context) error { record("second"); return nil }))
+
+	started := make(chan struct{})
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(300 * time.Millisecond)
+		_, _ = w.Write([]byte("done"))
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	opts := server.DefaultOptions("")
+	opts.Listener = ln
+	opts.ShutdownTimeout = 5 * time.Second
+	runErr := make(chan error, 1)
+	go func() { runErr <- server.Run(ctx, h, opts) }()
+
+	type result struct { body string; err error }
+	res := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String() + "/")
+		if err != nil { res <- result{err: err}; return }
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		res <- result{body: string(b), err: err}
+	}()
+
+	<-started
+	cancel() // shutdown while the request is in flight
+
+	got := <-res
+	if got.err != nil || got.body != "done" {
+		t.Fatalf("in-flight request not drained: body=%q err=%v", got.body, got.err)
+	}
+	if err := <-runErr; err != nil {
+		t.Fatalf("run returned error: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"start", "second", "first"}
+	if len(order) != len(want) {
+		t.Fatalf("hooks order: want %v, got %v", want, order)
+	}
+	for i := range want {
+		if order[i] != want[i] { t.Fatalf("hooks order: want %v, got %v", want, order) }
+	}
+}
+
+func Test_Removed_Hooks_Do_Not_Run(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil { t.Fatalf("listen: %v", err) }
+	ran := make(chan string, 2)
+	server.OnStart("test-removed", func(context.Context) error { ran <- "start"; return nil })()
+	server.OnShutdown("test-removed", func(context.Context) error { ran <- "shutdown"; return nil })()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	opts := server.DefaultOptions("")
+	opts.Listener = ln
+	if err := server.Run(ctx, http.NotFoundHandler(), opts); err != nil { t.Fatalf("run: %v", err) }
+	if len(ran) != 0 { t.Fatalf("removed hook ran: %s", <-ran) }
+}
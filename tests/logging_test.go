@@ -0,0 +1,104 @@
+package tests
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"gothicforge3/internal/auth"
+	"gothicforge3/internal/config"
+	"gothicforge3/internal/logging"
+	"gothicforge3/internal/server"
+)
+
+// newLoggedRouter builds a server whose logs are captured as JSON lines.
+func newLoggedRouter(t *testing.T, env map[string]string) (*chi.Mux, *bytes.Buffer) {
+	t.Helper()
+	var buf bytes.Buffer
+	prev := logging.Output
+	logging.Output = &buf
+	t.Cleanup(func() { logging.Output = prev })
+	env["LOG_FORMAT"] = "json"
+	env["JWT_SECRET"] = "testsecret"
+	cfg, err := config.LoadFrom(lookupMap(env))
+	if err != nil { t.Fatalf("config: %v", err) }
+	r := server.New(cfg)
+	r.Get("/items/{id}", func(w http.ResponseWriter, req *http.Request) {
+		logging.FromContext(req.Context()).Info("item viewed", "authorization", req.Header.Get("Authorization"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+	r.Get("/boom", func(http.ResponseWriter, *http.Request) { panic("kaboom") })
+	return r, &buf
+}
+
+func logLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var out []map[string]any
+	sc := bufio.NewScanner(bytes.NewReader(buf.Bytes()))
+	for sc.Scan() {
+		var m map[string]any
+		if err := json.Unmarshal(sc.Bytes(), &m); err != nil { t.Fatalf("invalid JSON log line %q: %v", sc.Text(), err) }
+		out = append(out, m)
+	}
+	return out
+}
+
+func Test_Logging_Request_Scoped_JSON_With_Redaction(t *testing.T) {
+	r, buf := newLoggedRouter(t, map[string]string{"LOG_LEVEL": "debug"})
+	tok, _, err := auth.Issue(time.Minute, map[string]any{"sub": "user-7"})
+	if err != nil { t.Fatal(err) }
+	req := httptest.NewRequest(http.MethodGet, "/items/42", nil)
+	req.Header.Set("User-Agent", `evil "quoted" agent`)
+	req.Header.Set("Authorization", "Bearer "+tok)
+	req.Header.Set("Cookie", "session=supersecret")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	var app, access map[string]any
+	for _, m := range logLines(t, buf) {
+		switch m["msg"] {
+		case "item viewed":
+			app = m
+		case "request":
+			access = m
+		}
+	}
+	if app == nil || access == nil { t.Fatalf("missing log lines:\n%s", buf) }
+	for _, m := range []map[string]any{app, access} {
+		if m["route"] != "/items/{id}" || m["user"] != "user-7" || m["request_id"] == "" || m["ip"] == "" {
+			t.Fatalf("request attributes missing: %v", m)
+		}
+	}
+	if app["authorization"] != logging.Redacted { t.Fatalf("authorization not redacted: %v", app["authorization"]) }
+	if access["ua"] != `evil "quoted" agent` || access["status"] != float64(http.StatusNoContent) {
+		t.Fatalf("unexpected access line: %v", access)
+	}
+	if strings.Contains(buf.String(), "supersecret") || strings.Contains(buf.String(), tok) {
+		t.Fatalf("secrets leaked into logs:\n%s", buf)
+	}
+}
+
+func Test_Logging_Sampling_And_Panics(t *testing.T) {
+	r, buf := newLoggedRouter(t, map[string]string{"LOG_SAMPLE_RATE": "0"})
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/items/1", nil))
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/missing", nil))
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/boom", nil))
+	if rec.Code != http.StatusInternalServerError { t.Fatalf("panic: want 500, got %d", rec.Code) }
+
+	var statuses []float64
+	panicked := false
+	for _, m := range logLines(t, buf) {
+		if m["msg"] == "request" { statuses = append(statuses, m["status"].(float64)) }
+		if m["msg"] == "panic" && m["error"] == "kaboom" { panicked = true }
+	}
+	if len(statuses) != 2 || statuses[0] != 404 || statuses[1] != 500 {
+		t.Fatalf("successful requests should be sampled out, errors kept; got %v", statuses)
+	}
+	if !panicked { t.Fatalf("panic not logged:\n%s", buf) }
+}
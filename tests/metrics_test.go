@@ -0,0 +1,64 @@
+package tests
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"gothicforge3/internal/config"
+	"gothicforge3/internal/ratelimit"
+	"gothicforge3/internal/server"
+)
+
+func newMetricsRouter(t *testing.T, env map[string]string) *chi.Mux {
+	t.Helper()
+	env["LOG_FORMAT"] = "off"
+	cfg, err := config.LoadFrom(lookupMap(env))
+	if err != nil { t.Fatalf("config: %v", err) }
+	return server.New(cfg)
+}
+
+func scrape(t *testing.T, h http.Handler, token string) (int, string) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	if token != "" { req.Header.Set("Authorization", "Bearer "+token) }
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	b, _ := io.ReadAll(rec.Body)
+	return rec.Code, string(b)
+}
+
+func Test_Metrics_Route_Patterns_And_Token(t *testing.T) {
+	r := newMetricsRouter(t, map[string]string{"METRICS_ENABLE": "1", "METRICS_TOKEN": "s3cret", "RATE_LIMIT_POLICIES": "metrics-test=1/1m"})
+	r.With(ratelimit.Limit("metrics-test")).Get("/widgets/{id}", func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) })
+	for _, p := range []string{"/widgets/1", "/widgets/2", "/nope"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, p, nil))
+	}
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("MADEUP", "/nope", nil))
+
+	if code, _ := scrape(t, r, ""); code != http.StatusUnauthorized { t.Fatalf("no token: want 401, got %d", code) }
+	if code, _ := scrape(t, r, "wrong"); code != http.StatusUnauthorized { t.Fatalf("bad token: want 401, got %d", code) }
+	code, body := scrape(t, r, "s3cret")
+	if code != http.StatusOK { t.Fatalf("want 200, got %d", code) }
+	for _, want := range []string{
+		`http_requests_total{code="200",method="GET",route="/widgets/{id}"}`,
+		`http_requests_total{code="429",method="GET",route="/widgets/{id}"}`,
+		`http_requests_total{code="404",method="GET",route="unmatched"}`,
+		`http_request_duration_seconds_bucket{method="GET",route="/widgets/{id}"`,
+		`gforge_ratelimit_rejections_total{policy="metrics-test"} 1`,
+		`gforge_valkey_errors_total`,
+		`gforge_session_errors_total`,
+	} {
+		if !strings.Contains(body, want) { t.Fatalf("metrics missing %s\n%s", want, body) }
+	}
+	if strings.Contains(body, `route="/widgets/1"`) { t.Fatalf("raw paths must not be used as labels") }
+	if strings.Contains(body, `method="MADEUP"`) || !strings.Contains(body, `method="OTHER"`) { t.Fatalf("unknown methods must be labelled OTHER") }
+}
+
+func Test_Metrics_Disabled_By_Default(t *testing.T) {
+	r := newMetricsRouter(t, map[string]string{})
+	if code, _ := scrape(t, r, ""); code != http.StatusNotFound { t.Fatalf("want 404 when disabled, got %d", code) }
+}
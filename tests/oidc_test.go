@@ -0,0 +1,247 @@
+package tests
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"gothicforge3/internal/auth"
+	"gothicforge3/internal/config"
+)
+
+// mockIdP is a minimal OpenID provider: discovery, JWKS and a token endpoint that checks the
+// client secret and PKCE verifier and returns an ES256 ID token.
+type mockIdP struct {
+	*httptest.Server
+	key       jwk.Key
+	issuer    string // in the discovery document
+	tokenIss  string // "iss" of ID tokens
+	claims    map[string]any
+	mu        sync.Mutex
+	challenge string
+	nonce     string
+	tamper    func(tok jwt.Token) jwk.Key // may change claims or return another signing key
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+	raw, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	key, err := jwk.FromRaw(raw)
+	if err != nil { t.Fatalf("jwk: %v", err) }
+	_ = key.Set(jwk.KeyIDKey, "k1")
+	m := &mockIdP{key: key, claims: map[string]any{"sub": "user-1", "email": "ada@idp.example", "email_verified": true, "name": "Ada"}}
+	m.Server = httptest.NewServer(http.HandlerFunc(m.serve))
+	t.Cleanup(m.Close)
+	m.issuer, m.tokenIss = m.URL, m.URL
+	return m
+}
+
+func (m *mockIdP) serve(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/.well-known/openid-configuration"):
+		_ = json.NewEncoder(w).Encode(map[string]string{"issuer": m.issuer, "authorization_endpoint": m.URL + "/authorize", "token_endpoint": m.URL + "/token", "jwks_uri": m.URL + "/jwks"})
+	case r.URL.Path == "/jwks":
+		pub, _ := m.key.PublicKey()
+		set := jwk.NewSet()
+		_ = set.AddKey(pub)
+		_ = json.NewEncoder(w).Encode(set)
+	case r.URL.Path == "/token":
+		_ = r.ParseForm()
+		id, secret, ok := r.BasicAuth()
+		if !ok { id, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret") }
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		m.mu.Lock()
+		challenge, nonce := m.challenge, m.nonce
+		m.mu.Unlock()
+		if id != "gf-client" || secret != "shh" || r.PostForm.Get("code") != "good-code" || base64.RawURLEncoding.EncodeToString(sum[:]) != challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		tok := jwt.New()
+		for k, v := range m.claims { _ = tok.Set(k, v) }
+		_ = tok.Set(jwt.IssuerKey, m.tokenIss)
+		_ = tok.Set(jwt.AudienceKey, "gf-client")
+		_ = tok.Set(jwt.IssuedAtKey, time.Now())
+		_ = tok.Set(jwt.ExpirationKey, time.Now().Add(5*time.Minute))
+		_ = tok.Set("nonce", nonce)
+		key := m.key
+		if m.tamper != nil {
+			if k := m.tamper(tok); k != nil { key = k }
+		}
+		signed, err := jwt.Sign(tok, jwt.WithKey(jwa.ES256, key))
+		if err != nil { w.WriteHeader(http.StatusInternalServerError); return }
+		_ = json.NewEncoder(w).Encode(map[string]any{"access_token": "at", "token_type": "Bearer", "expires_in": 3600, "id_token": string(signed)})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// begin starts a sign-in with provider and records the PKCE challenge and nonce the mock will
+// be asked about; it returns the authorization request parameters.
+func (m *mockIdP) begin(t *testing.T, b *browser, provider, next string) url.Values {
+	t.Helper()
+	rec := b.do(httptest.NewRequest(http.MethodGet, "/auth/"+provider+"/login?next="+url.QueryEscape(next), nil))
+	if rec.Code != http.StatusFound { t.Fatalf("login: %d %s", rec.Code, rec.Body.String()) }
+	loc, _ := url.Parse(rec.Header().Get("Location"))
+	if !strings.HasPrefix(loc.String(), m.URL+"/authorize?") { t.Fatalf("authorize redirect: %s", loc) }
+	q := loc.Query()
+	m.mu.Lock()
+	m.challenge, m.nonce = q.Get("code_challenge"), q.Get("nonce")
+	m.mu.Unlock()
+	return q
+}
+
+func (m *mockIdP) callback(b *browser, provider, state string) *httptest.ResponseRecorder {
+	return b.do(httptest.NewRequest(http.MethodGet, "/auth/"+provider+"/callback?code=good-code&state="+url.QueryEscape(state), nil))
+}
+
+func newOIDCRouter(t *testing.T, m *mockIdP) *browser {
+	t.Helper()
+	r := newLimitedRouter(t, map[string]string{
+		"OIDC_ISSUER": m.URL, "OIDC_CLIENT_ID": "gf-client", "OIDC_CLIENT_SECRET": "shh", "OIDC_NAME": "Mock IdP",
+		"OAUTH_BASE_URL": "http://app.test/", "OAUTH_RATE_LIMIT": "100",
+	})
+	return newBrowser(t, r)
+}
+
+func Test_OIDC_Login_With_Mock_Provider(t *testing.T) {
+	m := newMockIdP(t)
+	b := newOIDCRouter(t, m)
+
+	page := b.get("/login?next=/dashboard").Body.String()
+	if !strings.Contains(page, "Sign in with Mock IdP") || !strings.Contains(page, `href="/auth/oidc/login?next=%2Fdashboard"`) { t.Fatalf("login page does not list the provider") }
+	if rec := b.do(httptest.NewRequest(http.MethodGet, "/auth/google/login", nil)); rec.Code != http.StatusNotFound { t.Fatalf("unconfigured provider: %d", rec.Code) }
+	if home := b.get("/").Body.String(); !strings.Contains(home, `<form method="post" action="/logout"`) || !strings.Contains(home, `name="csrf_token"`) { t.Fatalf("home page logout is not a CSRF-protected form") }
+
+	q := m.begin(t, b, "oidc", "/dashboard")
+	if q.Get("client_id") != "gf-client" || q.Get("redirect_uri") != "http://app.test/auth/oidc/callback" || q.Get("response_type") != "code" ||
+		!strings.Contains(q.Get("scope"), "openid") || q.Get("code_challenge_method") != "S256" || q.Get("state") == "" || q.Get("nonce") == "" {
+		t.Fatalf("authorization request: %v", q)
+	}
+	rec := m.callback(b, "oidc", q.Get("state"))
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/dashboard" { t.Fatalf("callback: %d %s", rec.Code, rec.Body.String()) }
+	c, err := auth.Verify(context.Background(), b.cookies[auth.CookieName].Value)
+	if err != nil { t.Fatalf("gf_jwt: %v", err) }
+	if c["sub"] != "oidc:user-1" || c["provider"] != "oidc" || c["email"] != "ada@idp.example" || c["email_verified"] != true || c["name"] != "Ada" { t.Fatalf("claims: %v", c) }
+	if _, ok := b.cookies[auth.RefreshCookieName]; !ok { t.Fatalf("no refresh cookie") }
+
+	// The state cookie is single-use.
+	if rec := m.callback(b, "oidc", q.Get("state")); rec.Code != http.StatusUnauthorized { t.Fatalf("replayed callback: %d", rec.Code) }
+}
+
+func Test_OIDC_Rejects_Bad_Callbacks_And_ID_Tokens(t *testing.T) {
+	m := newMockIdP(t)
+	b := newOIDCRouter(t, m)
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	forged, _ := jwk.FromRaw(other)
+	_ = forged.Set(jwk.KeyIDKey, "k1")
+
+	for name, tc := range map[string]struct {
+		tamper func(jwt.Token) jwk.Key
+		state  func(string) string
+		pkce   bool
+	}{
+		"state":     {state: func(string) string { return "forged" }},
+		"pkce":      {pkce: true},
+		"nonce":     {tamper: func(tok jwt.Token) jwk.Key { _ = tok.Set("nonce", "other"); return nil }},
+		"audience":  {tamper: func(tok jwt.Token) jwk.Key { _ = tok.Set(jwt.AudienceKey, "someone-else"); return nil }},
+		"issuer":    {tamper: func(tok jwt.Token) jwk.Key { _ = tok.Set(jwt.IssuerKey, "https://evil.example"); return nil }},
+		"expired":   {tamper: func(tok jwt.Token) jwk.Key { _ = tok.Set(jwt.ExpirationKey, time.Now().Add(-time.Hour)); return nil }},
+		"signature": {tamper: func(jwt.Token) jwk.Key { return forged }},
+	} {
+		m.tamper = tc.tamper
+		q := m.begin(t, b, "oidc", "/")
+		if tc.pkce {
+			m.mu.Lock()
+			m.challenge = "not-the-challenge"
+			m.mu.Unlock()
+		}
+		state := q.Get("state")
+		if tc.state != nil { state = tc.state(state) }
+		if rec := m.callback(b, "oidc", state); rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), "Sign in") { t.Fatalf("%s: want 401 login page, got %d", name, rec.Code) }
+		if _, ok := b.cookies[auth.CookieName]; ok { t.Fatalf("%s: signed in", name) }
+	}
+}
+
+func Test_OIDC_Multi_Tenant_Issuer(t *testing.T) {
+	m := newMockIdP(t)
+	b := newOIDCRouter(t, m)
+	m.issuer = m.URL + "/{tenantid}/v2.0"
+	m.tokenIss = m.URL + "/tid-1/v2.0"
+	m.claims["tid"] = "tid-1"
+	auth.RegisterProvider(&auth.Provider{Name: "microsoft", DisplayName: "Microsoft", ClientID: "gf-client", ClientSecret: "shh", Issuer: m.URL + "/common/v2.0"})
+	t.Cleanup(func() { auth.RegisterProvider(&auth.Provider{Name: "microsoft"}) }) // no credentials: disabled
+
+	q := m.begin(t, b, "microsoft", "/")
+	if rec := m.callback(b, "microsoft", q.Get("state")); rec.Code != http.StatusSeeOther { t.Fatalf("tenant issuer rejected: %d", rec.Code) }
+	if sub := b.subject(); sub != "microsoft:user-1" { t.Fatalf("sub: %q", sub) }
+
+	b.post("/logout", nil)
+	m.tokenIss = m.URL + "/tid-2/v2.0" // issuer must match the token's own tenant
+	q = m.begin(t, b, "microsoft", "/")
+	if rec := m.callback(b, "microsoft", q.Get("state")); rec.Code != http.StatusUnauthorized { t.Fatalf("foreign tenant issuer accepted: %d", rec.Code) }
+}
+
+func Test_OIDC_Tenant_Issuer_Only_For_Microsoft(t *testing.T) {
+	m := newMockIdP(t)
+	b := newOIDCRouter(t, m)
+	m.issuer = m.URL + "/{tenantid}/v2.0"
+	m.tokenIss = m.URL + "/tid-1/v2.0"
+	m.claims["tid"] = "tid-1"
+	auth.RegisterProvider(&auth.Provider{Name: "tenant", DisplayName: "Work account", ClientID: "gf-client", ClientSecret: "shh", Issuer: m.URL + "/common/v2.0"})
+	t.Cleanup(func() { auth.RegisterProvider(&auth.Provider{Name: "tenant"}) })
+
+	if rec := b.do(httptest.NewRequest(http.MethodGet, "/auth/tenant/login", nil)); rec.Code == http.StatusFound { t.Fatalf("discovery with a foreign {tenantid} issuer accepted") }
+	if b.subject() != "" { t.Fatalf("signed in") }
+}
+
+func Test_OAuth_Config_Problems(t *testing.T) {
+	for env, want := range map[string]string{
+		"GOOGLE_CLIENT_ID": "GOOGLE_CLIENT_SECRET",
+		"OIDC_CLIENT_ID":   "OIDC_ISSUER",
+	} {
+		_, err := config.LoadFrom(lookupMap(map[string]string{env: "x"}))
+		if err == nil || !strings.Contains(err.Error(), want) { t.Fatalf("%s alone: want %s problem, got %v", env, want, err) }
+	}
+}
+
+func Test_OAuth_Has_Its_Own_Rate_Limit(t *testing.T) {
+	m := newMockIdP(t)
+	b := newBrowser(t, newLimitedRouter(t, map[string]string{
+		"OIDC_ISSUER": m.URL, "OIDC_CLIENT_ID": "gf-client", "OIDC_CLIENT_SECRET": "shh",
+		"OAUTH_BASE_URL": "http://app.test/", "AUTH_RATE_LIMIT": "3", "OAUTH_RATE_LIMIT": "4",
+	}))
+	// Two social sign-ins (login + callback each) use up the "oauth" budget only.
+	for i := 0; i < 2; i++ {
+		q := m.begin(t, b, "oidc", "/")
+		if rec := m.callback(b, "oidc", q.Get("state")); rec.Code != http.StatusSeeOther { t.Fatalf("sign-in %d: %d", i, rec.Code) }
+	}
+	if rec := b.do(httptest.NewRequest(http.MethodGet, "/auth/oidc/login", nil)); rec.Code != http.StatusTooManyRequests { t.Fatalf("oauth over limit: %d", rec.Code) }
+	if rec := b.post("/login", url.Values{"email": {"nobody@example.com"}, "password": {"wrong"}}); rec.Code == http.StatusTooManyRequests { t.Fatalf("password login limited by OAuth traffic") }
+}
+
+func Test_OAuth_State_Cookie_Cleared_With_Set_Attributes(t *testing.T) {
+	initAuth(t, map[string]string{"APP_ENV": "production", "SITE_BASE_URL": "https://app.example", "JWT_SECRET": "prod-test-secret"})
+	p := &auth.Provider{Name: "probe", ClientID: "id", ClientSecret: "secret", Issuer: "https://idp.example"}
+	rec := httptest.NewRecorder()
+	if _, _, err := p.CompleteLogin(rec, httptest.NewRequest(http.MethodGet, "/auth/probe/callback?state=x", nil), "https://app.example/auth/probe/callback"); err != auth.ErrOAuthState { t.Fatalf("want ErrOAuthState, got %v", err) }
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 { t.Fatalf("want the gf_oauth cookie cleared, got %v", cookies) }
+	if c := cookies[0]; c.MaxAge >= 0 || !c.HttpOnly || !c.Secure || c.SameSite != http.SameSiteLaxMode || c.Path != "/auth/" { t.Fatalf("%+v", c) }
+}
@@ -0,0 +1,109 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-chi/chi/v5"
+	"gothicforge3/app/routes"
+	"gothicforge3/internal/auth"
+	"gothicforge3/internal/config"
+	"gothicforge3/internal/csrf"
+	"gothicforge3/internal/ratelimit"
+	"gothicforge3/internal/server"
+)
+
+func newLimitedRouter(t *testing.T, env map[string]string) *chi.Mux {
+	t.Helper()
+	env["LOG_FORMAT"] = "off"
+	cfg, err := config.LoadFrom(lookupMap(env))
+	if err != nil { t.Fatalf("config: %v", err) }
+	r := server.New(cfg)
+	routes.Register(r, cfg)
+	return r
+}
+
+func postCounter(r http.Handler, cookies []*http.Cookie, tok string, htmx bool) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/counter/sync", strings.NewReader("count=1"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set(csrf.HeaderName, tok)
+	if htmx { req.Header.Set("HX-Request", "true") }
+	for _, c := range cookies { req.AddCookie(c) }
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func Test_RateLimit_Default_Policy_Headers_And_429(t *testing.T) {
+	r := newLimitedRouter(t, map[string]string{"RATE_LIMIT_MAX": "2", "RATE_LIMIT_WINDOW_SECONDS": "60"})
+	cookies, tok := csrfSession(t, r)
+
+	rec := postCounter(r, cookies, tok, false)
+	if rec.Code != http.StatusOK { t.Fatalf("first: want 200, got %d", rec.Code) }
+	if rec.Header().Get("RateLimit-Limit") != "2" || rec.Header().Get("RateLimit-Remaining") != "1" {
+		t.Fatalf("unexpected RateLimit headers: %v", rec.Header())
+	}
+	if got := rec.Header().Get("RateLimit-Policy"); got != "2;w=60" { t.Fatalf("RateLimit-Policy: %q", got) }
+	_ = postCounter(r, cookies, tok, false)
+
+	rec = postCounter(r, cookies, tok, true)
+	if rec.Code != http.StatusTooManyRequests { t.Fatalf("third: want 429, got %d", rec.Code) }
+	if ra := rec.Header().Get("Retry-After"); ra == "" || ra == "0" { t.Fatalf("missing Retry-After: %q", ra) }
+	if rec.Header().Get("HX-Retarget") != "#flash" || !strings.Contains(rec.Body.String(), `role="alert"`) {
+		t.Fatalf("HTMX 429 should render an alert fragment into #flash; body=%q", rec.Body.String())
+	}
+
+	// Safe methods are not counted by the default policy.
+	get := httptest.NewRecorder()
+	r.ServeHTTP(get, httptest.NewRequest(http.MethodGet, "/", nil))
+	if get.Code != http.StatusOK { t.Fatalf("GET should not be limited, got %d", get.Code) }
+}
+
+func Test_RateLimit_Named_Policy_Per_Subject(t *testing.T) {
+	t.Setenv("JWT_SECRET", "testsecret")
+	r := newLimitedRouter(t, map[string]string{"JWT_SECRET": "testsecret", "RATE_LIMIT_POLICIES": "per-user=1/1m:sub"})
+	r.With(ratelimit.Limit("per-user")).Get("/api/quota", func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusNoContent) })
+
+	call := func(sub string) int {
+		tok, _, err := auth.Issue(time.Minute, map[string]any{"sub": sub})
+		if err != nil { t.Fatalf("issue: %v", err) }
+		req := httptest.NewRequest(http.MethodGet, "/api/quota", nil)
+		req.Header.Set("Authorization", "Bearer "+tok)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if c := call("alice"); c != http.StatusNoContent { t.Fatalf("alice #1: %d", c) }
+	if c := call("bob"); c != http.StatusNoContent { t.Fatalf("bob #1 should have its own bucket: %d", c) }
+	if c := call("alice"); c != http.StatusTooManyRequests { t.Fatalf("alice #2: want 429, got %d", c) }
+}
+
+func Test_RateLimit_Valkey_Shared_Across_Instances(t *testing.T) {
+	mr := miniredis.RunT(t)
+	env := map[string]string{"VALKEY_URL": "redis://" + mr.Addr(), "RATE_LIMIT_POLICIES": "api=2/1m:apikey"}
+	call := func(r http.Handler, key string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/ping", nil)
+		req.Header.Set("X-API-Key", key)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	ok := func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusNoContent) }
+	a := newLimitedRouter(t, env)
+	a.With(ratelimit.Limit("api")).Get("/api/ping", ok)
+	if c := call(a, "apikey-alpha"); c != http.StatusNoContent { t.Fatalf("instance a: %d", c) }
+
+	// A second instance (e.g. after a deploy) sees the same counter.
+	b := newLimitedRouter(t, env)
+	b.With(ratelimit.Limit("api")).Get("/api/ping", ok)
+	if c := call(b, "apikey-alpha"); c != http.StatusNoContent { t.Fatalf("instance b: %d", c) }
+	if c := call(b, "apikey-alpha"); c != http.StatusTooManyRequests { t.Fatalf("shared limit: want 429, got %d", c) }
+	if c := call(b, "apikey-beta"); c != http.StatusNoContent { t.Fatalf("other API key should not be limited: %d", c) }
+	for _, k := range mr.Keys() {
+		if strings.Contains(k, "apikey-alpha") { t.Fatalf("API key stored in clear: %s", k) }
+	}
+}
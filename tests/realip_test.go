@@ -0,0 +1,84 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gothicforge3/internal/config"
+	"gothicforge3/internal/realip"
+)
+
+func setupTrusted(t *testing.T, proxies string) {
+	t.Helper()
+	cfg, err := config.LoadFrom(lookupMap(map[string]string{"TRUSTED_PROXIES": proxies}))
+	if err != nil { t.Fatalf("config: %v", err) }
+	if err := realip.Setup(cfg); err != nil { t.Fatalf("setup: %v", err) }
+	t.Cleanup(func() { _ = realip.Setup(mustConfig(t)) })
+}
+
+func Test_RealIP_Resolve(t *testing.T) {
+	setupTrusted(t, "10.0.0.0/8, loopback, cloudflare")
+	for _, tc := range []struct {
+		name, peer string
+		hdr        map[string]string
+		ip, scheme string
+	}{
+		{"untrusted peer ignores headers", "203.0.113.9:5000", map[string]string{"X-Forwarded-For": "1.2.3.4", "X-Forwarded-Proto": "https"}, "203.0.113.9", "http"},
+		{"rightmost untrusted hop wins", "10.0.0.5:5000", map[string]string{"X-Forwarded-For": "1.2.3.4, 198.51.100.7, 10.0.0.2", "X-Forwarded-Proto": "https"}, "198.51.100.7", "https"},
+		{"all hops trusted", "10.0.0.5:5000", map[string]string{"X-Forwarded-For": "10.1.1.1, 127.0.0.1"}, "10.1.1.1", "http"},
+		{"X-Real-IP fallback", "127.0.0.1:5000", map[string]string{"X-Real-IP": "198.51.100.8"}, "198.51.100.8", "http"},
+		{"Forwarded", "10.0.0.5:5000", map[string]string{"Forwarded": `for=192.0.2.60;proto=http, for="[2001:db8::1]:4711";proto=https;by=10.0.0.5`}, "2001:db8::1", "https"},
+		{"Forwarded wins over X-Forwarded-For", "10.0.0.5:5000", map[string]string{"Forwarded": "for=192.0.2.61", "X-Forwarded-For": "192.0.2.62"}, "192.0.2.61", "http"},
+		{"cloudflare preset", "173.245.48.10:443", map[string]string{"X-Forwarded-For": "198.51.100.9", "X-Forwarded-Proto": "https"}, "198.51.100.9", "https"},
+		{"unparseable hop keeps peer", "10.0.0.5:5000", map[string]string{"Forwarded": "for=unknown"}, "10.0.0.5", "http"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = tc.peer
+		for k, v := range tc.hdr { req.Header.Set(k, v) }
+		info := realip.Resolve(req)
+		if info.IP != tc.ip || info.Scheme != tc.scheme { t.Fatalf("%s: got %+v, want %s %s", tc.name, info, tc.ip, tc.scheme) }
+	}
+
+	if _, err := realip.ParseTrusted([]string{"10.0.0.0/8", "not-a-proxy"}); err == nil || !strings.Contains(err.Error(), "not-a-proxy") { t.Fatalf("want parse error, got %v", err) }
+}
+
+// A client cannot evade the per-IP limit by sending X-Forwarded-For, unless its peer is a trusted proxy.
+func Test_RealIP_RateLimit_Ignores_Spoofed_Headers(t *testing.T) {
+	for _, tc := range []struct {
+		proxies string
+		second  int
+	}{{"", http.StatusTooManyRequests}, {"192.0.2.0/24", http.StatusOK}} {
+		r := newLimitedRouter(t, map[string]string{"RATE_LIMIT_MAX": "1", "RATE_LIMIT_WINDOW_SECONDS": "60", "TRUSTED_PROXIES": tc.proxies})
+		cookies, tok := csrfSession(t, r)
+		var codes []int
+		for _, ip := range []string{"198.51.100.1", "198.51.100.2"} {
+			req := httptest.NewRequest(http.MethodPost, "/counter/sync", strings.NewReader("count=1"))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.Header.Set("X-CSRF-Token", tok)
+			req.Header.Set("X-Forwarded-For", ip)
+			for _, c := range cookies { req.AddCookie(c) }
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			codes = append(codes, rec.Code)
+		}
+		if codes[0] != http.StatusOK || codes[1] != tc.second { t.Fatalf("TRUSTED_PROXIES=%q: codes %v", tc.proxies, codes) }
+	}
+	_ = realip.Setup(mustConfig(t))
+}
+
+// Absolute URLs use the client's scheme only when a trusted proxy reports it.
+func Test_RealIP_Scheme_In_Absolute_URLs(t *testing.T) {
+	for _, tc := range []struct {
+		proxies, want string
+	}{{"", "Canonical: http://example.com/"}, {"192.0.2.0/24", "Canonical: https://example.com/"}} {
+		r := newLimitedRouter(t, map[string]string{"TRUSTED_PROXIES": tc.proxies, "SECURITY_CONTACT": "security@example.com"})
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/.well-known/security.txt", nil)
+		req.Header.Set("X-Forwarded-Proto", "https")
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if !strings.Contains(rec.Body.String(), tc.want) { t.Fatalf("TRUSTED_PROXIES=%q: want %q in %q", tc.proxies, tc.want, rec.Body.String()) }
+	}
+	_ = realip.Setup(mustConfig(t))
+}
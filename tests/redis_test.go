@@ -16,7 +16,7 @@ func Test_Sessions_Default_Memory_RoundTrip(t *testing.T) {
 	_ = os.Unsetenv("VALKEY_URL")
 	_ = os.Unsetenv("REDIS_URL")
 
-	r := server.New()
+	r := server.New(mustConfig(t))
 	// write sets a value into the session
 	r.Get("/_session/write", func(w http.ResponseWriter, r *http.Request) {
 		server.Sessions().Put(r.Context(), "k", "v")
@@ -52,7 +52,7 @@ func Test_Sessions_Redis_Configured_Sets_RedisStore(t *testing.T) {
 	_ = os.Setenv("LOG_FORMAT", "off")
 	_ = os.Setenv("VALKEY_URL", "redis://localhost:6379") // don't need actual server; just check store type
 
-	_ = server.New()
+	_ = server.New(mustConfig(t))
 	if server.Sessions() == nil || server.Sessions().Store == nil {
 		t.Skip("session store not initialized; skipping")
 		return
@@ -0,0 +1,230 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"gothicforge3/app"
+	"gothicforge3/internal/accounts"
+	"gothicforge3/internal/auth"
+	"gothicforge3/internal/config"
+	"gothicforge3/internal/logging"
+	"gothicforge3/internal/ratelimit"
+	"gothicforge3/internal/server"
+)
+
+// staleStore reports every earlier refresh token use as a minute old, past the reuse leeway.
+type staleStore struct{ *auth.MemorySessionStore }
+
+func (s staleStore) UseRefreshToken(ctx context.Context, hash []byte, now time.Time) (string, *time.Time, error) {
+	sid, used, err := s.MemorySessionStore.UseRefreshToken(ctx, hash, now)
+	if used != nil {
+		old := used.Add(-time.Minute)
+		used = &old
+	}
+	return sid, used, err
+}
+
+// lookupCountingStore counts session lookups (one per access token verification).
+type lookupCountingStore struct {
+	*auth.MemorySessionStore
+	lookups int
+}
+
+func (s *lookupCountingStore) Session(ctx context.Context, sid string) (*auth.Session, error) {
+	s.lookups++
+	return s.MemorySessionStore.Session(ctx, sid)
+}
+
+func Test_Session_Checked_Once_Per_Request(t *testing.T) {
+	var buf bytes.Buffer
+	prev := logging.Output
+	logging.Output = &buf
+	t.Cleanup(func() { logging.Output = prev })
+	cfg, err := config.LoadFrom(lookupMap(map[string]string{"LOG_FORMAT": "json", "RATE_LIMIT_POLICIES": "memo-test=100/1m:sub"}))
+	if err != nil { t.Fatalf("config: %v", err) }
+	r := server.New(cfg)
+	t.Cleanup(func() { logging.Setup(mustConfig(t)) })
+	r.With(ratelimit.Limit("memo-test"), auth.RequireAuth).Get("/memo", func(w http.ResponseWriter, req *http.Request) {
+		logging.FromContext(req.Context()).Info("handler", "subject", auth.Subject(req))
+	})
+	st := &lookupCountingStore{MemorySessionStore: auth.NewMemorySessionStore()}
+	auth.SetSessionStore(st)
+	tok, err := auth.StartSession(context.Background(), map[string]any{"sub": "42"})
+	if err != nil { t.Fatalf("start: %v", err) }
+
+	req := httptest.NewRequest(http.MethodGet, "/memo", nil)
+	req.AddCookie(&http.Cookie{Name: auth.CookieName, Value: tok.Access})
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK { t.Fatalf("memo: %d", rec.Code) }
+	if st.lookups != 1 { t.Fatalf("want 1 session lookup per request (logging, rate limit, RequireAuth, handler), got %d", st.lookups) }
+	if !strings.Contains(buf.String(), `"user":"42"`) { t.Fatalf("request log lacks the user:\n%s", buf.String()) }
+}
+
+func Test_Refresh_Rotates_And_Reuse_Revokes_Family(t *testing.T) {
+	initAuth(t, map[string]string{"JWT_SECRET": "s", "AUTH_SESSION_STORE": "memory", "JWT_ACCESS_TTL_SECONDS": "60"})
+	ctx := context.Background()
+	first, err := auth.StartSession(ctx, map[string]any{"sub": 7, "email": "ada@example.com"})
+	if err != nil { t.Fatalf("start: %v", err) }
+	if time.Until(first.AccessExpires) > time.Minute { t.Fatalf("access token outlives JWT_ACCESS_TTL_SECONDS: %v", first.AccessExpires) }
+	c, err := auth.Verify(ctx, first.Access)
+	if err != nil || c["sub"] != "7" || c["sid"] != first.SessionID { t.Fatalf("access claims: %v %v", c, err) }
+
+	second, err := auth.Refresh(ctx, first.Refresh)
+	if err != nil || second.Refresh == "" || second.Refresh == first.Refresh { t.Fatalf("rotate: %+v %v", second, err) }
+	// A parallel request presenting the same token right away gets an access token only.
+	raced, err := auth.Refresh(ctx, first.Refresh)
+	if err != nil || raced.Refresh != "" || raced.Access == "" { t.Fatalf("parallel refresh: %+v %v", raced, err) }
+
+	auth.SetSessionStore(staleStore{auth.NewMemorySessionStore()})
+	ts, err := auth.StartSession(ctx, map[string]any{"sub": "8"})
+	if err != nil { t.Fatalf("start: %v", err) }
+	next, err := auth.Refresh(ctx, ts.Refresh)
+	if err != nil { t.Fatalf("rotate: %v", err) }
+	if _, err := auth.Refresh(ctx, ts.Refresh); !errors.Is(err, auth.ErrRefreshReused) { t.Fatalf("reuse: want ErrRefreshReused, got %v", err) }
+	if _, err := auth.Refresh(ctx, next.Refresh); !errors.Is(err, auth.ErrRefreshInvalid) { t.Fatalf("family not revoked: %v", err) }
+	if _, err := auth.Verify(ctx, next.Access); !errors.Is(err, auth.ErrSessionRevoked) { t.Fatalf("access token of revoked family accepted: %v", err) }
+	if _, err := auth.Refresh(ctx, "not-a-token"); !errors.Is(err, auth.ErrRefreshInvalid) { t.Fatalf("garbage: %v", err) }
+}
+
+func Test_Refresh_Middleware_Renews_Expired_Access_Cookie(t *testing.T) {
+	r, _ := newAccountsRouter(t, map[string]string{})
+	b := newBrowser(t, r)
+	b.post("/signup", url.Values{"email": {"kay@example.com"}, "password": {"pass-phrase"}})
+	old, ok := b.cookies[auth.RefreshCookieName]
+	if !ok || !old.HttpOnly { t.Fatalf("gf_refresh not set: %v", b.cookies) }
+
+	delete(b.cookies, auth.CookieName) // the browser dropped the expired access cookie
+	if rec := b.get("/account"); rec.Code != http.StatusOK { t.Fatalf("account with refresh cookie only: %d", rec.Code) }
+	if b.subject() == "" || b.cookies[auth.RefreshCookieName].Value == old.Value { t.Fatalf("cookies not renewed") }
+
+	// Signing out changes state: a cross-site <img src=/auth/logout> must not do it.
+	if rec := b.get("/auth/logout"); rec.Code == http.StatusFound || b.subject() == "" { t.Fatalf("GET /auth/logout signed out: %d", rec.Code) }
+	if rec := b.post("/logout", nil); rec.Code != http.StatusSeeOther { t.Fatalf("logout: %d", rec.Code) }
+	b.cookies[auth.RefreshCookieName] = old // replay a token after sign-out
+	if rec := b.get("/account"); rec.Code != http.StatusSeeOther { t.Fatalf("revoked refresh token accepted: %d", rec.Code) }
+	if _, ok := b.cookies[auth.RefreshCookieName]; ok { t.Fatalf("dead refresh cookie not cleared") }
+}
+
+func Test_Refresh_Endpoint_For_API_Clients(t *testing.T) {
+	r := newLimitedRouter(t, map[string]string{})
+	tok, err := auth.StartSession(context.Background(), map[string]any{"sub": "9"})
+	if err != nil { t.Fatalf("start: %v", err) }
+	post := func(refresh string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, auth.RefreshPath, strings.NewReader(`{"refresh_token":"`+refresh+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+	rec := post(tok.Refresh)
+	var got struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); rec.Code != http.StatusOK || err != nil { t.Fatalf("refresh: %d %s", rec.Code, rec.Body.String()) }
+	if got.RefreshToken == "" || got.RefreshToken == tok.Refresh || got.ExpiresIn <= 0 || got.ExpiresIn > 900 { t.Fatalf("response: %+v", got) }
+
+	req := httptest.NewRequest(http.MethodGet, "/api/me", nil)
+	req.Header.Set("Authorization", "Bearer "+got.AccessToken)
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK { t.Fatalf("new access token: %d", rec.Code) }
+
+	if rec := post("unknown.token"); rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), "invalid_grant") { t.Fatalf("bad token: %d %s", rec.Code, rec.Body.String()) }
+}
+
+func Test_Logout_Everywhere_Revokes_Other_Devices(t *testing.T) {
+	r, mail := newAccountsRouter(t, map[string]string{})
+	laptop := newBrowser(t, r)
+	laptop.post("/signup", url.Values{"email": {"max@example.com"}, "password": {"pass-phrase"}})
+	phone := newBrowser(t, r)
+	phone.post("/login", url.Values{"email": {"max@example.com"}, "password": {"pass-phrase"}})
+	stolen := phone.cookies[auth.CookieName].Value
+
+	if rec := laptop.post("/auth/logout/all", nil); rec.Code != http.StatusSeeOther || laptop.subject() != "" { t.Fatalf("logout everywhere: %d", rec.Code) }
+	if rec := phone.get("/account"); rec.Code != http.StatusSeeOther { t.Fatalf("other device still signed in: %d", rec.Code) }
+	if _, err := auth.Verify(context.Background(), stolen); !errors.Is(err, auth.ErrSessionRevoked) { t.Fatalf("revoked access token accepted: %v", err) }
+
+	// API clients sign out everywhere with a bearer token alone; no session, no CSRF token.
+	api, err := auth.StartSession(context.Background(), map[string]any{"sub": "api-1"})
+	if err != nil { t.Fatalf("start: %v", err) }
+	other, _ := auth.StartSession(context.Background(), map[string]any{"sub": "api-1"})
+	req := httptest.NewRequest(http.MethodPost, auth.LogoutAllPath, nil)
+	req.Header.Set("Authorization", "Bearer "+api.Access)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent { t.Fatalf("bearer logout everywhere: %d %s", rec.Code, rec.Body.String()) }
+	if _, err := auth.Verify(context.Background(), other.Access); !errors.Is(err, auth.ErrSessionRevoked) { t.Fatalf("bearer logout everywhere left a session: %v", err) }
+
+	// A password reset signs out every other device too.
+	laptop.post("/login", url.Values{"email": {"max@example.com"}, "password": {"pass-phrase"}})
+	phone.post("/login", url.Values{"email": {"max@example.com"}, "password": {"pass-phrase"}})
+	laptop.post("/password/forgot", url.Values{"email": {"max@example.com"}})
+	_, tok := mail.lastLink(t)
+	if rec := laptop.post("/password/reset", url.Values{"token": {tok}, "password": {"new-pass-phrase"}}); rec.Code != http.StatusSeeOther || laptop.subject() == "" { t.Fatalf("reset: %d", rec.Code) }
+	if rec := phone.get("/account"); rec.Code != http.StatusSeeOther { t.Fatalf("device survived password reset: %d", rec.Code) }
+}
+
+func Test_Session_Stores_Memory_And_Valkey(t *testing.T) {
+	for _, valkey := range []bool{false, true} {
+		name := map[bool]string{false: "memory", true: "valkey"}[valkey]
+		t.Run(name, func(t *testing.T) {
+			initAuth(t, map[string]string{"JWT_SECRET": "s"})
+			initKV(t, valkey)
+			auth.SetSessionStore(map[bool]auth.SessionStore{false: auth.NewMemorySessionStore(), true: auth.ValkeySessionStore{}}[valkey])
+			ctx := context.Background()
+			a, err := auth.StartSession(ctx, map[string]any{"sub": "u1", "email": "u1@example.com"})
+			if err != nil { t.Fatalf("start: %v", err) }
+			b, err := auth.StartSession(ctx, map[string]any{"sub": "u1"})
+			if err != nil { t.Fatalf("start: %v", err) }
+			next, err := auth.Refresh(ctx, a.Refresh)
+			if err != nil || next.Refresh == "" { t.Fatalf("rotate: %+v %v", next, err) }
+			c, err := auth.Verify(ctx, next.Access)
+			if err != nil || c["email"] != "u1@example.com" || c["sid"] != a.SessionID { t.Fatalf("claims: %v %v", c, err) }
+			if raced, err := auth.Refresh(ctx, a.Refresh); err != nil || raced.Refresh != "" { t.Fatalf("parallel refresh: %+v %v", raced, err) }
+
+			if err := auth.RevokeSession(ctx, b.SessionID); err != nil { t.Fatalf("revoke: %v", err) }
+			if _, err := auth.Verify(ctx, b.Access); !errors.Is(err, auth.ErrSessionRevoked) { t.Fatalf("revoked session accepted: %v", err) }
+			if _, err := auth.Verify(ctx, next.Access); err != nil { t.Fatalf("other session affected: %v", err) }
+			if err := auth.RevokeAll(ctx, "u1"); err != nil { t.Fatalf("revoke all: %v", err) }
+			if _, err := auth.Refresh(ctx, next.Refresh); !errors.Is(err, auth.ErrRefreshInvalid) { t.Fatalf("refresh after revoke all: %v", err) }
+		})
+	}
+}
+
+func Test_Clear_Session_Cookies_Match_Set_Attributes(t *testing.T) {
+	initAuth(t, map[string]string{"APP_ENV": "production", "SITE_BASE_URL": "https://app.example", "JWT_SECRET": "prod-test-secret"})
+	rec := httptest.NewRecorder()
+	auth.ClearSessionCookies(rec)
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 2 { t.Fatalf("want 2 cookies, got %d", len(cookies)) }
+	for _, c := range cookies {
+		if c.MaxAge >= 0 || !c.HttpOnly || !c.Secure || c.SameSite != http.SameSiteLaxMode || c.Path != "/" { t.Fatalf("%s: %+v", c.Name, c) }
+	}
+}
+
+// The scaffold consts must stay identical to the migrations embedded in the app.
+func Test_Scaffold_Migrations_Match_Embedded(t *testing.T) {
+	for suffix, want := range map[string]string{
+		"_create_users.sql":         accounts.MigrationSQL,
+		"_create_auth_sessions.sql": auth.SessionsMigrationSQL,
+	} {
+		names, _ := fs.Glob(app.Migrations(), "*"+suffix)
+		if len(names) != 1 { t.Fatalf("%s: want 1 migration, got %v", suffix, names) }
+		got, err := fs.ReadFile(app.Migrations(), names[0])
+		if err != nil { t.Fatalf("read %s: %v", names[0], err) }
+		if string(got) != want { t.Fatalf("%s differs from the const that `gforge add auth` writes", names[0]) }
+	}
+}
@@ -0,0 +1,101 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gothicforge3/app/routes"
+	"gothicforge3/internal/config"
+	"gothicforge3/internal/reports"
+	"gothicforge3/internal/server"
+)
+
+func Test_Reports_Collector_Dedupes_To_File(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "reports.jsonl")
+	cfg, err := config.LoadFrom(lookupMap(map[string]string{
+		"LOG_FORMAT":    "off",
+		"REPORTS_STORE": "file",
+		"REPORTS_FILE":  file,
+	}))
+	if err != nil { t.Fatalf("config: %v", err) }
+	r := server.New(cfg)
+	routes.Register(r, cfg)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if csp := rec.Header().Get("Content-Security-Policy"); !strings.Contains(csp, "report-uri "+reports.Path) || !strings.Contains(csp, "report-to ") {
+		t.Fatalf("CSP lacks reporting directives: %q", csp)
+	}
+
+	legacy := `{"csp-report":{"document-uri":"http://x/","blocked-uri":"https://evil.example/a.js","effective-directive":"script-src-elem"}}`
+	api := `[{"type":"csp-violation","url":"http://x/about","body":{"documentURL":"http://x/about","blockedURL":"inline","effectiveDirective":"script-src-elem"}}]`
+	for _, body := range []string{legacy, legacy, api} {
+		req := httptest.NewRequest(http.MethodPost, reports.Path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/csp-report")
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if rec.Code != http.StatusNoContent { t.Fatalf("collector want 204, got %d", rec.Code) }
+	}
+
+	list, err := reports.ReadFile(file, time.Time{})
+	if err != nil { t.Fatalf("read: %v", err) }
+	if len(list) != 2 { t.Fatalf("duplicate should be suppressed; stored %d", len(list)) }
+	sums := reports.Summarize(list)
+	if len(sums) != 2 || sums[0].Directive != "script-src-elem" {
+		t.Fatalf("unexpected summary: %+v", sums)
+	}
+}
+
+type countingStore struct{ saved []reports.Violation }
+
+func (s *countingStore) Save(_ context.Context, list []reports.Violation) error {
+	s.saved = append(s.saved, list...)
+	return nil
+}
+
+func Test_Reports_Dedupe_Memory_Is_Bounded(t *testing.T) {
+	store := &countingStore{}
+	h := reports.Handler(store, time.Hour)
+	post := func(from, to int) {
+		var items []string
+		for i := from; i < to; i++ {
+			items = append(items, fmt.Sprintf(`{"type":"csp-violation","url":"http://x/","body":{"blockedURL":"https://e.example/%d.js","effectiveDirective":"script-src-elem"}}`, i))
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, reports.Path, strings.NewReader("["+strings.Join(items, ",")+"]")))
+		if rec.Code != http.StatusNoContent { t.Fatalf("collector want 204, got %d", rec.Code) }
+	}
+	post(0, 1)
+	post(0, 1)
+	if len(store.saved) != 1 { t.Fatalf("duplicate inside the window stored: %d", len(store.saved)) }
+	// Enough distinct reports inside one window to push the first one out of the deduper.
+	for i := 1; i <= 10000; i += 250 { post(i, i+250) }
+	post(0, 1)
+	if last := store.saved[len(store.saved)-1]; len(store.saved) != 10002 || last.BlockedURI != "https://e.example/0.js" {
+		t.Fatalf("oldest entry not evicted at the cap: %d stored, last %+v", len(store.saved), last)
+	}
+}
+
+func Test_SecurityTxt_From_Config(t *testing.T) {
+	cfg, err := config.LoadFrom(lookupMap(map[string]string{
+		"LOG_FORMAT":       "off",
+		"SITE_BASE_URL":    "https://example.com",
+		"SECURITY_CONTACT": "security@example.com",
+	}))
+	if err != nil { t.Fatalf("config: %v", err) }
+	r := server.New(cfg)
+	routes.Register(r, cfg)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/security.txt", nil))
+	if rec.Code != http.StatusOK { t.Fatalf("want 200, got %d", rec.Code) }
+	body := rec.Body.String()
+	for _, want := range []string{"Contact: mailto:security@example.com", "Expires: ", "Canonical: https://example.com/.well-known/security.txt"} {
+		if !strings.Contains(body, want) { t.Fatalf("security.txt missing %q:\n%s", want, body) }
+	}
+}
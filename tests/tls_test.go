@@ -0,0 +1,187 @@
+package tests
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+	"gothicforge3/internal/config"
+	"gothicforge3/internal/server"
+)
+
+// writeSelfSigned writes a certificate for 127.0.0.1/localhost and its key; it returns the paths
+// and a pool trusting the certificate.
+func writeSelfSigned(t *testing.T) (string, string, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil { t.Fatal(err) }
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil { t.Fatal(err) }
+	kb, err := x509.MarshalECPrivateKey(key)
+	if err != nil { t.Fatal(err) }
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil { t.Fatal(err) }
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kb}), 0o600); err != nil { t.Fatal(err) }
+	cert, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return certFile, keyFile, pool
+}
+
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil { t.Fatal(err) }
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+// Certificate files: HTTPS with HTTP/2, HSTS, and a plain listener redirecting to HTTPS.
+func Test_TLS_Files_HTTP2_HSTS_And_Redirect(t *testing.T) {
+	certFile, keyFile, pool := writeSelfSigned(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil { t.Fatal(err) }
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	redirectAddr := freeAddr(t)
+	cfg, err := config.LoadFrom(lookupMap(map[string]string{
+		"LOG_FORMAT":              "off",
+		"HTTP_PORT":               port,
+		"TLS_CERT_FILE":           certFile,
+		"TLS_KEY_FILE":            keyFile,
+		"HTTP_REDIRECT_ADDR":      redirectAddr,
+		"HSTS_INCLUDE_SUBDOMAINS": "1",
+	}))
+	if err != nil { t.Fatalf("config: %v", err) }
+	r := server.New(cfg)
+	r.Get("/t/proto", func(w http.ResponseWriter, req *http.Request) { io.WriteString(w, req.Proto) })
+	tlsConf, redirect, err := server.TLS(cfg)
+	if err != nil || tlsConf == nil || redirect == nil { t.Fatalf("TLS: %v", err) }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	opts := server.DefaultOptions("")
+	opts.Listener, opts.ShutdownTimeout = ln, 5*time.Second
+	opts.TLSConfig, opts.RedirectAddr, opts.RedirectHandler = tlsConf, redirectAddr, redirect
+	runErr := make(chan error, 1)
+	go func() { runErr <- server.Run(ctx, r, opts) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-runErr; err != nil { t.Errorf("run: %v", err) }
+	})
+
+	client := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}, ForceAttemptHTTP2: true},
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		Timeout:       5 * time.Second,
+	}
+	var resp *http.Response
+	for i := 0; i < 50; i++ {
+		if resp, err = client.Get("https://127.0.0.1:" + port + "/t/proto"); err == nil { break }
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil { t.Fatalf("https: %v", err) }
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.ProtoMajor != 2 || string(body) != "HTTP/2.0" { t.Fatalf("want HTTP/2, got %s (%q)", resp.Proto, body) }
+	if hsts := resp.Header.Get("Strict-Transport-Security"); hsts != "max-age=31536000; includeSubDomains" { t.Fatalf("HSTS %q", hsts) }
+
+	resp, err = client.Get("http://" + redirectAddr + "/db/posts?page=2")
+	if err != nil { t.Fatalf("redirect listener: %v", err) }
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMovedPermanently { t.Fatalf("want 301, got %d", resp.StatusCode) }
+	if loc := resp.Header.Get("Location"); loc != "https://127.0.0.1:"+port+"/db/posts?page=2" { t.Fatalf("Location %q", loc) }
+	if resp.Header.Get("Strict-Transport-Security") != "" { t.Fatalf("HSTS sent over plain HTTP") }
+}
+
+func Test_TLS_Redirect_Methods_And_Default_Port(t *testing.T) {
+	h := server.RedirectHTTPS("0.0.0.0:443")
+	for method, want := range map[string]int{http.MethodGet: http.StatusMovedPermanently, http.MethodPost: http.StatusPermanentRedirect} {
+		req, _ := http.NewRequest(method, "http://example.com:80/a?b=c", nil)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != want || rec.Header().Get("Location") != "https://example.com/a?b=c" { t.Fatalf("%s: %d %q", method, rec.Code, rec.Header().Get("Location")) }
+	}
+}
+
+func Test_TLS_Config_Problems(t *testing.T) {
+	for _, tc := range []struct {
+		env  map[string]string
+		want string
+	}{
+		{map[string]string{"TLS_CERT_FILE": "c.pem"}, "set both or neither"},
+		{map[string]string{"HTTP_REDIRECT_ADDR": ":80"}, "HTTP_REDIRECT_ADDR"},
+		{map[string]string{"ACME_DOMAINS": "example.com", "ACME_CACHE": "valkey"}, "ACME_CACHE"},
+		{map[string]string{"ACME_DOMAINS": "example.com", "TLS_CERT_FILE": "c.pem", "TLS_KEY_FILE": "k.pem"}, "cannot be combined"},
+	} {
+		_, err := config.LoadFrom(lookupMap(tc.env))
+		if err == nil || !strings.Contains(err.Error(), tc.want) { t.Fatalf("%v: want %q, got %v", tc.env, tc.want, err) }
+	}
+	cfg, err := config.LoadFrom(lookupMap(map[string]string{"ACME_DOMAINS": "example.com", "ACME_CACHE_DIR": t.TempDir()}))
+	if err != nil { t.Fatalf("config: %v", err) }
+	if cfg.TLSMode() != "acme" { t.Fatalf("mode %q", cfg.TLSMode()) }
+	tc, redirect, err := server.TLS(cfg)
+	if err != nil || tc == nil || redirect == nil { t.Fatalf("acme TLS: %v", err) }
+	if !strings.Contains(strings.Join(tc.NextProtos, ","), "acme-tls/1") { t.Fatalf("NextProtos %v", tc.NextProtos) }
+}
+
+// ACME certificates can be cached in Valkey so every instance shares them.
+func Test_TLS_KV_Cert_Cache(t *testing.T) {
+	initKV(t, true)
+	ctx := context.Background()
+	var c autocert.Cache = server.KVCertCache{}
+	if _, err := c.Get(ctx, "example.com"); !errors.Is(err, autocert.ErrCacheMiss) { t.Fatalf("want ErrCacheMiss, got %v", err) }
+	if err := c.Put(ctx, "example.com", []byte("pem")); err != nil { t.Fatalf("put: %v", err) }
+	if b, err := c.Get(ctx, "example.com"); err != nil || string(b) != "pem" { t.Fatalf("get: %q %v", b, err) }
+	if err := c.Delete(ctx, "example.com"); err != nil { t.Fatalf("delete: %v", err) }
+	if _, err := c.Get(ctx, "example.com"); !errors.Is(err, autocert.ErrCacheMiss) { t.Fatalf("after delete: %v", err) }
+}
+
+// Against a local Pebble (https://github.com/letsencrypt/pebble) started with
+// PEBBLE_VA_ALWAYS_VALID=1:
+//
+//	PEBBLE_DIRECTORY_URL=https://localhost:14000/dir PEBBLE_CA_FILE=test/certs/pebble.minica.pem go test ./tests -run Pebble
+func Test_TLS_ACME_Pebble(t *testing.T) {
+	dir := os.Getenv("PEBBLE_DIRECTORY_URL")
+	if dir == "" { t.Skip("PEBBLE_DIRECTORY_URL not set") }
+	cacheDir := t.TempDir()
+	cfg, err := config.LoadFrom(lookupMap(map[string]string{
+		"ACME_DOMAINS":       "localhost",
+		"ACME_DIRECTORY_URL": dir,
+		"ACME_CA_FILE":       os.Getenv("PEBBLE_CA_FILE"),
+		"ACME_CACHE_DIR":     cacheDir,
+	}))
+	if err != nil { t.Fatalf("config: %v", err) }
+	tc, _, err := server.TLS(cfg)
+	if err != nil { t.Fatalf("TLS: %v", err) }
+	cert, err := tc.GetCertificate(&tls.ClientHelloInfo{ServerName: "localhost"})
+	if err != nil { t.Fatalf("issue: %v", err) }
+	if cert.Leaf == nil || cert.Leaf.DNSNames[0] != "localhost" { t.Fatalf("unexpected certificate %+v", cert.Leaf) }
+	if entries, _ := os.ReadDir(cacheDir); len(entries) == 0 { t.Fatalf("certificate not cached in %s", cacheDir) }
+}
@@ -0,0 +1,128 @@
+package tests
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace/noop"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+	"gothicforge3/app/templates"
+	"gothicforge3/internal/config"
+	"gothicforge3/internal/kv"
+	"gothicforge3/internal/server"
+	"gothicforge3/internal/tracing"
+)
+
+// otlpCollector is a stand-in for an OpenTelemetry collector's OTLP/HTTP receiver. It records
+// span names with their span and parent IDs.
+type otlpCollector struct {
+	mu     sync.Mutex
+	path   string
+	spans  map[string]string // name -> parent span ID (hex)
+	ids    map[string]string // name -> span ID (hex)
+	header http.Header
+}
+
+func newOTLPCollector(t *testing.T) (*otlpCollector, *httptest.Server) {
+	t.Helper()
+	c := &otlpCollector{spans: map[string]string{}, ids: map[string]string{}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(r.Body)
+			if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+			body = gz
+		}
+		b, _ := io.ReadAll(body)
+		var req coltracepb.ExportTraceServiceRequest
+		if err := proto.Unmarshal(b, &req); err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+		c.mu.Lock()
+		c.path, c.header = r.URL.Path, r.Header.Clone()
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				for _, s := range ss.Spans {
+					c.spans[s.Name] = hexID(s.ParentSpanId)
+					c.ids[s.Name] = hexID(s.SpanId)
+				}
+			}
+		}
+		c.mu.Unlock()
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		out, _ := proto.Marshal(&coltracepb.ExportTraceServiceResponse{})
+		_, _ = w.Write(out)
+	}))
+	t.Cleanup(srv.Close)
+	return c, srv
+}
+
+func hexID(b []byte) string {
+	const digits = "0123456789abcdef"
+	out := make([]byte, 0, len(b)*2)
+	for _, x := range b { out = append(out, digits[x>>4], digits[x&0x0f]) }
+	return string(out)
+}
+
+func Test_Tracing_OTLP_Export_Spans(t *testing.T) {
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+	col, srv := newOTLPCollector(t)
+	mr := miniredis.RunT(t)
+	cfg, err := config.LoadFrom(lookupMap(map[string]string{
+		"LOG_FORMAT":                  "off",
+		"VALKEY_URL":                  "redis://" + mr.Addr(),
+		"OTEL_EXPORTER_OTLP_ENDPOINT": srv.URL,
+		"OTEL_EXPORTER_OTLP_HEADERS":  "x-collector-key=abc",
+	}))
+	if err != nil { t.Fatalf("config: %v", err) }
+	if got := tracing.Exporter(cfg); got != "otlp" { t.Fatalf("exporter: want otlp (endpoint set), got %q", got) }
+	shutdown, err := tracing.Setup(context.Background(), cfg)
+	if err != nil { t.Fatalf("setup: %v", err) }
+
+	r := server.New(cfg)
+	t.Cleanup(func() { _ = kv.Close() })
+	r.Get("/items/{id}", func(w http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+		_, _, _ = kv.Get(ctx, "item:"+req.PathValue("id"))
+		tr := tracing.PgxTracer()
+		qctx := tr.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: "SELECT id FROM posts WHERE id=$1"})
+		tr.TraceQueryEnd(qctx, nil, pgx.TraceQueryEndData{})
+		_ = templates.LayoutSEO(templates.SEO{Title: "Item"}).Render(ctx, w)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/items/7", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	if err := shutdown(context.Background()); err != nil { t.Fatalf("flush: %v", err) }
+
+	col.mu.Lock()
+	defer col.mu.Unlock()
+	if col.path != "/v1/traces" { t.Fatalf("export path: want /v1/traces, got %q", col.path) }
+	if col.header.Get("X-Collector-Key") != "abc" { t.Fatalf("OTEL_EXPORTER_OTLP_HEADERS not sent: %v", col.header) }
+	root, ok := col.ids["GET /items/{id}"]
+	if !ok { t.Fatalf("server span not renamed to route pattern; got %v", col.spans) }
+	if col.spans["GET /items/{id}"] != "00f067aa0ba902b7" { t.Fatalf("server span should continue the incoming traceparent, parent=%q", col.spans["GET /items/{id}"]) }
+	for _, name := range []string{"valkey GET", "db SELECT", "render LayoutSEO"} {
+		parent, ok := col.spans[name]
+		if !ok { t.Fatalf("missing span %q; got %v", name, col.spans) }
+		if parent != root { t.Fatalf("%q should be a child of the request span", name) }
+	}
+	if _, ok := col.spans["session.commit"]; !ok { t.Fatalf("missing session store span; got %v", col.spans) }
+}
+
+func Test_Tracing_Disabled_By_Default(t *testing.T) {
+	cfg, err := config.LoadFrom(lookupMap(map[string]string{}))
+	if err != nil { t.Fatalf("config: %v", err) }
+	if got := tracing.Exporter(cfg); got != "none" { t.Fatalf("want none, got %q", got) }
+	shutdown, err := tracing.Setup(context.Background(), cfg)
+	if err != nil || shutdown(context.Background()) != nil { t.Fatalf("no-op setup should not fail: %v", err) }
+	if _, err := config.LoadFrom(lookupMap(map[string]string{"OTEL_TRACES_EXPORTER": "zipkin"})); err == nil {
+		t.Fatalf("unknown exporter should be rejected by config")
+	}
+}
@@ -0,0 +1,131 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/a-h/templ"
+	"gothicforge3/app"
+	"gothicforge3/app/templates"
+	"gothicforge3/internal/config"
+	"gothicforge3/internal/server"
+	"gothicforge3/internal/vendored"
+)
+
+// vendorFixture downloads the pinned libraries from a CDN stand-in into a temp app/static and
+// returns its directory plus the stand-in's URL.
+func vendorFixture(t *testing.T) (string, string) {
+	t.Helper()
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "missing") { http.NotFound(w, r); return }
+		w.Write([]byte("/* " + r.URL.Path + " */"))
+	}))
+	t.Cleanup(cdn.Close)
+	libs := make([]vendored.Lib, len(vendored.Defaults))
+	for i, l := range vendored.Defaults {
+		l.URL = cdn.URL + strings.TrimPrefix(l.URL, "https://cdn.jsdelivr.net")
+		libs[i] = l
+	}
+	static := t.TempDir()
+	dir := filepath.Join(static, vendored.Dir)
+	lock, err := vendored.Download(context.Background(), cdn.Client(), libs, dir)
+	if err != nil { t.Fatalf("download: %v", err) }
+	if err := vendored.WriteLock(dir, lock); err != nil { t.Fatalf("lock: %v", err) }
+	t.Cleanup(func() { vendored.Init(app.Static(), "local", false) })
+	return static, cdn.URL
+}
+
+func renderLayout(t *testing.T, cfg *config.Config) (string, string) {
+	t.Helper()
+	h := server.CSPMiddleware(cfg)(templ.Handler(templates.Layout("vendor")))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	return rec.Body.String(), rec.Header().Get("Content-Security-Policy")
+}
+
+func prodConfig(t *testing.T) *config.Config {
+	t.Helper()
+	cfg, err := config.LoadFrom(lookupMap(map[string]string{"APP_ENV": "production", "SITE_BASE_URL": "https://app.example", "JWT_SECRET": "prod-test-secret"}))
+	if err != nil { t.Fatalf("config: %v", err) }
+	return cfg
+}
+
+func Test_Vendor_Download_Writes_Sha384_Lock(t *testing.T) {
+	static, _ := vendorFixture(t)
+	dir := filepath.Join(static, vendored.Dir)
+	lock, err := vendored.ReadLock(os.DirFS(dir))
+	if err != nil { t.Fatalf("read lock: %v", err) }
+	if len(lock.Libs) != len(vendored.Defaults) { t.Fatalf("want %d libs, got %d", len(vendored.Defaults), len(lock.Libs)) }
+	for _, l := range lock.Libs {
+		b, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(l.File)))
+		if err != nil { t.Fatalf("%s: %v", l.Name, err) }
+		if !strings.HasPrefix(l.Integrity, "sha384-") || l.Integrity != vendored.Integrity(b) { t.Fatalf("%s: integrity %q", l.Name, l.Integrity) }
+	}
+	if err := vendored.Verify(os.DirFS(dir), lock); err != nil { t.Fatalf("verify: %v", err) }
+
+	// Tampering with a vendored file is detected and local mode falls back to the CDN.
+	f := filepath.Join(dir, filepath.FromSlash(lock.Libs[0].File))
+	if err := os.WriteFile(f, []byte("tampered"), 0o644); err != nil { t.Fatal(err) }
+	if err := vendored.Verify(os.DirFS(dir), lock); err == nil { t.Fatalf("verify accepted a tampered file") }
+	if err := vendored.Init(os.DirFS(static), "local", true); err == nil || vendored.Local() { t.Fatalf("tampered copy served locally (err=%v)", err) }
+}
+
+func Test_Vendor_Download_Fails_On_HTTP_Error(t *testing.T) {
+	_, cdn := vendorFixture(t)
+	libs := []vendored.Lib{{Name: "gone", URL: cdn + "/missing.js", File: "gone.js"}}
+	if _, err := vendored.Download(context.Background(), nil, libs, t.TempDir()); err == nil { t.Fatalf("want error for 404") }
+}
+
+// Local mode links /static/vendor copies and the production CSP names no other origin.
+func Test_Vendor_Local_Mode_Self_Only_CSP(t *testing.T) {
+	static, _ := vendorFixture(t)
+	if err := vendored.Init(os.DirFS(static), "local", true); err != nil { t.Fatalf("init: %v", err) }
+	if !vendored.Local() { t.Fatalf("want local mode") }
+	body, csp := renderLayout(t, prodConfig(t))
+	for _, l := range vendored.Libs() {
+		if !strings.Contains(body, `"`+templates.Asset(l.AssetName())+`"`) { t.Fatalf("layout missing local %s", l.AssetName()) }
+	}
+	if strings.Contains(body, "jsdelivr") || strings.Contains(body, "unpkg") || strings.Contains(body, "integrity=") { t.Fatalf("local layout links a CDN:\n%s", body) }
+	for _, d := range strings.Split(csp, ";") {
+		d = strings.TrimSpace(d)
+		if strings.HasPrefix(d, "report-") { continue }
+		if strings.Contains(d, "http") { t.Fatalf("production CSP directive allows a remote origin: %q", d) }
+	}
+}
+
+// CDN mode keeps the pinned URLs but adds integrity= and crossorigin from the lock.
+func Test_Vendor_CDN_Mode_Adds_Integrity(t *testing.T) {
+	static, cdn := vendorFixture(t)
+	if err := vendored.Init(os.DirFS(static), "cdn", true); err != nil { t.Fatalf("init: %v", err) }
+	body, csp := renderLayout(t, prodConfig(t))
+	for _, l := range vendored.Libs() {
+		if !strings.Contains(body, `src="`+l.URL+`"`) && !strings.Contains(body, `href="`+l.URL+`"`) { t.Fatalf("layout missing %s", l.URL) }
+		if !strings.Contains(body, `integrity="`+l.Integrity+`" crossorigin="anonymous"`) { t.Fatalf("layout missing integrity for %s", l.Name) }
+	}
+	if !strings.Contains(csp, "script-src 'nonce-") || !strings.Contains(csp, cdn) { t.Fatalf("cdn CSP: %q", csp) }
+}
+
+// Without a lock development falls back to the pinned CDN URLs (never unpinned ones), while
+// production links nothing that has no integrity hash and keeps the CSP 'self' only.
+func Test_Vendor_No_Lock_Falls_Back_To_Pinned_CDN_In_Development_Only(t *testing.T) {
+	t.Cleanup(func() { vendored.Init(app.Static(), "local", false) })
+	if err := vendored.Init(os.DirFS(t.TempDir()), "local", false); err == nil { t.Fatalf("want a fallback warning") }
+	if vendored.Local() || vendored.Locked() { t.Fatalf("no lock: want CDN fallback") }
+	body, _ := renderLayout(t, mustConfig(t))
+	for _, l := range vendored.Defaults {
+		if !strings.Contains(l.URL, "@"+l.Version) { t.Fatalf("%s URL not pinned: %s", l.Name, l.URL) }
+		if !strings.Contains(body, l.URL) { t.Fatalf("layout missing pinned %s", l.URL) }
+	}
+	if strings.Contains(body, "unpkg.com") { t.Fatalf("layout still loads unpkg") }
+
+	for _, mode := range []string{"local", "cdn"} {
+		if err := vendored.Init(os.DirFS(t.TempDir()), mode, true); err == nil { t.Fatalf("%s: want an error in production", mode) }
+		body, csp := renderLayout(t, prodConfig(t))
+		if strings.Contains(body, "jsdelivr") || strings.Contains(csp, "jsdelivr") { t.Fatalf("%s: production links CDN files without integrity:\n%s\n%s", mode, body, csp) }
+	}
+}